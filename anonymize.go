@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var anonymizeKinds = []string{"paths", "emails", "domains"}
+
+var (
+	emailPattern    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	userPathPattern = regexp.MustCompile(`(/home/|/Users/|[A-Za-z]:\\Users\\|[A-Za-z]:/Users/)([^/\\\s"'<>]+)`)
+)
+
+// anonymizer replaces machine- and organisation-specific strings with
+// placeholders. Placeholders derive from a hash of the original value so they
+// are stable across runs.
+type anonymizer struct {
+	replacer *strings.Replacer
+	emails   bool
+	domains  *regexp.Regexp
+
+	kinds       []string // as given, for the manifest settings
+	domainNames []string
+}
+
+func newAnonymizer(kinds []string, absPath string, domains []string) (*anonymizer, error) {
+	for _, kind := range kinds {
+		if !slices.Contains(anonymizeKinds, kind) {
+			return nil, fmt.Errorf("unknown anonymize kind %q (valid: %s)", kind, strings.Join(anonymizeKinds, ", "))
+		}
+	}
+
+	a := &anonymizer{emails: slices.Contains(kinds, "emails"), kinds: kinds}
+
+	if slices.Contains(kinds, "paths") {
+		pairs := []string{absPath, "<root>"}
+		if home, err := os.UserHomeDir(); err == nil && home != "" && home != "/" {
+			pairs = append(pairs, home, "<home>")
+		}
+		if host, err := os.Hostname(); err == nil && host != "" && host != "localhost" {
+			pairs = append(pairs, host, "<host>")
+		}
+		a.replacer = strings.NewReplacer(pairs...)
+	}
+
+	if slices.Contains(kinds, "domains") {
+		if len(domains) == 0 {
+			return nil, fmt.Errorf("anonymizing domains requires -anonymize-domains")
+		}
+		quoted := make([]string, len(domains))
+		for i, domain := range domains {
+			quoted[i] = regexp.QuoteMeta(strings.TrimPrefix(domain, "."))
+		}
+		a.domainNames = domains
+		a.domains = regexp.MustCompile(`(?i)\b(?:[a-z0-9\-]+\.)*(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	return a, nil
+}
+
+// settings returns the kinds for the manifest settings, sorted, and a
+// digest of the domains, which would otherwise appear in the very output
+// they are hidden from.
+func (a *anonymizer) settings() ([]string, string) {
+	if a == nil {
+		return nil, ""
+	}
+	kinds := slices.Clone(a.kinds)
+	slices.Sort(kinds)
+	kinds = slices.Compact(kinds)
+	if len(a.domainNames) == 0 {
+		return kinds, ""
+	}
+	domains := make([]string, len(a.domainNames))
+	for i, domain := range a.domainNames {
+		domains[i] = strings.ToLower(strings.TrimPrefix(domain, "."))
+	}
+	slices.Sort(domains)
+	sum := sha256.Sum256([]byte(strings.Join(slices.Compact(domains), "\n")))
+	return kinds, "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (a *anonymizer) apply(s string) string {
+	if a.replacer != nil {
+		s = a.replacer.Replace(s)
+		s = userPathPattern.ReplaceAllStringFunc(s, func(match string) string {
+			parts := userPathPattern.FindStringSubmatch(match)
+			if strings.HasPrefix(parts[2], "<") {
+				return match
+			}
+			return parts[1] + placeholder("user", parts[2])
+		})
+	}
+	if a.emails {
+		s = emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+			return placeholder("email", strings.ToLower(email))
+		})
+	}
+	if a.domains != nil {
+		s = a.domains.ReplaceAllStringFunc(s, func(domain string) string {
+			return placeholder("domain", strings.ToLower(domain))
+		})
+	}
+	return s
+}
+
+func placeholder(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("<%s-%s>", kind, hex.EncodeToString(sum[:4]))
+}
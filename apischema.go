@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// condenseSchema reduces a .proto file or an OpenAPI/Swagger document to
+// its interface for -condense-schemas: messages, enums and RPCs with their
+// field types, and endpoints with their parameters, bodies, responses and
+// summaries. Other YAML and JSON files are left as they are.
+func condenseSchema(src sourceFile, data []byte) ([]byte, bool, error) {
+	if strings.ToLower(filepath.Ext(src.path)) == ".proto" {
+		return condenseProto(data), true, nil
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil || (doc["openapi"] == nil && doc["swagger"] == nil) {
+		return data, true, nil
+	}
+	return condenseOpenAPI(stringKeys(doc).(map[string]any)), true, nil
+}
+
+// stringKeys converts the maps YAML decodes with non-string keys, like the
+// status codes of responses, to maps keyed by strings.
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = stringKeys(value)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// protoTokens splits a .proto file into identifiers, numbers, strings and
+// punctuation, without comments.
+func protoTokens(data []byte) []string {
+	var tokens []string
+	s := string(data)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(s))
+			tokens = append(tokens, s[i:j])
+			i = j
+		case c == '_' || c == '.' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))) || c == '-' || c == '+':
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || s[j] < 0x80 && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			tokens = append(tokens, s[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+// protoCondenser writes the declarations of a token stream, dropping
+// options, field numbers, reserved ranges and comments.
+type protoCondenser struct {
+	tokens []string
+	pos    int
+	out    bytes.Buffer
+}
+
+func condenseProto(data []byte) []byte {
+	p := &protoCondenser{tokens: protoTokens(data)}
+	p.block(0, false)
+	return p.out.Bytes()
+}
+
+func (p *protoCondenser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+// statement returns the tokens up to a ';' or the '{' opening a body,
+// which it reports.
+func (p *protoCondenser) statement() ([]string, bool) {
+	var tokens []string
+	for p.pos < len(p.tokens) {
+		t := p.next()
+		switch t {
+		case ";":
+			return tokens, false
+		case "{":
+			return tokens, true
+		case "}":
+			p.pos--
+			return tokens, false
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, false
+}
+
+// skipBody skips to the '}' closing a body already opened.
+func (p *protoCondenser) skipBody() {
+	for depth := 1; depth > 0 && p.pos < len(p.tokens); {
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+}
+
+// block condenses statements until the '}' closing the current body, or
+// the end of the file at the top level. In enums only value names are kept.
+func (p *protoCondenser) block(depth int, enum bool) {
+	indent := strings.Repeat("  ", depth)
+	var values []string
+	for p.pos < len(p.tokens) {
+		if p.tokens[p.pos] == "}" {
+			p.pos++
+			break
+		}
+		tokens, body := p.statement()
+		if len(tokens) == 0 {
+			if body {
+				p.skipBody()
+			}
+			continue
+		}
+		switch keyword := tokens[0]; {
+		case keyword == "option" || keyword == "reserved" || keyword == "extensions":
+			if body {
+				p.skipBody()
+			}
+		case body && (keyword == "message" || keyword == "service" || keyword == "oneof" || keyword == "extend"):
+			fmt.Fprintf(&p.out, "%s%s {\n", indent, joinProtoTokens(tokens))
+			p.block(depth+1, false)
+			fmt.Fprintf(&p.out, "%s}\n", indent)
+		case body && keyword == "enum":
+			fmt.Fprintf(&p.out, "%s%s { ", indent, joinProtoTokens(tokens))
+			p.block(depth+1, true)
+		case enum:
+			values = append(values, tokens[0])
+		case keyword == "rpc":
+			if body {
+				p.skipBody()
+			}
+			fmt.Fprintf(&p.out, "%s%s;\n", indent, joinProtoTokens(tokens))
+		default:
+			if body {
+				p.skipBody()
+			}
+			fmt.Fprintf(&p.out, "%s%s;\n", indent, joinProtoTokens(withoutFieldNumber(tokens)))
+		}
+	}
+	if enum {
+		fmt.Fprintf(&p.out, "%s }\n", strings.Join(values, ", "))
+	}
+}
+
+// withoutFieldNumber cuts a field's "= N [options]" off; other statements,
+// like syntax = "proto3", keep their value.
+func withoutFieldNumber(tokens []string) []string {
+	for i, t := range tokens {
+		if t == "=" && i+1 < len(tokens) && tokens[i+1] != "" && unicode.IsDigit(rune(tokens[i+1][0])) && tokens[0] != "syntax" && tokens[0] != "edition" {
+			return tokens[:i]
+		}
+	}
+	return tokens
+}
+
+func joinProtoTokens(tokens []string) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && protoSpaceBetween(tokens[i-1], t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+func protoSpaceBetween(prev, next string) bool {
+	isWord := func(t string) bool {
+		c := t[0]
+		return c == '_' || c == '.' || c == '"' || c == '\'' || c == '-' || c == '+' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+	}
+	switch {
+	case next == "=" || prev == "=":
+		return true
+	case prev == "," || prev == ")" || prev == ">":
+		return true
+	case prev == "returns" && next == "(":
+		return true
+	default:
+		return isWord(prev) && isWord(next)
+	}
+}
+
+// condenseOpenAPI writes the endpoints of an OpenAPI 3 or Swagger 2
+// document, one per line with an indented line for its parameters, body
+// and responses, followed by its schemas on one line each. Paths and
+// schemas are sorted.
+func condenseOpenAPI(doc map[string]any) []byte {
+	var out bytes.Buffer
+	info, _ := doc["info"].(map[string]any)
+	version := doc["openapi"]
+	kind := "openapi"
+	if version == nil {
+		version, kind = doc["swagger"], "swagger"
+	}
+	fmt.Fprintf(&out, "%s %v", kind, version)
+	if title := strings.TrimSpace(fmt.Sprint(valueOr(info["title"], ""), " ", valueOr(info["version"], ""))); title != "" {
+		fmt.Fprintf(&out, ": %s", title)
+	}
+	out.WriteString("\n")
+	if servers, ok := doc["servers"].([]any); ok {
+		var urls []string
+		for _, server := range servers {
+			if s, ok := server.(map[string]any); ok {
+				urls = append(urls, fmt.Sprint(s["url"]))
+			}
+		}
+		if len(urls) > 0 {
+			fmt.Fprintf(&out, "servers: %s\n", strings.Join(urls, ", "))
+		}
+	} else if host, ok := doc["host"].(string); ok {
+		fmt.Fprintf(&out, "host: %s%v\n", host, valueOr(doc["basePath"], ""))
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	if len(paths) > 0 {
+		out.WriteString("\n")
+	}
+	for _, route := range sortedKeys(paths) {
+		item, _ := paths[route].(map[string]any)
+		shared, _ := item["parameters"].([]any)
+		for _, method := range []string{"get", "put", "post", "patch", "delete", "head", "options", "trace"} {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			line := strings.ToUpper(method) + " " + route
+			if id, ok := op["operationId"].(string); ok {
+				line += " " + id
+			}
+			if summary := operationSummary(op); summary != "" {
+				line += ": " + summary
+			}
+			if deprecated, _ := op["deprecated"].(bool); deprecated {
+				line += " (deprecated)"
+			}
+			out.WriteString(line + "\n")
+
+			params, _ := op["parameters"].([]any)
+			var parts []string
+			var body string
+			for _, param := range append(append([]any(nil), shared...), params...) {
+				p, _ := param.(map[string]any)
+				if ref, ok := p["$ref"].(string); ok {
+					parts = append(parts, refName(ref))
+					continue
+				}
+				if p["in"] == "body" {
+					body = schemaType(p["schema"], 0)
+					continue
+				}
+				name := fmt.Sprint(p["name"])
+				if required, _ := p["required"].(bool); !required {
+					name += "?"
+				}
+				typ := schemaType(p["schema"], 0)
+				if p["schema"] == nil {
+					typ = schemaType(p, 0)
+				}
+				parts = append(parts, fmt.Sprintf("%s: %v %s", name, p["in"], typ))
+			}
+			if len(parts) > 0 {
+				fmt.Fprintf(&out, "  params: %s\n", strings.Join(parts, ", "))
+			}
+			if requestBody, ok := op["requestBody"].(map[string]any); ok {
+				body = contentType(requestBody)
+			}
+			if body != "" {
+				fmt.Fprintf(&out, "  body: %s\n", body)
+			}
+			responses, _ := op["responses"].(map[string]any)
+			var codes []string
+			for _, code := range sortedKeys(responses) {
+				r, _ := responses[code].(map[string]any)
+				typ := contentType(r)
+				if typ == "" && r["schema"] != nil {
+					typ = schemaType(r["schema"], 0)
+				}
+				if ref, ok := r["$ref"].(string); ok {
+					typ = refName(ref)
+				}
+				if typ == "" {
+					codes = append(codes, code)
+				} else {
+					codes = append(codes, code+" "+typ)
+				}
+			}
+			if len(codes) > 0 {
+				fmt.Fprintf(&out, "  responses: %s\n", strings.Join(codes, ", "))
+			}
+		}
+	}
+
+	schemas, _ := doc["definitions"].(map[string]any)
+	if components, ok := doc["components"].(map[string]any); ok {
+		schemas, _ = components["schemas"].(map[string]any)
+	}
+	if len(schemas) > 0 {
+		out.WriteString("\nschemas:\n")
+	}
+	for _, name := range sortedKeys(schemas) {
+		fmt.Fprintf(&out, "  %s %s\n", name, schemaType(schemas[name], 0))
+	}
+	return out.Bytes()
+}
+
+func operationSummary(op map[string]any) string {
+	if summary, ok := op["summary"].(string); ok && summary != "" {
+		return strings.TrimSpace(summary)
+	}
+	description, _ := op["description"].(string)
+	first, _, _ := strings.Cut(strings.TrimSpace(description), "\n")
+	return first
+}
+
+// contentType returns the schema of a request body or response, from the
+// first of its media types.
+func contentType(v map[string]any) string {
+	if ref, ok := v["$ref"].(string); ok {
+		return refName(ref)
+	}
+	content, _ := v["content"].(map[string]any)
+	for _, mediaType := range sortedKeys(content) {
+		if media, ok := content[mediaType].(map[string]any); ok && media["schema"] != nil {
+			return schemaType(media["schema"], 0)
+		}
+	}
+	return ""
+}
+
+// schemaType renders a schema in a short TypeScript-like notation, e.g.
+// {id: string, tags?: []string, status?: "paid"|"failed"}. Objects nested
+// deeper than two levels are shown as object.
+func schemaType(v any, depth int) string {
+	s, ok := v.(map[string]any)
+	if !ok {
+		return "any"
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		return refName(ref)
+	}
+	for _, combinator := range []struct{ key, sep string }{{"allOf", " & "}, {"oneOf", " | "}, {"anyOf", " | "}} {
+		if list, ok := s[combinator.key].([]any); ok {
+			parts := make([]string, len(list))
+			for i, item := range list {
+				parts[i] = schemaType(item, depth)
+			}
+			return strings.Join(parts, combinator.sep)
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		parts := make([]string, len(enum))
+		for i, value := range enum {
+			parts[i] = fmt.Sprintf("%q", fmt.Sprint(value))
+		}
+		return strings.Join(parts, "|")
+	}
+	typ := fmt.Sprint(valueOr(s["type"], ""))
+	switch {
+	case typ == "array":
+		return "[]" + schemaType(s["items"], depth)
+	case typ == "object" || s["properties"] != nil:
+		props, _ := s["properties"].(map[string]any)
+		if len(props) == 0 {
+			if additional, ok := s["additionalProperties"].(map[string]any); ok {
+				return "map[string]" + schemaType(additional, depth)
+			}
+			return "object"
+		}
+		if depth >= 2 {
+			return "object"
+		}
+		required := make(map[string]bool)
+		if list, ok := s["required"].([]any); ok {
+			for _, name := range list {
+				required[fmt.Sprint(name)] = true
+			}
+		}
+		parts := make([]string, 0, len(props))
+		for _, name := range sortedKeys(props) {
+			field := name
+			if !required[name] {
+				field += "?"
+			}
+			parts = append(parts, field+": "+schemaType(props[name], depth+1))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case typ == "":
+		return "any"
+	}
+	if format, ok := s["format"].(string); ok {
+		return typ + "(" + format + ")"
+	}
+	return typ
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func valueOr(v, fallback any) any {
+	if v == nil {
+		return fallback
+	}
+	return v
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
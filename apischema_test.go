@@ -0,0 +1,153 @@
+package main
+
+import "testing"
+
+func TestCondenseSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		data string
+		want string
+	}{
+		{
+			name: "proto",
+			path: "shop.proto",
+			data: `syntax = "proto3";
+package shop.v1;
+// An order
+message Order {
+  string id = 1; // the id
+  repeated Item items = 2 [deprecated = true];
+  map<string, int32> counts = 3;
+  reserved 4, 5;
+  enum Status { STATUS_UNSPECIFIED = 0; PAID = 1 [(x) = "y"]; }
+  oneof payment { string card = 6; string iban = 7; }
+}
+service Orders {
+  option (svc) = true;
+  rpc Get(GetRequest) returns (Order) { option (google.api.http) = { get: "/v1/orders/{id}" }; }
+  rpc Watch(stream GetRequest) returns (stream Order);
+}
+`,
+			want: `syntax = "proto3";
+package shop.v1;
+message Order {
+  string id;
+  repeated Item items;
+  map<string, int32> counts;
+  enum Status { STATUS_UNSPECIFIED, PAID }
+  oneof payment {
+    string card;
+    string iban;
+  }
+}
+service Orders {
+  rpc Get(GetRequest) returns (Order);
+  rpc Watch(stream GetRequest) returns (stream Order);
+}
+`,
+		},
+		{
+			name: "openapi 3",
+			path: "api.yaml",
+			data: `openapi: 3.0.0
+info: {title: Shop, version: "1"}
+paths:
+  /orders/{id}:
+    get:
+      summary: Get an order
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: string}}
+        - {name: expand, in: query, schema: {type: boolean}}
+      responses:
+        "200": {description: ok, content: {application/json: {schema: {$ref: "#/components/schemas/Order"}}}}
+        "404": {description: missing}
+  /orders:
+    post:
+      requestBody: {content: {application/json: {schema: {$ref: "#/components/schemas/Order"}}}}
+      responses:
+        "201": {description: made}
+components:
+  schemas:
+    Order:
+      type: object
+      required: [id]
+      properties:
+        id: {type: string}
+        tags: {type: array, items: {type: string}}
+        status: {type: string, enum: [paid, failed]}
+`,
+			want: `openapi 3.0.0: Shop 1
+
+POST /orders
+  body: Order
+  responses: 201
+GET /orders/{id}: Get an order
+  params: id: path string, expand?: query boolean
+  responses: 200 Order, 404
+
+schemas:
+  Order {id: string, status?: "paid"|"failed", tags?: []string}
+`,
+		},
+		{
+			name: "swagger 2 without info",
+			path: "swagger.json",
+			data: `{"swagger": "2.0", "paths": {"/a": {"get": {"parameters": [{"name": "q", "in": "query", "type": "string"}],
+				"responses": {"200": {"description": "ok", "schema": {"type": "array", "items": {"$ref": "#/definitions/A"}}}}}}},
+				"definitions": {"A": {"type": "object", "properties": {"n": {"type": "integer"}}}}}`,
+			want: `swagger 2.0
+
+GET /a
+  params: q?: query string
+  responses: 200 []A
+
+schemas:
+  A {n?: integer}
+`,
+		},
+		{
+			name: "other json",
+			path: "package.json",
+			data: `{"name": "x"}`,
+			want: `{"name": "x"}`,
+		},
+		{
+			name: "invalid yaml",
+			path: "broken.yaml",
+			data: "a: [",
+			want: "a: [",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := condenseSchema(sourceFile{path: tt.path, relPath: tt.path}, []byte(tt.data))
+			if err != nil || !ok {
+				t.Fatalf("condenseSchema: ok %t, error %v", ok, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("condenseSchema =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaType(t *testing.T) {
+	tests := []struct {
+		schema map[string]any
+		want   string
+	}{
+		{map[string]any{"type": "string"}, "string"},
+		{map[string]any{"$ref": "#/components/schemas/User"}, "User"},
+		{map[string]any{"type": "array", "items": map[string]any{"type": "integer"}}, "[]integer"},
+		{map[string]any{"type": "string", "enum": []any{"a", "b"}}, `"a"|"b"`},
+		{map[string]any{"type": "object", "required": []any{"id"}, "properties": map[string]any{
+			"id": map[string]any{"type": "string"}, "n": map[string]any{"type": "number"},
+		}}, "{id: string, n?: number}"},
+	}
+	for _, tt := range tests {
+		if got := schemaType(tt.schema, 0); got != tt.want {
+			t.Errorf("schemaType(%v) = %s, want %s", tt.schema, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// archiveManifestPath and archiveMetadataPath are where the manifest and
+// the context metadata go inside an archive, clear of any file from the
+// input.
+const (
+	archiveManifestPath = ".contextify/manifest.json"
+	archiveMetadataPath = ".contextify/metadata.json"
+)
+
+// archiveFormatter writes the packed files as real files: a zip, or a tar
+// when the output name ends in .tar, .tar.gz or .tgz. The content is what
+// the text format would contain, after filters and transforms such as
+// -normalize and -redact. Like html it needs the whole context first, so it
+// buffers until close.
+type archiveFormatter struct {
+	w        io.Writer
+	buf      bytes.Buffer
+	kind     string // zip, tar or tgz
+	manifest *manifest
+	config   *Config
+	modified time.Time
+}
+
+func newArchiveFormatter(w io.Writer, config *Config) *archiveFormatter {
+	kind := "zip"
+	name := strings.ToLower(config.outputPath)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		kind = "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		kind = "tgz"
+	}
+	modified := time.Now()
+	if config.reproducible {
+		modified = reproducibleTime()
+	}
+	return &archiveFormatter{w: w, kind: kind, manifest: config.manifest, config: config, modified: modified}
+}
+
+func (a *archiveFormatter) Write(p []byte) (int, error) {
+	return a.buf.Write(p)
+}
+
+func (a *archiveFormatter) close() error {
+	files, _, _, err := parseContextBlocks(a.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to split output into files: %w", err)
+	}
+	if a.manifest != nil {
+		data, err := json.MarshalIndent(a.manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		files = append(files, packedFile{path: archiveManifestPath, content: append(data, '\n')})
+		// Archives cannot be resumed, so the metadata is always complete
+		data, err = json.MarshalIndent(newContextMetadata(a.config, true), "", "  ")
+		if err != nil {
+			return err
+		}
+		files = append(files, packedFile{path: archiveMetadataPath, content: append(data, '\n')})
+	}
+
+	switch a.kind {
+	case "zip":
+		return writeZip(a.w, files, a.modified)
+	case "tgz":
+		gz := gzip.NewWriter(a.w)
+		if err := writeTar(gz, files, a.modified); err != nil {
+			return err
+		}
+		return gz.Close()
+	default:
+		return writeTar(a.w, files, a.modified)
+	}
+}
+
+func writeZip(w io.Writer, files []packedFile, modified time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: archivePath(file.path), Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(file.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTar(w io.Writer, files []packedFile, modified time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:     archivePath(file.path),
+			Mode:     0o644,
+			Size:     int64(len(file.content)),
+			ModTime:  modified,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// archivePath makes an entry name relative and slash-separated.
+func archivePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, `\`, "/")), "/")
+}
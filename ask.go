@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func setupAsk(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+	prompt := fs.String("prompt", "", "Question to ask about the packed files (required)")
+	endpoint := fs.String("endpoint", "https://api.openai.com/v1", "Base URL of an OpenAI-compatible API")
+	keyEnv := fs.String("api-key-env", "OPENAI_API_KEY", "Environment variable holding the API key")
+
+	return func(args []string) int {
+		if !noArgs("ask", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		if *prompt == "" {
+			logger.Error("-prompt is required")
+			return exitFailure
+		}
+		if *pf.model == "" {
+			logger.Error("-model is required")
+			return exitFailure
+		}
+
+		config, err := pf.config(logger)
+		if err != nil {
+			logger.Error("Invalid flags", "error", err)
+			return exitFailure
+		}
+
+		// The request is assembled here, so pack plain text and keep the
+		// prepended text for the system prompt
+		system := config.prepend
+		config.format, config.prepend = "text", ""
+		var packed bytes.Buffer
+		config.outputWriter = &packed
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		code, err := pack(ctx, config, *pf.progress, *pf.resultJSON)
+		if code == exitFailure || code == exitCancelled {
+			logOutcome(logger, config, code, err)
+			return code
+		}
+		logger.Debug("Packed context", "files", config.result.FilesIncluded, "bytes", packed.Len())
+
+		messages := []chatMessage{}
+		if system != "" {
+			messages = append(messages, chatMessage{Role: "system", Content: system})
+		}
+		messages = append(messages, chatMessage{Role: "user", Content: packed.String() + "\n" + *prompt})
+
+		err = streamChat(ctx, *endpoint, os.Getenv(*keyEnv), chatRequest{Model: *pf.model, Messages: messages, Stream: true}, os.Stdout)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				logger.Warn("Cancelled")
+				return exitCancelled
+			}
+			logger.Error("Failed to get an answer", "error", err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+// streamChat posts a chat completion request and copies the streamed answer
+// to w as it arrives.
+func streamChat(ctx context.Context, endpoint, apiKey string, request chatRequest, w io.Writer) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("API returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if _, err := io.WriteString(w, choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
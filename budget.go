@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// budgetArea is a directory that receives a share of the budget.
+type budgetArea struct {
+	dir    string
+	weight float64 // percent of the budget
+}
+
+// Measures a budget can limit. A file's size in each is counted on its
+// rendered block.
+const (
+	measureTokens = iota
+	measureChars
+	measureLines
+	measureCount
+)
+
+var measureNames = [measureCount]string{"tokens", "chars", "lines"}
+
+// blockSize is the size of a rendered file block in every measure.
+type blockSize [measureCount]int
+
+// budgetUsage reports how a budget was spent. Only the measures that were
+// limited are set.
+type budgetUsage struct {
+	MaxTokens    int         `json:"maxTokens,omitempty"`
+	UsedTokens   int         `json:"usedTokens,omitempty"`
+	MaxChars     int         `json:"maxChars,omitempty"`
+	UsedChars    int         `json:"usedChars,omitempty"`
+	MaxLines     int         `json:"maxLines,omitempty"`
+	UsedLines    int         `json:"usedLines,omitempty"`
+	FilesDropped []string    `json:"filesDropped"`
+	Areas        []areaUsage `json:"areas,omitempty"`
+}
+
+type areaUsage struct {
+	Area      string `json:"area"`
+	Measure   string `json:"measure"`
+	Allocated int    `json:"allocated"`
+	Used      int    `json:"used"`
+}
+
+// budgetLimits returns the -max-tokens, -max-chars and -max-lines limits;
+// 0 leaves a measure unlimited.
+func budgetLimits(config *Config) blockSize {
+	return blockSize{config.maxTokens, config.maxChars, config.maxLines}
+}
+
+// limited reports whether any measure has a limit.
+func (s blockSize) limited() bool {
+	return s != blockSize{}
+}
+
+// parseBudget parses weights such as "src/api=40%,src/web=40%,docs=20%".
+func parseBudget(spec string) ([]budgetArea, error) {
+	var areas []budgetArea
+	total := 0.0
+	for _, item := range parseCommaSeparated(spec) {
+		dir, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid budget entry %q (expected dir=N%%)", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid budget weight %q", value)
+		}
+		total += weight
+		areas = append(areas, budgetArea{dir: strings.Trim(filepath.ToSlash(strings.TrimSpace(dir)), "/"), weight: weight})
+	}
+	if total > 100.0001 {
+		return nil, fmt.Errorf("budget weights add up to %.0f%%, more than 100%%", total)
+	}
+	return areas, nil
+}
+
+// measureFiles renders every file without writing it and returns the
+// size of each file block.
+func measureFiles(ctx context.Context, files []sourceFile, config *Config) ([]blockSize, error) {
+	// Side effects such as TODO collection belong to the real pass
+	measure := *config
+	measure.todos = nil
+	measure.symbolIndex = nil
+	measure.apiSurface = nil
+	measure.issueRefs = nil
+	measure.manifest = nil
+	measure.timings = nil
+
+	sizes := make([]blockSize, len(files))
+	for i, file := range files {
+		counter := &tokenCounter{bpe: config.tokenizer}
+		writer := bufio.NewWriter(counter)
+		_, err := processFile(ctx, file, writer, &measure)
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		var skipped *skipError
+		if err != nil && !errors.As(err, &skipped) {
+			return nil, err
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+		sizes[i] = blockSize{counter.tokens(), counter.runes, counter.lines()}
+	}
+	return sizes, nil
+}
+
+// applyBudget selects the files that fit in every limited measure. With
+// areas, each budget is split by weight; files outside every area share what
+// the weights leave unassigned, and allocation an area does not need is
+// redistributed to the others in proportion to their weights. Within an area
+// files are taken in output order, skipping any that no longer fit.
+func applyBudget(files []sourceFile, sizes []blockSize, limits blockSize, areas []budgetArea) ([]sourceFile, *budgetUsage) {
+	names := []string{"(all)"}
+	weights := []float64{100}
+	if len(areas) > 0 {
+		names, weights = nil, nil
+		assigned := 0.0
+		for _, area := range areas {
+			names = append(names, area.dir)
+			weights = append(weights, area.weight)
+			assigned += area.weight
+		}
+		names = append(names, "(other)")
+		weights = append(weights, 100-assigned)
+	}
+
+	// Assign each file to the area with the longest matching directory
+	areaOf := make([]int, len(files))
+	demand := make([]blockSize, len(names))
+	for i, file := range files {
+		areaOf[i] = len(names) - 1
+		best := -1
+		rel := filepath.ToSlash(file.relPath)
+		for a, area := range areas {
+			if (area.dir == "" || rel == area.dir || strings.HasPrefix(rel, area.dir+"/")) && len(area.dir) > best {
+				areaOf[i], best = a, len(area.dir)
+			}
+		}
+		for m := range sizes[i] {
+			demand[areaOf[i]][m] += sizes[i][m]
+		}
+	}
+
+	allocation := make([]blockSize, len(names))
+	for m, limit := range limits {
+		if limit <= 0 {
+			continue
+		}
+		measureDemand := make([]int, len(names))
+		for a := range demand {
+			measureDemand[a] = demand[a][m]
+		}
+		for a, allocated := range allocateBudget(limit, measureDemand, weights) {
+			allocation[a][m] = allocated
+		}
+	}
+
+	usage := &budgetUsage{MaxTokens: limits[measureTokens], MaxChars: limits[measureChars], MaxLines: limits[measureLines], FilesDropped: []string{}}
+	used := make([]blockSize, len(names))
+	var total blockSize
+	var selected []sourceFile
+	for i, file := range files {
+		a := areaOf[i]
+		fits := true
+		for m, limit := range limits {
+			if limit > 0 && used[a][m]+sizes[i][m] > allocation[a][m] {
+				fits = false
+			}
+		}
+		if !fits {
+			usage.FilesDropped = append(usage.FilesDropped, file.relPath)
+			continue
+		}
+		for m := range sizes[i] {
+			used[a][m] += sizes[i][m]
+			total[m] += sizes[i][m]
+		}
+		selected = append(selected, file)
+	}
+	if limits[measureTokens] > 0 {
+		usage.UsedTokens = total[measureTokens]
+	}
+	if limits[measureChars] > 0 {
+		usage.UsedChars = total[measureChars]
+	}
+	if limits[measureLines] > 0 {
+		usage.UsedLines = total[measureLines]
+	}
+	if len(areas) > 0 {
+		for m, limit := range limits {
+			if limit <= 0 {
+				continue
+			}
+			for a, name := range names {
+				usage.Areas = append(usage.Areas, areaUsage{Area: name, Measure: measureNames[m], Allocated: allocation[a][m], Used: used[a][m]})
+			}
+		}
+	}
+	return selected, usage
+}
+
+// allocateBudget splits total across areas by weight, capping each area at
+// its demand and handing the surplus to the areas that still need more.
+func allocateBudget(total int, demand []int, weights []float64) []int {
+	allocation := make([]int, len(demand))
+	active := make([]int, 0, len(demand))
+	for a := range demand {
+		if demand[a] > 0 {
+			active = append(active, a)
+		}
+	}
+
+	remaining := total
+	for len(active) > 0 && remaining > 0 {
+		weightSum := 0.0
+		for _, a := range active {
+			weightSum += weights[a]
+		}
+		if weightSum == 0 {
+			// Only unweighted areas are left; serve them in order
+			sort.Ints(active)
+			for _, a := range active {
+				give := min(demand[a], remaining)
+				allocation[a] += give
+				remaining -= give
+			}
+			break
+		}
+
+		satisfied := false
+		next := active[:0]
+		for _, a := range active {
+			share := int(float64(remaining) * weights[a] / weightSum)
+			if demand[a]-allocation[a] <= share {
+				satisfied = true
+				remaining -= demand[a] - allocation[a]
+				allocation[a] = demand[a]
+				continue
+			}
+			next = append(next, a)
+		}
+		active = next
+		if satisfied {
+			continue
+		}
+
+		// Nobody can be fully served: split what is left by weight
+		for _, a := range active {
+			allocation[a] += int(float64(remaining) * weights[a] / weightSum)
+		}
+		break
+	}
+	return allocation
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const buildErrorsMarker = "## Build Errors"
+
+// errorLocationPatterns find the file and line of compiler diagnostics.
+// The first capture group is the path and the second the line.
+var errorLocationPatterns = []*regexp.Regexp{
+	// Rust: "  --> src/main.rs:12:5"
+	regexp.MustCompile(`^\s*-->\s+(\S+?):(\d+):\d+`),
+	// TypeScript (tsc): "src/app.ts(12,5): error TS2322: ..."
+	regexp.MustCompile(`^\s*(\S+?)\((\d+),\d+\): (?:error|warning)`),
+	// Go, go vet, tsc --pretty and most others: "pkg/file.go:12:5: ...",
+	// "vet: ./file.go:3:2: ..." or "src/app.ts:12:5 - error TS2322: ..."
+	regexp.MustCompile(`^\s*(?:vet:\s+)?((?:[A-Za-z]:)?[^\s:()]+\.\w+):(\d+)(?::\d+)?(?::|\s+-\s)`),
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// buildErrorFiles returns the files the -from-errors log points at, in the
+// order the log first mentions them, and records the error lines of each
+// for -error-context. Paths are resolved against the input directory and
+// then the working directory; ones outside the input, such as standard
+// library sources, are left out.
+func buildErrorFiles(ctx context.Context, absPath string, config *Config) ([]sourceFile, error) {
+	data, err := readPastedLog(config.fromErrors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build log: %w", err)
+	}
+	config.buildLog = string(bytes.TrimRight(data, "\n"))
+	config.errorLines = make(map[string][]int)
+
+	var files []sourceFile
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, re := range errorLocationPatterns {
+			m := re.FindSubmatch(bytes.TrimRight(line, "\r"))
+			if m == nil {
+				continue
+			}
+			path, relPath, ok := resolveErrorPath(absPath, string(m[1]))
+			if !ok {
+				config.logger.Debug("Skipping build error outside the input", "path", string(m[1]))
+				break
+			}
+			n, _ := strconv.Atoi(string(m[2]))
+			if _, seen := config.errorLines[relPath]; !seen {
+				config.result.FilesScanned++
+				files = append(files, sourceFile{path: path, relPath: relPath})
+			}
+			config.errorLines[relPath] = append(config.errorLines[relPath], n)
+			break
+		}
+	}
+	return files, nil
+}
+
+// readPastedLog reads a log or trace from a file, or stdin for "-", without
+// its color codes.
+func readPastedLog(name string) ([]byte, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	return ansiEscape.ReplaceAll(data, nil), err
+}
+
+func resolveErrorPath(absPath, logPath string) (string, string, bool) {
+	candidates := []string{logPath}
+	if !filepath.IsAbs(logPath) {
+		candidates = []string{filepath.Join(absPath, logPath)}
+		if cwdPath, err := filepath.Abs(logPath); err == nil {
+			candidates = append(candidates, cwdPath)
+		}
+	}
+	for _, path := range candidates {
+		relPath, err := filepath.Rel(absPath, path)
+		if err != nil || !filepath.IsLocal(relPath) {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nfc(filepath.ToSlash(relPath)), true
+		}
+	}
+	return "", "", false
+}
+
+// errorRegions keeps the lines around a file's errors.
+func errorRegions(data []byte, lines []int, context int) []byte {
+	ranges := make([]lineRange, len(lines))
+	for i, n := range lines {
+		ranges[i] = lineRange{n, n}
+	}
+	return keepLines(data, ranges, context)
+}
+
+func writeBuildErrors(w io.Writer, log string) error {
+	_, err := fmt.Fprintf(w, "%s\n```\n%s\n```\n\n", buildErrorsMarker, log)
+	return err
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// command is a contextify subcommand. setup registers the command's flags
+// and returns the function that runs it with the remaining arguments, so the
+// flag set can also be inspected without running, e.g. for completion.
+type command struct {
+	name    string
+	args    string
+	summary string
+	setup   func(fs *flag.FlagSet) func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"pack", "[flags] [file[:lines]...]", "Pack a directory, or the given files or line ranges of them, into a single context file (default)", setupPack},
+		{"stats", "[flags]", "Report what pack would include, without writing the output", setupStats},
+		{"report", "[flags]", "Rank the files and directories that take the most tokens, with exclude suggestions", setupReport},
+		{"unpack", "[flags] [file]", "Recreate the files of a context file in a directory", setupUnpack},
+		{"diff", "[flags] <old> <new>", "Report changed files between two contexts or directories, with a delta context", setupDiff},
+		{"merge", "[flags] <context> <context>...", "Combine contexts into one, dropping duplicate file sections, with a fresh header", setupMerge},
+		{"pr", "[flags] <pull request URL>", "Pack a GitHub pull request: description, comments, diff and changed files", setupPR},
+		{"serve", "[flags]", "Serve pack and stats over HTTP", setupServe},
+		{"watch", "[flags]", "Repack whenever files in the input directory change", setupWatch},
+		{"daemon", "[flags]", "Regenerate the contexts of a config file on a schedule, with a status endpoint", setupDaemon},
+		{"ask", "-model <model> -prompt <question> [flags]", "Pack and ask an OpenAI-compatible model about the files", setupAsk},
+		{"explain", "[flags] <path>...", "Report why paths would be included in or left out of a pack with the given flags", setupExplain},
+		{"doctor", "[flags]", "Check the environment and the given pack flags, with hints for filters that do not do what they seem to", setupDoctor},
+		{"editor", "[flags]", "Answer pack, packRelated and explain requests of an editor extension as JSON-RPC over stdio", setupEditor},
+		{"completion", "bash|zsh|fish", "Print a shell completion script", setupCompletion},
+	}
+}
+
+// run executes the command named by the first argument. Without one, or when
+// the arguments start with a flag, it packs, as contextify did before it had
+// subcommands.
+func run(args []string) int {
+	name := "pack"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout)
+		return exitSuccess
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "contextify: unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitFailure
+	}
+
+	fs := newFlagSet(cmd)
+	runCmd := cmd.setup(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitSuccess
+		}
+		return exitFailure
+	}
+	return runCmd(fs.Args())
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet("contextify "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: contextify %s %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: contextify [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'contextify <command> -h' for the flags of a command.")
+}
+
+// noArgs rejects positional arguments for commands that take none.
+func noArgs(name string, args []string) bool {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "contextify %s: unexpected argument %q\n", name, args[0])
+		return false
+	}
+	return true
+}
+
+// signalContext is cancelled on the first SIGINT/SIGTERM; a second one
+// kills the process.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+func setupPack(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		config, err := pf.config(logger)
+		if err == nil {
+			err = config.setFileArgs(args)
+		}
+		if err != nil {
+			logger.Error("Invalid flags", "error", err)
+			return exitFailure
+		}
+
+		logger.Info("Starting contextify",
+			"input", config.inputPath,
+			"output", config.outputPath,
+			"excludeDirs", config.excludeDirs,
+			"includeExts", config.includeExts,
+		)
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		code, err := pack(ctx, config, *pf.progress, *pf.resultJSON)
+		logOutcome(logger, config, code, err)
+		if config.open && outputWritten(code) {
+			if err := openOutput(config); err != nil {
+				logger.Warn("Failed to open output", "error", err)
+			}
+		}
+		return code
+	}
+}
+
+// pack runs a single pack with progress reporting and returns its exit code
+// and error. The run summary is written to resultJSON when set. The
+// -pre-hook runs before the walk and the -post-hook once output is written;
+// a failing hook fails the run. The -notify-url webhook hears about every
+// outcome, failures included.
+func pack(ctx context.Context, config *Config, progress, resultJSON string) (int, error) {
+	var progressOut io.Writer = os.Stderr
+	if config.progressFile != "" {
+		f, err := os.OpenFile(config.progressFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			config.logger.Warn("Failed to open progress file, reporting to stderr", "error", err)
+		} else {
+			defer f.Close()
+			progressOut = f
+		}
+	}
+	config.progress = newProgressReporter(progress, progressOut)
+	config.result = newRunResult(config)
+	if config.profile != "" {
+		path := config.profileOut
+		if path == "" {
+			path = defaultProfilePath(config.profile)
+		}
+		if stopProfile, err := startProfile(config.profile, path); err != nil {
+			config.logger.Warn("Failed to profile run", "error", err)
+		} else {
+			defer func() {
+				if err := stopProfile(); err != nil {
+					config.logger.Warn("Failed to write profile", "error", err)
+					return
+				}
+				config.logger.Info("Wrote profile", "kind", config.profile, "path", path)
+			}()
+		}
+	}
+	if config.timing {
+		config.timings = &runTimings{}
+		config.result.Timing = config.timings
+	}
+
+	err := runHook(ctx, "pre", config.preHook, preHookEvent{
+		Event:  "pre",
+		Input:  config.inputPath,
+		Output: config.outputPath,
+		Format: config.format,
+	})
+	if err == nil {
+		start := time.Now()
+		if config.pipe != "" {
+			err = processPiped(ctx, config)
+		} else {
+			err = processDirectory(ctx, config)
+		}
+		if config.timings != nil {
+			config.timings.finish(time.Since(start))
+			// After the progress display is gone
+			defer writeTimings(os.Stderr, config.timings)
+		}
+	}
+	config.progress.finish()
+
+	if err == nil && config.splitOutput && config.outputWriter == nil {
+		var parts []string
+		var oversized []oversizedPart
+		if parts, oversized, err = splitOutput(config.outputPath, config.maxOutputSize); err == nil && parts != nil {
+			config.logger.Info("Split output over -max-output-size", "parts", parts)
+			config.result.Parts = parts
+			config.result.OversizedParts = oversized
+			for _, p := range oversized {
+				config.logger.Warn("Output part is over -max-output-size, as what it holds does not fit in one", "part", p.Part, "holds", p.Holds, "size", p.Size)
+			}
+		}
+	}
+	code := config.result.finish(err)
+	if config.windows && outputWritten(code) {
+		config.result.Windows = fitWindows(config.result.Tokens, config.manifest.Files)
+		writeWindowFit(os.Stderr, config.result.Windows)
+	}
+	if outputWritten(code) {
+		if err = runHook(ctx, "post", config.postHook, config.result); err != nil {
+			code = config.result.finish(err)
+		}
+	}
+	if config.notifyURL != "" {
+		if notifyErr := notify(ctx, config.notifyURL, config.result); notifyErr != nil {
+			config.logger.Warn("Failed to send notification", "error", notifyErr)
+		}
+	}
+	if config.findingsReport != "" && (config.redactor != nil || config.strict != nil) {
+		if writeErr := writeFindings(config.findingsReport, config); writeErr != nil {
+			config.logger.Error("Failed to write findings report", "error", writeErr)
+		}
+	}
+	config.progress.finished(config.result)
+	if resultJSON != "" {
+		if writeErr := config.result.writeJSON(resultJSON); writeErr != nil {
+			config.logger.Error("Failed to write run result", "error", writeErr)
+		}
+	}
+	return code, err
+}
+
+func logOutcome(logger *slog.Logger, config *Config, code int, err error) {
+	switch code {
+	case exitSuccess:
+		logger.Info("Successfully created context file", "output", config.outputPath)
+	case exitPartial:
+		logger.Warn("Created context file with skipped files", "output", config.outputPath, "skipped", len(config.result.FilesSkipped))
+	case exitNothingMatched:
+		logger.Warn("No files matched the filters", "output", config.outputPath)
+	case exitBudgetExceeded:
+		logger.Warn("Created context file, but files were left out to stay within budget", "output", config.outputPath)
+	case exitCancelled:
+		logger.Warn("Cancelled", "partialOutput", config.onCancel)
+	default:
+		logger.Error("Failed to process directory", "error", err)
+	}
+}
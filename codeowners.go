@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// codeOwnersLocations are where GitHub and GitLab look for a CODEOWNERS
+// file, in GitHub's order; the first found is used.
+var codeOwnersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// codeOwners holds the rules of the input's CODEOWNERS file, for
+// -codeowners and -owner.
+type codeOwners struct {
+	filter []string // -owner; empty keeps every file
+	file   string   // the CODEOWNERS file read, relative to the input
+	rules  []ownerRule
+}
+
+type ownerRule struct {
+	pattern   gitPattern
+	owners    []string
+	filesOnly bool // "dir/*" owns the files of dir but not its subdirectories
+}
+
+func newCodeOwners(filter []string) *codeOwners {
+	c := &codeOwners{}
+	for _, owner := range filter {
+		// Teams and users may be given without their "@"
+		if !strings.Contains(owner, "@") {
+			owner = "@" + owner
+		}
+		c.filter = append(c.filter, owner)
+	}
+	return c
+}
+
+// load reads the CODEOWNERS file of the input. Without one every file is
+// unowned, which -owner does not allow.
+func (c *codeOwners) load(absPath string, config *Config) error {
+	c.file, c.rules = "", nil
+	for _, location := range codeOwnersLocations {
+		f, err := os.Open(filepath.Join(absPath, filepath.FromSlash(location)))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		c.file = location
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseOwnerRule(scanner.Text()); ok {
+				c.rules = append(c.rules, rule)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", location, err)
+		}
+		config.logger.Debug("Loaded CODEOWNERS", "path", location, "rules", len(c.rules))
+		return nil
+	}
+	if len(c.filter) > 0 {
+		return fmt.Errorf("-owner needs a CODEOWNERS file, and there is none in %s", strings.Join(codeOwnersLocations, ", "))
+	}
+	config.logger.Warn("No CODEOWNERS file found", "looked in", strings.Join(codeOwnersLocations, ", "))
+	return nil
+}
+
+// parseOwnerRule parses a CODEOWNERS line: a gitignore-style pattern and
+// the owners that follow it. A pattern without owners leaves its files
+// unowned. GitLab section headings are skipped, so their rules apply as
+// if the file had no sections.
+func parseOwnerRule(line string) (ownerRule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") || strings.HasPrefix(line, "!") {
+		return ownerRule{}, false
+	}
+	fields := strings.Fields(line)
+	pattern, ok := parseGitPattern("", fields[0])
+	if !ok {
+		return ownerRule{}, false
+	}
+	rule := ownerRule{pattern: pattern, filesOnly: strings.HasSuffix(fields[0], "/*")}
+	for _, owner := range fields[1:] {
+		if strings.HasPrefix(owner, "#") {
+			break
+		}
+		rule.owners = append(rule.owners, owner)
+	}
+	return rule, true
+}
+
+// owners returns the owners of a file: those of the last rule matching it
+// or one of its directories.
+func (c *codeOwners) owners(relPath string) []string {
+	relPath = filepath.ToSlash(relPath)
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		rule := c.rules[i]
+		if rule.pattern.match(relPath, false) {
+			return rule.owners
+		}
+		if rule.filesOnly {
+			continue
+		}
+		for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+			if rule.pattern.match(dir, true) {
+				return rule.owners
+			}
+		}
+	}
+	return nil
+}
+
+// metadata returns the owners field of a file's metadata line.
+func (c *codeOwners) metadata(relPath string) []string {
+	owners := c.owners(relPath)
+	if len(owners) == 0 {
+		return nil
+	}
+	return []string{"owners=" + strings.Join(owners, ",")}
+}
+
+// ownerFiltered reports why -owner leaves a file out.
+func ownerFiltered(relPath string, config *Config) (string, bool) {
+	c := config.codeOwners
+	if c == nil || len(c.filter) == 0 {
+		return "", false
+	}
+	owners := c.owners(relPath)
+	for _, owner := range owners {
+		if slices.ContainsFunc(c.filter, func(f string) bool { return strings.EqualFold(f, owner) }) {
+			return "", false
+		}
+	}
+	if len(owners) == 0 {
+		return fmt.Sprintf("unowned in %s, and -owner is %s", c.file, strings.Join(c.filter, ",")), true
+	}
+	return fmt.Sprintf("owned by %s in %s, not -owner %s", strings.Join(owners, ","), c.file, strings.Join(c.filter, ",")), true
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionFlag describes a flag for completion scripts.
+type completionFlag struct {
+	name   string
+	usage  string
+	isBool bool
+	values []string
+}
+
+// commandFlags returns the flags of a command by registering them on a
+// throwaway flag set.
+func commandFlags(cmd command) []completionFlag {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	cmd.setup(fs)
+
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:   f.Name,
+			usage:  shortUsage(f.Usage),
+			isBool: ok && b.IsBoolFlag(),
+			values: flagValues[f.Name],
+		})
+	})
+	return flags
+}
+
+// shortUsage cuts a flag's usage down to its first clause.
+func shortUsage(usage string) string {
+	if idx := strings.IndexAny(usage, ":;("); idx > 0 {
+		usage = usage[:idx]
+	}
+	return strings.TrimSpace(usage)
+}
+
+func setupCompletion(fs *flag.FlagSet) func(args []string) int {
+	return func(args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "contextify completion: expected one of %s\n", strings.Join(completionShells, ", "))
+			return exitFailure
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(os.Stdout)
+		case "zsh":
+			writeZshCompletion(os.Stdout)
+		case "fish":
+			writeFishCompletion(os.Stdout)
+		default:
+			fmt.Fprintf(os.Stderr, "contextify completion: unsupported shell %q (valid: %s)\n", args[0], strings.Join(completionShells, ", "))
+			return exitFailure
+		}
+		return exitSuccess
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands)+1)
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return append(names, "help")
+}
+
+func writeBashCompletion(w io.Writer) {
+	// Flags share their meaning across commands, so value completion is
+	// keyed by flag name alone
+	valueCases := map[string]string{}
+	for _, cmd := range commands {
+		for _, f := range commandFlags(cmd) {
+			switch {
+			case len(f.values) > 0:
+				valueCases[f.name] = fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur")); return ;;`, strings.Join(f.values, " "))
+			case !f.isBool:
+				valueCases[f.name] = `COMPREPLY=($(compgen -f -- "$cur")); return ;;`
+			}
+		}
+	}
+	names := make([]string, 0, len(valueCases))
+	for name := range valueCases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# bash completion for contextify")
+	fmt.Fprintln(w, "_contextify() {")
+	fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd=pack`)
+	fmt.Fprintln(w, `    if [[ ${COMP_CWORD} -eq 1 && $cur != -* ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, `    [[ ${COMP_WORDS[1]} != -* ]] && cmd=${COMP_WORDS[1]}`)
+	fmt.Fprintln(w, `    case "${prev#-}" in`)
+	for _, name := range names {
+		fmt.Fprintf(w, "        %s|-%s) %s\n", name, name, valueCases[name])
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, `    case "$cmd" in`)
+	for _, cmd := range commands {
+		var flags []string
+		for _, f := range commandFlags(cmd) {
+			flags = append(flags, "-"+f.name)
+		}
+		fmt.Fprintf(w, "        %s) local flags=\"%s\" ;;\n", cmd.name, strings.Join(flags, " "))
+	}
+	fmt.Fprintln(w, `        *) return ;;`)
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, `    if [[ $cur == -* ]]; then`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -W "$flags" -- "$cur"))`)
+	fmt.Fprintln(w, `    elif [[ $cmd == completion ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(completionShells, " "))
+	fmt.Fprintln(w, `    elif [[ $cmd == unpack ]]; then`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _contextify contextify")
+}
+
+func writeZshCompletion(w io.Writer) {
+	quote := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+
+	fmt.Fprintln(w, "#compdef contextify")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "_contextify() {")
+	fmt.Fprintln(w, "  local -a commands")
+	fmt.Fprintln(w, "  commands=(")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    '%s:%s'\n", cmd.name, quote.Replace(cmd.summary))
+	}
+	fmt.Fprintln(w, "    'help:Show the available commands'")
+	fmt.Fprintln(w, "  )")
+	fmt.Fprintln(w, "  local cmd=pack")
+	fmt.Fprintln(w, "  if [[ ${words[2]} != -* ]]; then")
+	fmt.Fprintln(w, "    if (( CURRENT == 2 )); then")
+	fmt.Fprintln(w, "      _describe -t commands command commands")
+	fmt.Fprintln(w, "      return")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, "    cmd=${words[2]}")
+	fmt.Fprintln(w, "    shift words")
+	fmt.Fprintln(w, "    (( CURRENT-- ))")
+	fmt.Fprintln(w, "  fi")
+	fmt.Fprintln(w, "  case $cmd in")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    %s)\n      _arguments", cmd.name)
+		for _, f := range commandFlags(cmd) {
+			spec := fmt.Sprintf("-%s[%s]", f.name, quote.Replace(f.usage))
+			switch {
+			case len(f.values) > 0:
+				spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+			case !f.isBool:
+				spec += fmt.Sprintf(":%s:_files", f.name)
+			}
+			fmt.Fprintf(w, " \\\n        '%s'", spec)
+		}
+		switch cmd.name {
+		case "completion":
+			fmt.Fprintf(w, " \\\n        '1:shell:(%s)'", strings.Join(completionShells, " "))
+		case "unpack":
+			fmt.Fprint(w, " \\\n        '1:context file:_files'")
+		}
+		fmt.Fprintln(w, "\n      ;;")
+	}
+	fmt.Fprintln(w, "  esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `_contextify "$@"`)
+}
+
+func writeFishCompletion(w io.Writer) {
+	quote := strings.NewReplacer("'", `\'`)
+
+	fmt.Fprintln(w, "# fish completion for contextify")
+	fmt.Fprintln(w, "complete -c contextify -f")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c contextify -n __fish_use_subcommand -a %s -d '%s'\n", cmd.name, quote.Replace(cmd.summary))
+	}
+	fmt.Fprintln(w, "complete -c contextify -n __fish_use_subcommand -a help -d 'Show the available commands'")
+
+	for _, cmd := range commands {
+		condition := fmt.Sprintf("'__fish_seen_subcommand_from %s'", cmd.name)
+		if cmd.name == "pack" {
+			// Flags without a command pack
+			condition = "'__fish_use_subcommand; or __fish_seen_subcommand_from pack'"
+		}
+		for _, f := range commandFlags(cmd) {
+			line := fmt.Sprintf("complete -c contextify -n %s -o %s -d '%s'", condition, f.name, quote.Replace(f.usage))
+			switch {
+			case len(f.values) > 0:
+				line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " "))
+			case !f.isBool:
+				line += " -r -F"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	fmt.Fprintf(w, "complete -c contextify -n '__fish_seen_subcommand_from completion' -a '%s'\n", strings.Join(completionShells, " "))
+	fmt.Fprintln(w, "complete -c contextify -n '__fish_seen_subcommand_from unpack' -F")
+}
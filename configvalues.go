@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of infrastructure configuration -strip-config-values reduces to
+// keys and value types.
+const (
+	configEnv       = "env"
+	configYAML      = "yaml"
+	configTFVars    = "tfvars"
+	configVariables = "variables"
+)
+
+// infraConfigKind classifies dotenv files, Helm values, docker-compose
+// files and Terraform variables; it returns "" for other files.
+func infraConfigKind(relPath string) string {
+	base := strings.ToLower(filepath.Base(relPath))
+	ext := filepath.Ext(base)
+	switch {
+	case base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env"):
+		return configEnv
+	case ext == ".yaml" || ext == ".yml":
+		name := strings.TrimSuffix(base, ext)
+		if name == "values" || strings.HasPrefix(name, "values-") || strings.HasPrefix(name, "values.") ||
+			strings.HasPrefix(name, "docker-compose") || name == "compose" || strings.HasPrefix(name, "compose.") || strings.HasPrefix(name, "compose-") {
+			return configYAML
+		}
+	case ext == ".tfvars":
+		return configTFVars
+	case ext == ".tf" && strings.HasPrefix(base, "variables"):
+		return configVariables
+	}
+	return ""
+}
+
+// stripConfigValues replaces the literal values of an infrastructure
+// configuration file with their type, e.g. DATABASE_URL=<redacted:string>,
+// keeping its keys, structure and comments.
+func stripConfigValues(src sourceFile, data []byte) ([]byte, bool, error) {
+	switch infraConfigKind(src.relPath) {
+	case configEnv:
+		return stripEnvValues(data), true, nil
+	case configYAML:
+		out, err := stripYAMLValues(data)
+		return out, true, err
+	case configTFVars:
+		return stripHCLValues(data, false), true, nil
+	case configVariables:
+		return stripHCLValues(data, true), true, nil
+	}
+	return data, true, nil
+}
+
+// valueType names the type of a literal for its placeholder.
+func valueType(value string) string {
+	switch strings.ToLower(value) {
+	case "true", "false", "yes", "no", "on", "off":
+		return "bool"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "number"
+	}
+	return "string"
+}
+
+func valuePlaceholder(kind string) string {
+	return "<redacted:" + kind + ">"
+}
+
+var envAssignment = regexp.MustCompile(`^(\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_.-]*\s*=\s*)(.*)$`)
+
+func stripEnvValues(data []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		m := envAssignment.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			out.WriteString(line + "\n")
+			continue
+		}
+		value := strings.TrimSpace(m[2])
+		comment := ""
+		rest := value
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+				rest = value[end+2:]
+			}
+		}
+		if i := strings.Index(rest, " #"); i >= 0 {
+			comment = " " + rest[i+1:]
+			value = strings.TrimSpace(value[:len(value)-len(rest)+i])
+		}
+		if value == "" {
+			out.WriteString(line + "\n")
+			continue
+		}
+		kind := "string"
+		if value[0] != '"' && value[0] != '\'' {
+			kind = valueType(value)
+		}
+		out.WriteString(m[1] + valuePlaceholder(kind) + comment + "\n")
+	}
+	return out.Bytes()
+}
+
+var envListEntry = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=`)
+
+// stripYAMLValues replaces the scalars of every document in a YAML file.
+// Entries like KEY=value in lists, as docker-compose environment lists
+// have, keep their key.
+func stripYAMLValues(data []byte) ([]byte, error) {
+	// Templated values files are not YAML until rendered
+	if bytes.Contains(data, []byte("{{")) {
+		return stripEnvLikeYAML(data), nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stripEnvLikeYAML(data), nil
+		}
+		stripYAMLNode(&doc, false)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func stripYAMLNode(n *yaml.Node, inSequence bool) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			stripYAMLNode(child, n.Kind == yaml.SequenceNode)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			stripYAMLNode(n.Content[i], false)
+		}
+	case yaml.ScalarNode:
+		kind := ""
+		switch n.Tag {
+		case "!!null":
+			return
+		case "!!bool":
+			kind = "bool"
+		case "!!int", "!!float":
+			kind = "number"
+		default:
+			kind = "string"
+		}
+		placeholder := valuePlaceholder(kind)
+		if m := envListEntry.FindStringSubmatch(n.Value); inSequence && m != nil {
+			placeholder = m[0] + valuePlaceholder(valueType(n.Value[len(m[0]):]))
+		}
+		n.Tag, n.Value, n.Style = "!!str", placeholder, 0
+	}
+}
+
+var yamlLineValue = regexp.MustCompile(`^(\s*(?:- )?[^\s#:][^:#]*:\s+)([^\s|>{\[#&*].*?)(\s+#.*)?$`)
+
+// stripEnvLikeYAML handles YAML that does not parse, such as Helm
+// templates, line by line: the value after "key: " is replaced.
+func stripEnvLikeYAML(data []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if m := yamlLineValue.FindStringSubmatch(trimmed); m != nil && !strings.HasPrefix(strings.TrimSpace(m[2]), "{{") {
+			line = m[1] + valuePlaceholder(valueType(strings.Trim(m[2], `"'`))) + m[3] + line[len(trimmed):]
+		}
+		out.WriteString(line)
+	}
+	return out.Bytes()
+}
+
+var hclAssignment = regexp.MustCompile(`^(\s*"?([A-Za-z_][\w-]*)"?\s*=\s*)(.*)$`)
+
+// stripHCLValues replaces the values of Terraform assignments: every
+// attribute of a .tfvars file, or the defaults of a variables file. Lists
+// and heredocs become one placeholder; maps keep their keys.
+func stripHCLValues(data []byte, defaultsOnly bool) []byte {
+	var out bytes.Buffer
+	lines := strings.SplitAfter(string(data), "\n")
+	mapDepth := 0 // brace depth inside a map whose keys are stripped
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimRight(line, "\r\n")
+		inMap := mapDepth > 0
+		if inMap {
+			mapDepth += strings.Count(trimmed, "{") - strings.Count(trimmed, "}")
+		}
+		m := hclAssignment.FindStringSubmatch(trimmed)
+		if m == nil || defaultsOnly && !inMap && m[2] != "default" {
+			out.WriteString(line)
+			continue
+		}
+		value := strings.TrimSpace(m[3])
+		eol := line[len(trimmed):]
+		switch {
+		case strings.HasPrefix(value, "{"):
+			// Keys inside are assignments of their own
+			if !inMap {
+				mapDepth = strings.Count(trimmed, "{") - strings.Count(trimmed, "}")
+			}
+			out.WriteString(line)
+		case strings.HasPrefix(value, "["):
+			depth := strings.Count(value, "[") - strings.Count(value, "]")
+			for depth > 0 && i+1 < len(lines) {
+				i++
+				depth += strings.Count(lines[i], "[") - strings.Count(lines[i], "]")
+				eol = lines[i][len(strings.TrimRight(lines[i], "\r\n")):]
+			}
+			out.WriteString(m[1] + valuePlaceholder("list") + eol)
+		case strings.HasPrefix(value, "<<"):
+			marker := strings.TrimSpace(strings.TrimLeft(value[2:], "-~"))
+			for i+1 < len(lines) {
+				i++
+				if strings.TrimSpace(lines[i]) == marker {
+					eol = lines[i][len(strings.TrimRight(lines[i], "\r\n")):]
+					break
+				}
+			}
+			out.WriteString(m[1] + valuePlaceholder("string") + eol)
+		case strings.HasPrefix(value, `"`):
+			out.WriteString(m[1] + valuePlaceholder("string") + eol)
+		default:
+			if comment := strings.Index(value, "#"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+			out.WriteString(m[1] + valuePlaceholder(valueType(value)) + eol)
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverageProfile holds the statement coverage of a Go cover profile, as
+// written by go test -coverprofile, keyed by the file names it uses: the
+// import path of the package and the file's base name.
+type coverageProfile struct {
+	path     string
+	files    map[string]*fileCoverage
+	below    float64         // percentage Go files must be under to be packed; 0 keeps all
+	resolver *moduleResolver // maps input files to import paths, once the input is known
+}
+
+// fileCoverage holds the blocks of one file by position, so that profiles
+// concatenated from several test runs merge rather than double count.
+type fileCoverage struct {
+	blocks map[[4]int]*coverBlock
+}
+
+type coverBlock struct {
+	startLine, endLine int
+	statements         int
+	count              int
+}
+
+func loadCoverage(path string, below float64) (*coverageProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage profile: %w", err)
+	}
+	defer f.Close()
+
+	c := &coverageProfile{path: path, files: make(map[string]*fileCoverage), below: below}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// name.go:startLine.startCol,endLine.endCol statements count
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("%s:%d: not a cover profile line", path, n)
+		}
+		var pos [4]int
+		var statements, count int
+		if _, err := fmt.Sscanf(line[colon+1:], "%d.%d,%d.%d %d %d", &pos[0], &pos[1], &pos[2], &pos[3], &statements, &count); err != nil {
+			return nil, fmt.Errorf("%s:%d: not a cover profile line: %w", path, n, err)
+		}
+		name := line[:colon]
+		fc := c.files[name]
+		if fc == nil {
+			fc = &fileCoverage{blocks: make(map[[4]int]*coverBlock)}
+			c.files[name] = fc
+		}
+		if block := fc.blocks[pos]; block != nil {
+			block.count = max(block.count, count)
+		} else {
+			fc.blocks[pos] = &coverBlock{startLine: pos[0], endLine: pos[2], statements: statements, count: count}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read coverage profile: %w", err)
+	}
+	if len(c.files) == 0 {
+		return nil, fmt.Errorf("%s has no coverage data", path)
+	}
+	return c, nil
+}
+
+// setRoot resolves the modules of the input, so files can be matched to
+// the import paths the profile uses.
+func (c *coverageProfile) setRoot(absPath string) {
+	c.resolver = newModuleResolver(absPath)
+}
+
+// lookup finds the coverage of a file. Without a go.mod to derive its
+// import path, the profile name that ends in relPath is used.
+func (c *coverageProfile) lookup(path, relPath string) *fileCoverage {
+	if c.resolver != nil {
+		if importPath, ok := c.resolver.importPath(filepath.Dir(path)); ok {
+			if fc := c.files[importPath+"/"+filepath.Base(path)]; fc != nil {
+				return fc
+			}
+		}
+	}
+	relPath = filepath.ToSlash(relPath)
+	match := ""
+	for name := range c.files {
+		if (name == relPath || strings.HasSuffix(name, "/"+relPath)) && (match == "" || name < match) {
+			match = name
+		}
+	}
+	return c.files[match]
+}
+
+// stats returns the covered and total statements of a file.
+func (fc *fileCoverage) stats() (covered, total int) {
+	for _, block := range fc.blocks {
+		total += block.statements
+		if block.count > 0 {
+			covered += block.statements
+		}
+	}
+	return covered, total
+}
+
+// percent is the share of statements covered; a file without statements
+// has nothing left to cover.
+func (fc *fileCoverage) percent() float64 {
+	covered, total := fc.stats()
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// uncovered lists the line ranges of blocks no test ran, merged, e.g.
+// "12-14,30-41".
+func (fc *fileCoverage) uncovered() string {
+	var ranges [][2]int
+	for _, block := range fc.blocks {
+		if block.count == 0 {
+			ranges = append(ranges, [2]int{block.startLine, block.endLine})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	var merged [][2]int
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && r[0] <= merged[last][1]+1 {
+			merged[last][1] = max(merged[last][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	parts := make([]string, len(merged))
+	for i, r := range merged {
+		parts[i] = strconv.Itoa(r[0])
+		if r[1] != r[0] {
+			parts[i] += "-" + strconv.Itoa(r[1])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// metadata returns the coverage fields of a file's metadata line, or
+// nothing for files the profile does not cover.
+func (c *coverageProfile) metadata(path, relPath string) []string {
+	fc := c.lookup(path, relPath)
+	if fc == nil {
+		return nil
+	}
+	_, total := fc.stats()
+	fields := []string{fmt.Sprintf("coverage=%.1f%%", fc.percent()), "statements=" + strconv.Itoa(total)}
+	if uncovered := fc.uncovered(); uncovered != "" {
+		fields = append(fields, "uncovered="+uncovered)
+	}
+	return fields
+}
+
+// coverageFiltered reports why -coverage-below leaves a file out. Only Go
+// source files are filtered; tests and other files are left to the other
+// filters.
+func coverageFiltered(path, relPath string, config *Config) (string, bool) {
+	c := config.coverage
+	if c == nil || c.below <= 0 || filepath.Ext(relPath) != ".go" || strings.HasSuffix(relPath, "_test.go") {
+		return "", false
+	}
+	fc := c.lookup(path, relPath)
+	if fc == nil {
+		return "not in the coverage profile", true
+	}
+	if pct := fc.percent(); pct >= c.below {
+		return fmt.Sprintf("coverage %.1f%% is not below -coverage-below %g", pct, c.below), true
+	}
+	return "", false
+}
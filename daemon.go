@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// daemonFile is the -config file of the daemon: the contexts to keep fresh,
+// each given by its pack flags, e.g.
+//
+//	every: 1h
+//	contexts:
+//	  - name: backend
+//	    every: 15m
+//	    flags:
+//	      input: services/api
+//	      output: /srv/context/api.txt
+//	      extensions: .go,.mod
+type daemonFile struct {
+	Every    string `toml:"every" yaml:"every"`
+	Contexts []struct {
+		Name  string         `toml:"name" yaml:"name"`
+		Every string         `toml:"every" yaml:"every"`
+		Flags map[string]any `toml:"flags" yaml:"flags"`
+	} `toml:"contexts" yaml:"contexts"`
+}
+
+// daemonContext is one scheduled context and the outcome of its last run.
+type daemonContext struct {
+	Name    string     `json:"name"`
+	Every   string     `json:"every"`
+	Running bool       `json:"running"`
+	LastRun *runResult `json:"lastRun,omitempty"`
+	NextRun time.Time  `json:"nextRun"`
+	every   time.Duration
+	pf      *packFlags
+}
+
+func setupDaemon(fs *flag.FlagSet) func(args []string) int {
+	configPath := fs.String("config", "contextify.yaml", "Contexts to regenerate, as YAML or TOML (by extension)")
+	every := fs.Duration("every", time.Hour, "How often to regenerate contexts that do not set their own interval")
+	addr := fs.String("addr", "127.0.0.1:8081", "Address for the /healthz and /status endpoints; empty to disable")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		if !noArgs("daemon", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		contexts, err := loadDaemonContexts(*configPath, *every, logger)
+		if err != nil {
+			logger.Error("Invalid daemon config", "error", err)
+			return exitFailure
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		var mu sync.Mutex
+		if *addr != "" {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, "ok")
+			})
+			mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				data, err := json.MarshalIndent(contexts, "", "  ")
+				mu.Unlock()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(append(data, '\n'))
+			})
+			server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+			}()
+			go func() {
+				if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logger.Error("Failed to serve status", "error", err)
+					stop()
+				}
+			}()
+		}
+
+		logger.Info("Running contextify daemon", "config", *configPath, "contexts", len(contexts), "addr", *addr)
+		var wg sync.WaitGroup
+		for _, c := range contexts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.schedule(ctx, &mu, logger.With("context", c.Name))
+			}()
+		}
+		wg.Wait()
+		logger.Info("Stopped daemon")
+		return exitSuccess
+	}
+}
+
+// loadDaemonContexts reads the daemon config and validates the pack flags
+// of every context up front.
+func loadDaemonContexts(path string, every time.Duration, logger *slog.Logger) ([]*daemonContext, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daemon config: %w", err)
+	}
+	var file daemonFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &file)
+	default:
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse daemon config: %w", err)
+	}
+	if file.Every != "" {
+		if every, err = time.ParseDuration(file.Every); err != nil {
+			return nil, fmt.Errorf("invalid every: %w", err)
+		}
+	}
+	if len(file.Contexts) == 0 {
+		return nil, fmt.Errorf("%s defines no contexts", path)
+	}
+
+	var contexts []*daemonContext
+	names := make(map[string]bool)
+	for i, entry := range file.Contexts {
+		c := &daemonContext{Name: entry.Name, every: every}
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("context-%d", i+1)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate context name %q", c.Name)
+		}
+		names[c.Name] = true
+		if entry.Every != "" {
+			if c.every, err = time.ParseDuration(entry.Every); err != nil {
+				return nil, fmt.Errorf("context %s: invalid every: %w", c.Name, err)
+			}
+		}
+		if c.every <= 0 {
+			return nil, fmt.Errorf("context %s: every must be positive", c.Name)
+		}
+		c.Every = c.every.String()
+
+		fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+		c.pf = registerPackFlags(fs)
+		for name, value := range entry.Flags {
+			if fs.Lookup(name) == nil {
+				return nil, fmt.Errorf("context %s: unknown pack flag %q", c.Name, name)
+			}
+			if err := fs.Set(name, flagValue(value)); err != nil {
+				return nil, fmt.Errorf("context %s: invalid %s: %w", c.Name, name, err)
+			}
+		}
+		*c.pf.progress = "none"
+		if *c.pf.outputPath == "-" {
+			return nil, fmt.Errorf("context %s: needs an output file", c.Name)
+		}
+		if _, err := c.pf.config(logger); err != nil {
+			return nil, fmt.Errorf("context %s: %w", c.Name, err)
+		}
+		contexts = append(contexts, c)
+	}
+	return contexts, nil
+}
+
+// flagValue renders a config value as a flag value; lists become the
+// comma-separated form the flags take.
+func flagValue(value any) string {
+	if list, ok := value.([]any); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// schedule regenerates the context right away and then every c.every
+// until ctx is done. Each run builds a fresh config so that per-run state
+// does not carry over.
+func (c *daemonContext) schedule(ctx context.Context, mu *sync.Mutex, logger *slog.Logger) {
+	ticker := time.NewTicker(c.every)
+	defer ticker.Stop()
+	for {
+		mu.Lock()
+		c.Running = true
+		mu.Unlock()
+
+		var result *runResult
+		config, err := c.pf.config(logger)
+		if err == nil {
+			var code int
+			code, err = pack(ctx, config, "none", *c.pf.resultJSON)
+			result = config.result
+			if code != exitCancelled {
+				logOutcome(logger, config, code, err)
+			}
+		} else {
+			logger.Error("Invalid flags", "error", err)
+			result = &runResult{Status: "failed", ExitCode: exitFailure, Error: err.Error(), StartedAt: time.Now()}
+		}
+
+		mu.Lock()
+		c.Running = false
+		c.LastRun = result
+		c.NextRun = time.Now().Add(c.every)
+		mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
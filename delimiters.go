@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Defaults of the custom file delimiters: the usual header line, and a
+// blank line between files instead of the code fences.
+const (
+	defaultFileHeader    = "## File: {path}"
+	defaultFileSeparator = "\n\n"
+)
+
+// unescapeDelimiter turns the \n and \t escapes of a delimiter flag into
+// the characters they stand for.
+func unescapeDelimiter(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t").Replace(s)
+}
+
+// expandDelimiter fills the {path}, {index} and {lang} placeholders of a
+// -file-header-format or -file-separator. {lang} is the language in the
+// lower-case form code fences take, e.g. go or c++, and empty when unknown.
+func expandDelimiter(format, path string, index int, relPath string) string {
+	lang := detectLanguage(relPath)
+	if lang == "Other" {
+		lang = ""
+	}
+	return strings.NewReplacer(
+		"{path}", path,
+		"{index}", strconv.Itoa(index),
+		"{lang}", strings.ReplaceAll(strings.ToLower(lang), " ", "-"),
+	).Replace(format)
+}
+
+// customDelimiters reports whether files are delimited by
+// -file-header-format and -file-separator rather than code fences.
+func (c *Config) customDelimiters() bool {
+	return c.fileHeader != "" || c.fileSeparator != ""
+}
+
+// fileStart returns what precedes a file's metadata line and content.
+func (c *Config) fileStart(relPath string) string {
+	if !c.customDelimiters() {
+		return "## File: " + c.displayPath(relPath) + "\n"
+	}
+	header := c.fileHeader
+	if header == "" {
+		header = defaultFileHeader
+	}
+	return expandDelimiter(header, c.displayPath(relPath), c.fileIndex, relPath) + "\n"
+}
+
+// contentStart returns what follows the metadata line, before the content.
+func (c *Config) contentStart() string {
+	if c.customDelimiters() {
+		return ""
+	}
+	return "```\n"
+}
+
+// fileEnd returns what follows a file's content.
+func (c *Config) fileEnd(relPath string) string {
+	if !c.customDelimiters() {
+		return "\n```\n\n"
+	}
+	separator := c.fileSeparator
+	if separator == "" {
+		separator = defaultFileSeparator
+	}
+	return expandDelimiter(separator, c.displayPath(relPath), c.fileIndex, relPath)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// contextDiff lists how the files of two contexts differ.
+type contextDiff struct {
+	added    []packedFile
+	removed  []string
+	modified []packedFile
+	same     int
+}
+
+func setupDiff(fs *flag.FlagSet) func(args []string) int {
+	output := fs.String("output", "-", "Write the delta context to this file (- for stdout)")
+	reportOnly := fs.Bool("report", false, "Only list added, removed and modified files, without their content")
+	excludeDirs := fs.String("exclude", "", "Comma-separated directories to exclude when an argument is a directory")
+	includeExts := fs.String("extensions", "", "Comma-separated file extensions to include when an argument is a directory")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		if len(args) != 2 {
+			logger.Error("Expected two contexts or directories to compare", "args", args)
+			return exitFailure
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		var sides [2][]packedFile
+		for i, arg := range args {
+			sides[i], err = loadContext(ctx, arg, *excludeDirs, *includeExts, logger)
+			if err != nil {
+				logger.Error("Failed to load context", "path", arg, "error", err)
+				return exitFailure
+			}
+		}
+		diff := diffContexts(sides[0], sides[1])
+
+		var w io.Writer = os.Stdout
+		if *output != "-" {
+			f, err := os.Create(*output)
+			if err != nil {
+				logger.Error("Failed to create output file", "error", err)
+				return exitFailure
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := writeDelta(w, args[0], args[1], diff, *reportOnly); err != nil {
+			logger.Error("Failed to write delta", "error", err)
+			return exitFailure
+		}
+
+		logger.Info("Compared contexts",
+			"added", len(diff.added),
+			"removed", len(diff.removed),
+			"modified", len(diff.modified),
+			"unchanged", diff.same,
+		)
+		return exitSuccess
+	}
+}
+
+// loadContext reads the files of a context file or, for a directory, of a
+// pack of it. Message-format JSON bodies are unwrapped to their text.
+func loadContext(ctx context.Context, path, excludeDirs, includeExts string, logger *slog.Logger) ([]packedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if info.IsDir() {
+		fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+		pf := registerPackFlags(fs)
+		*pf.inputPath, *pf.excludeDirs, *pf.includeExts = path, excludeDirs, includeExts
+		config, err := pf.config(logger)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		config.outputWriter = &buf
+		if code, err := pack(ctx, config, "none", ""); code == exitFailure || code == exitCancelled {
+			return nil, err
+		}
+		data = buf.Bytes()
+	} else {
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			data, err = messageText(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parseContext(data)
+}
+
+// messageText extracts the user content of an openai-messages or
+// anthropic-messages request body.
+func messageText(data []byte) ([]byte, error) {
+	var body struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON context: %w", err)
+	}
+
+	var text strings.Builder
+	for _, message := range body.Messages {
+		if message.Role != "user" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(message.Content, &s) == nil {
+			text.WriteString(s)
+			continue
+		}
+		var blocks []struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(message.Content, &blocks); err != nil {
+			return nil, fmt.Errorf("unexpected message content: %w", err)
+		}
+		for _, block := range blocks {
+			text.WriteString(block.Text)
+		}
+	}
+	return []byte(text.String()), nil
+}
+
+func diffContexts(before, after []packedFile) contextDiff {
+	oldByPath := make(map[string][]byte, len(before))
+	for _, file := range before {
+		oldByPath[file.path] = file.content
+	}
+
+	var diff contextDiff
+	seen := make(map[string]bool, len(after))
+	for _, file := range after {
+		seen[file.path] = true
+		content, ok := oldByPath[file.path]
+		switch {
+		case !ok:
+			diff.added = append(diff.added, file)
+		case !bytes.Equal(content, file.content):
+			diff.modified = append(diff.modified, file)
+		default:
+			diff.same++
+		}
+	}
+	for _, file := range before {
+		if !seen[file.path] {
+			diff.removed = append(diff.removed, file.path)
+		}
+	}
+	sort.Strings(diff.removed)
+	return diff
+}
+
+// writeDelta writes a context holding only what changed: the report as
+// header and the current content of added and modified files.
+func writeDelta(w io.Writer, oldName, newName string, diff contextDiff, reportOnly bool) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Contextify Delta\n%s# From: %s\n# To: %s\n", formatLine(), oldName, newName)
+	fmt.Fprintf(&buf, "# %d added, %d removed, %d modified, %d unchanged\n", len(diff.added), len(diff.removed), len(diff.modified), diff.same)
+	for _, file := range diff.added {
+		fmt.Fprintf(&buf, "# Added: %s\n", file.path)
+	}
+	for _, path := range diff.removed {
+		fmt.Fprintf(&buf, "# Removed: %s\n", path)
+	}
+	for _, file := range diff.modified {
+		fmt.Fprintf(&buf, "# Modified: %s\n", file.path)
+	}
+	buf.WriteString("\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if reportOnly {
+		return nil
+	}
+
+	for _, file := range append(diff.added, diff.modified...) {
+		if _, err := fmt.Fprintf(w, "%s%s\n%s%s%s", fileMarker, file.path, blockFence, file.content, blockEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// dockerPlaceholderCmd is the command of the containers created to export
+// an image.
+const dockerPlaceholderCmd = "/contextify-export"
+
+// dockerFetch exports the filesystem of an image through the local docker
+// (or podman) daemon: a stopped container is created from the image, which
+// pulls it if needed, and its flattened filesystem streamed as a tar.
+func dockerFetch(ctx context.Context, u *url.URL, _ *Config) (*remoteFetch, error) {
+	ref := strings.TrimPrefix(u.String(), "docker://")
+	image, inner := splitImageRef(ref)
+	if image == "" {
+		return nil, fmt.Errorf("docker input needs an image: docker://image[:tag][/path]")
+	}
+	// The engine would take an image starting with "-" for an option
+	if strings.HasPrefix(image, "-") {
+		return nil, fmt.Errorf("docker image %q starts with \"-\"", image)
+	}
+
+	engine := "docker"
+	if _, err := exec.LookPath(engine); err != nil {
+		engine = "podman"
+		if _, err := exec.LookPath(engine); err != nil {
+			return nil, fmt.Errorf("docker input requires the docker or podman CLI")
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	// The container never runs; the command only lets images without a CMD
+	// or ENTRYPOINT be created
+	create := exec.CommandContext(ctx, engine, "create", "--", image, dockerPlaceholderCmd)
+	create.Stdout, create.Stderr = &stdout, &stderr
+	if err := create.Run(); err != nil {
+		return nil, fmt.Errorf("failed to create container from %s: %w: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+	id := strings.TrimSpace(stdout.String())
+
+	return &remoteFetch{
+		cmd:    exec.CommandContext(ctx, engine, "export", id),
+		prefix: inner,
+		cleanup: func() {
+			_ = exec.Command(engine, "rm", "-f", id).Run()
+		},
+	}, nil
+}
+
+// splitImageRef splits "registry/name:tag/some/path" into the image
+// reference and the path inside the image. The path starts after the first
+// component holding a tag or digest, so a path needs one; a leading
+// registry host with a port counts only when a tag follows it.
+func splitImageRef(ref string) (image, inner string) {
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		if !strings.ContainsAny(segment, ":@") {
+			continue
+		}
+		if i == 0 && strings.ContainsAny(strings.Join(segments[1:], "/"), ":@") {
+			continue
+		}
+		return strings.Join(segments[:i+1], "/"), strings.Join(segments[i+1:], "/")
+	}
+	return ref, ""
+}
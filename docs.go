@@ -0,0 +1,341 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// extractDocx returns the paragraph text of a .docx document.
+func extractDocx(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open docx archive: %w", err)
+	}
+
+	var document *zip.File
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			document = f
+			break
+		}
+	}
+	if document == nil {
+		return nil, fmt.Errorf("docx archive has no word/document.xml")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open word/document.xml: %w", err)
+	}
+	defer rc.Close()
+
+	var out bytes.Buffer
+	decoder := xml.NewDecoder(rc)
+	inText := false
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse word/document.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				out.WriteByte('\t')
+			case "br", "cr":
+				out.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				out.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				out.Write(t)
+			}
+		}
+	}
+	return bytes.TrimSpace(out.Bytes()), nil
+}
+
+var pdfStreamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// extractPDF pulls the text shown by BT/ET blocks out of a PDF's content
+// streams. It understands uncompressed and Flate-compressed streams and
+// simple font encodings; text drawn with embedded CID fonts is skipped.
+func extractPDF(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+
+	var out bytes.Buffer
+	for _, loc := range pdfStreamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[loc[2]:loc[3]])
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+
+		switch {
+		case strings.Contains(dict, "/FlateDecode"):
+			zr, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil && len(decoded) == 0 {
+				continue
+			}
+			stream = decoded
+		case strings.Contains(dict, "/Filter"):
+			// Image and other encodings carry no text
+			continue
+		}
+
+		if text := pdfContentText(stream); text != "" {
+			out.WriteString(text)
+			out.WriteString("\n\n")
+		}
+	}
+
+	text := bytes.TrimSpace(out.Bytes())
+	if len(text) == 0 {
+		return []byte("[no extractable text]"), nil
+	}
+	return text, nil
+}
+
+// pdfContentText interprets the text operators of a content stream.
+func pdfContentText(content []byte) string {
+	var out strings.Builder
+	var operands []string
+	inText := false
+
+	for pos := 0; pos < len(content); {
+		c := content[pos]
+		switch {
+		case c == '(':
+			s, next := pdfLiteralString(content, pos)
+			operands = append(operands, s)
+			pos = next
+		case c == '<' && pos+1 < len(content) && content[pos+1] != '<':
+			end := bytes.IndexByte(content[pos:], '>')
+			if end < 0 {
+				return out.String()
+			}
+			operands = append(operands, pdfHexString(content[pos+1:pos+end]))
+			pos += end + 1
+		case c == '[':
+			operands = append(operands, "[")
+			pos++
+		case c == ']':
+			operands = append(operands, "]")
+			pos++
+		case c == '%':
+			for pos < len(content) && content[pos] != '\n' && content[pos] != '\r' {
+				pos++
+			}
+		case isPDFSpace(c) || c == '<' || c == '>' || c == '{' || c == '}' || c == '/':
+			if c == '/' {
+				start := pos
+				pos++
+				for pos < len(content) && !isPDFSpace(content[pos]) && !strings.ContainsRune("/[]()<>{}%", rune(content[pos])) {
+					pos++
+				}
+				operands = append(operands, string(content[start:pos]))
+				continue
+			}
+			pos++
+		default:
+			start := pos
+			for pos < len(content) && !isPDFSpace(content[pos]) && !strings.ContainsRune("/[]()<>{}%", rune(content[pos])) {
+				pos++
+			}
+			if pos == start {
+				// Stray delimiter such as an unbalanced ")"
+				pos++
+				continue
+			}
+			word := string(content[start:pos])
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				operands = append(operands, word)
+				continue
+			}
+
+			switch word {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				out.WriteString("\n")
+			case "Tj", "'", "\"":
+				if inText && len(operands) > 0 {
+					if word != "Tj" {
+						out.WriteString("\n")
+					}
+					out.WriteString(operands[len(operands)-1])
+				}
+			case "TJ":
+				if inText {
+					out.WriteString(pdfTextArray(operands))
+				}
+			case "Td", "TD":
+				if inText && len(operands) >= 2 {
+					if y, err := strconv.ParseFloat(operands[len(operands)-1], 64); err == nil && y != 0 {
+						out.WriteString("\n")
+					} else {
+						out.WriteString(" ")
+					}
+				}
+			case "T*":
+				if inText {
+					out.WriteString("\n")
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+
+	text := strings.TrimSpace(out.String())
+	if !mostlyPrintable(text) {
+		return ""
+	}
+	return text
+}
+
+// pdfTextArray renders the operand of a TJ operator, treating large kerning
+// adjustments as word breaks.
+func pdfTextArray(operands []string) string {
+	start := -1
+	for i := len(operands) - 1; i >= 0; i-- {
+		if operands[i] == "[" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	for _, op := range operands[start+1:] {
+		if op == "]" {
+			break
+		}
+		if n, err := strconv.ParseFloat(op, 64); err == nil {
+			if n < -200 {
+				out.WriteString(" ")
+			}
+			continue
+		}
+		out.WriteString(op)
+	}
+	return out.String()
+}
+
+func pdfLiteralString(content []byte, pos int) (string, int) {
+	var out strings.Builder
+	depth := 0
+	for pos < len(content) {
+		c := content[pos]
+		switch {
+		case c == '\\' && pos+1 < len(content):
+			pos++
+			switch e := content[pos]; e {
+			case 'n':
+				out.WriteByte('\n')
+			case 'r':
+				out.WriteByte('\r')
+			case 't':
+				out.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					end := pos
+					for end < len(content) && end < pos+3 && content[end] >= '0' && content[end] <= '7' {
+						end++
+					}
+					n, _ := strconv.ParseUint(string(content[pos:end]), 8, 8)
+					out.WriteRune(rune(n))
+					pos = end - 1
+				} else {
+					out.WriteByte(e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				out.WriteByte(c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return out.String(), pos + 1
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteRune(rune(c))
+		}
+		pos++
+	}
+	return out.String(), pos
+}
+
+func pdfHexString(hex []byte) string {
+	digits := make([]byte, 0, len(hex))
+	for _, c := range hex {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	var out strings.Builder
+	for i := 0; i+1 < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return ""
+		}
+		out.WriteRune(rune(n))
+	}
+	return out.String()
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func mostlyPrintable(text string) bool {
+	if text == "" {
+		return false
+	}
+	printable := 0
+	total := 0
+	for _, r := range text {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			printable++
+		}
+	}
+	return printable*10 >= total*9
+}
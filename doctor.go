@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// diagnosis is the outcome of one doctor check.
+type diagnosis struct {
+	level   string // ok, info, warn or fail
+	check   string
+	message string
+}
+
+// doctor collects diagnoses for the pack flags it was given.
+type doctor struct {
+	results []diagnosis
+}
+
+func (d *doctor) report(level, check, format string, args ...any) {
+	d.results = append(d.results, diagnosis{level: level, check: check, message: fmt.Sprintf(format, args...)})
+}
+
+func setupDoctor(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+	daemonConfig := fs.String("daemon-config", "", "Also validate this daemon config file")
+	tenants := fs.String("tenants", "", "Also validate this serve -tenants file")
+
+	return func(args []string) int {
+		if !noArgs("doctor", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		d := &doctor{}
+		d.checkGit(ctx)
+		d.checkClipboard()
+		config, err := pf.config(logger)
+		if err != nil {
+			d.report("fail", "flags", "%v", err)
+		} else {
+			d.report("ok", "flags", "valid")
+		}
+		d.checkInput(*pf.inputPath)
+		d.checkOutput(*pf.outputPath)
+		d.checkFiles(pf)
+		d.checkPatterns(pf)
+		if *daemonConfig != "" {
+			if _, err := loadDaemonContexts(*daemonConfig, time.Hour, logger); err != nil {
+				d.report("fail", "daemon config", "%v", err)
+			} else {
+				d.report("ok", "daemon config", "%s is valid", *daemonConfig)
+			}
+		}
+		if *tenants != "" {
+			if _, err := loadTenants(*tenants, "."); err != nil {
+				d.report("fail", "tenants", "%v", err)
+			} else {
+				d.report("ok", "tenants", "%s is valid", *tenants)
+			}
+		}
+		if config != nil && !isRemoteInput(*pf.inputPath) {
+			d.checkMatches(ctx, config)
+		}
+
+		failed := false
+		for _, r := range d.results {
+			fmt.Printf("%-5s %s: %s\n", r.level, r.check, r.message)
+			failed = failed || r.level == "fail"
+		}
+		if failed {
+			return exitFailure
+		}
+		return exitSuccess
+	}
+}
+
+func (d *doctor) checkGit(ctx context.Context) {
+	if _, err := exec.LookPath("git"); err != nil {
+		d.report("warn", "git", "git is not in PATH; install it to work with git checkouts and repository tooling")
+		return
+	}
+	out, err := exec.CommandContext(ctx, "git", "--version").Output()
+	if err != nil {
+		d.report("warn", "git", "git --version failed: %v", err)
+		return
+	}
+	d.report("ok", "git", "%s", strings.TrimSpace(string(out)))
+}
+
+// clipboardCommands are the commands a context can be piped into to copy
+// it, per platform.
+var clipboardCommands = map[string][]string{
+	"darwin":  {"pbcopy"},
+	"windows": {"clip.exe", "clip"},
+	"linux":   {"wl-copy", "xclip", "xsel", "clip.exe"},
+}
+
+func (d *doctor) checkClipboard() {
+	candidates, ok := clipboardCommands[runtime.GOOS]
+	if !ok {
+		candidates = clipboardCommands["linux"]
+	}
+	for _, name := range candidates {
+		if _, err := exec.LookPath(name); err == nil {
+			usage := name
+			if name == "xclip" {
+				usage = "xclip -selection clipboard"
+			} else if name == "xsel" {
+				usage = "xsel --clipboard --input"
+			}
+			d.report("ok", "clipboard", "copy a context with: contextify -pipe %q", usage)
+			return
+		}
+	}
+	d.report("info", "clipboard", "no clipboard command found (%s); install one to copy contexts with -pipe", strings.Join(candidates, ", "))
+}
+
+func (d *doctor) checkInput(input string) {
+	if isRemoteInput(input) {
+		d.report("info", "input", "%s is remote and not checked", input)
+		return
+	}
+	info, err := os.Stat(input)
+	switch {
+	case err != nil:
+		d.report("fail", "input", "%v", err)
+	case !info.IsDir():
+		d.report("fail", "input", "%s is not a directory", input)
+	default:
+		if _, err := os.ReadDir(input); err != nil {
+			d.report("fail", "input", "cannot list %s: %v", input, err)
+			return
+		}
+		d.report("ok", "input", "%s is a readable directory", input)
+	}
+}
+
+// checkOutput makes sure the output can be created, by creating and
+// removing a temporary file next to it.
+func (d *doctor) checkOutput(output string) {
+	switch {
+	case isObjectStoreURL(output):
+		if _, err := uploadCommand(output, ""); err != nil {
+			d.report("fail", "output", "%v", err)
+		} else {
+			d.report("ok", "output", "%s can be uploaded", output)
+		}
+		return
+	}
+	if info, err := os.Stat(output); err == nil && info.IsDir() {
+		d.report("fail", "output", "%s is a directory; name a file", output)
+		return
+	}
+	dir := filepath.Dir(output)
+	if _, err := os.Stat(dir); err != nil {
+		d.report("fail", "output", "directory of %s: %v", output, err)
+		return
+	}
+	f, err := os.CreateTemp(dir, ".contextify-doctor-*")
+	if err != nil {
+		d.report("fail", "output", "cannot write to %s: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	d.report("ok", "output", "%s is writable", output)
+}
+
+// checkFiles validates the files the flags point to.
+func (d *doctor) checkFiles(pf *packFlags) {
+	if *pf.secretRules != "" {
+		if rules, _, err := loadSecretRules(*pf.secretRules); err != nil {
+			d.report("fail", "secret rules", "%v", err)
+		} else {
+			d.report("ok", "secret rules", "%d rules in %s", len(rules), *pf.secretRules)
+		}
+	}
+	for _, file := range []struct{ flag, path string }{
+		{"prepend-file", *pf.prependFile},
+		{"files-from", *pf.filesFrom},
+		{"from-errors", *pf.fromErrors},
+		{"from-trace", *pf.fromTrace},
+	} {
+		if file.path == "" || file.path == "-" {
+			continue
+		}
+		if f, err := os.Open(file.path); err != nil {
+			d.report("fail", file.flag, "%v", err)
+		} else {
+			f.Close()
+			d.report("ok", file.flag, "%s is readable", file.path)
+		}
+	}
+}
+
+// checkPatterns looks for filters that are valid but do not do what they
+// seem to: globs in -exclude, extensions without a dot and ignore file
+// lines that are skipped.
+func (d *doctor) checkPatterns(pf *packFlags) {
+	for _, dir := range parseCommaSeparated(*pf.excludeDirs) {
+		switch {
+		case strings.ContainsAny(dir, "*?["):
+			d.report("warn", "exclude", "%q is matched literally against directory names and paths, not as a glob; put glob patterns in %s", dir, ignoreFileName)
+		case strings.HasPrefix(dir, "./"), strings.HasSuffix(dir, "/"):
+			d.report("warn", "exclude", "%q never matches: entries are names or paths relative to the input, without ./ or a trailing /", dir)
+		case strings.Contains(dir, "/") && !isRemoteInput(*pf.inputPath):
+			if _, err := os.Stat(filepath.Join(*pf.inputPath, filepath.FromSlash(dir))); err != nil {
+				d.report("warn", "exclude", "%q does not exist below the input", dir)
+			}
+		}
+	}
+	for _, ext := range parseCommaSeparated(*pf.includeExts) {
+		switch {
+		case !strings.HasPrefix(ext, "."):
+			d.report("warn", "extensions", "%q never matches: extensions start with a dot, e.g. .%s", ext, ext)
+		case strings.Count(ext, ".") > 1:
+			d.report("warn", "extensions", "%q never matches: only the last extension counts, e.g. %s", ext, filepath.Ext(ext))
+		}
+	}
+	for _, ext := range parseCommaSeparated(*pf.excludeExts) {
+		if !strings.HasPrefix(ext, ".") {
+			d.report("warn", "exclude-extensions", "%q matches any name ending in it, not just the extension; write .%s", ext, ext)
+		}
+	}
+
+	var files []string
+	if *pf.ignoreFile != "" {
+		files = append(files, *pf.ignoreFile)
+	}
+	if !isRemoteInput(*pf.inputPath) {
+		excluded := createLookupMap(ensureGitExcluded(parseCommaSeparated(*pf.excludeDirs)))
+		_ = filepath.WalkDir(*pf.inputPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(*pf.inputPath, path)
+			if entry.IsDir() && rel != "." && shouldExcludeDir(rel, excluded) {
+				return filepath.SkipDir
+			}
+			if entry.Name() == ignoreFileName {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if _, err := os.Stat(filepath.Join(*pf.inputPath, ".gitignore")); err == nil {
+			d.report("info", "ignore", ".gitignore is not read; copy patterns that should keep files out of the context to %s", ignoreFileName)
+		}
+	}
+	for _, file := range files {
+		d.lintIgnoreFile(file)
+	}
+}
+
+// lintIgnoreFile reports lines of an ignore file that are skipped or
+// cannot match.
+func (d *doctor) lintIgnoreFile(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		d.report("fail", "ignore", "%v", err)
+		return
+	}
+	defer f.Close()
+
+	patterns, problems := 0, 0
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		where := fmt.Sprintf("%s:%d", path, n)
+		switch _, ok := parseGitPattern(".", line); {
+		case !ok:
+			d.report("warn", "ignore", "%s: %q is not a valid pattern and is skipped", where, line)
+		case strings.HasPrefix(strings.TrimPrefix(trimmed, "!"), "./"):
+			d.report("warn", "ignore", "%s: %q never matches; anchor patterns with a leading / instead of ./", where, line)
+		case strings.Contains(trimmed, `\`) && !strings.ContainsAny(trimmed, "/"):
+			d.report("warn", "ignore", "%s: %q uses \\, which escapes the next character; separate directories with /", where, line)
+		default:
+			patterns++
+			continue
+		}
+		problems++
+	}
+	if err := scanner.Err(); err != nil {
+		d.report("fail", "ignore", "failed to read %s: %v", path, err)
+		return
+	}
+	if problems == 0 {
+		d.report("ok", "ignore", "%s: %d patterns", path, patterns)
+	}
+}
+
+// checkMatches walks the input as pack would and reports how many files
+// the filters leave.
+func (d *doctor) checkMatches(ctx context.Context, config *Config) {
+	absPath, err := filepath.Abs(config.inputPath)
+	if err != nil {
+		return
+	}
+	config.progress = newProgressReporter("none", nil)
+	config.result = newRunResult(config)
+	config.logger = config.logger.With("check", "doctor")
+	if config.workspace != "" {
+		if err := resolveWorkspace(absPath, config); err != nil {
+			d.report("fail", "workspace", "%v", err)
+			return
+		}
+	}
+	var files []sourceFile
+	if config.filesFrom != "" && config.filesFrom != "-" {
+		files, err = readFileList(ctx, absPath, config)
+	} else if config.fromErrors != "" && config.fromErrors != "-" {
+		files, err = buildErrorFiles(ctx, absPath, config)
+	} else if config.fromTrace != "" && config.fromTrace != "-" {
+		files, err = stackTraceFiles(ctx, absPath, config)
+	} else if config.filesFrom == "" && config.fromErrors == "" && config.fromTrace == "" {
+		files, err = collectFiles(ctx, absPath, config)
+	} else {
+		return
+	}
+	switch {
+	case err != nil:
+		d.report("fail", "files", "%v", err)
+	case len(files) == 0:
+		d.report("warn", "files", "none of the %d files scanned match the filters", config.result.FilesScanned)
+	default:
+		d.report("ok", "files", "%d of %d files scanned match the filters", len(files), config.result.FilesScanned)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var packModes = []string{"full", "docs"}
+
+var docFileExtensions = []string{".md", ".markdown", ".mdx", ".rst", ".txt", ".adoc", ".org"}
+
+// docView reduces a file to its documentation for -mode docs: prose files
+// are kept whole, source files shrink to doc comments and the signatures of
+// exported declarations. It reports false for files with no documentation.
+func docView(src sourceFile, data []byte) ([]byte, bool, error) {
+	ext := strings.ToLower(filepath.Ext(src.path))
+	base := strings.ToUpper(filepath.Base(src.path))
+	switch {
+	case hasExtension(docFileExtensions...)(src), ext == "" && (strings.HasPrefix(base, "README") || base == "CHANGELOG"):
+		return data, true, nil
+	case ext == ".go":
+		out, err := goDocView(data)
+		return out, len(out) > 0, err
+	case ext == ".py" || ext == ".pyi":
+		out := pythonDocView(data)
+		return out, len(out) > 0, nil
+	case isSourceExtension(ext):
+		out := commentDocView(data)
+		return out, len(out) > 0, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// goDocView keeps the package doc and clause and the exported declarations
+// with their doc comments. Function bodies are left out; exported types are
+// kept whole.
+func goDocView(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	text := func(from, to token.Pos) []byte {
+		return src[fset.Position(from).Offset:fset.Position(to).Offset]
+	}
+
+	var out bytes.Buffer
+	if file.Doc != nil {
+		out.Write(text(file.Doc.Pos(), file.Doc.End()))
+		out.WriteString("\n")
+	}
+	out.WriteString("package " + file.Name.Name + "\n")
+
+	found := file.Doc != nil
+	for _, decl := range file.Decls {
+		var doc *ast.CommentGroup
+		var body []byte
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() || d.Recv != nil && !ast.IsExported(receiverName(d)) {
+				continue
+			}
+			doc = d.Doc
+			end := d.End()
+			if d.Body != nil {
+				end = d.Body.Lbrace
+			}
+			body = bytes.TrimSpace(text(d.Pos(), end))
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT || !exportsName(d) {
+				continue
+			}
+			doc = d.Doc
+			body = text(d.Pos(), d.End())
+		default:
+			continue
+		}
+
+		out.WriteString("\n")
+		if doc != nil {
+			out.Write(text(doc.Pos(), doc.End()))
+			out.WriteString("\n")
+		}
+		out.Write(body)
+		out.WriteString("\n")
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return out.Bytes(), nil
+}
+
+func exportsName(d *ast.GenDecl) bool {
+	for _, spec := range d.Specs {
+		switch sp := spec.(type) {
+		case *ast.TypeSpec:
+			if sp.Name.IsExported() {
+				return true
+			}
+		case *ast.ValueSpec:
+			for _, name := range sp.Names {
+				if name.IsExported() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+var pythonDefPattern = regexp.MustCompile(`^(\s*)(?:async\s+)?(?:def|class)\s+(\w+)`)
+
+// pythonDocView keeps the module docstring and the public classes and
+// functions with their docstrings.
+func pythonDocView(src []byte) []byte {
+	lines := strings.SplitAfter(string(src), "\n")
+	var out strings.Builder
+
+	// docstring copies the docstring starting at or after line i, if any
+	docstring := func(i int) {
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+		if i >= len(lines) {
+			return
+		}
+		first := strings.TrimSpace(lines[i])
+		quote := ""
+		for _, q := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(strings.TrimLeft(first, "rRuU"), q) {
+				quote = q
+			}
+		}
+		if quote == "" {
+			return
+		}
+		for j := i; j < len(lines); j++ {
+			out.WriteString(lines[j])
+			rest := strings.TrimSpace(lines[j])
+			if j == i {
+				rest = rest[strings.Index(rest, quote)+len(quote):]
+			}
+			if strings.Contains(rest, quote) {
+				return
+			}
+		}
+	}
+
+	docstring(0)
+	for i := 0; i < len(lines); i++ {
+		m := pythonDefPattern.FindStringSubmatch(lines[i])
+		if m == nil || strings.HasPrefix(m[2], "_") && m[2] != "__init__" {
+			continue
+		}
+		// Decorators belong to the signature
+		start := i
+		for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "@") {
+			start--
+		}
+		// Signatures may span lines up to the colon that opens the body
+		end := i
+		for end < len(lines)-1 && !strings.HasSuffix(strings.TrimSpace(lines[end]), ":") {
+			end++
+		}
+		for _, line := range lines[start : end+1] {
+			out.WriteString(line)
+		}
+		docstring(end + 1)
+		out.WriteString("\n")
+		i = end
+	}
+	return []byte(out.String())
+}
+
+var publicSignaturePattern = regexp.MustCompile(`^\s*(?:export|public|pub(?:\([a-z]+\))?)\s`)
+
+// commentDocView is the language-agnostic fallback: doc comment blocks
+// (/** */, ///, //!) and the declaration line after each, plus the
+// signatures of public declarations without one.
+func commentDocView(src []byte) []byte {
+	lines := strings.SplitAfter(string(src), "\n")
+	var out strings.Builder
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(trimmed, "/**"):
+			for ; i < len(lines); i++ {
+				out.WriteString(lines[i])
+				if strings.Contains(lines[i], "*/") {
+					break
+				}
+			}
+		case strings.HasPrefix(trimmed, "///"), strings.HasPrefix(trimmed, "//!"):
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if !strings.HasPrefix(t, "///") && !strings.HasPrefix(t, "//!") {
+					i--
+					break
+				}
+				out.WriteString(lines[i])
+			}
+		case publicSignaturePattern.MatchString(lines[i]) && signaturePattern.MatchString(lines[i]):
+			out.WriteString(signatureLine(lines[i]))
+			continue
+		default:
+			continue
+		}
+
+		// The declaration the comment documents
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "" {
+			i++
+		}
+		if i+1 < len(lines) {
+			i++
+			out.WriteString(signatureLine(lines[i]))
+		}
+		out.WriteString("\n")
+	}
+	return []byte(out.String())
+}
+
+// signatureLine drops an opening body from a declaration line.
+func signatureLine(line string) string {
+	if idx := strings.Index(line, "{"); idx > 0 {
+		return strings.TrimRight(line[:idx], " \t") + "\n"
+	}
+	return line
+}
+
+var sourceExtensions = []string{
+	".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".java", ".kt", ".kts", ".scala", ".rs", ".c", ".h",
+	".cc", ".cpp", ".hpp", ".cs", ".swift", ".php", ".dart", ".groovy",
+}
+
+func isSourceExtension(ext string) bool {
+	for _, e := range sourceExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const dupesMarker = "## Duplicate Code"
+
+// dupeShingle is the number of significant lines a duplicate block has at
+// least.
+const dupeShingle = 6
+
+// maxDupeFileSize keeps generated and data files out of the comparison.
+const maxDupeFileSize = 1 << 20
+
+// duplicateBlock is a run of lines of a file that an earlier file in the
+// output already has.
+type duplicateBlock struct {
+	path     string
+	from, to int // lines in path
+	same     string
+	sameFrom int
+	sameTo   int
+}
+
+type dupeLine struct {
+	text string
+	line int
+}
+
+// findDuplicateBlocks compares the files in output order by shingles of
+// dupeShingle significant lines, whitespace trimmed, and returns the blocks
+// of each file that repeat an earlier file, extended as far as they match.
+// Blank lines, comment lines and lines of only brackets are left out of
+// the comparison, so license headers and closing braces do not count.
+func findDuplicateBlocks(ctx context.Context, files []sourceFile, config *Config) ([]duplicateBlock, error) {
+	type position struct{ file, index int }
+	first := make(map[uint64]position)
+	lines := make([][]dupeLine, len(files))
+	var blocks []duplicateBlock
+
+	for fi, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if size := fileSize(file.path); size == 0 || size > maxDupeFileSize {
+			continue
+		}
+		data, err := os.ReadFile(file.path)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			continue
+		}
+		lines[fi] = significantLines(data)
+		sig := lines[fi]
+
+		for j := 0; j+dupeShingle <= len(sig); {
+			pos, ok := first[shingleHash(sig[j:j+dupeShingle])]
+			if !ok {
+				j++
+				continue
+			}
+			other := lines[pos.file]
+			n := 0
+			for j+n < len(sig) && pos.index+n < len(other) && sig[j+n].text == other[pos.index+n].text {
+				n++
+			}
+			if n < dupeShingle {
+				// A hash collision
+				j++
+				continue
+			}
+			blocks = append(blocks, duplicateBlock{
+				path:     file.relPath,
+				from:     sig[j].line,
+				to:       sig[j+n-1].line,
+				same:     files[pos.file].relPath,
+				sameFrom: other[pos.index].line,
+				sameTo:   other[pos.index+n-1].line,
+			})
+			j += n
+		}
+
+		// Only blocks of earlier files count, so a file's own repetition
+		// is left alone
+		for j := 0; j+dupeShingle <= len(sig); j++ {
+			h := shingleHash(sig[j : j+dupeShingle])
+			if _, ok := first[h]; !ok {
+				first[h] = position{fi, j}
+			}
+		}
+	}
+	if len(blocks) > 0 {
+		config.logger.Debug("Found duplicate code", "blocks", len(blocks))
+	}
+	return blocks, nil
+}
+
+func significantLines(data []byte) []dupeLine {
+	var sig []dupeLine
+	for n, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || !strings.ContainsFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			continue
+		}
+		if strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "/*") ||
+			strings.HasPrefix(text, "*") || strings.HasPrefix(text, "--") || strings.HasPrefix(text, "<!--") {
+			continue
+		}
+		sig = append(sig, dupeLine{text: text, line: n + 1})
+	}
+	return sig
+}
+
+func shingleHash(lines []dupeLine) uint64 {
+	h := fnv.New64a()
+	for _, l := range lines {
+		h.Write([]byte(l.text))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+// collapseDuplicates replaces the duplicate blocks of a file with a line
+// pointing at the earlier copy. The blocks refer to the file as written.
+func collapseDuplicates(data []byte, blocks []duplicateBlock) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	var out strings.Builder
+	next := 0
+	for _, b := range blocks {
+		if b.from-1 < next || b.to > len(lines) {
+			continue
+		}
+		for _, line := range lines[next : b.from-1] {
+			out.WriteString(line)
+		}
+		indent := lines[b.from-1][:len(lines[b.from-1])-len(strings.TrimLeft(lines[b.from-1], " \t"))]
+		fmt.Fprintf(&out, "%s... [lines %d-%d duplicate %s:%d-%d] ...\n", indent, b.from, b.to, b.same, b.sameFrom, b.sameTo)
+		next = b.to
+	}
+	for _, line := range lines[next:] {
+		out.WriteString(line)
+	}
+	return []byte(out.String())
+}
+
+// writeDuplicatesSection lists the duplicate blocks, a map of what could be
+// shared.
+func writeDuplicatesSection(writer *bufio.Writer, blocks []duplicateBlock, collapsed bool, config *Config) error {
+	lines := 0
+	for _, b := range blocks {
+		lines += b.to - b.from + 1
+	}
+	note := ""
+	if collapsed {
+		note = ", collapsed"
+	}
+	if _, err := fmt.Fprintf(writer, "%s (%d blocks, %d lines%s)\n```\n", dupesMarker, len(blocks), lines, note); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if _, err := fmt.Fprintf(writer, "%s:%d-%d duplicates %s:%d-%d (%d lines)\n",
+			config.displayPath(b.path), b.from, b.to, config.displayPath(b.same), b.sameFrom, b.sameTo, b.to-b.from+1); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
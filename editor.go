@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+var editorMethods = []string{"initialize", "pack", "packRelated", "explain", "shutdown", "exit"}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// editorParams are the parameters common to the pack methods: pack flags
+// by name, as in a serve request, and for pack the files of the selection,
+// relative to the root and with optional line ranges (path:120-240).
+type editorParams struct {
+	Flags map[string]any `json:"flags"`
+	Files []string       `json:"files"`
+	File  string         `json:"file"`  // packRelated, relative to the input
+	Depth int            `json:"depth"` // packRelated, default 1
+	Paths []string       `json:"paths"` // explain
+}
+
+type editorPackResult struct {
+	Context string     `json:"context"`
+	Result  *runResult `json:"result"`
+}
+
+type editorExplanation struct {
+	Path     string   `json:"path"`
+	Included bool     `json:"included"`
+	Reasons  []string `json:"reasons"`
+}
+
+// editorServer answers the requests of an editor extension over stdio.
+// Requests run one at a time, so runs share the process and its caches,
+// such as loaded tokenizers, but no state.
+type editorServer struct {
+	root   string
+	logger *slog.Logger
+	out    *bufio.Writer
+}
+
+func setupEditor(fs *flag.FlagSet) func(args []string) int {
+	root := fs.String("root", ".", "Workspace root that request paths and the input flag are resolved against")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		if !noArgs("editor", args) {
+			return exitFailure
+		}
+		// Logs go to stderr or -log-file; stdout carries the protocol
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		absRoot, err := filepath.Abs(*root)
+		if err != nil {
+			logger.Error("Failed to get absolute path", "error", err)
+			return exitFailure
+		}
+		ctx, stop := signalContext()
+		defer stop()
+
+		s := &editorServer{root: absRoot, logger: logger, out: bufio.NewWriter(os.Stdout)}
+		logger.Info("Serving editor requests on stdio", "root", absRoot)
+		if err := s.serve(ctx, bufio.NewReader(os.Stdin)); err != nil {
+			logger.Error("Failed to serve editor requests", "error", err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+}
+
+// serve reads requests until exit or the end of input. Messages are framed
+// as in the Language Server Protocol, with a Content-Length header, or
+// else one JSON object per line; responses use the framing of the request.
+func (s *editorServer) serve(ctx context.Context, in *bufio.Reader) error {
+	for {
+		body, framed, err := readRPCMessage(in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(framed, rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rpcErr := s.handle(ctx, req)
+		if req.ID == nil {
+			// A notification gets no response
+			continue
+		}
+		s.reply(framed, rpcResponse{ID: req.ID, Result: result, Error: rpcErr})
+	}
+}
+
+func readRPCMessage(in *bufio.Reader) ([]byte, bool, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return nil, false, err
+	}
+	value, ok := strings.CutPrefix(strings.TrimSpace(line), "Content-Length:")
+	if !ok {
+		return []byte(line), false, nil
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid Content-Length %q", value)
+	}
+	// Other headers end at a blank line
+	for {
+		header, err := in.ReadString('\n')
+		if err != nil {
+			return nil, true, err
+		}
+		if strings.TrimSpace(header) == "" {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(in, body); err != nil {
+		return nil, true, err
+	}
+	return body, true, nil
+}
+
+func (s *editorServer) reply(framed bool, resp rpcResponse) {
+	resp.JSONRPC = "2.0"
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(rpcResponse{JSONRPC: "2.0", ID: resp.ID, Error: &rpcError{rpcInternalError, err.Error()}})
+	}
+	if framed {
+		fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(data))
+		s.out.Write(data)
+	} else {
+		s.out.Write(data)
+		s.out.WriteByte('\n')
+	}
+	if err := s.out.Flush(); err != nil {
+		s.logger.Debug("Failed to write response", "error", err)
+	}
+}
+
+func (s *editorServer) handle(ctx context.Context, req rpcRequest) (any, *rpcError) {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return nil, &rpcError{rpcInvalidRequest, "expected a JSON-RPC 2.0 request"}
+	}
+	var params editorParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]any{"name": "contextify", "version": version, "formatVersion": formatVersion, "methods": editorMethods}, nil
+	case "shutdown":
+		return map[string]any{}, nil
+	case "pack":
+		return s.pack(ctx, params, params.Files, nil)
+	case "packRelated":
+		if params.File == "" {
+			return nil, &rpcError{rpcInvalidParams, "packRelated requires file"}
+		}
+		depth := params.Depth
+		if depth <= 0 {
+			depth = 1
+		}
+		return s.pack(ctx, params, nil, map[string]string{"seed": params.File, "expand-depth": strconv.Itoa(depth)})
+	case "explain":
+		return s.explain(ctx, params)
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+// packFlags parses the flags of a request, with the input resolved against
+// the root. Flags that only make sense on the command line are refused, as
+// serve refuses them.
+func (s *editorServer) packFlags(params editorParams, extra map[string]string) (*packFlags, error) {
+	fs := flag.NewFlagSet("editor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	pf := registerPackFlags(fs)
+	set := func(name, value string) error {
+		if fs.Lookup(name) == nil || !requestFlags[name] {
+			return fmt.Errorf("unsupported flag %q", name)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid flag %q: %w", name, err)
+		}
+		return nil
+	}
+	for name, value := range params.Flags {
+		if err := set(name, fmt.Sprint(value)); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range extra {
+		if err := set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if !filepath.IsAbs(*pf.inputPath) {
+		*pf.inputPath = filepath.Join(s.root, *pf.inputPath)
+	}
+	*pf.progress = "none"
+	return pf, nil
+}
+
+func (s *editorServer) pack(ctx context.Context, params editorParams, files []string, extra map[string]string) (any, *rpcError) {
+	pf, err := s.packFlags(params, extra)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	config, err := pf.config(s.logger)
+	if err == nil {
+		var args []string
+		for _, file := range files {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(s.root, file)
+			}
+			args = append(args, file)
+		}
+		err = config.setFileArgs(args)
+	}
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+
+	var buf bytes.Buffer
+	config.outputWriter = &buf
+	code, err := pack(ctx, config, "none", "")
+	if code == exitFailure || code == exitCancelled {
+		return nil, &rpcError{rpcInternalError, err.Error()}
+	}
+	return editorPackResult{Context: buf.String(), Result: config.result}, nil
+}
+
+func (s *editorServer) explain(ctx context.Context, params editorParams) (any, *rpcError) {
+	if len(params.Paths) == 0 {
+		return nil, &rpcError{rpcInvalidParams, "explain requires paths"}
+	}
+	pf, err := s.packFlags(params, nil)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if _, err := pf.config(s.logger); err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	explanations := make([]editorExplanation, 0, len(params.Paths))
+	for _, path := range params.Paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.root, path)
+		}
+		e, err := explainPath(ctx, pf, path, s.logger)
+		if err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		explanations = append(explanations, editorExplanation{Path: e.path, Included: e.included, Reasons: e.reasons})
+	}
+	return explanations, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var undecodablePolicies = []string{"skip", "replace", "raw"}
+
+// decodeText converts data to UTF-8 and strips any byte order mark. It
+// recognises UTF-8, UTF-16 (with a BOM or by the distribution of zero bytes)
+// and falls back to Windows-1252, a superset of Latin-1, for text that is
+// not valid UTF-8. It returns the detected encoding name, or "" when the
+// content looks binary and could not be decoded.
+func decodeText(data []byte) ([]byte, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+		if utf8.Valid(data) {
+			return data, "utf-8"
+		}
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		if decoded, err := decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), data); err == nil {
+			return decoded, "utf-16"
+		}
+	}
+
+	// NUL bytes are valid UTF-8 but only occur in binary data or UTF-16
+	if utf8.Valid(data) && bytes.IndexByte(data, 0) < 0 {
+		return data, "utf-8"
+	}
+
+	if order, ok := guessUTF16(data); ok {
+		if decoded, err := decodeWith(unicode.UTF16(order, unicode.IgnoreBOM), data); err == nil {
+			return decoded, "utf-16"
+		}
+	}
+
+	if looksBinary(data) {
+		return nil, ""
+	}
+	if decoded, err := decodeWith(charmap.Windows1252, data); err == nil {
+		return decoded, "windows-1252"
+	}
+	return nil, ""
+}
+
+func decodeWith(enc encoding.Encoding, data []byte) ([]byte, error) {
+	return enc.NewDecoder().Bytes(data)
+}
+
+// guessUTF16 detects BOM-less UTF-16 text, where most characters are ASCII
+// and therefore every other byte is zero.
+func guessUTF16(data []byte) (unicode.Endianness, bool) {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return unicode.LittleEndian, false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(data) / 2
+	switch {
+	case oddZeros*10 >= pairs*4 && evenZeros*10 < pairs:
+		return unicode.LittleEndian, true
+	case evenZeros*10 >= pairs*4 && oddZeros*10 < pairs:
+		return unicode.BigEndian, true
+	}
+	return unicode.LittleEndian, false
+}
+
+// looksBinary reports whether data contains NUL bytes or a high share of
+// control characters.
+func looksBinary(data []byte) bool {
+	sample := data
+	if len(sample) > 8192 {
+		sample = sample[:8192]
+	}
+	if len(sample) == 0 {
+		return false
+	}
+	control := 0
+	for _, b := range sample {
+		if b == 0 {
+			return true
+		}
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\b' && b != 0x1b {
+			control++
+		}
+	}
+	return control*10 > len(sample)
+}
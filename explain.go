@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// explanation is why explain's path would or would not be packed.
+type explanation struct {
+	path     string
+	included bool
+	reasons  []string
+}
+
+func setupExplain(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		if len(args) == 0 {
+			logger.Error("Expected at least one path to explain")
+			return exitFailure
+		}
+		if isRemoteInput(*pf.inputPath) || *pf.filesFrom != "" || *pf.fromErrors != "" || *pf.fromTrace != "" {
+			logger.Error("explain needs a local input directory to walk, not a remote input, -files-from, -from-errors or -from-trace")
+			return exitFailure
+		}
+		if _, err := pf.config(logger); err != nil {
+			logger.Error("Invalid flags", "error", err)
+			return exitFailure
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		code := exitSuccess
+		for _, arg := range args {
+			e, err := explainPath(ctx, pf, arg, logger)
+			if err != nil {
+				logger.Error("Failed to explain path", "path", arg, "error", err)
+				code = exitFailure
+				continue
+			}
+			verdict := "excluded"
+			if e.included {
+				verdict = "included"
+			}
+			fmt.Printf("%s: %s\n", e.path, verdict)
+			for _, reason := range e.reasons {
+				fmt.Printf("  %s\n", reason)
+			}
+		}
+		return code
+	}
+}
+
+// explainPath follows a path, relative to the working directory, through
+// the walk, the content transforms and the token budget, as pack would.
+// Each stage builds a fresh config so that run state does not carry over.
+func explainPath(ctx context.Context, pf *packFlags, arg string, logger *slog.Logger) (*explanation, error) {
+	config, err := explainConfig(pf, logger)
+	if err != nil {
+		return nil, err
+	}
+	absInput, err := filepath.Abs(config.inputPath)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(arg)
+	if err != nil {
+		return nil, err
+	}
+	relPath, err := filepath.Rel(absInput, absPath)
+	if err != nil || !filepath.IsLocal(relPath) {
+		return nil, fmt.Errorf("%s is not below the input %s", arg, config.inputPath)
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return nil, err
+	}
+	relPath = nfc(relPath)
+	e := &explanation{path: filepath.ToSlash(relPath)}
+
+	// The walk stops at the first reason to skip the path or a directory
+	// above it
+	config.walkOnly = relPath
+	config.trace = func(skipped, reason string) {
+		if skipped == relPath || strings.HasPrefix(relPath, skipped+string(filepath.Separator)) {
+			e.reasons = append(e.reasons, filepath.ToSlash(skipped)+": "+reason)
+		}
+	}
+	files, err := collectFiles(ctx, absInput, config)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.reasons) > 0 {
+		return e, nil
+	}
+	if info.IsDir() {
+		e.included = true
+		e.reasons = append(e.reasons, "the walk descends into this directory")
+		return e, nil
+	}
+	i := slices.IndexFunc(files, func(f sourceFile) bool { return f.relPath == e.path })
+	if i < 0 {
+		e.reasons = append(e.reasons, "not a regular file the walk picks up")
+		return e, nil
+	}
+	file := files[i]
+	e.reasons = append(e.reasons, filterReason(config, relPath))
+
+	if len(config.seeds) > 0 {
+		reached, err := explainSeeds(ctx, pf, absInput, e.path, logger)
+		if err != nil {
+			return nil, err
+		}
+		if !reached {
+			e.reasons = append(e.reasons, fmt.Sprintf("not reached from -seed %s within -expand-depth %d", strings.Join(config.seeds, ","), config.expandDepth))
+			return e, nil
+		}
+		e.reasons = append(e.reasons, fmt.Sprintf("reached from -seed %s within -expand-depth %d", strings.Join(config.seeds, ","), config.expandDepth))
+	}
+
+	if config.trimFixtures && fixtureDir(e.path) != "" {
+		kept, err := explainFixtures(ctx, pf, absInput, e.path, logger)
+		if err != nil {
+			return nil, err
+		}
+		if !kept {
+			e.reasons = append(e.reasons, "a fixture, and -trim-fixtures keeps another file of "+fixtureDir(e.path))
+			return e, nil
+		}
+		e.reasons = append(e.reasons, "the representative -trim-fixtures keeps of "+fixtureDir(e.path))
+	}
+
+	if dir := migrationDir(e.path); config.sqlSchema && dir != "" && strings.EqualFold(filepath.Ext(e.path), ".sql") {
+		e.included = true
+		e.reasons = append(e.reasons, fmt.Sprintf("folded into the SQL schema of %s rather than packed as a file", dir))
+		return e, nil
+	}
+
+	if limits := budgetLimits(config); limits.limited() {
+		kept, err := explainBudget(ctx, pf, absInput, e.path, logger)
+		if err != nil {
+			return nil, err
+		}
+		var budgets []string
+		for m, flagName := range []string{"-max-tokens", "-max-chars", "-max-lines"} {
+			if limits[m] > 0 {
+				budgets = append(budgets, fmt.Sprintf("%s %d", flagName, limits[m]))
+			}
+		}
+		if !kept {
+			e.reasons = append(e.reasons, "left out to stay within "+strings.Join(budgets, " and "))
+			return e, nil
+		}
+		e.reasons = append(e.reasons, "fits within "+strings.Join(budgets, " and "))
+	}
+
+	if len(config.symbols) > 0 {
+		config.symbolSelector = newSymbolSelector(config.symbols, files, config.logger)
+	}
+	config.transforms = buildTransforms(config)
+	dropped := ""
+	for i := range config.transforms {
+		t := &config.transforms[i]
+		if apply := t.apply; apply != nil {
+			t.apply = func(src sourceFile, data []byte) ([]byte, bool, error) {
+				out, keep, err := apply(src, data)
+				if !keep && err == nil {
+					dropped = t.name
+				}
+				return out, keep, err
+			}
+		}
+	}
+	counter := &tokenCounter{bpe: config.tokenizer}
+	writer := bufio.NewWriter(counter)
+	written, err := processFile(ctx, file, writer, config)
+	var skipped *skipError
+	switch {
+	case errors.As(err, &skipped):
+		e.reasons = append(e.reasons, "skipped when read: "+err.Error())
+		return e, nil
+	case err != nil:
+		return nil, err
+	case !written:
+		e.reasons = append(e.reasons, fmt.Sprintf("left out by the %s transform", dropped))
+		return e, nil
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	e.included = true
+	size := info.Size()
+	if config.maxFileSize > 0 && size > config.maxFileSize {
+		e.reasons = append(e.reasons, fmt.Sprintf("truncated: %s is over -max-file-size %s (-truncate %s)", formatBytes(size), formatBytes(config.maxFileSize), config.truncate))
+	}
+	if config.maxMemory > 0 && size > config.maxMemory {
+		e.reasons = append(e.reasons, fmt.Sprintf("%s is over -max-memory %s: streamed if its transforms allow, otherwise -over-memory %s", formatBytes(size), formatBytes(config.maxMemory), config.overMemory))
+	}
+	e.reasons = append(e.reasons, fmt.Sprintf("~%d tokens in the output", counter.tokens()))
+	return e, nil
+}
+
+// explainConfig builds a config for one explain stage, with the side
+// effects of a real run turned off.
+func explainConfig(pf *packFlags, logger *slog.Logger) (*Config, error) {
+	config, err := pf.config(logger)
+	if err != nil {
+		return nil, err
+	}
+	config.progress = newProgressReporter("none", nil)
+	config.result = newRunResult(config)
+	config.todos = nil
+	config.symbolIndex = nil
+	config.apiSurface = nil
+	config.issueRefs = nil
+	if config.workspace != "" {
+		absInput, err := filepath.Abs(config.inputPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := resolveWorkspace(absInput, config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// filterReason says which filter let a walked file through.
+func filterReason(config *Config, relPath string) string {
+	switch {
+	case len(config.includeMap) == 0:
+		return "no -extensions filter applies"
+	case shouldIncludeFile(relPath, config.includeMap):
+		return fmt.Sprintf("extension %q is in -extensions", filepath.Ext(relPath))
+	case matchesName(relPath, config.includeNames):
+		return "name is kept by -include-names or as a well-known file"
+	case config.stripConfigValues && infraConfigKind(relPath) != "":
+		return "kept by -strip-config-values as infrastructure configuration"
+	case config.images != "" && isImageFile(relPath):
+		return "kept by -images as an image"
+	default:
+		return "name is in -always-include"
+	}
+}
+
+// explainBudget reports whether path survives the budgets, which
+// needs every file of the walk.
+func explainBudget(ctx context.Context, pf *packFlags, absInput, path string, logger *slog.Logger) (bool, error) {
+	config, err := explainConfig(pf, logger)
+	if err != nil {
+		return false, err
+	}
+	files, err := collectFiles(ctx, absInput, config)
+	if err != nil {
+		return false, err
+	}
+	files = dropDuplicateFiles(files, config)
+	if len(config.seeds) > 0 {
+		if files, err = expandSeeds(absInput, files, config); err != nil {
+			return false, err
+		}
+	}
+	if config.trimFixtures {
+		files, _ = trimFixtures(files, config)
+	}
+	if len(config.symbols) > 0 {
+		config.symbolSelector = newSymbolSelector(config.symbols, files, config.logger)
+	}
+	config.transforms = buildTransforms(config)
+	sizes, err := measureFiles(ctx, files, config)
+	if err != nil {
+		return false, err
+	}
+	kept, _ := applyBudget(files, sizes, budgetLimits(config), config.budget)
+	return slices.ContainsFunc(kept, func(f sourceFile) bool { return f.relPath == path }), nil
+}
+
+// explainFixtures reports whether path is the fixture -trim-fixtures keeps
+// of its directory, which needs every file of the walk.
+func explainFixtures(ctx context.Context, pf *packFlags, absInput, path string, logger *slog.Logger) (bool, error) {
+	config, err := explainConfig(pf, logger)
+	if err != nil {
+		return false, err
+	}
+	files, err := collectFiles(ctx, absInput, config)
+	if err != nil {
+		return false, err
+	}
+	files = dropDuplicateFiles(files, config)
+	if len(config.seeds) > 0 {
+		if files, err = expandSeeds(absInput, files, config); err != nil {
+			return false, err
+		}
+	}
+	files, _ = trimFixtures(files, config)
+	return slices.ContainsFunc(files, func(f sourceFile) bool { return f.relPath == path }), nil
+}
+
+// explainSeeds reports whether path is reached from the -seed files, which
+// needs every file of the walk.
+func explainSeeds(ctx context.Context, pf *packFlags, absInput, path string, logger *slog.Logger) (bool, error) {
+	config, err := explainConfig(pf, logger)
+	if err != nil {
+		return false, err
+	}
+	files, err := collectFiles(ctx, absInput, config)
+	if err != nil {
+		return false, err
+	}
+	files, err = expandSeeds(absInput, dropDuplicateFiles(files, config), config)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(files, func(f sourceFile) bool { return f.relPath == path }), nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const fileMapMarker = "## Map"
+
+// mapDescriptionLimit caps a description at about two lines.
+const mapDescriptionLimit = 160
+
+// writeFileMap writes the -map section: the packed files as a tree with a
+// short description of each directory and file, so a reader can find their
+// way before the contents start. Descriptions come from the first doc
+// comment of a file or the first paragraph of a document, and for
+// directories from their README or Go package comment. With -summarize,
+// files large enough to be summarized are described by their summary.
+func writeFileMap(w io.Writer, absPath string, files []sourceFile, config *Config) error {
+	paths := make([]string, len(files))
+	byPath := make(map[string]sourceFile, len(files))
+	for i, file := range files {
+		paths[i] = filepath.ToSlash(file.relPath)
+		byPath[paths[i]] = file
+	}
+	sort.Strings(paths)
+
+	var out bytes.Buffer
+	out.WriteString(fileMapMarker + "\n\n")
+	described := make(map[string]bool)
+	for _, p := range paths {
+		dir := path.Dir(p)
+		// Open the directories not yet listed, outermost first
+		var open []string
+		for d := dir; d != "." && !described[d]; d = path.Dir(d) {
+			open = append(open, d)
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			d := open[i]
+			described[d] = true
+			writeMapEntry(&out, d, path.Base(d)+"/", directoryDescription(filepath.Join(absPath, filepath.FromSlash(d))))
+		}
+		writeMapEntry(&out, p, path.Base(p), fileDescription(byPath[p], config))
+	}
+	out.WriteString("\n")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func writeMapEntry(out *bytes.Buffer, p, name, description string) {
+	indent := strings.Repeat("  ", strings.Count(p, "/"))
+	if description == "" {
+		fmt.Fprintf(out, "%s- %s\n", indent, name)
+		return
+	}
+	fmt.Fprintf(out, "%s- %s: %s\n", indent, name, description)
+}
+
+// directoryDescription describes a directory by its README, or else the
+// package comment of its Go files.
+func directoryDescription(dir string) string {
+	for _, name := range []string{"README.md", "README", "README.rst", "README.txt", "readme.md"} {
+		if data := readHead(filepath.Join(dir, name)); data != nil {
+			if description := documentDescription(data); description != "" {
+				return description
+			}
+		}
+	}
+	if data := readHead(filepath.Join(dir, "doc.go")); data != nil {
+		return commentDescription(data)
+	}
+	return ""
+}
+
+func fileDescription(src sourceFile, config *Config) string {
+	if s := config.summarizer; s != nil && !isImageFile(src.path) && fileSize(src.path) >= s.over {
+		if summary := summaryOf(src, config); summary != "" {
+			return summary
+		}
+	}
+	data := readHead(src.path)
+	if data == nil {
+		return ""
+	}
+	switch strings.ToLower(filepath.Ext(src.path)) {
+	case ".md", ".markdown", ".rst", ".txt", ".adoc":
+		return documentDescription(data)
+	}
+	return commentDescription(data)
+}
+
+// summaryOf runs a file through the transforms to take the summary
+// -summarize gives it. The summary is cached, so the file's own pass
+// later does not ask again.
+func summaryOf(src sourceFile, config *Config) string {
+	f, err := os.Open(src.path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	r, keep, err := transformContent(src, f, config)
+	if err != nil || !keep {
+		return ""
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || !bytes.HasPrefix(data, []byte("[summary of ")) {
+		return ""
+	}
+	_, summary, _ := strings.Cut(string(data), "\n")
+	summary, _, _ = strings.Cut(summary, "\n[full content]\n")
+	return shortDescription(summary)
+}
+
+// readHead reads the start of a file, which is where descriptions are.
+func readHead(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, 64*1024))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+var markdownNoise = regexp.MustCompile(`^(\s*$|#|!\[|\[!\[|<|=+$|-+$|\*+$|\.\. |:)`)
+
+// documentDescription takes the first paragraph of a document that is not
+// a heading, badge or HTML, or else its first heading.
+func documentDescription(data []byte) string {
+	heading := ""
+	var paragraph []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if markdownNoise.MatchString(line) {
+			if len(paragraph) > 0 {
+				break
+			}
+			if heading == "" && strings.HasPrefix(line, "#") {
+				heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			}
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	if len(paragraph) == 0 {
+		return shortDescription(heading)
+	}
+	return shortDescription(strings.Join(paragraph, " "))
+}
+
+var commentLine = regexp.MustCompile(`^\s*(//+|#+|--|;+|\*+|/\*+|\*/)\s?`)
+
+// commentDescription takes the first comment block of a source file after
+// any license header, skipping shebangs and directives such as //go:build.
+func commentDescription(data []byte) string {
+	data = stripLicenseHeader(data)
+	var block []string
+	inBlock, inDocstring := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 0; scanner.Scan() && n < 200; n++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		switch {
+		case inDocstring:
+			end := strings.Contains(line, `"""`) || strings.Contains(line, "'''")
+			block = append(block, strings.Trim(line, `"' `))
+			if end {
+				return shortDescription(strings.Join(block, " "))
+			}
+			continue
+		case strings.HasPrefix(line, `"""`) || strings.HasPrefix(line, "'''"):
+			// A Python module docstring
+			rest := strings.TrimSpace(line[3:])
+			if end := strings.Index(rest, line[:3]); end >= 0 {
+				return shortDescription(rest[:end])
+			}
+			block, inDocstring = append(block, rest), true
+			continue
+		case strings.HasPrefix(line, "#!") || strings.HasPrefix(line, "//go:") || strings.HasPrefix(line, "// +build") ||
+			strings.HasPrefix(line, "# -*-") || strings.HasPrefix(line, "#include") || strings.HasPrefix(line, "#define") ||
+			strings.HasPrefix(line, "#pragma") || strings.HasPrefix(line, "#region") || strings.HasPrefix(line, "#endregion"):
+			continue
+		}
+		// Lines starting with * only continue a /* block
+		if m := commentLine.FindString(raw); m != "" && (inBlock || !strings.HasPrefix(strings.TrimSpace(m), "*")) {
+			text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(raw[len(m):]), "*/"))
+			inBlock = true
+			if text != "" {
+				block = append(block, text)
+			}
+			if strings.HasSuffix(line, "*/") && len(block) > 0 {
+				break
+			}
+			continue
+		}
+		if inBlock && len(block) > 0 {
+			break
+		}
+		inBlock = false
+	}
+	return shortDescription(strings.Join(block, " "))
+}
+
+// shortDescription keeps the first two sentences of text, within
+// mapDescriptionLimit.
+func shortDescription(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	sentences := 0
+	for i := 0; i < len(text); i++ {
+		if (text[i] == '.' || text[i] == '!' || text[i] == '?') && (i+1 == len(text) || text[i+1] == ' ') {
+			if sentences++; sentences == 2 {
+				text = text[:i+1]
+				break
+			}
+		}
+	}
+	if len(text) > mapDescriptionLimit {
+		cut := strings.LastIndexByte(text[:mapDescriptionLimit], ' ')
+		if cut <= 0 {
+			cut = mapDescriptionLimit
+		}
+		text = text[:cut] + "..."
+	}
+	return text
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// readFileList returns the files named in the -files-from list, or given as
+// arguments, instead of walking the input directory. Relative entries are
+// resolved against the working directory, as tools like git, rg and fzf
+// print them, and no filters apply: the list is packed as given. An entry
+// such as path/to/file.go:120-240 packs only those lines; a file listed
+// several times keeps all of its ranges, or all of it if it is once listed
+// whole.
+func readFileList(ctx context.Context, absPath string, config *Config) ([]sourceFile, error) {
+	logger := config.logger
+
+	entries := config.fileArgs
+	if config.filesFrom != "" {
+		var err error
+		if entries, err = readListEntries(config); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []sourceFile
+	seen := make(map[string]string) // relPath by absolute path
+	whole := make(map[string]bool)
+	config.lineRanges = make(map[string][]lineRange)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry, ranges, err := splitLineRanges(entry)
+		if err != nil {
+			return nil, err
+		}
+		path, err := filepath.Abs(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if relPath, ok := seen[path]; ok {
+			if ranges == nil {
+				whole[relPath] = true
+				delete(config.lineRanges, relPath)
+			} else if !whole[relPath] {
+				config.lineRanges[relPath] = append(config.lineRanges[relPath], ranges...)
+			}
+			continue
+		}
+
+		// Files outside the input directory keep the path they were listed
+		// with
+		relPath, err := filepath.Rel(absPath, path)
+		if err != nil || !filepath.IsLocal(relPath) {
+			relPath = filepath.Clean(entry)
+		}
+		relPath = nfc(filepath.ToSlash(relPath))
+		seen[path] = relPath
+
+		config.progress.fileScanned()
+		config.result.FilesScanned++
+
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.Warn("Skipping listed file", "path", relPath, "error", err)
+			config.skipFile(relPath, err)
+			continue
+		}
+		if info.IsDir() {
+			logger.Debug("Skipping listed directory", "path", relPath)
+			continue
+		}
+
+		if ranges == nil {
+			whole[relPath] = true
+		} else {
+			config.lineRanges[relPath] = ranges
+		}
+		files = append(files, sourceFile{path: path, relPath: relPath})
+	}
+	return files, nil
+}
+
+// readListEntries reads the entries of the -files-from list.
+func readListEntries(config *Config) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if config.filesFrom != "-" {
+		f, err := os.Open(config.filesFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	sep := byte('\n')
+	if config.filesFromNul {
+		sep = 0
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var entries []string
+	for scanner.Scan() {
+		entry := scanner.Text()
+		if !config.filesFromNul {
+			entry = strings.TrimSpace(entry)
+		}
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return entries, nil
+}
+
+var lineRangeSuffix = regexp.MustCompile(`:(\d+(?:-\d+)?(?:,\d+(?:-\d+)?)*)$`)
+
+// splitLineRanges splits a ":120-240" suffix, or several ranges separated
+// by commas, off a listed path. A single number is one line. An entry
+// naming an existing file is taken as it is.
+func splitLineRanges(entry string) (string, []lineRange, error) {
+	m := lineRangeSuffix.FindStringSubmatchIndex(entry)
+	if m == nil {
+		return entry, nil, nil
+	}
+	if _, err := os.Stat(entry); err == nil {
+		return entry, nil, nil
+	}
+	var ranges []lineRange
+	for _, spec := range strings.Split(entry[m[2]:m[3]], ",") {
+		from, to, isRange := strings.Cut(spec, "-")
+		r := lineRange{}
+		r.from, _ = strconv.Atoi(from)
+		r.to = r.from
+		if isRange {
+			r.to, _ = strconv.Atoi(to)
+		}
+		if r.from < 1 || r.to < r.from {
+			return "", nil, fmt.Errorf("invalid line range %q in %q", spec, entry)
+		}
+		ranges = append(ranges, r)
+	}
+	return entry[:m[0]], ranges, nil
+}
+
+// setFileArgs takes the files given as arguments to pack, which are packed
+// like a -files-from list.
+func (c *Config) setFileArgs(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if c.filesFrom != "" || c.fromErrors != "" || c.fromTrace != "" {
+		return fmt.Errorf("file arguments cannot be combined with -files-from, -from-errors or -from-trace")
+	}
+	c.fileArgs = args
+	return nil
+}
+
+// lineRangesField describes the line ranges of a file for its metadata
+// line, e.g. "lines=120-240,300-310".
+func lineRangesField(ranges []lineRange) string {
+	specs := make([]string, len(ranges))
+	for i, r := range ranges {
+		specs[i] = fmt.Sprintf("%d-%d", r.from, r.to)
+	}
+	return "lines=" + strings.Join(specs, ",")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitLineRanges(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "notes:12")
+	if err := os.WriteFile(existing, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		entry    string
+		wantPath string
+		want     []lineRange
+		wantErr  bool
+	}{
+		{"main.go", "main.go", nil, false},
+		{"main.go:120-240", "main.go", []lineRange{{120, 240}}, false},
+		{"main.go:7", "main.go", []lineRange{{7, 7}}, false},
+		{"main.go:1-3,10,20-25", "main.go", []lineRange{{1, 3}, {10, 10}, {20, 25}}, false},
+		{`C:\src\main.go:5`, `C:\src\main.go`, []lineRange{{5, 5}}, false},
+		{"main.go:abc", "main.go:abc", nil, false},
+		{existing, existing, nil, false},
+		{"main.go:0", "", nil, true},
+		{"main.go:9-3", "", nil, true},
+	}
+	for _, tt := range tests {
+		path, ranges, err := splitLineRanges(tt.entry)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitLineRanges(%q) error = %v, want error %t", tt.entry, err, tt.wantErr)
+			continue
+		}
+		if path != tt.wantPath || !slices.Equal(ranges, tt.want) {
+			t.Errorf("splitLineRanges(%q) = %q, %v, want %q, %v", tt.entry, path, ranges, tt.wantPath, tt.want)
+		}
+	}
+}
+
+func TestReadFileListLineRanges(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("package x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(entry string) string { return filepath.Join(dir, entry) }
+	tests := []struct {
+		name      string
+		args      []string
+		wantFiles []string
+		want      map[string][]lineRange
+	}{
+		{"whole files", []string{join("a.go"), join("b.go")}, []string{"a.go", "b.go"}, map[string][]lineRange{}},
+		{"ranges of one file gathered", []string{join("a.go:1-2"), join("b.go"), join("a.go:5")}, []string{"a.go", "b.go"}, map[string][]lineRange{"a.go": {{1, 2}, {5, 5}}}},
+		{"whole file listed after a range", []string{join("a.go:1-2"), join("a.go")}, []string{"a.go"}, map[string][]lineRange{}},
+		{"range listed after the whole file", []string{join("c.go"), join("c.go:3")}, []string{"c.go"}, map[string][]lineRange{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), result: &runResult{}, fileArgs: tt.args}
+			files, err := readFileList(context.Background(), dir, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, f := range files {
+				paths = append(paths, f.relPath)
+			}
+			if !slices.Equal(paths, tt.wantFiles) {
+				t.Errorf("files %q, want %q", paths, tt.wantFiles)
+			}
+			if !maps.EqualFunc(config.lineRanges, tt.want, slices.Equal) {
+				t.Errorf("line ranges %v, want %v", config.lineRanges, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepLineRanges(t *testing.T) {
+	data := "1\n2\n3\n4\n5\n6\n"
+	tests := []struct {
+		name   string
+		ranges []lineRange
+		want   string
+	}{
+		{"one range", []lineRange{{2, 3}}, "... [line 1 omitted] ...\n2\n3\n... [lines 4-6 omitted] ...\n"},
+		{"whole file", []lineRange{{1, 6}}, data},
+		{"out of order and overlapping", []lineRange{{5, 6}, {1, 2}, {2, 3}}, "1\n2\n3\n... [line 4 omitted] ...\n5\n6\n"},
+		{"past the end", []lineRange{{5, 40}}, "... [lines 1-4 omitted] ...\n5\n6\n"},
+		{"wholly past the end", []lineRange{{2, 2}, {10, 12}}, "... [line 1 omitted] ...\n2\n... [lines 3-6 omitted] ...\n"},
+	}
+	for _, tt := range tests {
+		if got := string(keepLines([]byte(data), tt.ranges, 0)); got != tt.want {
+			t.Errorf("%s: keepLines =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+	if got, want := string(keepLines([]byte("a\nb"), []lineRange{{2, 2}}, 0)), "... [line 1 omitted] ...\nb\n"; got != want {
+		t.Errorf("keepLines without a final newline = %q, want %q", got, want)
+	}
+}
+
+func TestLineRangesField(t *testing.T) {
+	got := lineRangesField([]lineRange{{120, 240}, {300, 300}})
+	if want := "lines=120-240,300-300"; got != want {
+		t.Errorf("lineRangesField = %q, want %q", got, want)
+	}
+}
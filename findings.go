@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// finding is one hit of the redaction or -strict policies, as the
+// -findings-report lists it.
+type finding struct {
+	Path   string `json:"path,omitempty"`
+	Rule   string `json:"rule"`
+	Line   int    `json:"line,omitempty"`
+	Action string `json:"action"` // redacted or blocked
+	Detail string `json:"detail,omitempty"`
+}
+
+// runFindings gathers what -redact replaced and what -strict objected to,
+// by path and line.
+func runFindings(config *Config) []finding {
+	var findings []finding
+	if config.redactor != nil {
+		for path, redactions := range config.redactor.findings {
+			for _, r := range redactions {
+				findings = append(findings, finding{Path: path, Rule: r.Rule, Line: r.Line, Action: "redacted"})
+			}
+		}
+	}
+	for _, issue := range config.result.StrictIssues {
+		rule := "strict-" + issue.Kind
+		if issue.Rule != "" {
+			rule = issue.Rule
+		}
+		findings = append(findings, finding{Path: issue.Path, Rule: rule, Line: issue.Line, Action: "blocked", Detail: issue.Detail})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// writeFindings writes the -findings-report: SARIF 2.1.0 when the name ends
+// in .sarif or .sarif.json, for code scanning and CI annotations, and a
+// JSON list otherwise.
+func writeFindings(path string, config *Config) error {
+	findings := runFindings(config)
+	var report any = findings
+	name := strings.ToLower(path)
+	if strings.HasSuffix(name, ".sarif") || strings.HasSuffix(name, ".sarif.json") {
+		report = sarifReport(findings)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write findings report: %w", err)
+	}
+	return nil
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifReport turns findings into a SARIF log. Redactions are warnings,
+// since the secret did not reach the output; what -strict blocked is an
+// error.
+func sarifReport(findings []finding) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "contextify",
+			Version:        version,
+			InformationURI: "https://github.com/deusdat/contextify",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if !seen[f.Rule] {
+			seen[f.Rule] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: f.Rule, ShortDescription: sarifMessage{Text: ruleDescription(f.Rule)}})
+		}
+		result := sarifResult{RuleID: f.Rule, Level: "warning", Properties: map[string]string{"action": f.Action}}
+		message := fmt.Sprintf("%s redacted from the context", f.Rule)
+		if f.Action == "blocked" {
+			result.Level = "error"
+			message = f.Detail
+		}
+		result.Message.Text = message
+		if f.Path != "" {
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = f.Path
+			if f.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+			}
+			result.Locations = append(result.Locations, location)
+		}
+		run.Results = append(run.Results, result)
+	}
+	return sarifLog{Schema: "https://json.schemastore.org/sarif-2.1.0.json", Version: "2.1.0", Runs: []sarifRun{run}}
+}
+
+func ruleDescription(rule string) string {
+	switch rule {
+	case "strict-size":
+		return "File larger than the -strict size limit"
+	case "strict-binary":
+		return "Binary content in the context"
+	case "strict-tokens":
+		return "Context over the -strict token limit"
+	}
+	return "Likely " + rule
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const fixturesMarker = "## Trimmed Fixtures"
+
+// fixtureGroup is a directory of fixtures cut down to one file.
+type fixtureGroup struct {
+	dir     string
+	kept    string
+	dropped []sourceFile
+}
+
+// fixtureDir returns the directory of a file if it lies in one of the
+// fixtureDirs smart ordering puts last, or "".
+func fixtureDir(relPath string) string {
+	dir := path.Dir(filepath.ToSlash(relPath))
+	if dir == "." {
+		return ""
+	}
+	for _, segment := range strings.Split(dir, "/") {
+		if fixtureDirs[strings.ToLower(segment)] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// trimFixtures keeps one representative file of each directory of
+// fixtures for -trim-fixtures: the one of median size, so neither an empty
+// case nor the largest golden file stands in for the rest. The others are
+// returned by directory, to be listed.
+func trimFixtures(files []sourceFile, config *Config) ([]sourceFile, []fixtureGroup) {
+	byDir := make(map[string][]sourceFile)
+	for _, file := range files {
+		if dir := fixtureDir(file.relPath); dir != "" {
+			byDir[dir] = append(byDir[dir], file)
+		}
+	}
+	keep := make(map[string]bool, len(files))
+	var groups []fixtureGroup
+	for dir, members := range byDir {
+		if len(members) == 1 {
+			keep[members[0].relPath] = true
+			continue
+		}
+		bySize := make([]sourceFile, len(members))
+		copy(bySize, members)
+		sort.SliceStable(bySize, func(i, j int) bool { return fileSize(bySize[i].path) < fileSize(bySize[j].path) })
+		kept := bySize[(len(bySize)-1)/2]
+		keep[kept.relPath] = true
+		group := fixtureGroup{dir: dir, kept: kept.relPath}
+		for _, file := range members {
+			if file.relPath != kept.relPath {
+				group.dropped = append(group.dropped, file)
+			}
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].dir < groups[j].dir })
+
+	trimmed := make([]sourceFile, 0, len(files))
+	for _, file := range files {
+		if fixtureDir(file.relPath) == "" || keep[file.relPath] {
+			trimmed = append(trimmed, file)
+			continue
+		}
+		config.logger.Debug("Skipping file (fixture trimmed)", "path", file.relPath)
+		config.traceSkip(file.relPath, "a fixture, and -trim-fixtures keeps one file of "+path.Dir(file.relPath))
+	}
+	return trimmed, groups
+}
+
+// writeFixturesSection lists the fixtures left out, by directory, with the
+// file kept in their place.
+func writeFixturesSection(writer *bufio.Writer, groups []fixtureGroup, config *Config) error {
+	dropped := 0
+	for _, g := range groups {
+		dropped += len(g.dropped)
+	}
+	if _, err := fmt.Fprintf(writer, "%s (%d files in %d directories)\n```\n", fixturesMarker, dropped, len(groups)); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		var size int64
+		for _, file := range g.dropped {
+			size += fileSize(file.path)
+		}
+		if _, err := fmt.Fprintf(writer, "%s/: kept %s, left out %d (%s)\n", config.displayPath(g.dir), path.Base(g.kept), len(g.dropped), formatBytes(size)); err != nil {
+			return err
+		}
+		for _, file := range g.dropped {
+			if _, err := fmt.Fprintf(writer, "  %s %s\n", path.Base(file.relPath), formatBytes(fileSize(file.path))); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
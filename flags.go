@@ -0,0 +1,659 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// packFlags holds the flags shared by every command that packs a directory.
+type packFlags struct {
+	inputPath   *string
+	outputPath  *string
+	excludeDirs *string
+	includeExts *string
+	excludeExts *string
+	includeMIME *string
+	excludeMIME *string
+	inclNames   *string
+	workspace   *string
+	order       *string
+	symbols     *string
+	todos       *bool
+	nbOutputs   *bool
+	extractDocs *bool
+	sampleData  *int
+	maxFileSize *string
+	truncate    *string
+	anonymize   *string
+	anonDomains *string
+	progress    *string
+	onCancel    *string
+	noAtomic    *bool
+	resultJSON  *string
+	undecodable *string
+	normalize   *string
+	hidden      *string
+	maxDepth    *int
+	maxTokens   *int
+	budget      *string
+	filesFrom   *string
+	nulList     *bool
+	format      *string
+	prependFile *string
+	model       *string
+	respTokens  *int
+	manifest    *bool
+	manifestOut *string
+	redact      *string
+	secretRules *string
+	alwaysIncl  *string
+	maxChars    *int
+	maxLines    *int
+	tokenizer   *string
+	vocab       *string
+	windows     *bool
+	summarize   *string
+	sumOver     *string
+	sumModel    *string
+	sumEndpoint *string
+	sumKeyEnv   *string
+	fileMap     *bool
+	fileHeader  *string
+	fileSep     *string
+	strict      *bool
+	strictSize  *string
+	strictTok   *int
+	findings    *string
+	appendOut   *bool
+	regionsOnly *bool
+	open        *bool
+	pipe        *string
+	progressOut *string
+	reproduce   *bool
+	maxOutput   *string
+	onOversize  *string
+	submodules  *string
+	symbolIndex *bool
+	apiSurface  *bool
+	detectDupes *bool
+	collapseDup *bool
+	pairTests   *bool
+	codeOwners  *bool
+	owner       *string
+	issueRefs   *bool
+	issueAPI    *string
+	issueKeyEnv *string
+	condenseLoc *bool
+	locales     *string
+	trimFixture *bool
+	paths       *string
+	stripHeader *bool
+	mode        *string
+	generated   *bool
+	ignoreFile  *string
+	metadata    *string
+	resume      *bool
+	maxMemory   *string
+	overMemory  *string
+	transform   *string
+	preHook     *string
+	postHook    *string
+	notifyURL   *string
+	profile     *string
+	profileOut  *string
+	timing      *bool
+	coverage    *string
+	covBelow    *float64
+	fromErrors  *string
+	errContext  *int
+	fromTrace   *string
+	seeds       *string
+	expandDepth *int
+	condense    *bool
+	sqlSchema   *bool
+	stripValues *bool
+	images      *string
+}
+
+func registerPackFlags(fs *flag.FlagSet) *packFlags {
+	return &packFlags{
+		inputPath:   fs.String("input", ".", "Input directory path (relative or absolute), sftp://[user@]host[:port]/path, docker://image[:tag][/path], git+https://host/repo[#ref], or a GitHub, GitLab, Bitbucket or Azure DevOps repository URL"),
+		outputPath:  fs.String("output", "context.txt", "Output file path, or an s3://bucket/key or gs://bucket/key URL"),
+		excludeDirs: fs.String("exclude", "", "Comma-separated list of directories to exclude (e.g., node_modules,dist,.git)"),
+		includeExts: fs.String("extensions", "", "Comma-separated list of file extensions to include (e.g., .ts,.js,.go)"),
+		excludeExts: fs.String("exclude-extensions", "", "Comma-separated list of file extensions to leave out (e.g., .svg,.snap,.lock,.min.js)"),
+		includeMIME: fs.String("include-mime", "", "Comma-separated MIME types to include, detected from content (e.g., text/*)"),
+		excludeMIME: fs.String("exclude-mime", "", "Comma-separated MIME types to leave out, detected from content (e.g., image/*,font/*)"),
+		inclNames:   fs.String("include-names", "", "Comma-separated file names kept when -extensions is set, in addition to well-known ones like Dockerfile, Makefile, LICENSE and go.mod (start with none to drop those)"),
+		workspace:   fs.String("workspace", "", "Pack only this workspace member and its in-repo dependencies (go.work, pnpm, npm/yarn or Cargo workspaces)"),
+		order:       fs.String("order", "path", "File order: path (walk order), deps (Go packages in dependency order, leaves first, from the import lines of the collected files; build tags are not evaluated) or smart (READMEs, top-level manifests and entry points, then code by directory, tests and fixtures)"),
+		symbols:     fs.String("symbols", "", "Comma-separated Go declarations to emit instead of whole files (e.g., Server.Handle*,NewClient)"),
+		todos:       fs.Bool("todos", false, "Append a section listing TODO/FIXME/HACK/XXX comments from included files"),
+		nbOutputs:   fs.Bool("notebook-outputs", false, "Include text outputs of code cells when converting .ipynb notebooks"),
+		extractDocs: fs.Bool("extract-docs", false, "Extract plain text from .pdf and .docx files instead of emitting raw bytes"),
+		sampleData:  fs.Int("sample-data", 0, "Include only the header plus the first and last N rows of CSV/TSV/JSONL files (0 includes them whole)"),
+		maxFileSize: fs.String("max-file-size", "", "Truncate files larger than this size (e.g., 100KB, 2MB)"),
+		truncate:    fs.String("truncate", "head", "Truncation strategy for oversized files: head (keep start), tail (keep end), middle (keep both ends) or smart (keep signatures, elide bodies)"),
+		anonymize:   fs.String("anonymize", "", "Comma-separated placeholders to apply to headers and content: paths (base path, home, user, host), emails, domains"),
+		anonDomains: fs.String("anonymize-domains", "", "Comma-separated internal domains replaced when -anonymize includes domains"),
+		progress:    fs.String("progress", "auto", "Progress display on stderr: auto, none, plain, bar or json (an NDJSON event per step: walk_started, file_included, file_skipped, budget_exceeded and done)"),
+		onCancel:    fs.String("on-cancel", "remove", "What to do with the partial output when interrupted: remove or keep"),
+		noAtomic:    fs.Bool("no-atomic", false, "Write the output file in place instead of via a temporary file renamed on success"),
+		resultJSON:  fs.String("result-json", "", "Write a machine-readable run summary to this file"),
+		undecodable: fs.String("undecodable", "replace", "Handling of files that are not decodable text: skip, replace (invalid bytes become U+FFFD) or raw"),
+		normalize:   fs.String("normalize", "", "Comma-separated content normalizations: eol (CRLF to LF), trailing-ws, tabs=N (expand tabs)"),
+		hidden:      fs.String("hidden", "default", "Hidden files: default (include, except editor/OS metadata like .DS_Store, .idea, .vscode), include or exclude; .git is always excluded"),
+		maxDepth:    fs.Int("max-depth", -1, "Maximum directory depth to descend into (0 = top-level files only, -1 = unlimited)"),
+		maxTokens:   fs.Int("max-tokens", 0, "Approximate token budget for the output; files that do not fit are left out (0 = unlimited)"),
+		budget:      fs.String("budget", "", "Split -max-tokens, -max-chars or -max-lines across directories by weight (e.g., src/api=40%,src/web=40%,docs=20%)"),
+		filesFrom:   fs.String("files-from", "", "Pack exactly the files listed in this file, one per line, instead of walking the input directory (- reads stdin)"),
+		nulList:     fs.Bool("0", false, "Entries of -files-from are NUL-separated (e.g., from find -print0 or git diff -z)"),
+		format:      fs.String("format", "text", "Output format: text, openai-messages or anthropic-messages (a JSON request body for the chat APIs), html (a standalone page with a file tree and highlighted code), archive (the files themselves, in a zip or, for .tar/.tar.gz/.tgz outputs, a tar) or multimodal (a directory with the context, the images it references by ID and an images.json index)"),
+		prependFile: fs.String("prepend-file", "", "Prepend the content of this file to the output; the message formats use it as the system prompt"),
+		model:       fs.String("model", "", "Model name to set in the message formats"),
+		respTokens:  fs.Int("max-response-tokens", 4096, "max_tokens to set in the anthropic-messages format"),
+		manifest:    fs.Bool("manifest", false, "Append a manifest section listing each included file with its SHA-256, size and token count"),
+		manifestOut: fs.String("manifest-file", "", "Write the manifest as JSON to this file"),
+		redact:      fs.String("redact", "", "Comma-separated kinds of sensitive content to replace with <redacted:rule> markers: secrets, pii"),
+		secretRules: fs.String("secret-rules", "", "Additional secret rules from a gitleaks-compatible TOML file or YAML file (implies -redact secrets)"),
+		alwaysIncl:  fs.String("always-include", "", "Comma-separated file names included even when -extensions would leave them out (e.g., LICENSE,NOTICE)"),
+		mode:        fs.String("mode", "full", "What to emit: full (file content) or docs (doc comments, docstrings, markdown and exported API signatures)"),
+		generated:   fs.Bool("include-generated", false, "Include files marked linguist-generated or linguist-vendored in .gitattributes"),
+		ignoreFile:  fs.String("ignore-file", "", "Additional ignore file in gitignore syntax, applied from the input root; .contextifyignore files are always read"),
+		metadata:    fs.String("metadata", "", "Comma-separated file metadata to add below each file header: size, mtime, mode, hash (SHA-256)"),
+		resume:      fs.Bool("resume", false, "Checkpoint progress next to the output and, if an earlier run was interrupted, verify its output and continue where it stopped"),
+		maxMemory:   fs.String("max-memory", defaultMaxMemory, "Largest file to hold in memory, or 0 for no limit; larger files are streamed in line-aligned chunks when their transforms allow, otherwise handled per -over-memory. Decoding, -normalize, -anonymize and head truncation work line by line; other transforms (-redact, -transform-cmd, -summarize, document, notebook and schema views, contextify: markers) need the whole file"),
+		overMemory:  fs.String("over-memory", "truncate", "What to do with a file over -max-memory that cannot be streamed: truncate (keep the first -max-memory bytes) or skip"),
+		transform:   fs.String("transform-cmd", "", "Shell command each file's content is piped through; its output replaces the content. Exit status 3 leaves the file out; any other failure leaves it out and marks the run partial. CONTEXTIFY_PATH and CONTEXTIFY_FILE name the file"),
+		preHook:     fs.String("pre-hook", "", "Shell command to run before the walk, e.g. git fetch; it receives the input and output as JSON on stdin, and its failure aborts the run"),
+		postHook:    fs.String("post-hook", "", "Shell command to run after the output is written; it receives the run summary as JSON on stdin, and its failure fails the run"),
+		notifyURL:   fs.String("notify-url", "", "Webhook to POST the run summary to when the run ends, e.g. a Slack incoming webhook"),
+		profile:     fs.String("profile", "", "Write a profile of the run: cpu or mem (pprof, for go tool pprof) or trace (for go tool trace)"),
+		profileOut:  fs.String("profile-out", "", "File for the -profile output (default contextify.cpu.pprof, contextify.mem.pprof or contextify.trace)"),
+		timing:      fs.Bool("timing", false, "Print how long the walk, budget, reads, transforms, tokenizing and writing took, and add it to the run summary"),
+		coverage:    fs.String("coverage", "", "Go cover profile (go test -coverprofile) whose per-file coverage and uncovered lines are added to each Go file's metadata line"),
+		covBelow:    fs.Float64("coverage-below", 0, "With -coverage, pack only Go files whose statement coverage is below this percentage (tests and other files are kept)"),
+		fromErrors:  fs.String("from-errors", "", "Pack the files named in this Go, TypeScript or Rust compiler error log, with the log itself, instead of walking the input directory (- reads stdin)"),
+		errContext:  fs.Int("error-context", 0, "With -from-errors or -from-trace, keep only this many lines around each error or frame line of a file (0 keeps whole files)"),
+		fromTrace:   fs.String("from-trace", "", "Pack the files in the frames of this Go, Python, Java, Node or Rust stack trace, innermost first, with the trace itself, instead of walking the input directory (- reads stdin)"),
+		seeds:       fs.String("seed", "", "Comma-separated files, relative to the input, to pack with the Go files they reach through heuristic references, instead of every file (e.g., internal/billing/charge.go). References are matched by name in the syntax tree, not type-checked: a method call reaches every method of that name in the package and its imports, and calls through interfaces or function values are not followed"),
+		expandDepth: fs.Int("expand-depth", 1, "With -seed, how many steps of heuristic references to follow from the seed files"),
+		condense:    fs.Bool("condense-schemas", false, "Reduce .proto files and OpenAPI/Swagger YAML or JSON documents to messages, field types, RPCs and endpoint signatures with their summaries"),
+		sqlSchema:   fs.Bool("sql-schema", false, "Replace the .sql files of migrations directories with the schema they build up (tables, columns, constraints and indexes), and reduce other .sql files to the schema they define"),
+		stripValues: fs.Bool("strip-config-values", false, "Include .env files, Helm values, docker-compose files and Terraform variables even when -extensions leaves them out, with their values replaced by their type (e.g., DATABASE_URL=<redacted:string>)"),
+		images:      fs.String("images", "", "Emit images (even when -extensions leaves them out) as a line with their format, dimensions and size: placeholder, or base64 to add the image as a data URI"),
+		maxChars:    fs.Int("max-chars", 0, "Character budget for the output, trimmed like -max-tokens (0 = unlimited)"),
+		maxLines:    fs.Int("max-lines", 0, "Line budget for the output, trimmed like -max-tokens (0 = unlimited)"),
+		tokenizer:   fs.String("tokenizer", "approx", "Tokenizer for token counts and -max-tokens: approx (four characters per token), cl100k, o200k or llama3; cl100k and o200k vocabularies are downloaded once to the user cache"),
+		vocab:       fs.String("tokenizer-vocab", "", "BPE vocabulary for -tokenizer in tiktoken format (base64 token and rank per line), e.g. Llama 3's tokenizer.model"),
+		windows:     fs.Bool("windows", false, "After packing, print which common model context windows the output fits and which directories to exclude to fit the next smaller one"),
+		summarize:   fs.String("summarize", "", "Summarize files of at least -summarize-over with an LLM: replace emits the summary instead of the content, alongside before it. Summaries are cached by content hash"),
+		sumOver:     fs.String("summarize-over", "16KB", "Size from which -summarize summarizes a file"),
+		sumModel:    fs.String("summarize-model", "", "Model -summarize asks for summaries"),
+		sumEndpoint: fs.String("summarize-endpoint", "https://api.openai.com/v1", "Base URL of the OpenAI-compatible API -summarize calls"),
+		sumKeyEnv:   fs.String("summarize-key-env", "OPENAI_API_KEY", "Environment variable holding the API key for -summarize"),
+		fileMap:     fs.Bool("map", false, "Start with a map of the packed directories and files, each with a one-line description from its README, doc comment or -summarize summary"),
+		fileHeader:  fs.String("file-header-format", "", "Line that starts each file instead of \"## File: path\" and a code fence, e.g. \"===== {path} =====\"; {path}, {index} and {lang} are filled in and \\n starts a new line"),
+		fileSep:     fs.String("file-separator", "", "Text after each file's content when files are not fenced (default a blank line); takes the placeholders of -file-header-format"),
+		strict:      fs.Bool("strict", false, "Fail the run, writing no output, when a file holds a likely secret, is larger than -strict-file-size or looks binary, or the output is over -strict-tokens"),
+		strictSize:  fs.String("strict-file-size", "1MB", "Largest file content -strict lets through (0 = no limit)"),
+		strictTok:   fs.Int("strict-tokens", 0, "Most tokens -strict lets the output have (0 = no limit)"),
+		findings:    fs.String("findings-report", "", "Write what -redact replaced and -strict blocked (file, rule, line, action) to this file: SARIF when it ends in .sarif, JSON otherwise"),
+		appendOut:   fs.Bool("append", false, "Add the files of this run to the existing output instead of replacing it: sections of files already there are replaced, and the header is regenerated"),
+		regionsOnly: fs.Bool("regions-only", false, "Cut files holding contextify:begin-include and contextify:end-include comment markers down to the lines between them; other files are packed whole"),
+		open:        fs.Bool("open", false, "Open the output when the pack is done: in $VISUAL or $EDITOR, or for HTML and archive outputs and without an editor, in the default application"),
+		pipe:        fs.String("pipe", "", "Shell command to stream the output into instead of writing -output, e.g. \"llm -m claude-sonnet\"; its output is passed through"),
+		progressOut: fs.String("progress-file", "", "Write -progress json events to this file, e.g. a named pipe, instead of stderr"),
+		reproduce:   fs.Bool("reproducible", false, "Make the output byte-identical for identical inputs and settings: files sorted by path, CRLF line endings normalized, timestamps set to SOURCE_DATE_EPOCH (or 1980-01-01), absolute paths in the header and settings cut to their base name and the settings digest in the header"),
+		maxOutput:   fs.String("max-output-size", "", "Largest output to write (e.g., 50MB); larger outputs are handled per -on-oversize"),
+		onOversize:  fs.String("on-oversize", "fail", "What to do with an output over -max-output-size: fail (the run fails and nothing is written) or split (into context.part1.txt, context.part2.txt, ... cut between files)"),
+		submodules:  fs.String("submodules", "include", "How to walk git submodules and nested repositories: include (as any directory), skip (leave them out, with their commit in the header) or include-with-ref (include them, with their commit in the header)"),
+		symbolIndex: fs.Bool("symbol-index", false, "Append an index of exported functions, types, classes and HTTP endpoints of the included files (symbol, kind, file:line)"),
+		apiSurface:  fs.Bool("api-surface", false, "Append an API surface section listing the HTTP routes of the included files (net/http, gin, echo, Express, FastAPI, Flask): method, path, handler and file:line"),
+		detectDupes: fs.Bool("detect-dupes", false, "Append a report of code blocks (6 or more significant lines) repeated from an earlier file"),
+		collapseDup: fs.Bool("collapse-dupes", false, "Replace blocks found by -detect-dupes with a line pointing at the earlier copy (implies -detect-dupes)"),
+		pairTests:   fs.Bool("pair-tests", false, "Place each file's test right after it, and a test's source right before it, pulling in partners the filters left out"),
+		codeOwners:  fs.Bool("codeowners", false, "Add each file's owners from the input's CODEOWNERS file to its metadata line"),
+		owner:       fs.String("owner", "", "Comma-separated CODEOWNERS owners (e.g., @platform-team) whose files alone are packed (implies -codeowners)"),
+		issueRefs:   fs.Bool("issue-refs", false, "Append a cross-reference of issue references (PROJ-123, #456, owner/repo#456) in comments of the included files and in the last 200 commit messages"),
+		issueAPI:    fs.String("issue-api", "", "URL template for fetching the titles of -issue-refs: {id} for keys (e.g., https://jira.example.com/rest/api/2/issue/{id}), {number} and {repo} for numbers (e.g., https://api.github.com/repos/{repo}/issues/{number}); implies -issue-refs"),
+		issueKeyEnv: fs.String("issue-api-key-env", "ISSUE_API_TOKEN", "Environment variable holding the token for -issue-api, sent as a bearer token, or as basic credentials when it is user:token"),
+		condenseLoc: fs.Bool("condense-locales", false, "Reduce translation bundles (JSON or YAML files named by locale under locales, i18n, lang, translations or messages directories) of all but the -locales to their key count and the keys they miss or add"),
+		locales:     fs.String("locales", "en", "Comma-separated locales whose translation bundles -condense-locales keeps whole, with their regional variants; the first is the default the others are compared with"),
+		trimFixture: fs.Bool("trim-fixtures", false, "Pack one representative file of each test snapshot and fixture directory (__snapshots__, testdata, fixtures, golden) and list the others"),
+		paths:       fs.String("paths", "", "Comma-separated subtrees of a git input to fetch and pack (e.g., src/,docs/), with a sparse checkout of a partial clone"),
+		stripHeader: fs.Bool("strip-license-headers", false, "Remove leading license and copyright comment blocks from source files"),
+	}
+}
+
+// flagValues lists the accepted values of enumerated flags, used for
+// validation messages and shell completion.
+var flagValues = map[string][]string{
+	"order":       {"path", "deps", "smart"},
+	"truncate":    truncateStrategies,
+	"anonymize":   anonymizeKinds,
+	"progress":    progressModes,
+	"on-cancel":   {"remove", "keep"},
+	"undecodable": undecodablePolicies,
+	"hidden":      hiddenModes,
+	"log-format":  {"text", "json"},
+	"format":      outputFormats,
+	"redact":      redactKinds,
+	"mode":        packModes,
+	"metadata":    metadataFields,
+	"over-memory": overMemoryPolicies,
+	"profile":     profileKinds,
+	"images":      imageModes,
+	"tokenizer":   tokenizers,
+	"summarize":   summarizeModes,
+	"on-oversize": oversizePolicies,
+	"submodules":  submoduleModes,
+}
+
+// checkChoice validates the value of an enumerated flag.
+func checkChoice(name, value string) error {
+	if !slices.Contains(flagValues[name], value) {
+		return fmt.Errorf("invalid -%s %q (valid: %v)", name, value, flagValues[name])
+	}
+	return nil
+}
+
+// config validates the parsed flags and builds the run configuration.
+func (pf *packFlags) config(logger *slog.Logger) (*Config, error) {
+	for _, choice := range [][2]string{
+		{"order", *pf.order},
+		{"progress", *pf.progress},
+		{"on-cancel", *pf.onCancel},
+		{"undecodable", *pf.undecodable},
+		{"hidden", *pf.hidden},
+		{"truncate", *pf.truncate},
+		{"format", *pf.format},
+		{"mode", *pf.mode},
+		{"over-memory", *pf.overMemory},
+		{"tokenizer", *pf.tokenizer},
+		{"on-oversize", *pf.onOversize},
+		{"submodules", *pf.submodules},
+	} {
+		if err := checkChoice(choice[0], choice[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if *pf.profile != "" {
+		if err := checkChoice("profile", *pf.profile); err != nil {
+			return nil, err
+		}
+	}
+	if *pf.images != "" {
+		if err := checkChoice("images", *pf.images); err != nil {
+			return nil, err
+		}
+	}
+
+	normalizeOpts, err := parseNormalize(*pf.normalize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalize settings: %w", err)
+	}
+	if *pf.reproduce {
+		normalizeOpts.eol = true
+	}
+	budgetAreas, err := parseBudget(nfc(*pf.budget))
+	if err != nil {
+		return nil, fmt.Errorf("invalid budget: %w", err)
+	}
+	if len(budgetAreas) > 0 && *pf.maxTokens <= 0 && *pf.maxChars <= 0 && *pf.maxLines <= 0 {
+		return nil, fmt.Errorf("-budget requires -max-tokens, -max-chars or -max-lines")
+	}
+	if *pf.format == "anthropic-messages" && *pf.respTokens <= 0 {
+		return nil, fmt.Errorf("-max-response-tokens must be positive")
+	}
+	if isObjectStoreURL(*pf.outputPath) {
+		if _, err := uploadCommand(*pf.outputPath, ""); err != nil {
+			return nil, err
+		}
+	}
+	if (*pf.fileHeader != "" || *pf.fileSep != "") && (*pf.format == "html" || *pf.format == "archive") {
+		return nil, fmt.Errorf("-format %s reads files back by their standard headers and cannot take -file-header-format or -file-separator", *pf.format)
+	}
+	if *pf.format == "multimodal" {
+		switch {
+		case isObjectStoreURL(*pf.outputPath):
+			return nil, fmt.Errorf("-format multimodal writes a directory and needs a local -output")
+		case *pf.images == "base64":
+			return nil, fmt.Errorf("-images base64 cannot be combined with -format multimodal, which copies the images instead")
+		}
+		// Images are what the format is for
+		*pf.images = "placeholder"
+		if *pf.outputPath == "context.txt" {
+			*pf.outputPath = "context"
+		}
+	}
+	if *pf.resume {
+		switch {
+		case *pf.format != "text":
+			return nil, fmt.Errorf("-resume requires -format text")
+		case *pf.todos, *pf.symbolIndex, *pf.apiSurface, *pf.issueRefs, *pf.issueAPI != "", *pf.manifest, *pf.manifestOut != "", *pf.sqlSchema:
+			return nil, fmt.Errorf("-resume cannot be combined with -todos, -symbol-index, -api-surface, -issue-refs, -sql-schema or a manifest, which need every file in one run")
+		case isObjectStoreURL(*pf.outputPath):
+			return nil, fmt.Errorf("-resume requires a local output file")
+		}
+	}
+	if *pf.appendOut {
+		switch {
+		case *pf.format != "text":
+			return nil, fmt.Errorf("-append requires -format text")
+		case *pf.resume:
+			return nil, fmt.Errorf("-append cannot be combined with -resume")
+		case *pf.fileHeader != "" || *pf.fileSep != "":
+			return nil, fmt.Errorf("-append requires the standard file delimiters")
+		case isObjectStoreURL(*pf.outputPath):
+			return nil, fmt.Errorf("-append requires a local output file")
+		}
+	}
+	if *pf.pipe != "" && (*pf.resume || *pf.appendOut || *pf.open) {
+		return nil, fmt.Errorf("-pipe writes no output file, so it cannot be combined with -resume, -append or -open")
+	}
+	if *pf.progressOut != "" && *pf.progress != "json" {
+		return nil, fmt.Errorf("-progress-file requires -progress json")
+	}
+	if *pf.open && isObjectStoreURL(*pf.outputPath) {
+		return nil, fmt.Errorf("-open requires a local output file")
+	}
+	if *pf.nulList && *pf.filesFrom == "" {
+		return nil, fmt.Errorf("-0 requires -files-from")
+	}
+	sources := 0
+	for _, source := range []string{*pf.filesFrom, *pf.fromErrors, *pf.fromTrace} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("only one of -files-from, -from-errors and -from-trace can be given")
+	}
+	if *pf.expandDepth < 0 {
+		return nil, fmt.Errorf("-expand-depth must not be negative")
+	}
+	if *pf.errContext < 0 {
+		return nil, fmt.Errorf("-error-context must not be negative")
+	}
+	if *pf.errContext > 0 && *pf.fromErrors == "" && *pf.fromTrace == "" {
+		return nil, fmt.Errorf("-error-context requires -from-errors or -from-trace")
+	}
+	includeMIME, err := parseMIMEPatterns(*pf.includeMIME)
+	if err != nil {
+		return nil, err
+	}
+	excludeMIME, err := parseMIMEPatterns(*pf.excludeMIME)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseMetadataFields(*pf.metadata)
+	if err != nil {
+		return nil, err
+	}
+	maxFileBytes, err := parseSize(*pf.maxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max file size: %w", err)
+	}
+	if *pf.covBelow < 0 || *pf.covBelow > 100 {
+		return nil, fmt.Errorf("-coverage-below must be between 0 and 100")
+	}
+	if *pf.covBelow > 0 && *pf.coverage == "" {
+		return nil, fmt.Errorf("-coverage-below requires -coverage")
+	}
+	var coverage *coverageProfile
+	if *pf.coverage != "" {
+		if coverage, err = loadCoverage(*pf.coverage, *pf.covBelow); err != nil {
+			return nil, err
+		}
+	}
+	if *pf.issueAPI != "" && !strings.Contains(*pf.issueAPI, "{id}") && !strings.Contains(*pf.issueAPI, "{number}") {
+		return nil, fmt.Errorf("-issue-api must contain {id} or {number}")
+	}
+	if *pf.condenseLoc && len(parseCommaSeparated(*pf.locales)) == 0 {
+		return nil, fmt.Errorf("-condense-locales requires at least one of -locales")
+	}
+	var codeOwners *codeOwners
+	if *pf.codeOwners || *pf.owner != "" {
+		codeOwners = newCodeOwners(parseCommaSeparated(*pf.owner))
+	}
+	tokenizer, err := loadTokenizer(*pf.tokenizer, *pf.vocab, logger)
+	if err != nil {
+		return nil, err
+	}
+	if *pf.findings != "" && *pf.redact == "" && *pf.secretRules == "" && !*pf.strict {
+		return nil, fmt.Errorf("-findings-report requires -redact, -secret-rules or -strict")
+	}
+	var strict *strictChecker
+	if *pf.strict {
+		size, err := parseSize(*pf.strictSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid strict file size: %w", err)
+		}
+		strict = newStrictChecker(size, *pf.strictTok)
+	}
+	var summaries *summarizer
+	if *pf.summarize != "" {
+		if err := checkChoice("summarize", *pf.summarize); err != nil {
+			return nil, err
+		}
+		over, err := parseSize(*pf.sumOver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid summarize size: %w", err)
+		}
+		if summaries, err = newSummarizer(*pf.summarize, over, *pf.sumModel, *pf.sumEndpoint, *pf.sumKeyEnv, logger); err != nil {
+			return nil, err
+		}
+	}
+	if *pf.paths != "" && !isGitInput(*pf.inputPath) {
+		return nil, fmt.Errorf("-paths requires a git input, e.g. git+https://host/repo")
+	}
+	maxOutput, err := parseSize(*pf.maxOutput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max output size: %w", err)
+	}
+	if maxOutput > 0 && *pf.onOversize == "split" {
+		switch {
+		case *pf.format != "text":
+			return nil, fmt.Errorf("-on-oversize split requires -format text")
+		case *pf.fileHeader != "" || *pf.fileSep != "":
+			return nil, fmt.Errorf("-on-oversize split requires the standard file delimiters")
+		case *pf.pipe != "" || *pf.resume || isObjectStoreURL(*pf.outputPath):
+			return nil, fmt.Errorf("-on-oversize split requires a local output file, without -pipe or -resume")
+		}
+	}
+	maxMemory, err := parseSize(*pf.maxMemory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max memory: %w", err)
+	}
+	if *pf.format == "html" || *pf.format == "archive" {
+		// These hold the whole output anyway, so only an explicit limit is
+		// refused
+		if *pf.maxMemory == defaultMaxMemory {
+			maxMemory = 0
+		}
+	}
+	if maxMemory > 0 && (*pf.format == "html" || *pf.format == "archive") {
+		return nil, fmt.Errorf("-max-memory cannot bound -format %s, which holds the whole output until it is written", *pf.format)
+	}
+
+	// Always exclude .git directory
+	excludeList := parseCommaSeparated(nfc(*pf.excludeDirs))
+	excludeList = ensureGitExcluded(excludeList)
+
+	config := &Config{
+		inputPath:   *pf.inputPath,
+		outputPath:  *pf.outputPath,
+		excludeDirs: excludeList,
+		includeExts: parseCommaSeparated(*pf.includeExts),
+		excludeExts: parseCommaSeparated(*pf.excludeExts),
+		includeMIME: includeMIME,
+		excludeMIME: excludeMIME,
+		workspace:   *pf.workspace,
+		order:       *pf.order,
+		symbols:     parseCommaSeparated(*pf.symbols),
+		logger:      logger,
+
+		notebookOutputs: *pf.nbOutputs,
+		extractDocs:     *pf.extractDocs,
+		sampleData:      *pf.sampleData,
+		maxFileSize:     maxFileBytes,
+		truncate:        *pf.truncate,
+		onCancel:        *pf.onCancel,
+		atomic:          !*pf.noAtomic && !*pf.resume,
+		undecodable:     *pf.undecodable,
+		normalize:       normalizeOpts,
+		hidden:          *pf.hidden,
+		maxDepth:        *pf.maxDepth,
+		maxTokens:       *pf.maxTokens,
+		budget:          budgetAreas,
+		filesFrom:       *pf.filesFrom,
+		filesFromNul:    *pf.nulList,
+		format:          *pf.format,
+		model:           *pf.model,
+
+		maxResponseTokens: *pf.respTokens,
+		manifestSection:   *pf.manifest,
+		manifestFile:      *pf.manifestOut,
+		resultFile:        *pf.resultJSON,
+
+		alwaysInclude:       parseCommaSeparated(nfc(*pf.alwaysIncl)),
+		includeNames:        includeNames(nfc(*pf.inclNames)),
+		metadata:            metadata,
+		resume:              *pf.resume,
+		maxMemory:           maxMemory,
+		overMemory:          *pf.overMemory,
+		transform:           *pf.transform,
+		preHook:             *pf.preHook,
+		postHook:            *pf.postHook,
+		notifyURL:           *pf.notifyURL,
+		profile:             *pf.profile,
+		profileOut:          *pf.profileOut,
+		timing:              *pf.timing,
+		coverage:            coverage,
+		fromErrors:          *pf.fromErrors,
+		errorContext:        *pf.errContext,
+		fromTrace:           *pf.fromTrace,
+		seeds:               parseCommaSeparated(nfc(*pf.seeds)),
+		expandDepth:         *pf.expandDepth,
+		condenseSchemas:     *pf.condense,
+		sqlSchema:           *pf.sqlSchema,
+		stripConfigValues:   *pf.stripValues,
+		images:              *pf.images,
+		stripLicenseHeaders: *pf.stripHeader,
+		maxChars:            *pf.maxChars,
+		maxLines:            *pf.maxLines,
+		tokenizerName:       *pf.tokenizer,
+		tokenizer:           tokenizer,
+		windows:             *pf.windows,
+		summarizer:          summaries,
+		fileMap:             *pf.fileMap,
+		fileHeader:          unescapeDelimiter(*pf.fileHeader),
+		fileSeparator:       unescapeDelimiter(*pf.fileSep),
+		strict:              strict,
+		findingsReport:      *pf.findings,
+		appendOutput:        *pf.appendOut,
+		regionsOnly:         *pf.regionsOnly,
+		open:                *pf.open,
+		pipe:                *pf.pipe,
+		progressFile:        *pf.progressOut,
+		reproducible:        *pf.reproduce,
+		maxOutputSize:       maxOutput,
+		splitOutput:         *pf.onOversize == "split",
+		submodules:          *pf.submodules,
+		detectDupes:         *pf.detectDupes || *pf.collapseDup,
+		collapseDupes:       *pf.collapseDup,
+		pairTests:           *pf.pairTests,
+		remotePaths:         parseCommaSeparated(*pf.paths),
+		codeOwners:          codeOwners,
+		condenseLocales:     *pf.condenseLoc,
+		locales:             parseCommaSeparated(*pf.locales),
+		trimFixtures:        *pf.trimFixture,
+		mode:                *pf.mode,
+		includeGenerated:    *pf.generated,
+		ignoreFile:          *pf.ignoreFile,
+	}
+
+	if *pf.prependFile != "" {
+		data, err := os.ReadFile(*pf.prependFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prepend file: %w", err)
+		}
+		config.prepend = strings.TrimRight(string(data), "\n")
+	}
+
+	if *pf.todos {
+		config.todos = &todoCollector{}
+	}
+	if *pf.symbolIndex {
+		config.symbolIndex = &symbolIndex{}
+	}
+	if *pf.apiSurface {
+		config.apiSurface = &routeCollector{}
+	}
+	if *pf.issueRefs || *pf.issueAPI != "" {
+		config.issueRefs = newIssueCollector(*pf.issueAPI, *pf.issueKeyEnv)
+	}
+
+	if *pf.anonymize != "" {
+		absInput, err := filepath.Abs(config.inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		config.anonymizer, err = newAnonymizer(parseCommaSeparated(*pf.anonymize), absInput, parseCommaSeparated(*pf.anonDomains))
+		if err != nil {
+			return nil, fmt.Errorf("invalid anonymize settings: %w", err)
+		}
+	}
+
+	if *pf.redact != "" || *pf.secretRules != "" {
+		config.redactor, err = newRedactor(parseCommaSeparated(*pf.redact), *pf.secretRules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact settings: %w", err)
+		}
+	}
+
+	// Create lookup maps for faster checking
+	config.excludeMap = createLookupMap(config.excludeDirs)
+	config.includeMap = createLookupMap(config.includeExts)
+
+	return config, nil
+}
+
+// logFlags holds the logging flags every command accepts.
+type logFlags struct {
+	verbose   *bool
+	quiet     *bool
+	logFormat *string
+	logFile   *string
+}
+
+func registerLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		verbose:   fs.Bool("verbose", false, "Enable verbose logging"),
+		quiet:     fs.Bool("quiet", false, "Only log errors"),
+		logFormat: fs.String("log-format", "text", "Log format: text or json"),
+		logFile:   fs.String("log-file", "", "Write logs to this file instead of stderr"),
+	}
+}
+
+// logger opens the logger selected by the flags. The returned function
+// closes the log file; it reports problems on stderr since the logger is
+// unusable.
+func (lf *logFlags) logger() (*slog.Logger, func(), error) {
+	logger, closeLog, err := newLogger(*lf.logFormat, *lf.logFile, *lf.verbose, *lf.quiet)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logger, func() {
+		if err := closeLog(); err != nil {
+			fmt.Fprintln(os.Stderr, "contextify: failed to close log file:", err)
+		}
+	}, nil
+}
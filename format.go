@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+var outputFormats = []string{"text", "openai-messages", "anthropic-messages", "html", "archive", "multimodal"}
+
+// outputFormatter wraps the rendered context in the selected output format.
+// close writes whatever the format needs after the content.
+type outputFormatter interface {
+	io.Writer
+	close() error
+}
+
+// newFormatter starts the output in config.format. The message formats
+// produce a request body for the chat APIs: the -prepend-file content is the
+// system prompt and the packed repository the user message.
+func newFormatter(w io.Writer, config *Config) (outputFormatter, error) {
+	switch config.format {
+	case "openai-messages":
+		var prefix bytes.Buffer
+		prefix.WriteString("{")
+		if config.model != "" {
+			fmt.Fprintf(&prefix, `"model":%s,`, jsonString(config.model))
+		}
+		prefix.WriteString(`"messages":[`)
+		if config.prepend != "" {
+			fmt.Fprintf(&prefix, `{"role":"system","content":%s},`, jsonString(config.prepend))
+		}
+		prefix.WriteString(`{"role":"user","content":"`)
+		return newMessageFormatter(w, prefix.String(), "\"}]}\n")
+	case "anthropic-messages":
+		var prefix bytes.Buffer
+		prefix.WriteString("{")
+		if config.model != "" {
+			fmt.Fprintf(&prefix, `"model":%s,`, jsonString(config.model))
+		}
+		fmt.Fprintf(&prefix, `"max_tokens":%d,`, config.maxResponseTokens)
+		if config.prepend != "" {
+			fmt.Fprintf(&prefix, `"system":%s,`, jsonString(config.prepend))
+		}
+		prefix.WriteString(`"messages":[{"role":"user","content":[{"type":"text","text":"`)
+		return newMessageFormatter(w, prefix.String(), "\"}]}]}\n")
+	case "html":
+		h := &htmlFormatter{w: w}
+		if config.prepend != "" {
+			h.buf.WriteString(config.prepend + "\n\n")
+		}
+		return h, nil
+	case "archive":
+		return newArchiveFormatter(w, config), nil
+	case "multimodal":
+		if config.prepend != "" {
+			if _, err := io.WriteString(w, config.prepend+"\n\n"); err != nil {
+				return nil, err
+			}
+		}
+		return &multimodalFormatter{textFormatter{w}, config}, nil
+	default:
+		if config.prepend != "" {
+			if _, err := io.WriteString(w, config.prepend+"\n\n"); err != nil {
+				return nil, err
+			}
+		}
+		return textFormatter{w}, nil
+	}
+}
+
+type textFormatter struct {
+	io.Writer
+}
+
+func (textFormatter) close() error { return nil }
+
+// messageFormatter streams the context into a JSON string between prefix
+// and suffix, so the output never has to be held in memory.
+type messageFormatter struct {
+	jsonStringWriter
+	suffix string
+}
+
+func newMessageFormatter(w io.Writer, prefix, suffix string) (*messageFormatter, error) {
+	if _, err := io.WriteString(w, prefix); err != nil {
+		return nil, err
+	}
+	return &messageFormatter{jsonStringWriter{w}, suffix}, nil
+}
+
+func (m *messageFormatter) close() error {
+	_, err := io.WriteString(m.w, m.suffix)
+	return err
+}
+
+// jsonStringWriter escapes what is written to it as the body of a JSON
+// string. Only ASCII bytes need escaping, so multi-byte characters split
+// across writes pass through intact.
+type jsonStringWriter struct {
+	w io.Writer
+}
+
+func (j jsonStringWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	start := 0
+	for i, b := range p {
+		var esc string
+		switch {
+		case b == '"':
+			esc = `\"`
+		case b == '\\':
+			esc = `\\`
+		case b == '\n':
+			esc = `\n`
+		case b == '\r':
+			esc = `\r`
+		case b == '\t':
+			esc = `\t`
+		case b < 0x20:
+			esc = fmt.Sprintf(`\u%04x`, b)
+		default:
+			continue
+		}
+		buf.Write(p[start:i])
+		buf.WriteString(esc)
+		start = i + 1
+	}
+	buf.Write(p[start:])
+	if _, err := j.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// linguistAttributes mark files that GitHub hides in diffs and language
+// statistics.
+var linguistAttributes = []string{"linguist-generated", "linguist-vendored"}
+
+type attributeRule struct {
+	pattern gitPattern
+	attrs   map[string]bool // set or unset
+}
+
+// gitAttributes holds the rules of the .gitattributes files seen so far in
+// a walk. Files deeper in the tree are loaded later and take precedence, as
+// in git.
+type gitAttributes struct {
+	rules []attributeRule
+}
+
+// load reads the .gitattributes file of a directory, if there is one.
+func (a *gitAttributes) load(absDir, relDir string) error {
+	f, err := os.Open(filepath.Join(absDir, ".gitattributes"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	base := filepath.ToSlash(relDir)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		pattern, ok := parseGitPattern(base, fields[0])
+		if !ok || pattern.negate {
+			// Negative patterns are forbidden in .gitattributes
+			continue
+		}
+		rule := attributeRule{pattern: pattern, attrs: make(map[string]bool)}
+		for _, attr := range fields[1:] {
+			switch {
+			case strings.HasPrefix(attr, "-"), strings.HasPrefix(attr, "!"):
+				rule.attrs[attr[1:]] = false
+			default:
+				name, value, hasValue := strings.Cut(attr, "=")
+				rule.attrs[name] = !hasValue || value == "true" || value == "1"
+			}
+		}
+		a.rules = append(a.rules, rule)
+	}
+	return scanner.Err()
+}
+
+// isSet reports whether the last rule that mentions attr for the file sets
+// it.
+func (a *gitAttributes) isSet(relPath, attr string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for i := len(a.rules) - 1; i >= 0; i-- {
+		rule := a.rules[i]
+		value, ok := rule.attrs[attr]
+		if ok && rule.pattern.match(relPath, false) {
+			return value
+		}
+	}
+	return false
+}
+
+// linguistExcluded reports whether a file is marked generated or vendored.
+func (a *gitAttributes) linguistExcluded(relPath string) bool {
+	for _, attr := range linguistAttributes {
+		if a.isSet(relPath, attr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// forgeTokens are the environment variables holding an access token for
+// each forge, in order, and the user name the token is sent with over
+// HTTPS. The variables are only sent to the forge's public service;
+// self-hosted instances get theirs from CONTEXTIFY_GIT_HOST_TOKENS.
+// CONTEXTIFY_GIT_TOKEN is used for any host when the others are unset.
+var forgeTokens = map[string]struct {
+	envs []string
+	user string
+}{
+	"github":    {[]string{"GITHUB_TOKEN"}, "x-access-token"},
+	"gitlab":    {[]string{"GITLAB_TOKEN"}, "oauth2"},
+	"bitbucket": {[]string{"BITBUCKET_TOKEN"}, "x-token-auth"},
+	"azure":     {[]string{"AZURE_DEVOPS_EXT_PAT", "AZURE_DEVOPS_TOKEN"}, "pat"},
+}
+
+// publicForge reports whether host is the public service of a forge
+// rather than an instance that merely looks like one.
+func publicForge(forge, host string) bool {
+	host = strings.ToLower(host)
+	if kind, ok := gitForges[host]; ok {
+		return kind == forge
+	}
+	return forge == "azure" && strings.HasSuffix(host, ".visualstudio.com")
+}
+
+// hostTokenEnv returns the environment variable holding the token of a
+// host, from CONTEXTIFY_GIT_HOST_TOKENS: comma-separated host=VARIABLE
+// pairs such as "github.example.com=GHE_TOKEN,gitlab.internal=GL_TOKEN".
+func hostTokenEnv(host string) string {
+	for _, pair := range parseCommaSeparated(os.Getenv("CONTEXTIFY_GIT_HOST_TOKENS")) {
+		if h, name, ok := strings.Cut(pair, "="); ok && strings.EqualFold(strings.TrimSpace(h), host) {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// gitAuthEnv returns the environment of the fetch commands. Over HTTPS the
+// credentials are, in order: a password in the URL, a token from the
+// environment, an entry for the host in ~/.netrc (or $NETRC), and the
+// System.AccessToken of an Azure Pipelines job for Azure DevOps itself. A token or netrc entry is
+// sent as an Authorization header for the repository's host, passed
+// through git's environment configuration so it shows neither in the
+// remote URL nor in the process list. Without any, git's own credential
+// helpers are asked as usual. Git never prompts: a run in CI fails instead
+// of waiting for a password, and SSH runs in batch mode.
+func gitAuthEnv(src gitSource, logger *slog.Logger) []string {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	if src.repo.Scheme != "https" && src.repo.Scheme != "http" {
+		return env
+	}
+	if _, ok := src.repo.User.Password(); ok {
+		return env
+	}
+
+	header, from := gitAuthHeader(src)
+	if header == "" {
+		logger.Debug("Using git credential helpers for the git input", "host", src.repo.Host)
+		return env
+	}
+	logger.Debug("Authenticating the git input", "host", src.repo.Host, "credentials", from)
+
+	// Keep any configuration already passed this way
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	scope := src.repo.Scheme + "://" + src.repo.Host + "/"
+	return append(env,
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", n+1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=http.%s.extraHeader", n, scope),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=Authorization: %s", n, header),
+	)
+}
+
+// gitAuthHeader returns the Authorization header value for a repository
+// and where its credentials came from, or "" when none were found.
+func gitAuthHeader(src gitSource) (header, from string) {
+	basic := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	host := src.repo.Hostname()
+	user := "x-access-token"
+	var envs []string
+	if name := hostTokenEnv(host); name != "" {
+		envs = append(envs, name)
+	}
+	if forge, ok := forgeTokens[src.forge]; ok {
+		user = forge.user
+		if publicForge(src.forge, host) {
+			envs = append(envs, forge.envs...)
+		}
+	}
+	envs = append(envs, "CONTEXTIFY_GIT_TOKEN")
+	for _, name := range envs {
+		if token := os.Getenv(name); token != "" {
+			return basic(user, token), name
+		}
+	}
+	if login, password, ok := netrcEntry(host); ok {
+		return basic(login, password), "netrc"
+	}
+	if publicForge("azure", host) {
+		if token := os.Getenv("SYSTEM_ACCESSTOKEN"); token != "" {
+			return "Bearer " + token, "SYSTEM_ACCESSTOKEN"
+		}
+	}
+	return "", ""
+}
+
+// netrcEntry looks up the login and password for host in the netrc file:
+// $NETRC, or ~/.netrc (~/_netrc on Windows). A default entry applies to
+// hosts without their own.
+func netrcEntry(host string) (login, password string, ok bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		path = filepath.Join(home, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+
+	type entry struct{ login, password string }
+	var found, fallback *entry
+	var current *entry
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		next := func() string {
+			if i+1 < len(fields) {
+				i++
+				return fields[i]
+			}
+			return ""
+		}
+		switch fields[i] {
+		case "machine":
+			current = nil
+			if next() == host && found == nil {
+				found = &entry{}
+				current = found
+			}
+		case "default":
+			current = nil
+			if fallback == nil {
+				fallback = &entry{}
+				current = fallback
+			}
+		case "login":
+			if value := next(); current != nil {
+				current.login = value
+			}
+		case "password":
+			if value := next(); current != nil {
+				current.password = value
+			}
+		}
+	}
+	for _, e := range []*entry{found, fallback} {
+		if e != nil && e.password != "" {
+			return e.login, e.password, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// gitSource is a git input resolved to what to fetch: the clone URL, the
+// branch, tag or commit, and the directory in the repository to pack.
+type gitSource struct {
+	repo  *url.URL
+	ref   string // empty for the remote's HEAD
+	dir   string
+	forge string // github, gitlab, bitbucket or azure when known, for tokens
+}
+
+// gitForges maps the hosts of the public forges to their kind. Self-hosted
+// instances are recognized by a gitlab. or bitbucket. host name, or by
+// their URL layout, to read their web URLs; only the public hosts are sent
+// the forges' tokens.
+var gitForges = map[string]string{
+	"github.com":        "github",
+	"gitlab.com":        "gitlab",
+	"bitbucket.org":     "bitbucket",
+	"dev.azure.com":     "azure",
+	"ssh.dev.azure.com": "azure",
+}
+
+// scpLikeURL matches the user@host:path form of SSH remotes.
+var scpLikeURL = regexp.MustCompile(`^([\w.-]+)@([\w.-]+):([^/\\].*)$`)
+
+// parseGitInput recognizes a git input: a git+https, git+ssh, git+file or
+// git URL, an SSH remote such as git@gitlab.com:group/repo.git, or the web
+// URL of a repository on GitHub, GitLab, Bitbucket or Azure DevOps,
+// including the pages of a branch or directory (…/tree/main/src,
+// …/-/tree/main/src, …/src/main/src, on Bitbucket Server
+// …/browse/src?at=main and on Azure DevOps …/_git/repo?path=/src&version=GBmain).
+// A #ref fragment selects the branch, tag or commit.
+func parseGitInput(input string) (gitSource, bool) {
+	if m := scpLikeURL.FindStringSubmatch(input); m != nil {
+		input = "git+ssh://" + m[1] + "@" + m[2] + "/" + m[3]
+	}
+	u, err := url.Parse(input)
+	if err != nil || u.Host == "" && u.Scheme != "git+file" {
+		return gitSource{}, false
+	}
+	src := gitSource{ref: u.Fragment, forge: forgeKind(u)}
+	repo := *u
+	repo.Fragment = ""
+
+	switch {
+	case u.Scheme == "git" || strings.HasPrefix(u.Scheme, "git+"):
+		repo.Scheme = strings.TrimPrefix(u.Scheme, "git+")
+	case (u.Scheme == "https" || u.Scheme == "http") && (src.forge != "" || strings.HasSuffix(u.Path, ".git")):
+		if src.forge != "" {
+			var ref string
+			repo.Path, ref, src.dir = splitForgePath(src.forge, u)
+			if ref != "" {
+				src.ref = ref
+			}
+			repo.RawQuery = ""
+		}
+	default:
+		return gitSource{}, false
+	}
+	src.repo = &repo
+	return src, true
+}
+
+func forgeKind(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if kind, ok := gitForges[host]; ok {
+		return kind
+	}
+	switch {
+	case strings.HasSuffix(host, ".visualstudio.com"):
+		return "azure"
+	case strings.HasPrefix(host, "gitlab.") || strings.Contains(u.Path, "/-/"):
+		return "gitlab"
+	case strings.HasPrefix(host, "bitbucket.") || strings.HasPrefix(u.Path, "/projects/"):
+		return "bitbucket"
+	case strings.HasPrefix(host, "github."):
+		return "github"
+	}
+	return ""
+}
+
+// splitForgePath splits the path of a forge web URL into the repository
+// path, the ref and the directory it shows.
+func splitForgePath(forge string, u *url.URL) (repoPath, ref, dir string) {
+	p := strings.Trim(u.Path, "/")
+	var rest string
+	switch forge {
+	case "azure":
+		// dev.azure.com/org/project/_git/repo?path=/src&version=GBmain; the
+		// version is GB, GT or GC and a branch, tag or commit
+		if before, after, ok := strings.Cut(p, "/_git/"); ok {
+			repo, _, _ := strings.Cut(after, "/")
+			p = before + "/_git/" + repo
+		}
+		if version := u.Query().Get("version"); len(version) > 2 {
+			ref = version[2:]
+		}
+		return "/" + p, ref, strings.Trim(u.Query().Get("path"), "/")
+	case "gitlab":
+		// Groups nest, so the repository ends where /-/ starts
+		if before, after, ok := strings.Cut(p, "/-/"); ok {
+			p = before
+			if view, tail, ok := strings.Cut(after, "/"); ok && view == "tree" {
+				rest = tail
+			}
+		}
+	case "bitbucket":
+		// Bitbucket Server: /projects/P/repos/R/browse/dir?at=ref
+		if parts := strings.Split(p, "/"); len(parts) >= 4 && parts[0] == "projects" && parts[2] == "repos" {
+			repoPath = "/scm/" + strings.ToLower(parts[1]) + "/" + parts[3] + ".git"
+			if len(parts) > 5 && parts[4] == "browse" {
+				dir = strings.Join(parts[5:], "/")
+			}
+			return repoPath, strings.TrimPrefix(u.Query().Get("at"), "refs/heads/"), dir
+		}
+		if parts := strings.SplitN(p, "/", 4); len(parts) == 4 && parts[2] == "src" {
+			p, rest = parts[0]+"/"+parts[1], parts[3]
+		}
+	default:
+		if parts := strings.SplitN(p, "/", 4); len(parts) == 4 && parts[2] == "tree" {
+			p, rest = parts[0]+"/"+parts[1], parts[3]
+		}
+	}
+	// A branch with a slash in its name cannot be told from a directory
+	// here; such branches are selected with #ref instead
+	ref, dir, _ = strings.Cut(rest, "/")
+	if !strings.HasSuffix(p, ".git") {
+		p += ".git"
+	}
+	return "/" + p, ref, strings.Trim(dir, "/")
+}
+
+// gitFetch checks out a git repository at the selected ref, the remote's
+// HEAD by default, and streams it with git archive. Only the one commit is
+// fetched. With -paths, or a URL naming a directory, the checkout is sparse
+// and the clone partial, so only the blobs of those subtrees cross the
+// network.
+func gitFetch(ctx context.Context, src gitSource, config *Config) (*remoteFetch, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git input requires git: %w", err)
+	}
+	if err := checkGitRef(src.ref); err != nil {
+		return nil, err
+	}
+	paths := config.remotePaths
+	if src.dir != "" {
+		if len(paths) > 0 {
+			return nil, fmt.Errorf("-paths cannot be combined with an input URL naming a directory (%s)", src.dir)
+		}
+		paths = []string{src.dir}
+	}
+	ref := src.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	dir, err := os.MkdirTemp("", "contextify-clone-*")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	steps := [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", src.repo.String()},
+	}
+	fetch := []string{"fetch", "-q", "--depth", "1", "--no-tags"}
+	if len(paths) > 0 {
+		sparse := []string{"sparse-checkout", "set", "--no-cone"}
+		for _, p := range paths {
+			sparse = append(sparse, "/"+strings.Trim(p, "/")+"/", "/"+strings.Trim(p, "/"))
+		}
+		steps = append(steps, sparse)
+		fetch = append(fetch, "--filter=blob:none")
+	}
+	steps = append(steps, append(fetch, "--end-of-options", "origin", ref), []string{"checkout", "-q", "FETCH_HEAD"})
+	env := gitAuthEnv(src, config.logger)
+	for _, args := range steps {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = env
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	archive := []string{"-C", dir, "archive", "--format=tar", "FETCH_HEAD"}
+	if len(paths) > 0 {
+		archive = append(archive, "--")
+		for _, p := range paths {
+			archive = append(archive, strings.Trim(p, "/"))
+		}
+	}
+	return &remoteFetch{cmd: exec.CommandContext(ctx, "git", archive...), prefix: src.dir, cleanup: cleanup}, nil
+}
+
+// checkGitRef rejects a ref from an input URL that git would take for an
+// option, or that is not a valid ref name; the URL alone must not be able
+// to change what git runs.
+func checkGitRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("git ref %q starts with \"-\"", ref)
+	}
+	if err := exec.Command("git", "check-ref-format", "--allow-onelevel", ref).Run(); err != nil {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	return nil
+}
+
+// isGitInput reports whether an input is a git repository.
+func isGitInput(input string) bool {
+	_, ok := parseGitInput(input)
+	return ok
+}
+
+// gitInputLabel names a git input in the header, without credentials.
+func gitInputLabel(src gitSource) string {
+	label := src.repo.Redacted()
+	if src.ref != "" {
+		label += "#" + src.ref
+	}
+	if src.dir != "" {
+		label += " (" + path.Clean(src.dir) + ")"
+	}
+	return label
+}
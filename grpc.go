@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcChunkSize is the most content a StreamPack chunk carries.
+const grpcChunkSize = 64 << 10
+
+// The gRPC service of proto/contextify.proto. The few messages are encoded
+// by hand with protowire rather than generated, so serving gRPC needs no
+// code generation step.
+var contextifyService = grpc.ServiceDesc{
+	ServiceName: "contextify.v1.Contextify",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Pack", Handler: grpcUnary((*packServer).grpcPack)},
+		{MethodName: "Stats", Handler: grpcUnary((*packServer).grpcStats)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamPack", Handler: grpcStreamPack, ServerStreams: true},
+	},
+	Metadata: "proto/contextify.proto",
+}
+
+func newGRPCServer(s *packServer) *grpc.Server {
+	server := grpc.NewServer(grpc.ForceServerCodec(wireCodec{}))
+	server.RegisterService(&contextifyService, s)
+	return server
+}
+
+func grpcUnary(handle func(*packServer, context.Context, *packRequest) (wireMessage, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		req := &packRequest{}
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		return handle(srv.(*packServer), ctx, req)
+	}
+}
+
+func (s *packServer) grpcConfig(ctx context.Context, req *packRequest) (*Config, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	t, err := s.authenticate(authorization)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	params := url.Values{}
+	for name, value := range req.flags {
+		params.Set(name, value)
+	}
+	config, err := s.paramsConfig(params, t)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return config, nil
+}
+
+// grpcPackError maps a failed pack to a status.
+func (s *packServer) grpcPackError(config *Config, code int, err error) error {
+	switch {
+	case code != exitFailure && code != exitCancelled:
+		return nil
+	case errors.Is(err, errBusy), errors.Is(err, errLimitExceeded):
+		s.logger.Warn("Request over limits", "input", config.inputPath, "error", err)
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case code == exitCancelled:
+		return status.Error(codes.Canceled, "pack cancelled")
+	}
+	s.logger.Error("Failed to pack", "input", config.inputPath, "error", err)
+	return status.Error(codes.Internal, "failed to pack: "+err.Error())
+}
+
+func (s *packServer) grpcPack(ctx context.Context, req *packRequest) (wireMessage, error) {
+	config, err := s.grpcConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	config.outputWriter = &buf
+	code, err := s.run(ctx, config, true)
+	if err := s.grpcPackError(config, code, err); err != nil {
+		return nil, err
+	}
+	return &packResponse{content: buf.Bytes(), summary: config.result}, nil
+}
+
+func (s *packServer) grpcStats(ctx context.Context, req *packRequest) (wireMessage, error) {
+	config, err := s.grpcConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	config.outputWriter = io.Discard
+	config.outputPath = ""
+	code, err := s.run(ctx, config, false)
+	if err := s.grpcPackError(config, code, err); err != nil {
+		return nil, err
+	}
+	return &statsResponse{summary: config.result}, nil
+}
+
+func grpcStreamPack(srv any, stream grpc.ServerStream) error {
+	s := srv.(*packServer)
+	req := &packRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	config, err := s.grpcConfig(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	chunks := &chunkSender{stream: stream}
+	config.outputWriter = chunks
+	code, err := s.run(stream.Context(), config, true)
+	if err := s.grpcPackError(config, code, err); err != nil {
+		return err
+	}
+	if chunks.err != nil {
+		return chunks.err
+	}
+	return stream.SendMsg(&packChunk{content: chunks.buf.Bytes(), summary: config.result})
+}
+
+// chunkSender sends what is written to it as PackChunk messages of up to
+// grpcChunkSize, keeping the remainder for the final chunk.
+type chunkSender struct {
+	stream grpc.ServerStream
+	buf    bytes.Buffer
+	err    error
+}
+
+func (c *chunkSender) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.buf.Write(p)
+	for c.buf.Len() > grpcChunkSize {
+		if c.err = c.stream.SendMsg(&packChunk{content: c.buf.Next(grpcChunkSize)}); c.err != nil {
+			return 0, c.err
+		}
+	}
+	return len(p), nil
+}
+
+// wireMessage is a message the server sends; wireCodec also decodes
+// packRequest.
+type wireMessage interface {
+	marshal() []byte
+}
+
+type wireCodec struct{}
+
+func (wireCodec) Name() string { return "proto" }
+
+func (wireCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v any) error {
+	req, ok := v.(*packRequest)
+	if !ok {
+		return fmt.Errorf("cannot decode %T", v)
+	}
+	return req.unmarshal(data)
+}
+
+type packRequest struct {
+	flags map[string]string
+}
+
+func (r *packRequest) unmarshal(data []byte) error {
+	r.flags = make(map[string]string)
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		// A map entry is a message with the key as field 1 and the value as
+		// field 2
+		var key, val string
+		err := consumeFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				key = string(value)
+			case num == 2 && typ == protowire.BytesType:
+				val = string(value)
+			}
+			return nil
+		})
+		r.flags[key] = val
+		return err
+	})
+}
+
+// consumeFields calls fn for each field of a message. value holds the
+// payload of length-delimited fields and is nil for the others.
+func consumeFields(data []byte, fn func(protowire.Number, protowire.Type, []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(data)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type packResponse struct {
+	content []byte
+	summary *runResult
+}
+
+func (m *packResponse) marshal() []byte {
+	b := appendBytesField(nil, 1, m.content)
+	return appendBytesField(b, 2, marshalSummary(m.summary))
+}
+
+type statsResponse struct {
+	summary *runResult
+}
+
+func (m *statsResponse) marshal() []byte {
+	return appendBytesField(nil, 1, marshalSummary(m.summary))
+}
+
+type packChunk struct {
+	content []byte
+	summary *runResult // set on the last chunk
+}
+
+func (m *packChunk) marshal() []byte {
+	b := appendBytesField(nil, 1, m.content)
+	if m.summary != nil {
+		b = appendBytesField(b, 2, marshalSummary(m.summary))
+	}
+	return b
+}
+
+func marshalSummary(r *runResult) []byte {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(r.Status))
+	b = appendVarintField(b, 2, int64(r.ExitCode))
+	b = appendVarintField(b, 3, int64(r.FilesScanned))
+	b = appendVarintField(b, 4, int64(r.FilesMatched))
+	b = appendVarintField(b, 5, int64(r.FilesIncluded))
+	for _, skipped := range r.FilesSkipped {
+		entry := appendBytesField(nil, 1, []byte(skipped.Path))
+		entry = appendBytesField(entry, 2, []byte(skipped.Reason))
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	b = appendVarintField(b, 7, r.BytesWritten)
+	b = appendVarintField(b, 8, int64(r.Tokens))
+	b = appendBytesField(b, 9, []byte(r.Error))
+	return appendVarintField(b, 10, r.DurationMs)
+}
+
+// appendBytesField and appendVarintField leave out zero values, as proto3
+// does.
+func appendBytesField(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+func appendVarintField(b []byte, num protowire.Number, value int64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(value))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// flagEntry encodes one entry of PackRequest.flags.
+func flagEntry(key, value string) []byte {
+	entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, key)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, value)
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
+
+func TestPackRequestUnmarshal(t *testing.T) {
+	unknown := protowire.AppendTag(nil, 7, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 42)
+	wrongType := protowire.AppendTag(nil, 1, protowire.VarintType)
+	wrongType = protowire.AppendVarint(wrongType, 1)
+	tests := []struct {
+		name    string
+		data    []byte
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", nil, map[string]string{}, false},
+		{"flags", append(flagEntry("input", "src"), flagEntry("extensions", ".go,.mod")...), map[string]string{"input": "src", "extensions": ".go,.mod"}, false},
+		{"later entry wins", append(flagEntry("input", "a"), flagEntry("input", "b")...), map[string]string{"input": "b"}, false},
+		{"empty value", flagEntry("quiet", ""), map[string]string{"quiet": ""}, false},
+		{"unknown fields skipped", bytes.Join([][]byte{unknown, flagEntry("input", "src"), wrongType}, nil), map[string]string{"input": "src"}, false},
+		{"truncated", flagEntry("input", "src")[:5], nil, true},
+		{"bad tag", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req packRequest
+			err := wireCodec{}.Unmarshal(tt.data, &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(req.flags, tt.want) {
+				t.Errorf("flags = %v, want %v", req.flags, tt.want)
+			}
+		})
+	}
+}
+
+// wireFields decodes the fields of a message by number, keeping each
+// occurrence: the payload of length-delimited fields, the value of varints.
+func wireFields(t *testing.T, data []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := make(map[protowire.Number][]any)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			fields[num] = append(fields[num], string(v))
+			data = data[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			fields[num] = append(fields[num], int64(v))
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d for field %d", typ, num)
+		}
+	}
+	return fields
+}
+
+func TestMarshalSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *runResult
+		want   map[protowire.Number][]any
+	}{
+		{"zero values left out", &runResult{}, map[protowire.Number][]any{}},
+		{
+			name: "all fields",
+			result: &runResult{
+				Status: "partial", ExitCode: exitPartial, FilesScanned: 3, FilesMatched: 2, FilesIncluded: 1,
+				FilesSkipped: []skippedFile{{Path: "a.bin", Reason: "binary"}, {Path: "b", Reason: "too large"}},
+				BytesWritten: 1 << 20, Tokens: 300, Error: "boom", DurationMs: 12,
+			},
+			want: map[protowire.Number][]any{
+				1: {"partial"}, 2: {int64(exitPartial)}, 3: {int64(3)}, 4: {int64(2)}, 5: {int64(1)},
+				6:  {"\n\x05a.bin\x12\x06binary", "\n\x01b\x12\ttoo large"},
+				7:  {int64(1 << 20)},
+				8:  {int64(300)},
+				9:  {"boom"},
+				10: {int64(12)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wireFields(t, marshalSummary(tt.result))
+			if len(got) != len(tt.want) {
+				t.Errorf("fields %v, want %v", got, tt.want)
+			}
+			for num, want := range tt.want {
+				if !slices.Equal(got[num], want) {
+					t.Errorf("field %d = %q, want %q", num, got[num], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWireMessages(t *testing.T) {
+	summary := &runResult{Status: "success"}
+	encodedSummary := string(marshalSummary(summary))
+	tests := []struct {
+		name string
+		msg  wireMessage
+		want map[protowire.Number][]any
+	}{
+		{"pack response", &packResponse{content: []byte("ctx"), summary: summary}, map[protowire.Number][]any{1: {"ctx"}, 2: {encodedSummary}}},
+		{"stats response", &statsResponse{summary: summary}, map[protowire.Number][]any{1: {encodedSummary}}},
+		{"chunk", &packChunk{content: []byte("part")}, map[protowire.Number][]any{1: {"part"}}},
+		{"last chunk", &packChunk{content: []byte("end"), summary: summary}, map[protowire.Number][]any{1: {"end"}, 2: {encodedSummary}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := wireCodec{}.Marshal(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := wireFields(t, data)
+			if len(got) != len(tt.want) {
+				t.Errorf("fields %v, want %v", got, tt.want)
+			}
+			for num, want := range tt.want {
+				if !slices.Equal(got[num], want) {
+					t.Errorf("field %d = %q, want %q", num, got[num], want)
+				}
+			}
+		})
+	}
+	if _, err := (wireCodec{}).Marshal("not a message"); err == nil {
+		t.Error("Marshal accepted a value that is not a message")
+	}
+}
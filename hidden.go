@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+)
+
+var hiddenModes = []string{"default", "include", "exclude"}
+
+// hiddenJunk lists editor and OS metadata skipped in the default hidden
+// mode.
+var hiddenJunk = map[string]bool{
+	".DS_Store":   true,
+	".idea":       true,
+	".vscode":     true,
+	"Thumbs.db":   true,
+	"desktop.ini": true,
+}
+
+// skipHidden reports whether an entry should be left out under the given
+// hidden mode. include keeps every hidden entry, exclude drops dotfiles and
+// entries with the Windows hidden attribute, and default keeps them except
+// for well-known editor and OS metadata. .git is excluded separately.
+func skipHidden(d fs.DirEntry, mode string) bool {
+	name := d.Name()
+	switch mode {
+	case "include":
+		return false
+	case "exclude":
+		return strings.HasPrefix(name, ".") || hasHiddenAttribute(d)
+	default:
+		return hiddenJunk[name]
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+// hasHiddenAttribute is always false outside Windows, where hidden files are
+// identified by their leading dot alone.
+func hasHiddenAttribute(fs.DirEntry) bool {
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// preHookEvent is what -pre-hook receives on stdin. -post-hook receives
+// the run summary, as written by -result-json.
+type preHookEvent struct {
+	Event  string `json:"event"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Format string `json:"format"`
+}
+
+// runHook runs a -pre-hook or -post-hook command with payload as JSON on
+// stdin. The command's own output goes to stderr, clear of an output
+// written to stdout. An empty command line does nothing.
+func runHook(ctx context.Context, name, line string, payload any) error {
+	if line == "" {
+		return nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	cmd := shellCommand(ctx, line)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+// outputWritten reports whether a run with this exit code produced output
+// for a -post-hook to act on.
+func outputWritten(code int) bool {
+	return code == exitSuccess || code == exitPartial || code == exitBudgetExceeded
+}
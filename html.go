@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// htmlFormatter renders the context as a standalone HTML page with a file
+// tree and highlighted code. The page needs the whole context to build the
+// tree, so unlike the other formats it buffers the output until close.
+type htmlFormatter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (h *htmlFormatter) Write(p []byte) (int, error) {
+	return h.buf.Write(p)
+}
+
+func (h *htmlFormatter) close() error {
+	data := h.buf.Bytes()
+	page := htmlPage{Title: "Contextify Output"}
+	files, start, end, err := parseContextBlocks(data)
+	if err != nil {
+		// Content that defeats the block parser is still shown, unstructured
+		page.Header = string(data)
+	} else {
+		page.Header = string(data[:start])
+		page.Trailer = string(data[end:])
+		for i, file := range files {
+			page.Files = append(page.Files, htmlFile{
+				ID:   fmt.Sprintf("file-%d", i+1),
+				Path: file.path,
+				Code: highlight(file.path, string(file.content)),
+			})
+		}
+		page.Tree = buildFileTree(page.Files)
+	}
+	for _, line := range strings.Split(page.Header, "\n") {
+		if source, ok := strings.CutPrefix(line, "# Generated from: "); ok {
+			page.Title = source
+		}
+	}
+	return htmlTemplate.Execute(h.w, page)
+}
+
+type htmlPage struct {
+	Title   string
+	Header  string
+	Trailer string
+	Files   []htmlFile
+	Tree    []*treeNode
+}
+
+type htmlFile struct {
+	ID   string
+	Path string
+	Code template.HTML
+}
+
+// treeNode is a directory or file in the sidebar.
+type treeNode struct {
+	Name     string
+	ID       string // set for files
+	Children []*treeNode
+}
+
+func buildFileTree(files []htmlFile) []*treeNode {
+	root := &treeNode{}
+	for _, file := range files {
+		node := root
+		parts := strings.Split(file.Path, "/")
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				node.Children = append(node.Children, &treeNode{Name: part, ID: file.ID})
+				break
+			}
+			var dir *treeNode
+			for _, child := range node.Children {
+				if child.ID == "" && child.Name == part {
+					dir = child
+				}
+			}
+			if dir == nil {
+				dir = &treeNode{Name: part}
+				node.Children = append(node.Children, dir)
+			}
+			node = dir
+		}
+	}
+	sortTree(root)
+	return root.Children
+}
+
+// sortTree lists directories before files, each by name.
+func sortTree(node *treeNode) {
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if (a.ID == "") != (b.ID == "") {
+			return a.ID == ""
+		}
+		return a.Name < b.Name
+	})
+	for _, child := range node.Children {
+		sortTree(child)
+	}
+}
+
+// highlightKeywords is a union of the keywords of common languages; a
+// word that is a keyword in one language is rarely an identifier in code of
+// another.
+var highlightKeywords = toSet(strings.Fields(`
+	abstract as async await break case catch class const continue def default defer del do elif else
+	enum export extends false final finally fn for from func function go if impl implements import in
+	interface is lambda let loop match mod module mut namespace new nil none null package pass private
+	protected pub public raise return select self static struct super switch this throw throws trait
+	true try type typeof undefined use var void where while with yield`))
+
+func toSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// highlight marks up comments, strings, numbers and keywords. It is a
+// lexical approximation that works across C-like languages, Python, shell
+// and the like; prose and data files are only escaped.
+func highlight(filePath, code string) template.HTML {
+	language := detectLanguage(filePath)
+	lineComment := "//"
+	switch language {
+	case "Markdown", "Text", "reStructuredText", "AsciiDoc", "CSV", "TSV", "Other":
+		return template.HTML(template.HTMLEscapeString(code))
+	case "Python", "Shell", "Ruby", "YAML", "TOML", "Makefile", "Dockerfile", "Perl", "R", "Elixir", "INI", "Dotenv", "Ignore List":
+		lineComment = "#"
+	case "SQL", "Lua", "Haskell":
+		lineComment = "--"
+	}
+
+	var out strings.Builder
+	span := func(class, text string) {
+		fmt.Fprintf(&out, `<span class="%s">%s</span>`, class, template.HTMLEscapeString(text))
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		switch c := code[i]; {
+		case strings.HasPrefix(rest, lineComment):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			span("c", rest[:end])
+			i += end
+		case lineComment == "//" && strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			span("c", rest[:end])
+			i += end
+		case c == '"' || c == '\'' || c == '`':
+			end := 1
+			for end < len(rest) && rest[end] != c && (c == '`' || rest[end] != '\n') {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(rest))
+			span("s", rest[:end])
+			i += end
+		case isWordByte(c):
+			end := 1
+			for end < len(rest) && isWordByte(rest[end]) {
+				end++
+			}
+			word := rest[:end]
+			switch {
+			case c >= '0' && c <= '9':
+				span("n", word)
+			case highlightKeywords[word]:
+				span("k", word)
+			default:
+				out.WriteString(template.HTMLEscapeString(word))
+			}
+			i += end
+		default:
+			out.WriteString(template.HTMLEscapeString(rest[:1]))
+			i++
+		}
+	}
+	return template.HTML(out.String())
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+var htmlTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; display: flex; font: 14px/1.5 system-ui, sans-serif; color: #24292f; }
+nav { position: sticky; top: 0; height: 100vh; overflow: auto; width: 280px; flex: none; padding: 12px; box-sizing: border-box; background: #f6f8fa; border-right: 1px solid #d0d7de; }
+nav ul { list-style: none; margin: 0; padding-left: 14px; }
+nav > ul { padding-left: 0; }
+nav summary { cursor: pointer; font-weight: 600; }
+nav a { color: #0969da; text-decoration: none; }
+nav a:hover { text-decoration: underline; }
+main { flex: 1; min-width: 0; padding: 12px 24px; }
+section { margin-bottom: 24px; }
+h2 { font-size: 15px; font-family: ui-monospace, monospace; border-bottom: 1px solid #d0d7de; padding-bottom: 4px; }
+pre { background: #f6f8fa; padding: 12px; overflow: auto; font: 13px/1.45 ui-monospace, SFMono-Regular, Menlo, monospace; border-radius: 6px; }
+.c { color: #6e7781; font-style: italic; }
+.s { color: #0a3069; }
+.n { color: #0550ae; }
+.k { color: #cf222e; }
+</style>
+</head>
+<body>
+<nav>
+<ul>
+{{- template "tree" .Tree}}
+</ul>
+</nav>
+<main>
+<pre>{{.Header}}</pre>
+{{- range .Files}}
+<section id="{{.ID}}">
+<h2>{{.Path}}</h2>
+<pre><code>{{.Code}}</code></pre>
+</section>
+{{- end}}
+{{- if .Trailer}}
+<pre>{{.Trailer}}</pre>
+{{- end}}
+</main>
+</body>
+</html>
+{{define "tree"}}
+{{- range .}}
+{{- if .ID}}
+<li><a href="#{{.ID}}">{{.Name}}</a></li>
+{{- else}}
+<li><details open><summary>{{.Name}}</summary><ul>{{template "tree" .Children}}</ul></details></li>
+{{- end}}
+{{- end}}
+{{- end}}
+`))
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is contextify's own ignore file. It uses gitignore syntax
+// but is independent of .gitignore, so exclusions that only matter for LLM
+// context can be versioned without changing what git tracks.
+const ignoreFileName = ".contextifyignore"
+
+// ignoreRules holds the patterns of the ignore files seen so far in a walk.
+// As in git, the last matching pattern decides and patterns from deeper
+// files come later.
+type ignoreRules struct {
+	patterns []gitPattern
+}
+
+// load reads a directory's .contextifyignore, if there is one.
+func (r *ignoreRules) load(absDir, relDir string) error {
+	err := r.loadFile(filepath.Join(absDir, ignoreFileName), filepath.Join(relDir, ignoreFileName), relDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// loadFile reads an ignore file whose patterns apply below relDir. name is
+// how the file is shown where a pattern is traced back to it.
+func (r *ignoreRules) loadFile(path, name, relDir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	base := filepath.ToSlash(relDir)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if pattern, ok := parseGitPattern(base, scanner.Text()); ok {
+			pattern.source = fmt.Sprintf("%s:%d: %s", filepath.ToSlash(name), n, strings.TrimSpace(scanner.Text()))
+			r.patterns = append(r.patterns, pattern)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+func (r *ignoreRules) ignored(relPath string, isDir bool) bool {
+	p := r.matching(relPath, isDir)
+	return p != nil && !p.negate
+}
+
+// matching returns the pattern that decides whether a path is ignored, or
+// nil if none matches.
+func (r *ignoreRules) matching(relPath string, isDir bool) *gitPattern {
+	relPath = filepath.ToSlash(relPath)
+	for i := len(r.patterns) - 1; i >= 0; i-- {
+		if r.patterns[i].match(relPath, isDir) {
+			return &r.patterns[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// sourceMarker matches a comment line holding only a contextify marker, in
+// the comment syntax of most languages. Requiring the whole comment keeps
+// prose that mentions a marker from triggering it.
+var sourceMarker = regexp.MustCompile(`^\s*(?://+|#+|--|;+|%+|/\*+|\*|<!--|\{/\*|\{#|'|REM\b)\s*contextify:(ignore-file|begin-ignore|end-ignore|begin-include|end-include)\s*(?:\*/\}?|-->|#\}|%\})?\s*$`)
+
+// applySourceMarkers leaves out what developers marked in the source: the
+// whole file for "contextify:ignore-file", and the lines between
+// "contextify:begin-ignore" and "contextify:end-ignore", markers included,
+// which are replaced by a note naming them. A begin-ignore without an end
+// runs to the end of the file.
+//
+// With regionsOnly, a file holding "contextify:begin-include" and
+// "contextify:end-include" markers is cut down to the lines between them,
+// as -regions-only asks; files without them are kept whole.
+func applySourceMarkers(data []byte, regionsOnly bool) ([]byte, bool) {
+	if !bytes.Contains(data, []byte("contextify:")) {
+		return data, true
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	ignored := make([]bool, len(lines))
+	var included []lineRange
+	ignoreFrom, includeFrom := 0, 0 // first line of the open region, 1-based
+	for i, line := range lines {
+		n := i + 1
+		m := sourceMarker.FindSubmatch(bytes.TrimRight(line, "\r\n"))
+		marker := ""
+		if m != nil {
+			marker = string(m[1])
+		}
+		switch marker {
+		case "ignore-file":
+			return nil, false
+		case "begin-ignore":
+			if ignoreFrom == 0 {
+				ignoreFrom = n
+			}
+		case "end-ignore":
+			ignored[i] = true
+			ignoreFrom = 0
+		case "begin-include":
+			if includeFrom == 0 {
+				includeFrom = n
+			}
+		case "end-include":
+			if includeFrom > 0 && n > includeFrom+1 {
+				included = append(included, lineRange{includeFrom + 1, n - 1})
+			}
+			includeFrom = 0
+		}
+		if ignoreFrom > 0 {
+			ignored[i] = true
+		}
+	}
+
+	if regionsOnly && len(included) > 0 {
+		var ranges []lineRange
+		for _, r := range included {
+			for n := r.from; n <= r.to; n++ {
+				if ignored[n-1] {
+					continue
+				}
+				if len(ranges) > 0 && ranges[len(ranges)-1].to == n-1 {
+					ranges[len(ranges)-1].to = n
+				} else {
+					ranges = append(ranges, lineRange{n, n})
+				}
+			}
+		}
+		return keepLines(data, ranges, 0), true
+	}
+
+	var out bytes.Buffer
+	for i := 0; i < len(lines); i++ {
+		if !ignored[i] {
+			out.Write(lines[i])
+			continue
+		}
+		from := i
+		for i+1 < len(lines) && ignored[i+1] {
+			i++
+		}
+		// A lone end-ignore is dropped without a note
+		if i > from || ignoreMarkerKind(lines[i]) != "end-ignore" {
+			out.WriteString(ignoredLines(from+1, i+1))
+		}
+	}
+	return out.Bytes(), true
+}
+
+func ignoreMarkerKind(line []byte) string {
+	if m := sourceMarker.FindSubmatch(bytes.TrimRight(line, "\r\n")); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+func ignoredLines(from, to int) string {
+	return fmt.Sprintf("... [lines %d-%d left out by contextify:begin-ignore] ...\n", from, to)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+var imageModes = []string{"placeholder", "base64"}
+
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".bmp", ".ico", ".tif", ".tiff", ".avif", ".heic"}
+
+func isImageFile(path string) bool {
+	return hasExtension(imageExtensions...)(sourceFile{path: path})
+}
+
+// imagePlaceholder replaces an image with a line giving its format,
+// dimensions and size for -images. In base64 mode a data URI of the image
+// follows, for models that accept images inline.
+func imagePlaceholder(src sourceFile, data []byte, mode string) []byte {
+	format, width, height := imageInfo(src.path, data)
+	dimensions := "unknown dimensions"
+	if width > 0 && height > 0 {
+		dimensions = fmt.Sprintf("%dx%d pixels", width, height)
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "[image: %s, %s, %s]\n", format, dimensions, formatBytes(int64(len(data))))
+	if mode == "base64" {
+		fmt.Fprintf(&out, "data:%s;base64,%s\n", imageMediaType(src.path, format), base64.StdEncoding.EncodeToString(data))
+	}
+	return out.Bytes()
+}
+
+// imageInfo returns the format of an image and its dimensions, when they
+// can be read from its header: PNG, JPEG and GIF through the standard
+// decoders, and BMP and WebP directly.
+func imageInfo(path string, data []byte) (string, int, int) {
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return format, cfg.Width, cfg.Height
+	}
+	switch {
+	case len(data) >= 26 && string(data[:2]) == "BM":
+		width := int(int32(binary.LittleEndian.Uint32(data[18:])))
+		height := int(int32(binary.LittleEndian.Uint32(data[22:])))
+		return "bmp", width, max(height, -height)
+	case len(data) >= 30 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		switch string(data[12:16]) {
+		case "VP8 ":
+			return "webp", int(binary.LittleEndian.Uint16(data[26:]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:]) & 0x3fff)
+		case "VP8L":
+			bits := binary.LittleEndian.Uint32(data[21:])
+			return "webp", int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1
+		case "VP8X":
+			width := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+			height := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+			return "webp", width + 1, height + 1
+		}
+		return "webp", 0, 0
+	}
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."), 0, 0
+}
+
+func imageMediaType(path, format string) string {
+	if mediaType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); strings.HasPrefix(mediaType, "image/") {
+		return mediaType
+	}
+	return "image/" + format
+}
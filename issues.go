@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	issueRefsMarker = "## Issue References"
+	// issueLogDepth is how many recent commits are searched for references.
+	issueLogDepth = 200
+	// maxIssueMentions caps the places listed under one reference.
+	maxIssueMentions = 20
+	// maxIssueTitles caps the titles fetched from -issue-api in one run.
+	maxIssueTitles  = 200
+	issueAPITimeout = 10 * time.Second
+)
+
+var (
+	// Jira-style keys: PROJ-123
+	issueKeyPattern = regexp.MustCompile(`\b([A-Z][A-Z0-9_]+)-([1-9][0-9]{0,6})\b`)
+	// GitHub and GitLab numbers: #456, owner/repo#456, GH-456
+	issueNumberPattern = regexp.MustCompile(`(?:^|[^\w&/#])((?:[\w.-]+/[\w.-]+)?#([1-9][0-9]{0,6}))\b`)
+	// issueCommentStart finds where a line's comment begins, so identifiers,
+	// strings and CSS colors are not taken for references
+	issueCommentStart = regexp.MustCompile(`//|/\*|<!--|^\s*\*|^\s*(?:#|--|;)|\s#\s`)
+)
+
+// notIssueKeys are uppercase prefixes of standards, algorithms and
+// licenses that look like issue keys (UTF-8, SHA-256, RFC-7231).
+var notIssueKeys = map[string]bool{
+	"UTF": true, "UCS": true, "SHA": true, "MD": true, "ISO": true, "RFC": true, "CVE": true, "CWE": true,
+	"AES": true, "RSA": true, "HS": true, "RS": true, "ES": true, "PS": true, "TLS": true, "SSL": true,
+	"HTTP": true, "ECMA": true, "IEEE": true, "ANSI": true, "CRC": true, "PKCS": true, "ASN": true,
+	"GPL": true, "LGPL": true, "AGPL": true, "BSD": true, "MPL": true, "CC": true, "APACHE": true,
+	"INT": true, "UINT": true, "FLOAT": true, "WIN": true, "X": true, "COVID": true,
+}
+
+// proseExtensions are scanned whole rather than only in comments.
+var proseExtensions = map[string]bool{".md": true, ".markdown": true, ".rst": true, ".txt": true, ".adoc": true}
+
+// styleExtensions hold hex colors that read as "#123456".
+var styleExtensions = map[string]bool{".css": true, ".scss": true, ".sass": true, ".less": true, ".styl": true}
+
+// issueMention is a place that refers to an issue: a file line or a
+// commit.
+type issueMention struct {
+	path    string
+	line    int
+	commit  string
+	subject string
+}
+
+// issueCollector gathers the issue references of the included files and
+// of recent commits for -issue-refs.
+type issueCollector struct {
+	mentions map[string][]issueMention // by reference
+	apiURL   string                    // -issue-api template; empty fetches no titles
+	apiKey   string
+}
+
+func newIssueCollector(apiURL, keyEnv string) *issueCollector {
+	return &issueCollector{mentions: make(map[string][]issueMention), apiURL: apiURL, apiKey: os.Getenv(keyEnv)}
+}
+
+// issueScanner finds the references of one file as it streams through.
+type issueScanner struct {
+	lineFeed
+	path     string
+	prose    bool
+	numbers  bool
+	line     int
+	mentions map[string][]issueMention
+}
+
+func (c *issueCollector) scan(relPath string) *issueScanner {
+	ext := strings.ToLower(filepath.Ext(relPath))
+	s := &issueScanner{path: relPath, prose: proseExtensions[ext], numbers: !styleExtensions[ext], mentions: make(map[string][]issueMention)}
+	s.onLine = s.scanLine
+	return s
+}
+
+// commit records the references of a finished file if it made it into the
+// output.
+func (c *issueCollector) commit(s *issueScanner, keep bool) {
+	s.flush()
+	if !keep {
+		return
+	}
+	for ref, mentions := range s.mentions {
+		c.mentions[ref] = append(c.mentions[ref], mentions...)
+	}
+}
+
+func (s *issueScanner) scanLine(line []byte) {
+	s.line++
+	text := string(line)
+	if !s.prose {
+		loc := issueCommentStart.FindStringIndex(text)
+		if loc == nil {
+			return
+		}
+		text = text[loc[1]:]
+	}
+	for _, ref := range findIssueRefs(text, s.numbers) {
+		s.mentions[ref] = append(s.mentions[ref], issueMention{path: s.path, line: s.line})
+	}
+}
+
+// findIssueRefs returns the distinct references in text, in order.
+func findIssueRefs(text string, numbers bool) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	for _, m := range issueKeyPattern.FindAllStringSubmatchIndex(text, -1) {
+		project := text[m[2]:m[3]]
+		if notIssueKeys[project] || (m[0] > 0 && text[m[0]-1] == '-') {
+			continue
+		}
+		// Versions and ranges: X-1.2, SHA-2-256
+		if rest := text[m[1]:]; len(rest) > 1 && (rest[0] == '.' || rest[0] == '-') && rest[1] >= '0' && rest[1] <= '9' {
+			continue
+		}
+		if project == "GH" {
+			add("#" + text[m[4]:m[5]])
+			continue
+		}
+		add(text[m[0]:m[1]])
+	}
+	if numbers {
+		for _, m := range issueNumberPattern.FindAllStringSubmatch(text, -1) {
+			add(m[1])
+		}
+	}
+	return refs
+}
+
+// readLog collects the references in the messages of the last
+// issueLogDepth commits touching the input directory. An input outside a
+// git repository has none.
+func (c *issueCollector) readLog(ctx context.Context, absPath string, config *Config) {
+	cmd := exec.CommandContext(ctx, "git", "-C", absPath, "log", "-n", strconv.Itoa(issueLogDepth), "--format=%h%x1f%s%x1f%b%x1e", "--", ".")
+	out, err := cmd.Output()
+	if err != nil {
+		config.logger.Debug("No git history for issue references", "error", err)
+		return
+	}
+	commits := 0
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		commits++
+		for _, ref := range findIssueRefs(fields[1]+"\n"+fields[2], true) {
+			c.mentions[ref] = append(c.mentions[ref], issueMention{commit: fields[0], subject: fields[1]})
+		}
+	}
+	config.logger.Debug("Read git history for issue references", "commits", commits)
+}
+
+// titles fetches the title of each reference from -issue-api. A reference
+// the API does not know keeps no title; any other failure stops the
+// fetching, so a misconfigured API is not asked for every reference.
+func (c *issueCollector) titles(ctx context.Context, refs []string, config *Config) map[string]string {
+	titles := make(map[string]string)
+	if c.apiURL == "" {
+		return titles
+	}
+	fetched := 0
+	for _, ref := range refs {
+		target, ok := issueAPIURL(c.apiURL, ref)
+		if !ok {
+			continue
+		}
+		if fetched == maxIssueTitles {
+			config.logger.Warn("Fetched the most issue titles allowed, leaving the rest untitled", "max", maxIssueTitles)
+			break
+		}
+		fetched++
+		title, err := c.fetchTitle(ctx, target)
+		if err != nil {
+			config.logger.Warn("Failed to fetch issue title, leaving the rest untitled", "ref", ref, "error", err)
+			break
+		}
+		if title != "" {
+			titles[ref] = title
+		}
+	}
+	return titles
+}
+
+// issueAPIURL fills in the -issue-api template for a reference. A
+// template with {id} takes keys such as PROJ-123; one with {number} takes
+// numbers such as #123, and with {repo}, only those written owner/repo#123.
+// Other references are not fetched.
+func issueAPIURL(template, ref string) (string, bool) {
+	repo, number, isNumber := strings.Cut(ref, "#")
+	switch {
+	case strings.Contains(template, "{id}"):
+		if isNumber {
+			return "", false
+		}
+		return strings.ReplaceAll(template, "{id}", url.PathEscape(ref)), true
+	case strings.Contains(template, "{number}"):
+		if !isNumber || (strings.Contains(template, "{repo}") && repo == "") {
+			return "", false
+		}
+		return strings.NewReplacer("{number}", number, "{repo}", repo).Replace(template), true
+	}
+	return "", false
+}
+
+func (c *issueCollector) fetchTitle(ctx context.Context, target string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, issueAPITimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		// user:token, as Jira Cloud takes it, is sent as basic credentials
+		if strings.Contains(c.apiKey, ":") {
+			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.apiKey)))
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("API returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	// GitHub and GitLab name it title, Jira fields.summary, Redmine subject
+	var issue struct {
+		Title   string `json:"title"`
+		Subject string `json:"subject"`
+		Summary string `json:"summary"`
+		Fields  struct {
+			Summary string `json:"summary"`
+		} `json:"fields"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&issue); err != nil {
+		return "", fmt.Errorf("failed to decode issue: %w", err)
+	}
+	for _, title := range []string{issue.Title, issue.Fields.Summary, issue.Summary, issue.Subject} {
+		if title = strings.Join(strings.Fields(title), " "); title != "" {
+			return title, nil
+		}
+	}
+	return "", nil
+}
+
+// writeIssueSection lists each reference with its title, if fetched, and
+// the lines and commits that mention it.
+func writeIssueSection(ctx context.Context, writer *bufio.Writer, c *issueCollector, config *Config) error {
+	refs := make([]string, 0, len(c.mentions))
+	for ref := range c.mentions {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return issueLess(refs[i], refs[j]) })
+	titles := c.titles(ctx, refs, config)
+
+	if _, err := fmt.Fprintf(writer, "%s (%d)\n```\n", issueRefsMarker, len(refs)); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		heading := ref
+		if title := titles[ref]; title != "" {
+			heading += ": " + title
+		}
+		if _, err := fmt.Fprintln(writer, heading); err != nil {
+			return err
+		}
+		mentions := c.mentions[ref]
+		for _, m := range mentions[:min(len(mentions), maxIssueMentions)] {
+			var err error
+			if m.commit != "" {
+				_, err = fmt.Fprintf(writer, "  commit %s %s\n", m.commit, m.subject)
+			} else {
+				_, err = fmt.Fprintf(writer, "  %s:%d\n", config.displayPath(m.path), m.line)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(mentions) > maxIssueMentions {
+			if _, err := fmt.Fprintf(writer, "  ... and %d more\n", len(mentions)-maxIssueMentions); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
+
+// issueLess orders references by project or repository, then by number.
+func issueLess(a, b string) bool {
+	split := func(ref string) (string, int) {
+		i := strings.LastIndexAny(ref, "-#")
+		n, _ := strconv.Atoi(ref[i+1:])
+		return ref[:i+1], n
+	}
+	pa, na := split(a)
+	pb, nb := split(b)
+	if pa != pb {
+		return pa < pb
+	}
+	return na < nb
+}
+
+// issueRefsSetting describes -issue-refs for the manifest settings.
+func issueRefsSetting(c *issueCollector) string {
+	if c == nil {
+		return ""
+	}
+	if c.apiURL == "" {
+		return "on"
+	}
+	return "titles from " + c.apiURL
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// languageExtensions maps extensions to language names as GitHub linguist
+// reports them.
+var languageExtensions = map[string]string{
+	".go": "Go", ".mod": "Go Module", ".sum": "Go Checksums",
+	".py": "Python", ".pyi": "Python", ".ipynb": "Jupyter Notebook",
+	".js": "JavaScript", ".mjs": "JavaScript", ".cjs": "JavaScript", ".jsx": "JavaScript",
+	".ts": "TypeScript", ".mts": "TypeScript", ".cts": "TypeScript", ".tsx": "TSX",
+	".java": "Java", ".kt": "Kotlin", ".kts": "Kotlin", ".scala": "Scala", ".groovy": "Groovy", ".gradle": "Gradle",
+	".rs": "Rust", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++", ".cxx": "C++", ".hpp": "C++", ".hh": "C++",
+	".cs": "C#", ".fs": "F#", ".vb": "Visual Basic .NET", ".swift": "Swift", ".m": "Objective-C", ".mm": "Objective-C++",
+	".rb": "Ruby", ".php": "PHP", ".pl": "Perl", ".lua": "Lua", ".r": "R", ".dart": "Dart",
+	".ex": "Elixir", ".exs": "Elixir", ".erl": "Erlang", ".hs": "Haskell", ".ml": "OCaml", ".clj": "Clojure",
+	".zig": "Zig", ".nim": "Nim", ".jl": "Julia", ".sol": "Solidity", ".tf": "HCL", ".hcl": "HCL",
+	".sh": "Shell", ".bash": "Shell", ".zsh": "Shell", ".fish": "fish", ".ps1": "PowerShell", ".bat": "Batchfile",
+	".sql": "SQL", ".graphql": "GraphQL", ".gql": "GraphQL", ".proto": "Protocol Buffer",
+	".html": "HTML", ".htm": "HTML", ".css": "CSS", ".scss": "SCSS", ".sass": "Sass", ".less": "Less",
+	".vue": "Vue", ".svelte": "Svelte", ".astro": "Astro",
+	".json": "JSON", ".jsonl": "JSON Lines", ".ndjson": "JSON Lines", ".json5": "JSON5",
+	".yaml": "YAML", ".yml": "YAML", ".toml": "TOML", ".xml": "XML", ".ini": "INI", ".cfg": "INI", ".env": "Dotenv",
+	".csv": "CSV", ".tsv": "TSV", ".svg": "SVG", ".lock": "Lockfile", ".snap": "Jest Snapshot",
+	".md": "Markdown", ".markdown": "Markdown", ".mdx": "MDX", ".rst": "reStructuredText", ".adoc": "AsciiDoc",
+	".txt": "Text", ".tex": "TeX", ".org": "Org",
+}
+
+// languageFilenames maps well-known file names without a telling extension.
+var languageFilenames = map[string]string{
+	"dockerfile": "Dockerfile", "containerfile": "Dockerfile", "makefile": "Makefile", "gnumakefile": "Makefile",
+	"jenkinsfile": "Groovy", "rakefile": "Ruby", "gemfile": "Ruby", "vagrantfile": "Ruby", "cmakelists.txt": "CMake",
+	"go.mod": "Go Module", "go.sum": "Go Checksums", "go.work": "Go Workspace",
+	"package-lock.json": "Lockfile", "yarn.lock": "Lockfile", "pnpm-lock.yaml": "Lockfile", "cargo.lock": "Lockfile",
+	".gitignore": "Ignore List", ".dockerignore": "Ignore List", ".gitattributes": "Git Attributes",
+	"license": "Text", "notice": "Text", "readme": "Text",
+}
+
+// detectLanguage names the language of a file, or "Other".
+func detectLanguage(relPath string) string {
+	base := strings.ToLower(filepath.Base(relPath))
+	if language, ok := languageFilenames[base]; ok {
+		return language
+	}
+	if strings.HasPrefix(base, "dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+		return "Dockerfile"
+	}
+	if language, ok := languageExtensions[filepath.Ext(base)]; ok {
+		return language
+	}
+	return "Other"
+}
+
+// languageStats is one row of the per-language breakdown.
+type languageStats struct {
+	Language string  `json:"language"`
+	Files    int     `json:"files"`
+	Lines    int     `json:"lines"`
+	Tokens   int     `json:"tokens"`
+	Share    float64 `json:"share"` // percent of all file tokens
+}
+
+// languageBreakdown groups the manifest entries by language, largest first.
+func languageBreakdown(files []manifestEntry) []languageStats {
+	byLanguage := make(map[string]*languageStats)
+	total := 0
+	for _, file := range files {
+		language := detectLanguage(file.Path)
+		stats := byLanguage[language]
+		if stats == nil {
+			stats = &languageStats{Language: language}
+			byLanguage[language] = stats
+		}
+		stats.Files++
+		stats.Lines += file.lines
+		stats.Tokens += file.Tokens
+		total += file.Tokens
+	}
+
+	breakdown := []languageStats{}
+	for _, stats := range byLanguage {
+		if total > 0 {
+			stats.Share = 100 * float64(stats.Tokens) / float64(total)
+		}
+		breakdown = append(breakdown, *stats)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Tokens != breakdown[j].Tokens {
+			return breakdown[i].Tokens > breakdown[j].Tokens
+		}
+		return breakdown[i].Language < breakdown[j].Language
+	})
+	return breakdown
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// isAlwaysIncluded reports whether a file matches one of the -always-include
+// names, either as its relative path or as a name as -include-names matches
+// it (LICENSE matches LICENSE.md).
+func isAlwaysIncluded(relPath string, names []string) bool {
+	for _, name := range names {
+		if strings.EqualFold(filepath.ToSlash(relPath), filepath.ToSlash(name)) {
+			return true
+		}
+	}
+	return matchesName(relPath, names)
+}
+
+var licenseKeywords = regexp.MustCompile(`(?i)copyright|licensed under|license|spdx-license-identifier|all rights reserved`)
+
+// lineCommentPrefixes start the comment lines of a license header.
+var lineCommentPrefixes = []string{"//", "#", "--", ";", "%", "'"}
+
+// stripLicenseHeader removes a leading comment block that mentions a
+// license or copyright, together with the blank lines after it. A shebang
+// line is kept, and so is everything else when the first comment is not a
+// license.
+func stripLicenseHeader(data []byte) []byte {
+	var shebang []byte
+	rest := data
+	if bytes.HasPrefix(rest, []byte("#!")) {
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			return data
+		}
+		shebang, rest = rest[:end+1], rest[end+1:]
+	}
+	body := bytes.TrimLeft(rest, " \t\r\n")
+
+	var block, after []byte
+	switch {
+	case bytes.HasPrefix(body, []byte("/*")), bytes.HasPrefix(body, []byte("<!--")):
+		closer := []byte("*/")
+		if body[0] == '<' {
+			closer = []byte("-->")
+		}
+		end := bytes.Index(body, closer)
+		if end < 0 {
+			return data
+		}
+		block, after = body[:end+len(closer)], body[end+len(closer):]
+	default:
+		prefix := ""
+		for _, p := range lineCommentPrefixes {
+			if bytes.HasPrefix(body, []byte(p)) {
+				prefix = p
+				break
+			}
+		}
+		if prefix == "" || prefix == "#" && bytes.HasPrefix(body, []byte("#!")) {
+			return data
+		}
+		end := 0
+		for end < len(body) {
+			line := body[end:]
+			if i := bytes.IndexByte(line, '\n'); i >= 0 {
+				line = line[:i+1]
+			}
+			if !bytes.HasPrefix(bytes.TrimLeft(line, " \t"), []byte(prefix)) {
+				break
+			}
+			end += len(line)
+		}
+		block, after = body[:end], body[end:]
+	}
+
+	if !licenseKeywords.Match(block) {
+		return data
+	}
+	after = bytes.TrimLeft(after, " \t\r\n")
+	stripped := make([]byte, 0, len(shebang)+len(after))
+	return append(append(stripped, shebang...), after...)
+}
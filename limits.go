@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// errLimitExceeded marks a request that asks for more than the
+	// server's limits allow.
+	errLimitExceeded = errors.New("limit exceeded")
+	errBusy          = errors.New("too many concurrent requests")
+)
+
+// serveLimits bound what a single serve request may cost, so that a
+// misconfigured client cannot take the host down.
+type serveLimits struct {
+	maxFiles int
+	maxBytes int64
+	maxTime  time.Duration
+	slots    chan struct{} // nil for no concurrency limit
+	allowed  []string      // absolute directories requests may pack; nil for all of root
+}
+
+// run packs config within the limits. A request over the concurrency limit
+// fails at once with errBusy rather than queueing. The output limit only
+// applies when limitOutput is set, i.e. when output goes to the client.
+func (s *packServer) run(ctx context.Context, config *Config, limitOutput bool) (int, error) {
+	if s.limits.slots != nil {
+		select {
+		case s.limits.slots <- struct{}{}:
+			defer func() { <-s.limits.slots }()
+		default:
+			return exitFailure, errBusy
+		}
+	}
+	if s.limits.maxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.limits.maxTime)
+		defer cancel()
+	}
+	config.maxFiles = s.limits.maxFiles
+	if limitOutput && s.limits.maxBytes > 0 {
+		config.outputWriter = &limitWriter{w: config.outputWriter, remaining: s.limits.maxBytes, limit: s.limits.maxBytes}
+	}
+	return pack(ctx, config, "none", "")
+}
+
+// allowedInput reports whether an absolute input path lies in one of the
+// allowed directories.
+func (l *serveLimits) allowedInput(input string) bool {
+	if l.allowed == nil {
+		return true
+	}
+	for _, dir := range l.allowed {
+		if rel, err := filepath.Rel(dir, input); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// confineFiles leaves out files whose real path, symlinks resolved, is
+// outside config.confineTo, so that a link inside a served directory cannot
+// expose a file outside it.
+func confineFiles(files []sourceFile, config *Config) []sourceFile {
+	if config.confineTo == "" {
+		return files
+	}
+	inside := &serveLimits{allowed: []string{config.confineTo}}
+	kept := files[:0]
+	for _, file := range files {
+		if real, err := filepath.EvalSymlinks(file.path); err == nil && inside.allowedInput(real) {
+			kept = append(kept, file)
+			continue
+		}
+		config.logger.Warn("Skipping file (resolves outside the served input)", "path", file.relPath)
+		config.traceSkip(file.relPath, "symlink to a file outside the served input")
+	}
+	return kept
+}
+
+// limitWriter fails once more than limit bytes are written.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+	limit     int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		return 0, fmt.Errorf("%w: output exceeds %d bytes", errLimitExceeded, l.limit)
+	}
+	l.remaining -= int64(len(p))
+	return l.w.Write(p)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestConfineFiles(t *testing.T) {
+	// The served root is resolved, as serve resolves it
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, outside := filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(root, "a.txt"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(f, []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inner.txt": "a.txt",
+		"leak.txt":  filepath.Join(outside, "secret.txt"),
+		"up.txt":    filepath.Join("..", "outside", "secret.txt"),
+		"dangling":  "missing.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	var files []sourceFile
+	for _, name := range []string{"a.txt", "inner.txt", "leak.txt", "up.txt", "dangling"} {
+		files = append(files, sourceFile{path: filepath.Join(root, name), relPath: name})
+	}
+
+	tests := []struct {
+		name      string
+		confineTo string
+		want      []string
+	}{
+		{"outside serve", "", []string{"a.txt", "inner.txt", "leak.txt", "up.txt", "dangling"}},
+		{"served root", root, []string{"a.txt", "inner.txt"}},
+	}
+	for _, tt := range tests {
+		config := &Config{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), result: &runResult{}, confineTo: tt.confineTo}
+		var got []string
+		for _, f := range confineFiles(slices.Clone(files), config) {
+			got = append(got, f.relPath)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: kept %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "os"
+
+// fileKey identifies a file on disk independently of the path it was
+// reached by: the device and inode on Unix.
+type fileKey struct {
+	dev, ino uint64
+}
+
+type duplicateFile struct {
+	Path   string `json:"path"`
+	SameAs string `json:"sameAs"`
+}
+
+// dropDuplicateFiles keeps only the first path of files that are the same
+// file on disk: hard links, files reached again through a bind mount or a
+// duplicated tree, and symlinks to files already included. Where the
+// platform cannot identify files, nothing is dropped.
+func dropDuplicateFiles(files []sourceFile, config *Config) []sourceFile {
+	seen := make(map[fileKey]string)
+	kept := files[:0]
+	for _, file := range files {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			kept = append(kept, file)
+			continue
+		}
+		key, ok := fileIdentity(info)
+		if !ok {
+			kept = append(kept, file)
+			continue
+		}
+		if first, dup := seen[key]; dup {
+			config.logger.Debug("Skipping file (same file as an earlier one)", "path", file.relPath, "sameAs", first)
+			config.result.Duplicates = append(config.result.Duplicates, duplicateFile{
+				Path:   config.displayPath(file.relPath),
+				SameAs: config.displayPath(first),
+			})
+			continue
+		}
+		seen[key] = file.relPath
+		kept = append(kept, file)
+	}
+	return kept
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// fileIdentity is unavailable where FileInfo carries no device and inode,
+// e.g. on Windows, where file IDs need an open handle.
+func fileIdentity(fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
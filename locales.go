@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// localeDirs are the directories translation bundles live in, named by
+// locale (locales/fr.json, i18n/messages.fr.yaml) or in a directory per
+// locale (locales/fr/common.json).
+var localeDirs = map[string]bool{
+	"locales": true, "locale": true, "i18n": true, "l10n": true, "lang": true, "langs": true,
+	"languages": true, "translations": true, "messages": true,
+}
+
+// localeCode matches ll and ll-RR style codes, such as fr, pt-BR, en_US
+// and zh-Hant.
+var localeCode = regexp.MustCompile(`^[a-z]{2}(?:[-_](?:[A-Z][a-z]{3}|[A-Za-z]{2}|[0-9]{3}))*$`)
+
+// maxLocaleKeysListed caps the missing and extra keys named for a bundle.
+const maxLocaleKeysListed = 20
+
+// localeBundle returns the locale of a translation bundle and the index of
+// the path segment naming it, or "" when relPath is not a JSON or YAML
+// bundle in one of the localeDirs.
+func localeBundle(relPath string) (string, int) {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	last := len(segments) - 1
+	switch strings.ToLower(path.Ext(segments[last])) {
+	case ".json", ".yaml", ".yml":
+	default:
+		return "", -1
+	}
+	stem := strings.TrimSuffix(segments[last], path.Ext(segments[last]))
+	if i := strings.LastIndexByte(stem, '.'); i >= 0 {
+		stem = stem[i+1:]
+	}
+	if localeCode.MatchString(stem) {
+		for _, dir := range segments[:last] {
+			if localeDirs[strings.ToLower(dir)] {
+				return stem, last
+			}
+		}
+	}
+	for i := last - 1; i > 0; i-- {
+		if localeCode.MatchString(segments[i]) && localeDirs[strings.ToLower(segments[i-1])] {
+			return segments[i], i
+		}
+	}
+	return "", -1
+}
+
+// sameLocale reports whether locale is keep or a regional variant of it:
+// "en" keeps en-US and en_GB.
+func sameLocale(locale, keep string) bool {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	keep = strings.ToLower(strings.ReplaceAll(keep, "_", "-"))
+	return locale == keep || strings.HasPrefix(locale, keep+"-")
+}
+
+// condensesLocale reports whether -condense-locales reduces a file: a
+// translation bundle of none of the kept locales.
+func condensesLocale(src sourceFile, locales []string) bool {
+	locale, _ := localeBundle(src.relPath)
+	if locale == "" {
+		return false
+	}
+	for _, keep := range locales {
+		if sameLocale(locale, keep) {
+			return false
+		}
+	}
+	return true
+}
+
+// condenseLocale replaces a translation bundle with its key count and the
+// keys it misses or adds compared with the same bundle of the default
+// locale, the first of locales. Bundles that do not parse are kept whole.
+func condenseLocale(src sourceFile, data []byte, locales []string) ([]byte, bool, error) {
+	locale, segment := localeBundle(src.relPath)
+	keys, ok := localeKeys(data, locale)
+	if !ok {
+		return data, true, nil
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "[translations for %s: %d keys, condensed by -condense-locales]\n", locale, len(keys))
+
+	def := locales[0]
+	segments := strings.Split(filepath.ToSlash(src.relPath), "/")
+	if segment == len(segments)-1 {
+		ext := path.Ext(segments[segment])
+		stem := strings.TrimSuffix(segments[segment], ext)
+		segments[segment] = stem[:len(stem)-len(locale)] + def + ext
+	} else {
+		segments[segment] = def
+	}
+	root := strings.TrimSuffix(src.path, filepath.FromSlash(src.relPath))
+	defData, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(strings.Join(segments, "/"))))
+	if err != nil {
+		return []byte(out.String()), true, nil
+	}
+	defKeys, ok := localeKeys(defData, def)
+	if !ok {
+		return []byte(out.String()), true, nil
+	}
+	var missing, extra []string
+	for key := range defKeys {
+		if !keys[key] {
+			missing = append(missing, key)
+		}
+	}
+	for key := range keys {
+		if !defKeys[key] {
+			extra = append(extra, key)
+		}
+	}
+	fmt.Fprintf(&out, "%s has %d keys; missing here: %s; not in %s: %s\n", def, len(defKeys), keyList(missing), def, keyList(extra))
+	return []byte(out.String()), true, nil
+}
+
+// localeKeys returns the dotted paths of the leaf values of a bundle. A
+// single top-level key naming the locale, as Rails bundles have, is left
+// out of the paths.
+func localeKeys(data []byte, locale string) (map[string]bool, bool) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, false
+	}
+	doc = stringKeys(doc)
+	if m, ok := doc.(map[string]any); ok && len(m) == 1 {
+		for key, value := range m {
+			if sameLocale(locale, key) {
+				doc = value
+			}
+		}
+	}
+	keys := make(map[string]bool)
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		m, ok := v.(map[string]any)
+		if !ok || len(m) == 0 {
+			if prefix != "" {
+				keys[prefix] = true
+			}
+			return
+		}
+		for key, value := range m {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			walk(key, value)
+		}
+	}
+	walk("", doc)
+	return keys, true
+}
+
+// keyList names the first keys in order, with a count of the rest.
+func keyList(keys []string) string {
+	if len(keys) == 0 {
+		return "none"
+	}
+	sort.Strings(keys)
+	list := strings.Join(keys[:min(len(keys), maxLocaleKeysListed)], ", ")
+	if len(keys) > maxLocaleKeysListed {
+		list += fmt.Sprintf(" and %d more", len(keys)-maxLocaleKeysListed)
+	}
+	return fmt.Sprintf("%d (%s)", len(keys), list)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// newLogger builds the process logger. Logs go to stderr unless logFile is
+// set, in which case the returned function closes it.
+func newLogger(format, logFile string, verbose, quiet bool) (*slog.Logger, func() error, error) {
+	if verbose && quiet {
+		return nil, nil, fmt.Errorf("-verbose and -quiet are mutually exclusive")
+	}
+
+	logLevel := slog.LevelInfo
+	switch {
+	case verbose:
+		logLevel = slog.LevelDebug
+	case quiet:
+		logLevel = slog.LevelError
+	}
+
+	var out io.Writer = os.Stderr
+	closeLog := func() error { return nil }
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = f
+		closeLog = f.Close
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		_ = closeLog()
+		return nil, nil, fmt.Errorf("invalid log format %q (valid: text, json)", format)
+	}
+
+	return slog.New(handler), closeLog, nil
+}
@@ -2,14 +2,17 @@ package main
 
 import (
 	"bufio"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -17,60 +20,137 @@ type Config struct {
 	outputPath  string
 	excludeDirs []string
 	includeExts []string
+	excludeExts []string
+	includeMIME []string
+	excludeMIME []string
 	excludeMap  map[string]bool
 	includeMap  map[string]bool
+	workspace   string
+	order       string
+	symbols     []string
 	logger      *slog.Logger
-}
 
-func main() {
-	var (
-		inputPath   = flag.String("input", ".", "Input directory path (relative or absolute)")
-		outputPath  = flag.String("output", "context.txt", "Output file path")
-		excludeDirs = flag.String("exclude", "", "Comma-separated list of directories to exclude (e.g., node_modules,dist,.git)")
-		includeExts = flag.String("extensions", "", "Comma-separated list of file extensions to include (e.g., .ts,.js,.go)")
-		verbose     = flag.Bool("verbose", false, "Enable verbose logging")
-	)
-	flag.Parse()
+	notebookOutputs bool
+	extractDocs     bool
+	sampleData      int
+	maxFileSize     int64
+	truncate        string
+	anonymizer      *anonymizer
+	redactor        *redactor
+	progress        *progressReporter
+	result          *runResult
+	onCancel        string
+	atomic          bool
+	undecodable     string
+	normalize       normalizeOptions
+	hidden          string
+	maxDepth        int
+	maxTokens       int
+	budget          []budgetArea
+	filesFrom       string
+	filesFromNul    bool
+	fileArgs        []string // files given as pack arguments
+	format          string
+	prepend         string
+	model           string
 
-	// Configure logger
-	logLevel := slog.LevelInfo
-	if *verbose {
-		logLevel = slog.LevelDebug
-	}
+	maxResponseTokens int
+	manifestSection   bool
+	manifestFile      string
+	resultFile        string // -result-json
 
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
+	alwaysInclude       []string
+	includeNames        []string // kept by name when includeExts is set
+	metadata            []string
+	resume              bool
+	maxMemory           int64 // bytes of a single file held at once
+	overMemory          string
+	transform           string // -transform-cmd
+	preHook             string
+	postHook            string
+	notifyURL           string
+	coverage            *coverageProfile
+	fromErrors          string
+	errorContext        int // lines kept around each error; 0 keeps whole files
+	fromTrace           string
+	seeds               []string
+	expandDepth         int
+	condenseSchemas     bool
+	sqlSchema           bool
+	stripConfigValues   bool
+	images              string // -images mode; empty treats images as any other file
+	maxChars            int
+	maxLines            int
+	tokenizerName       string
+	tokenizer           *bpeEncoding // nil estimates tokens from characters
+	windows             bool
+	summarizer          *summarizer // set by -summarize
+	fileMap             bool
+	fileHeader          string // -file-header-format, with escapes resolved
+	fileSeparator       string
+	strict              *strictChecker // set by -strict
+	findingsReport      string
+	appendOutput        bool // -append
+	regionsOnly         bool
+	open                bool
+	pipe                string
+	progressFile        string
+	reproducible        bool
+	maxOutputSize       int64
+	splitOutput         bool // split an output over maxOutputSize instead of failing
+	detectDupes         bool
+	collapseDupes       bool
+	pairTests           bool
+	submodules          string
+	remotePaths         []string    // -paths of a git input
+	codeOwners          *codeOwners // set by -codeowners and -owner
+	condenseLocales     bool
+	locales             []string // kept whole by condenseLocales, the default first
+	trimFixtures        bool
+	profile             string
+	profileOut          string
+	timing              bool
+	maxFiles            int    // set by serve to fail requests matching more files
+	confineTo           string // set by serve: files must resolve inside it
+	stripLicenseHeaders bool
+	mode                string
+	includeGenerated    bool
+	ignoreFile          string
 
-	// Always exclude .git directory
-	excludeList := parseCommaSeparated(*excludeDirs)
-	excludeList = ensureGitExcluded(excludeList)
+	// outputWriter replaces the output file when set, e.g. for stats or
+	// an HTTP response
+	outputWriter io.Writer
 
-	config := &Config{
-		inputPath:   *inputPath,
-		outputPath:  *outputPath,
-		excludeDirs: excludeList,
-		includeExts: parseCommaSeparated(*includeExts),
-		logger:      logger,
-	}
+	// Set by explain to walk only the way to walkOnly and learn why paths
+	// are skipped
+	walkOnly string
+	trace    func(relPath, reason string)
 
-	// Create lookup maps for faster checking
-	config.excludeMap = createLookupMap(config.excludeDirs)
-	config.includeMap = createLookupMap(config.includeExts)
-
-	logger.Info("Starting contextify",
-		"input", config.inputPath,
-		"output", config.outputPath,
-		"excludeDirs", config.excludeDirs,
-		"includeExts", config.includeExts,
-	)
-
-	if err := processDirectory(config); err != nil {
-		logger.Error("Failed to process directory", "error", err)
-		os.Exit(1)
-	}
+	// Resolved at run time
+	workspaceDirs     []string
+	workspaceManifest string
+	buildLog          string           // the -from-errors log, without color codes
+	errorLines        map[string][]int // error or frame lines by relPath, for -error-context
+	traceLog          string
+	traceFrames       []traceFrame
+	migrations        []migrationSet // taken out of the files for -sql-schema
+	attachments       []attachment
+	fileIndex         int // of the file being written, from 1
+	symbolSelector    *symbolSelector
+	lineRanges        map[string][]lineRange
+	todos             *todoCollector
+	symbolIndex       *symbolIndex
+	apiSurface        *routeCollector
+	issueRefs         *issueCollector
+	duplicateBlocks   []duplicateBlock
+	trimmedFixtures   []fixtureGroup
+	manifest          *manifest
+	transforms        []contentTransform
+	timings           *runTimings // set for -timing
+}
 
-	logger.Info("Successfully created context file", "output", config.outputPath)
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
 
 func parseCommaSeparated(input string) []string {
@@ -96,98 +176,735 @@ func createLookupMap(items []string) map[string]bool {
 	return lookup
 }
 
-func processDirectory(config *Config) error {
+func processDirectory(ctx context.Context, config *Config) (err error) {
 	logger := config.logger
 
 	// Convert to absolute path for consistent handling
-	absPath, err := filepath.Abs(config.inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+	var absPath string
+	if isRemoteInput(config.inputPath) {
+		dir, cleanup, err := fetchRemoteInput(ctx, config.inputPath, config)
+		if err != nil {
+			return fmt.Errorf("failed to fetch remote input: %w", err)
+		}
+		defer cleanup()
+		absPath = dir
+	} else {
+		absPath, err = filepath.Abs(config.inputPath)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
 	}
 
 	logger.Debug("Processing directory", "absolutePath", absPath)
 
-	// Create output file
-	outputFile, err := os.Create(config.outputPath)
+	if config.workspace != "" {
+		if err := resolveWorkspace(absPath, config); err != nil {
+			return err
+		}
+	}
+
+	walkStart := time.Now()
+	config.progress.walkStarted(config.inputPath)
+	var files []sourceFile
+	switch {
+	case config.filesFrom != "" || len(config.fileArgs) > 0:
+		files, err = readFileList(ctx, absPath, config)
+	case config.fromErrors != "":
+		files, err = buildErrorFiles(ctx, absPath, config)
+	case config.fromTrace != "":
+		files, err = stackTraceFiles(ctx, absPath, config)
+	default:
+		files, err = collectFiles(ctx, absPath, config)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	defer func() {
-		if closeErr := outputFile.Close(); closeErr != nil {
-			logger.Error("Failed to close output file", "error", closeErr)
+	files = confineFiles(files, config)
+	files = dropDuplicateFiles(files, config)
+	if config.timings != nil {
+		config.timings.walk = time.Since(walkStart)
+	}
+	if len(config.seeds) > 0 {
+		if files, err = expandSeeds(absPath, files, config); err != nil {
+			return err
 		}
-	}()
+	}
+	if config.trimFixtures {
+		files, config.trimmedFixtures = trimFixtures(files, config)
+	}
+	if config.sqlSchema {
+		files, config.migrations = splitMigrations(files)
+	}
+	if config.maxFiles > 0 && len(files) > config.maxFiles {
+		return fmt.Errorf("%w: %d files match, at most %d allowed", errLimitExceeded, len(files), config.maxFiles)
+	}
+
+	if config.reproducible && config.order == "path" {
+		// Lists from -files-from and arguments too, whatever produced them
+		sort.SliceStable(files, func(i, j int) bool { return files[i].relPath < files[j].relPath })
+	}
+	switch config.order {
+	case "deps":
+		files = orderByDependencies(absPath, files, logger)
+	case "smart":
+		files = orderSmart(files)
+	}
+	if config.pairTests {
+		files = confineFiles(pairTests(absPath, files, config), config)
+	}
+
+	if len(config.symbols) > 0 {
+		config.symbolSelector = newSymbolSelector(config.symbols, files, logger)
+	}
+	if config.detectDupes {
+		if config.duplicateBlocks, err = findDuplicateBlocks(ctx, files, config); err != nil {
+			return err
+		}
+	}
+	if config.issueRefs != nil {
+		config.issueRefs.readLog(ctx, absPath, config)
+	}
+	config.transforms = buildTransforms(config)
+	// Always built: its digests go into the metadata section
+	config.manifest = newManifest(config)
+
+	if limits := budgetLimits(config); limits.limited() {
+		budgetStart := time.Now()
+		sizes, err := measureFiles(ctx, files, config)
+		if err != nil {
+			return err
+		}
+		if config.timings != nil {
+			config.timings.budget = time.Since(budgetStart)
+		}
+		var usage *budgetUsage
+		files, usage = applyBudget(files, sizes, limits, config.budget)
+		config.result.Budget = usage
+		if len(usage.FilesDropped) > 0 {
+			config.result.budgetExceeded = true
+			config.progress.budgetExceeded(usage)
+			for _, path := range usage.FilesDropped {
+				config.progress.fileSkipped(path, "over budget")
+			}
+			logger.Warn("Budget exceeded, leaving files out",
+				"maxTokens", config.maxTokens,
+				"usedTokens", usage.UsedTokens,
+				"maxChars", config.maxChars,
+				"usedChars", usage.UsedChars,
+				"maxLines", config.maxLines,
+				"usedLines", usage.UsedLines,
+				"filesDropped", len(usage.FilesDropped),
+			)
+		}
+		for _, area := range usage.Areas {
+			logger.Debug("Budget area", "area", area.Area, "measure", area.Measure, "allocated", area.Allocated, "used", area.Used)
+		}
+	}
+
+	var resume *resumer
+	if config.resume && config.outputWriter == nil {
+		resume, err = openResume(config, files)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if finishErr := resume.finish(err == nil); finishErr != nil {
+				logger.Warn("Failed to finish resume checkpoint", "error", finishErr)
+			}
+		}()
+		if resume.header {
+			logger.Info("Resuming interrupted run", "filesDone", resume.skip, "offset", resume.offset)
+			config.result.bytes.Store(resume.offset)
+		}
+	}
+
+	if config.format == "multimodal" && config.outputWriter != nil {
+		return fmt.Errorf("-format multimodal writes a directory and cannot be streamed")
+	}
+	var output io.Writer = config.outputWriter
+	if output == nil {
+		// Create output file
+		var outputFile *outputFile
+		var createErr error
+		var appended *appender
+		if config.appendOutput {
+			// Read before the output file replaces it
+			if appended, err = newAppender(config.outputPath, logger); err != nil {
+				return err
+			}
+		}
+		if resume != nil {
+			outputFile, createErr = resume.openOutput(config.outputPath)
+		} else {
+			outputPath := config.outputPath
+			if config.format == "multimodal" {
+				// The output is a directory holding the context and its images
+				if err := os.MkdirAll(outputPath, 0o755); err != nil {
+					return fmt.Errorf("failed to create output directory: %w", err)
+				}
+				outputPath = filepath.Join(outputPath, multimodalContext)
+			}
+			outputFile, createErr = createOutput(outputPath, config.atomic)
+		}
+		if createErr != nil {
+			return fmt.Errorf("failed to create output file: %w", createErr)
+		}
+		defer func() {
+			// A resumable run keeps whatever it wrote for the next attempt
+			keep := err == nil || resume != nil || (errors.Is(err, context.Canceled) && config.onCancel == "keep")
+			if !keep {
+				if discardErr := outputFile.discard(); discardErr != nil {
+					logger.Error("Failed to discard output", "error", discardErr)
+				}
+				return
+			}
+			if commitErr := outputFile.commit(); commitErr != nil && err == nil {
+				err = commitErr
+			}
+		}()
+		output = outputFile
+		if appended != nil {
+			// Before the output is committed, after the run is written
+			appended.out = outputFile
+			defer func() {
+				if err == nil || errors.Is(err, context.Canceled) {
+					if mergeErr := appended.merge(); mergeErr != nil && err == nil {
+						err = mergeErr
+					}
+				}
+			}()
+			output = appended
+		}
+		if resume != nil {
+			output = io.MultiWriter(outputFile, resume)
+		}
+	}
+
+	if config.strict != nil {
+		// Before the output is committed, so a failure discards it
+		defer func() {
+			if err != nil {
+				return
+			}
+			var issues []strictIssue
+			if issues, err = config.strict.verdict(config.result.tokens.tokens()); err != nil {
+				config.result.StrictIssues = issues
+				for _, issue := range issues {
+					logger.Error("Strict check failed", "path", issue.Path, "kind", issue.Kind, "detail", issue.Detail)
+				}
+			}
+		}()
+	}
 
-	writer := bufio.NewWriter(outputFile)
+	if config.maxOutputSize > 0 && !config.splitOutput {
+		output = &limitWriter{w: output, remaining: config.maxOutputSize, limit: config.maxOutputSize}
+	}
+	formatter, err := newFormatter(config.progress.writer(&countingWriter{w: output, n: &config.result.bytes}), config)
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	var out, tokens io.Writer = formatter, &config.result.tokens
+	if t := config.timings; t != nil {
+		out, tokens = timedWriter{out, &t.write}, timedWriter{tokens, &t.tokenize}
+	}
+	writer := bufio.NewWriter(io.MultiWriter(out, tokens))
 	defer func() {
-		if flushErr := writer.Flush(); flushErr != nil {
-			logger.Error("Failed to flush writer", "error", flushErr)
+		if flushErr := writer.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("failed to flush output: %w", flushErr)
+		}
+		if closeErr := formatter.close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to finish output: %w", closeErr)
 		}
 	}()
 
-	// Write header
-	if err := writeHeader(writer, absPath, config); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
+	// Write header, unless an interrupted run already did
+	if resume == nil || !resume.header {
+		if err := writeHeader(writer, absPath, config); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		if config.fileMap {
+			if err := writeFileMap(writer, absPath, files, config); err != nil {
+				return fmt.Errorf("failed to write map: %w", err)
+			}
+		}
+		if err := checkpointStep(writer, resume, nil, false); err != nil {
+			return err
+		}
 	}
 
+	config.progress.setTotal(len(files))
+	config.result.FilesMatched = len(files)
 	fileCount := 0
+	if resume != nil {
+		fileCount = resume.included
+		config.fileIndex = resume.included
+	}
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return writeCancelMarker(writer, err)
+		}
+		if resume != nil && i < resume.skip {
+			// Handled by the interrupted run
+			config.progress.fileDone(file.relPath, true)
+			continue
+		}
+		logger.Debug("Processing file", "path", file.relPath)
+		written, err := processFile(ctx, file, writer, config)
+		if errors.Is(err, context.Canceled) {
+			return writeCancelMarker(writer, err)
+		}
+		var skipped *skipError
+		if errors.As(err, &skipped) {
+			logger.Warn("Skipping file", "path", file.relPath, "error", err)
+			config.skipFile(file.relPath, err)
+			config.progress.fileDone(file.relPath, false)
+			if err := checkpointStep(writer, resume, &file, false); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			logger.Error("Failed to process file", "path", file.relPath, "error", err)
+			return err
+		}
+		if written {
+			fileCount++
+		}
+		if !written {
+			config.progress.fileSkipped(file.relPath, "dropped by a content transform")
+		}
+		config.progress.fileDone(file.relPath, written)
+		if err := checkpointStep(writer, resume, &file, written); err != nil {
+			return err
+		}
+	}
+
+	if err := writeSQLSchemas(writer, config.migrations, config); err != nil {
+		return fmt.Errorf("failed to write SQL schema: %w", err)
+	}
+	if config.todos != nil {
+		if err := writeTodoSection(writer, config.todos.entries); err != nil {
+			return fmt.Errorf("failed to write TODO section: %w", err)
+		}
+	}
+	if config.detectDupes {
+		if err := writeDuplicatesSection(writer, config.duplicateBlocks, config.collapseDupes, config); err != nil {
+			return fmt.Errorf("failed to write duplicate code section: %w", err)
+		}
+	}
+	if config.apiSurface != nil {
+		if err := writeAPISurfaceSection(writer, config.apiSurface.routes, config); err != nil {
+			return fmt.Errorf("failed to write API surface section: %w", err)
+		}
+	}
+	if config.symbolIndex != nil {
+		if err := writeSymbolIndexSection(writer, config.symbolIndex.entries, config); err != nil {
+			return fmt.Errorf("failed to write symbol index: %w", err)
+		}
+	}
+	if config.issueRefs != nil {
+		if err := writeIssueSection(ctx, writer, config.issueRefs, config); err != nil {
+			return fmt.Errorf("failed to write issue references: %w", err)
+		}
+	}
+	if len(config.trimmedFixtures) > 0 {
+		if err := writeFixturesSection(writer, config.trimmedFixtures, config); err != nil {
+			return fmt.Errorf("failed to write trimmed fixtures: %w", err)
+		}
+	}
+
+	config.manifest.finish()
+	if config.manifestSection {
+		if err := writeManifestSection(writer, config.manifest); err != nil {
+			return fmt.Errorf("failed to write manifest section: %w", err)
+		}
+	}
+	if config.manifestFile != "" {
+		if err := config.manifest.writeJSON(config.manifestFile); err != nil {
+			return err
+		}
+	}
+	if err := writeMetadataSection(writer, newContextMetadata(config, resume == nil || resume.skip == 0)); err != nil {
+		return fmt.Errorf("failed to write metadata section: %w", err)
+	}
+
+	config.result.FilesIncluded = fileCount
+	if config.redactor != nil {
+		config.result.Redactions = config.redactor.count()
+		config.result.RedactedFiles = config.redactor.summary()
+		for _, file := range files {
+			if counts := config.result.RedactedFiles[file.relPath]; counts != nil {
+				logger.Info("Redacted content", "path", file.relPath, "counts", counts)
+			}
+		}
+	}
+	logger.Info("Processing completed", "filesProcessed", fileCount)
+	return nil
+}
+
+// displayPath returns a path as it should appear in the output.
+func (c *Config) displayPath(p string) string {
+	if c.anonymizer != nil {
+		return c.anonymizer.apply(p)
+	}
+	return p
+}
+
+// checkpointStep flushes the output and records a step of a -resume run.
+// src is nil for the header; included reports whether the file made it into
+// the output.
+func checkpointStep(writer *bufio.Writer, resume *resumer, src *sourceFile, included bool) error {
+	if resume == nil {
+		return nil
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush output: %w", err)
+	}
+	return resume.record(src, included)
+}
+
+// writeCancelMarker notes at the end of a kept partial output that the run
+// was interrupted, and passes err through.
+func writeCancelMarker(writer *bufio.Writer, err error) error {
+	if _, writeErr := fmt.Fprint(writer, "\n# Output incomplete: run was cancelled\n"); writeErr != nil {
+		return errors.Join(err, writeErr)
+	}
+	return err
+}
+
+// sourceFile is a file selected for output.
+type sourceFile struct {
+	path    string // absolute path
+	relPath string // path relative to the input directory
+}
+
+// collectFiles walks the input directory and returns the files that pass the
+// configured filters, in walk order.
+func collectFiles(ctx context.Context, absPath string, config *Config) ([]sourceFile, error) {
+	logger := config.logger
+
+	var attributes *gitAttributes
+	if !config.includeGenerated {
+		attributes = &gitAttributes{}
+	}
+
+	if config.coverage != nil {
+		config.coverage.setRoot(absPath)
+	}
+	if config.codeOwners != nil {
+		if err := config.codeOwners.load(absPath, config); err != nil {
+			return nil, err
+		}
+	}
+
+	ignore := &ignoreRules{}
+	if config.ignoreFile != "" {
+		if err := ignore.loadFile(config.ignoreFile, config.ignoreFile, "."); err != nil {
+			return nil, fmt.Errorf("failed to read ignore file: %w", err)
+		}
+	}
+
+	var modules map[string]bool
+	if config.submodules != "include" {
+		modules = gitModulePaths(absPath)
+	}
+
+	var files []sourceFile
+	written := ownOutputs(config)
 	// Walk the directory tree
-	err = filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			logger.Warn("Error accessing path", "path", path, "error", err)
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// Get relative path from the input directory
 		relPath, err := filepath.Rel(absPath, path)
 		if err != nil {
 			return err
 		}
+		relPath = nfc(relPath)
+		// explain only needs the way down to one path
+		if config.walkOnly != "" && relPath != "." && relPath != config.walkOnly && !strings.HasPrefix(config.walkOnly, relPath+string(filepath.Separator)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// An output inside the input would otherwise be packed into the next
+		// run
+		if relPath != "." && written(path) {
+			logger.Debug("Skipping contextify output", "path", relPath)
+			config.traceSkip(relPath, "written by contextify in this run")
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if relPath != "." && skipHidden(d, config.hidden) {
+			logger.Debug("Skipping hidden path", "path", relPath)
+			config.traceSkip(relPath, fmt.Sprintf("hidden, and -hidden is %s", config.hidden))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		// Check if we should exclude this directory
 		if d.IsDir() {
 			if shouldExcludeDir(relPath, config.excludeMap) {
 				logger.Debug("Excluding directory", "path", relPath)
+				config.traceSkip(relPath, fmt.Sprintf("directory matches -exclude (%s)", strings.Join(config.excludeDirs, ",")))
+				return filepath.SkipDir
+			}
+			if config.maxDepth >= 0 && relPath != "." && pathDepth(relPath) > config.maxDepth {
+				logger.Debug("Excluding directory (beyond max depth)", "path", relPath)
+				config.traceSkip(relPath, fmt.Sprintf("directory is deeper than -max-depth %d", config.maxDepth))
+				return filepath.SkipDir
+			}
+			if config.workspaceDirs != nil && !withinDirs(relPath, config.workspaceDirs, true) {
+				logger.Debug("Excluding directory (outside workspace selection)", "path", relPath)
+				config.traceSkip(relPath, fmt.Sprintf("directory is outside -workspace %s and its dependencies", config.workspace))
+				return filepath.SkipDir
+			}
+			if relPath != "." && ignore.ignored(relPath, true) {
+				logger.Debug("Excluding directory (ignore file)", "path", relPath)
+				config.traceSkip(relPath, "directory matches ignore pattern "+ignore.matching(relPath, true).source)
 				return filepath.SkipDir
 			}
+			if modules != nil && relPath != "." && isNestedRepo(path, relPath, modules) {
+				config.recordSubmodule(path, relPath)
+				if config.submodules == "skip" {
+					logger.Debug("Excluding directory (nested repository)", "path", relPath)
+					config.traceSkip(relPath, "directory is a submodule or nested repository, and -submodules is skip")
+					return filepath.SkipDir
+				}
+			}
+			if err := ignore.load(path, relPath); err != nil {
+				logger.Warn("Failed to read "+ignoreFileName, "path", relPath, "error", err)
+			}
+			if attributes != nil {
+				if err := attributes.load(path, relPath); err != nil {
+					logger.Warn("Failed to read .gitattributes", "path", relPath, "error", err)
+				}
+			}
+			return nil
+		}
+
+		// The .git file of a submodule checkout only points at its git
+		// directory
+		if d.Name() == ".git" {
+			logger.Debug("Skipping file (git directory link)", "path", relPath)
+			config.traceSkip(relPath, ".git file of a submodule or linked work tree")
+			return nil
+		}
+
+		if config.workspaceDirs != nil && relPath != config.workspaceManifest && !withinDirs(relPath, config.workspaceDirs, false) {
+			logger.Debug("Skipping file (outside workspace selection)", "path", relPath)
+			config.traceSkip(relPath, fmt.Sprintf("outside -workspace %s and its dependencies", config.workspace))
+			return nil
+		}
+
+		// WalkDir does not follow symlinks; skip links to directories too
+		if d.Type()&fs.ModeSymlink != 0 {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				logger.Debug("Skipping symlinked directory", "path", relPath)
+				config.traceSkip(relPath, "symlink to a directory, which the walk does not follow")
+				return nil
+			}
+		}
+
+		config.progress.fileScanned()
+		config.result.FilesScanned++
+
+		if ignore.ignored(relPath, false) {
+			logger.Debug("Skipping file (ignore file)", "path", relPath)
+			config.traceSkip(relPath, "matches ignore pattern "+ignore.matching(relPath, false).source)
 			return nil
 		}
 
 		// Check if we should include this file
-		if !shouldIncludeFile(path, config.includeMap) {
+		if !shouldIncludeFile(path, config.includeMap) && !matchesName(relPath, config.includeNames) && !isAlwaysIncluded(relPath, config.alwaysInclude) && !(config.stripConfigValues && infraConfigKind(relPath) != "") && !(config.images != "" && isImageFile(path)) {
 			logger.Debug("Skipping file (extension not included)", "path", relPath)
+			config.traceSkip(relPath, fmt.Sprintf("extension %q is not in -extensions (%s), and the name is not kept by -include-names or -always-include", filepath.Ext(relPath), strings.Join(config.includeExts, ",")))
+			return nil
+		}
+		if shouldExcludeFile(path, config.excludeExts) && !isAlwaysIncluded(relPath, config.alwaysInclude) {
+			logger.Debug("Skipping file (extension excluded)", "path", relPath)
+			config.traceSkip(relPath, fmt.Sprintf("name ends in one of -exclude-extensions (%s)", strings.Join(config.excludeExts, ",")))
+			return nil
+		}
+		if reason, skip := mimeFiltered(path, config); skip && !isAlwaysIncluded(relPath, config.alwaysInclude) {
+			logger.Debug("Skipping file (MIME type "+reason+")", "path", relPath)
+			config.traceSkip(relPath, "MIME type "+reason+" by -include-mime or -exclude-mime")
+			return nil
+		}
+		if reason, skip := coverageFiltered(path, relPath, config); skip && !isAlwaysIncluded(relPath, config.alwaysInclude) {
+			logger.Debug("Skipping file ("+reason+")", "path", relPath)
+			config.traceSkip(relPath, reason)
+			return nil
+		}
+		if reason, skip := ownerFiltered(relPath, config); skip && !isAlwaysIncluded(relPath, config.alwaysInclude) {
+			logger.Debug("Skipping file (not owned by -owner)", "path", relPath)
+			config.traceSkip(relPath, reason)
+			return nil
+		}
+		if attributes != nil && attributes.linguistExcluded(relPath) {
+			logger.Debug("Skipping file (generated or vendored per .gitattributes)", "path", relPath)
+			config.traceSkip(relPath, "marked linguist-generated or linguist-vendored in .gitattributes (see -include-generated)")
 			return nil
 		}
 
-		// Process the file
-		logger.Debug("Processing file", "path", relPath)
-		if err := processFile(path, relPath, writer, logger); err != nil {
-			logger.Error("Failed to process file", "path", relPath, "error", err)
-			return err
+		if windowsPaths && hasReservedName(filepath.ToSlash(relPath)) {
+			logger.Warn("Skipping file with a reserved Windows device name", "path", relPath)
+			config.traceSkip(relPath, "reserved Windows device name")
+			return nil
 		}
 
-		fileCount++
+		// Relative paths use forward slashes on every platform, so the
+		// output does not depend on where it was generated
+		files = append(files, sourceFile{path: path, relPath: filepath.ToSlash(relPath)})
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// traceSkip reports why the walk skips a path, when explain or -progress
+// json asks.
+func (c *Config) traceSkip(relPath, reason string) {
+	if c.trace != nil {
+		c.trace(relPath, reason)
+	}
+	c.progress.fileSkipped(relPath, reason)
+}
+
+// skipFile records a file left out of the output by an error.
+func (c *Config) skipFile(relPath string, err error) {
+	c.result.skip(relPath, err)
+	c.progress.fileSkipped(relPath, err.Error())
+}
+
+// resolveWorkspace restricts the walk to the selected workspace member and
+// the members it depends on.
+func resolveWorkspace(absPath string, config *Config) error {
+	ws, err := detectWorkspace(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to detect workspace: %w", err)
+	}
+	if ws == nil {
+		return fmt.Errorf("no workspace manifest (go.work, pnpm-workspace.yaml, package.json workspaces, Cargo.toml) found in %s", absPath)
+	}
 
+	dirs, err := ws.resolve(config.workspace)
 	if err != nil {
 		return err
 	}
+	config.workspaceDirs = dirs
+	config.workspaceManifest = ws.manifest
 
-	logger.Info("Processing completed", "filesProcessed", fileCount)
+	config.logger.Info("Resolved workspace member",
+		"kind", ws.kind,
+		"member", config.workspace,
+		"directories", dirs,
+	)
 	return nil
 }
 
 func writeHeader(writer *bufio.Writer, absPath string, config *Config) error {
+	label := reproducibleLabel
+	if !config.reproducible {
+		label = func(path string) string { return path }
+	}
 	headers := []string{
 		"# Contextify Output\n",
-		fmt.Sprintf("# Generated from: %s\n", absPath),
+		formatLine(),
+		fmt.Sprintf("# Generated from: %s\n", config.displayPath(stripLongPathPrefix(label(inputLabel(config.inputPath, absPath))))),
 		fmt.Sprintf("# Excluded directories: %s\n", strings.Join(config.excludeDirs, ", ")),
 	}
 
+	if config.filesFrom != "" {
+		source := label(config.filesFrom)
+		if source == "-" {
+			source = "stdin"
+		}
+		headers = append(headers, fmt.Sprintf("# Files from: %s\n", source))
+	}
+	if len(config.fileArgs) > 0 {
+		headers = append(headers, fmt.Sprintf("# Files from: arguments (%s)\n", strings.Join(config.fileArgs, " ")))
+	}
+	if config.fromErrors != "" {
+		source := label(config.fromErrors)
+		if source == "-" {
+			source = "stdin"
+		}
+		headers = append(headers, fmt.Sprintf("# Files from: build errors in %s\n", source))
+	}
+	if config.fromTrace != "" {
+		source := label(config.fromTrace)
+		if source == "-" {
+			source = "stdin"
+		}
+		headers = append(headers, fmt.Sprintf("# Files from: stack trace in %s\n", source))
+	}
+	if len(config.remotePaths) > 0 {
+		headers = append(headers, fmt.Sprintf("# Paths: %s\n", strings.Join(config.remotePaths, ", ")))
+	}
+	if c := config.codeOwners; c != nil && len(c.filter) > 0 {
+		headers = append(headers, fmt.Sprintf("# Owners: %s (per %s)\n", strings.Join(c.filter, ", "), c.file))
+	}
+	if config.workspace != "" {
+		headers = append(headers, fmt.Sprintf("# Workspace member: %s (directories: %s)\n", config.workspace, strings.Join(config.workspaceDirs, ", ")))
+	}
+	if len(config.seeds) > 0 {
+		headers = append(headers, fmt.Sprintf("# Seeds: %s (heuristic references followed %d deep)\n", strings.Join(config.seeds, ", "), config.expandDepth))
+	}
+	if len(config.symbols) > 0 {
+		headers = append(headers, fmt.Sprintf("# Go symbols: %s\n", strings.Join(config.symbols, ", ")))
+	}
+	if budget := config.result.Budget; budget != nil {
+		if budget.MaxTokens > 0 {
+			headers = append(headers, fmt.Sprintf("# Token budget: ~%d of %d tokens used, %d files left out\n", budget.UsedTokens, budget.MaxTokens, len(budget.FilesDropped)))
+		}
+		if budget.MaxChars > 0 {
+			headers = append(headers, fmt.Sprintf("# Character budget: %d of %d characters used, %d files left out\n", budget.UsedChars, budget.MaxChars, len(budget.FilesDropped)))
+		}
+		if budget.MaxLines > 0 {
+			headers = append(headers, fmt.Sprintf("# Line budget: %d of %d lines used, %d files left out\n", budget.UsedLines, budget.MaxLines, len(budget.FilesDropped)))
+		}
+	}
+	if config.reproducible {
+		headers = append(headers, fmt.Sprintf("# Settings digest: %s\n", config.manifest.SettingsDigest))
+	}
+	for _, ref := range config.result.Submodules {
+		headers = append(headers, submoduleHeader(ref))
+	}
+	for _, dup := range config.result.Duplicates {
+		headers = append(headers, fmt.Sprintf("# Duplicate: %s is the same file as %s, shown once\n", dup.Path, dup.SameAs))
+	}
+	if config.mode != "" && config.mode != "full" {
+		headers = append(headers, fmt.Sprintf("# Mode: %s\n", config.mode))
+	}
 	if len(config.includeExts) > 0 {
 		headers = append(headers, fmt.Sprintf("# Included extensions: %s\n", strings.Join(config.includeExts, ", ")))
 	}
+	if len(config.excludeExts) > 0 {
+		headers = append(headers, fmt.Sprintf("# Excluded extensions: %s\n", strings.Join(config.excludeExts, ", ")))
+	}
+	if len(config.includeMIME) > 0 {
+		headers = append(headers, fmt.Sprintf("# Included MIME types: %s\n", strings.Join(config.includeMIME, ", ")))
+	}
+	if len(config.excludeMIME) > 0 {
+		headers = append(headers, fmt.Sprintf("# Excluded MIME types: %s\n", strings.Join(config.excludeMIME, ", ")))
+	}
 	headers = append(headers, "\n")
 
 	for _, header := range headers {
@@ -196,6 +913,12 @@ func writeHeader(writer *bufio.Writer, absPath string, config *Config) error {
 		}
 	}
 
+	switch {
+	case config.fromErrors != "":
+		return writeBuildErrors(writer, config.buildLog)
+	case config.fromTrace != "":
+		return writeStackTrace(writer, config.traceLog, config.traceFrames)
+	}
 	return nil
 }
 
@@ -205,15 +928,21 @@ func shouldExcludeDir(relPath string, excludeMap map[string]bool) bool {
 	}
 
 	// Check each part of the path
-	parts := strings.Split(relPath, string(filepath.Separator))
+	relPath = filepath.ToSlash(relPath)
+	parts := strings.Split(relPath, "/")
 	for _, part := range parts {
-		if excludeMap[part] {
+		if containsPathName(excludeMap, part) {
 			return true
 		}
 	}
 
 	// Also check the full relative path
-	return excludeMap[relPath]
+	return containsPathName(excludeMap, relPath)
+}
+
+// pathDepth returns the number of directories in a relative path.
+func pathDepth(relPath string) int {
+	return len(strings.Split(relPath, string(filepath.Separator)))
 }
 
 func shouldIncludeFile(filePath string, includeMap map[string]bool) bool {
@@ -226,10 +955,27 @@ func shouldIncludeFile(filePath string, includeMap map[string]bool) bool {
 	return includeMap[ext]
 }
 
-func processFile(fullPath, relPath string, writer *bufio.Writer, logger *slog.Logger) error {
+// shouldExcludeFile matches the end of the file name, so multi-part
+// extensions such as .min.js or .d.ts can be excluded too.
+func shouldExcludeFile(filePath string, excludeExts []string) bool {
+	name := filepath.Base(filePath)
+	for _, ext := range excludeExts {
+		if hasPathSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// processFile writes a single file block. It reports false when a content
+// transform dropped the file.
+func processFile(ctx context.Context, src sourceFile, writer *bufio.Writer, config *Config) (written bool, err error) {
+	logger := config.logger
+	fullPath, relPath := src.path, src.relPath
+
 	file, err := os.Open(fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", fullPath, err)
+		return false, &skipError{fmt.Errorf("failed to open file %s: %w", fullPath, err)}
 	}
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -243,29 +989,139 @@ func processFile(fullPath, relPath string, writer *bufio.Writer, logger *slog.Lo
 		logger.Warn("Could not get file stats", "path", relPath, "error", err)
 	} else {
 		logger.Debug("File info", "path", relPath, "size", fileInfo.Size())
+		if config.reproducible {
+			fileInfo = fixedModTime{fileInfo, reproducibleTime()}
+		}
+	}
+
+	input := &contextReader{ctx: ctx, r: file}
+	if config.timings != nil {
+		input.spent = &config.timings.read
+	}
+	var raw io.Reader = input
+	if config.todos != nil {
+		scanner := config.todos.scan(relPath)
+		raw = io.TeeReader(raw, scanner)
+		defer func() { config.todos.commit(scanner, written) }()
+	}
+	if config.symbolIndex != nil {
+		scanner := config.symbolIndex.scan(relPath)
+		raw = io.TeeReader(raw, scanner)
+		defer func() { config.symbolIndex.commit(scanner, written) }()
+	}
+	if config.apiSurface != nil {
+		scanner := newRouteScanner(relPath)
+		raw = io.TeeReader(raw, scanner)
+		defer func() { config.apiSurface.commit(scanner, written) }()
+	}
+	if config.issueRefs != nil {
+		scanner := config.issueRefs.scan(relPath)
+		raw = io.TeeReader(raw, scanner)
+		defer func() { config.issueRefs.commit(scanner, written) }()
+	}
+	var recorder *manifestRecorder
+	if config.manifest != nil {
+		recorder = config.manifest.record(config.displayPath(relPath))
+		raw = io.TeeReader(raw, recorder)
+		defer func() { config.manifest.commit(recorder, written) }()
+	}
+
+	content, keep, err := transformContent(src, raw, config)
+	if err != nil {
+		var skipped *skipError
+		if input.readErr != nil && !errors.As(err, &skipped) {
+			return false, &skipError{err}
+		}
+		return false, err
+	}
+	if !keep {
+		logger.Debug("Skipping file (dropped by content transform)", "path", relPath)
+		return false, nil
+	}
+	if recorder != nil {
+		content = recorder.teeTokens(content)
 	}
 
 	// Write file header with path information
-	if _, err := fmt.Fprintf(writer, "## File: %s\n", relPath); err != nil {
-		return fmt.Errorf("failed to write file header: %w", err)
+	config.fileIndex++
+	if _, err := fmt.Fprint(writer, config.fileStart(relPath)); err != nil {
+		return false, fmt.Errorf("failed to write file header: %w", err)
+	}
+	fields := config.metadata
+	if fileInfo == nil {
+		fields = nil
+	}
+	var extra []string
+	if ranges := config.lineRanges[relPath]; len(ranges) > 0 {
+		extra = append(extra, lineRangesField(ranges))
 	}
-	if _, err := fmt.Fprintf(writer, "```\n"); err != nil {
-		return fmt.Errorf("failed to write code block start: %w", err)
+	if config.coverage != nil {
+		extra = append(extra, config.coverage.metadata(fullPath, relPath)...)
+	}
+	if config.codeOwners != nil {
+		extra = append(extra, config.codeOwners.metadata(relPath)...)
+	}
+	if len(fields) > 0 || len(extra) > 0 {
+		line, err := metadataLine(fullPath, fileInfo, fields, extra)
+		if err != nil {
+			return false, &skipError{fmt.Errorf("failed to read file metadata: %w", err)}
+		}
+		if _, err := fmt.Fprint(writer, line); err != nil {
+			return false, fmt.Errorf("failed to write file metadata: %w", err)
+		}
+	}
+	if _, err := fmt.Fprint(writer, config.contentStart()); err != nil {
+		return false, fmt.Errorf("failed to write code block start: %w", err)
 	}
 
-	// Copy file contents directly
-	bytesWritten, err := io.Copy(writer, file)
+	// Copy file contents directly. The writer is wrapped so that bufio does
+	// not delegate to ReadFrom, which would make a cancelled read a sticky
+	// write error and lose the buffered output.
+	bytesWritten, err := io.Copy(struct{ io.Writer }{writer}, content)
+	if err != nil && input.readErr != nil {
+		// Close the block so the rest of the output stays well-formed
+		if _, writeErr := fmt.Fprint(writer, "\n[content incomplete: read error]"+config.fileEnd(relPath)); writeErr != nil {
+			return false, fmt.Errorf("failed to write code block end: %w", writeErr)
+		}
+		return false, &skipError{fmt.Errorf("failed to read file content: %w", err)}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to copy file content: %w", err)
+		return false, fmt.Errorf("failed to copy file content: %w", err)
 	}
 
 	logger.Debug("File processed", "path", relPath, "bytes", bytesWritten)
 
-	if _, err := fmt.Fprintf(writer, "\n```\n\n"); err != nil {
-		return fmt.Errorf("failed to write code block end: %w", err)
+	if _, err := fmt.Fprint(writer, config.fileEnd(relPath)); err != nil {
+		return false, fmt.Errorf("failed to write code block end: %w", err)
 	}
 
-	return nil
+	return true, nil
+}
+
+// contextReader fails reads once ctx is done so that copying a large file
+// stops promptly on cancellation.
+// It also records read failures of the underlying file and, for -timing,
+// the time spent reading.
+type contextReader struct {
+	ctx     context.Context
+	r       io.Reader
+	readErr error
+	spent   *time.Duration
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	n, err := c.r.Read(p)
+	if c.spent != nil {
+		*c.spent += time.Since(start)
+	}
+	if err != nil && err != io.EOF {
+		c.readErr = err
+	}
+	return n, err
 }
 
 // ensureGitExcluded adds .git to the exclude list if it's not already present
@@ -277,4 +1133,4 @@ func ensureGitExcluded(excludeDirs []string) []string {
 	}
 	// Add .git to the list
 	return append(excludeDirs, ".git")
-}
\ No newline at end of file
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+const manifestMarker = "## Manifest"
+
+// manifestEntry describes one included file: the hash and size of its bytes
+// on disk and the estimated tokens of what was written for it.
+type manifestEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Tokens int    `json:"tokens"`
+
+	lines int // of the rendered content, for stats
+}
+
+// manifest records the included files so that two outputs can be checked
+// for identical inputs.
+type manifest struct {
+	SettingsDigest string          `json:"settingsDigest"`
+	Digest         string          `json:"digest"`
+	Files          []manifestEntry `json:"files"`
+
+	settings  manifestSettings
+	tokenizer *bpeEncoding
+}
+
+// manifestSettings are the options that affect the content of the output.
+type manifestSettings struct {
+	ExcludeDirs     []string `json:"excludeDirs"`
+	IncludeExts     []string `json:"includeExts"`
+	ExcludeExts     []string `json:"excludeExts"`
+	IncludeMIME     []string `json:"includeMime"`
+	ExcludeMIME     []string `json:"excludeMime"`
+	IncludeNames    []string `json:"includeNames"`
+	Workspace       string   `json:"workspace"`
+	Order           string   `json:"order"`
+	Symbols         []string `json:"symbols"`
+	NotebookOutputs bool     `json:"notebookOutputs"`
+	ExtractDocs     bool     `json:"extractDocs"`
+	SampleData      int      `json:"sampleData"`
+	MaxFileSize     int64    `json:"maxFileSize"`
+	Truncate        string   `json:"truncate"`
+	Anonymize       []string `json:"anonymize"`
+	Redact          []string `json:"redact"`
+	Undecodable     string   `json:"undecodable"`
+	Normalize       string   `json:"normalize"`
+	Hidden          string   `json:"hidden"`
+	MaxDepth        int      `json:"maxDepth"`
+	MaxTokens       int      `json:"maxTokens"`
+	Budget          []string `json:"budget"`
+	Format          string   `json:"format"`
+
+	AlwaysInclude       []string `json:"alwaysInclude"`
+	StripLicenseHeaders bool     `json:"stripLicenseHeaders"`
+	Mode                string   `json:"mode"`
+	IncludeGenerated    bool     `json:"includeGenerated"`
+	Metadata            []string `json:"metadata"`
+	MaxMemory           int64    `json:"maxMemory"`
+	OverMemory          string   `json:"overMemory"`
+	TransformCmd        string   `json:"transformCmd"`
+	Coverage            string   `json:"coverage"`
+	CoverageBelow       float64  `json:"coverageBelow"`
+	FromErrors          string   `json:"fromErrors"`
+	ErrorContext        int      `json:"errorContext"`
+	FromTrace           string   `json:"fromTrace"`
+	Seeds               []string `json:"seeds"`
+	ExpandDepth         int      `json:"expandDepth"`
+	CondenseSchemas     bool     `json:"condenseSchemas"`
+	SQLSchema           bool     `json:"sqlSchema"`
+	StripConfigValues   bool     `json:"stripConfigValues"`
+	Images              string   `json:"images"`
+	MaxChars            int      `json:"maxChars"`
+	MaxLines            int      `json:"maxLines"`
+	Tokenizer           string   `json:"tokenizer"`
+	Summarize           string   `json:"summarize"`
+	Map                 bool     `json:"map"`
+	FileHeader          string   `json:"fileHeader"`
+	FileSeparator       string   `json:"fileSeparator"`
+	RegionsOnly         bool     `json:"regionsOnly,omitempty"`
+	Reproducible        bool     `json:"reproducible,omitempty"`
+	Submodules          string   `json:"submodules,omitempty"`
+	Paths               []string `json:"paths,omitempty"`
+	CollapseDupes       bool     `json:"collapseDupes,omitempty"`
+	PairTests           bool     `json:"pairTests,omitempty"`
+	CodeOwners          bool     `json:"codeowners,omitempty"`
+	Owners              []string `json:"owners,omitempty"`
+	IssueRefs           string   `json:"issueRefs,omitempty"`
+	CondenseLocales     []string `json:"condenseLocales,omitempty"`
+	TrimFixtures        bool     `json:"trimFixtures,omitempty"`
+	AnonymizeDomains    string   `json:"anonymizeDomains,omitempty"`
+	Todos               bool     `json:"todos,omitempty"`
+	PrependFile         string   `json:"prependFile,omitempty"`
+	Model               string   `json:"model,omitempty"`
+	Manifest            bool     `json:"manifest,omitempty"`
+	SymbolIndex         bool     `json:"symbolIndex,omitempty"`
+	DetectDupes         bool     `json:"detectDupes,omitempty"`
+	APISurface          bool     `json:"apiSurface,omitempty"`
+}
+
+// manifestRecorder hashes a file's bytes and counts the tokens of its
+// rendered content while both stream through processFile.
+type manifestRecorder struct {
+	path   string
+	hash   hash.Hash
+	size   int64
+	tokens tokenCounter
+}
+
+func (m *manifest) record(relPath string) *manifestRecorder {
+	return &manifestRecorder{path: relPath, hash: sha256.New(), tokens: tokenCounter{bpe: m.tokenizer}}
+}
+
+func (r *manifestRecorder) Write(p []byte) (int, error) {
+	r.size += int64(len(p))
+	return r.hash.Write(p)
+}
+
+// commit adds the file if it made it into the output.
+func (m *manifest) commit(r *manifestRecorder, keep bool) {
+	if keep {
+		m.Files = append(m.Files, manifestEntry{
+			Path:   r.path,
+			SHA256: hex.EncodeToString(r.hash.Sum(nil)),
+			Size:   r.size,
+			Tokens: r.tokens.tokens(),
+			lines:  r.tokens.lines(),
+		})
+	}
+}
+
+func newManifest(config *Config) *manifest {
+	settings := manifestSettings{
+		ExcludeDirs:     config.excludeDirs,
+		IncludeExts:     config.includeExts,
+		ExcludeExts:     config.excludeExts,
+		IncludeMIME:     config.includeMIME,
+		ExcludeMIME:     config.excludeMIME,
+		IncludeNames:    config.includeNames,
+		Workspace:       config.workspace,
+		Order:           config.order,
+		Symbols:         config.symbols,
+		NotebookOutputs: config.notebookOutputs,
+		ExtractDocs:     config.extractDocs,
+		SampleData:      config.sampleData,
+		MaxFileSize:     config.maxFileSize,
+		Truncate:        config.truncate,
+		Redact:          config.redactor.ruleIDs(),
+		Undecodable:     config.undecodable,
+		Normalize:       config.normalize.String(),
+		Hidden:          config.hidden,
+		MaxDepth:        config.maxDepth,
+		MaxTokens:       config.maxTokens,
+		Format:          config.format,
+
+		AlwaysInclude:       config.alwaysInclude,
+		StripLicenseHeaders: config.stripLicenseHeaders,
+		Mode:                config.mode,
+		IncludeGenerated:    config.includeGenerated,
+		Metadata:            config.metadata,
+		MaxMemory:           config.maxMemory,
+		OverMemory:          config.overMemory,
+		TransformCmd:        config.transform,
+		FromErrors:          config.fromErrors,
+		ErrorContext:        config.errorContext,
+		FromTrace:           config.fromTrace,
+		Seeds:               config.seeds,
+		ExpandDepth:         config.expandDepth,
+		CondenseSchemas:     config.condenseSchemas,
+		SQLSchema:           config.sqlSchema,
+		StripConfigValues:   config.stripConfigValues,
+		Images:              config.images,
+		MaxChars:            config.maxChars,
+		MaxLines:            config.maxLines,
+		Tokenizer:           config.tokenizerName,
+		Summarize:           summarizeSetting(config.summarizer),
+		Map:                 config.fileMap,
+		FileHeader:          config.fileHeader,
+		FileSeparator:       config.fileSeparator,
+		RegionsOnly:         config.regionsOnly,
+		Reproducible:        config.reproducible,
+		Paths:               config.remotePaths,
+		CollapseDupes:       config.collapseDupes,
+		PairTests:           config.pairTests,
+		IssueRefs:           issueRefsSetting(config.issueRefs),
+		TrimFixtures:        config.trimFixtures,
+		Todos:               config.todos != nil,
+		Model:               config.model,
+		Manifest:            config.manifestSection,
+		SymbolIndex:         config.symbolIndex != nil,
+		DetectDupes:         config.detectDupes,
+		APISurface:          config.apiSurface != nil,
+	}
+	settings.Anonymize, settings.AnonymizeDomains = config.anonymizer.settings()
+	if config.prepend != "" {
+		// The content, not the path, is what ends up in the output
+		sum := sha256.Sum256([]byte(config.prepend))
+		settings.PrependFile = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if config.submodules != "include" {
+		settings.Submodules = config.submodules
+	}
+	if config.condenseLocales {
+		settings.CondenseLocales = config.locales
+	}
+	if config.codeOwners != nil {
+		settings.CodeOwners = true
+		settings.Owners = config.codeOwners.filter
+	}
+	if config.coverage != nil {
+		settings.Coverage = config.coverage.path
+		settings.CoverageBelow = config.coverage.below
+	}
+	for _, area := range config.budget {
+		settings.Budget = append(settings.Budget, fmt.Sprintf("%s=%g", area.dir, area.weight))
+	}
+	if config.reproducible {
+		settings.FromErrors = reproducibleLabel(settings.FromErrors)
+		settings.FromTrace = reproducibleLabel(settings.FromTrace)
+		settings.Coverage = reproducibleLabel(settings.Coverage)
+	}
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return &manifest{SettingsDigest: hex.EncodeToString(sum[:]), Files: []manifestEntry{}, settings: settings, tokenizer: config.tokenizer}
+}
+
+// finish computes the overall digest over the settings and every file's
+// path and hash.
+func (m *manifest) finish() {
+	h := sha256.New()
+	fmt.Fprintf(h, "settings %s\n", m.SettingsDigest)
+	for _, entry := range m.Files {
+		fmt.Fprintf(h, "%s %s\n", entry.SHA256, entry.Path)
+	}
+	m.Digest = hex.EncodeToString(h.Sum(nil))
+}
+
+func writeManifestSection(writer *bufio.Writer, m *manifest) error {
+	if _, err := fmt.Fprintf(writer, "%s (%d files)\n```\n", manifestMarker, len(m.Files)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(writer, "digest %s\nsettings %s\n", m.Digest, m.SettingsDigest); err != nil {
+		return err
+	}
+	for _, entry := range m.Files {
+		if _, err := fmt.Fprintf(writer, "%s %d %d %s\n", entry.SHA256, entry.Size, entry.Tokens, entry.Path); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
+
+func (m *manifest) writeJSON(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
+}
+
+// teeTokens counts the tokens of content as it is read.
+func (r *manifestRecorder) teeTokens(content io.Reader) io.Reader {
+	return io.TeeReader(content, &r.tokens)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+var overMemoryPolicies = []string{"truncate", "skip"}
+
+// defaultMaxMemory bounds the memory a file takes unless -max-memory says
+// otherwise, so a dataset directory does not exhaust it.
+const defaultMaxMemory = "64MB"
+
+// streamChunkSize is the size of the chunks a file larger than -max-memory
+// is streamed in. Chunks end at a line break, so one holds at most twice
+// this much.
+const streamChunkSize = 64 << 10
+
+// boundedContent transforms a file larger than config.maxMemory without
+// holding all of it. When every active transform works line by line, the
+// file is streamed in line-aligned chunks. Otherwise config.overMemory
+// decides: truncate runs the transforms on the first maxMemory bytes only,
+// skip leaves the file out.
+func boundedContent(src sourceFile, r io.Reader, size int64, active []contentTransform, config *Config) (io.Reader, bool, error) {
+	stream := &chunkStream{src: src, r: bufio.NewReaderSize(r, streamChunkSize), size: size, config: config}
+	canStream := true
+	for _, t := range active {
+		switch {
+		case t.name == "source-markers" && !hasSourceMarkers(src.path):
+			// Without markers the transform leaves the file as it is
+		case t.name == "truncate" && config.truncate == "head":
+			stream.limit = config.maxFileSize
+		case t.lineSafe:
+			stream.transforms = append(stream.transforms, t)
+		default:
+			canStream = false
+		}
+	}
+
+	var first []byte
+	var readErr error
+	if canStream {
+		// Decoding chunk by chunk is only sound for UTF-8
+		first, readErr = stream.nextChunk()
+		if readErr != nil && readErr != io.EOF {
+			return nil, false, fmt.Errorf("failed to read file content: %w", readErr)
+		}
+		if _, name := decodeText(first); name != "utf-8" {
+			canStream = false
+		}
+	}
+	if canStream {
+		config.logger.Debug("Streaming file larger than -max-memory", "path", src.relPath, "size", size)
+		data, keep, err := stream.apply(first)
+		if err != nil {
+			return nil, false, &skipError{err}
+		}
+		if !keep {
+			return nil, false, nil
+		}
+		stream.pending, stream.done = data, readErr == io.EOF
+		return stream, true, nil
+	}
+
+	if config.overMemory == "skip" {
+		config.logger.Warn("Skipping file larger than -max-memory", "path", src.relPath, "size", size)
+		return nil, false, nil
+	}
+	config.logger.Warn("Truncating file larger than -max-memory", "path", src.relPath, "size", size)
+	head, err := io.ReadAll(io.LimitReader(io.MultiReader(bytes.NewReader(first), bytes.NewReader(stream.carry), stream.r), config.maxMemory))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file content: %w", err)
+	}
+	head = cutAtLine(head)
+	// Drain the rest so that -manifest and -todos still see the whole file
+	if _, err := io.Copy(io.Discard, stream.r); err != nil {
+		return nil, false, fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	for _, t := range active {
+		if t.name == "truncate" {
+			// Only the start of the file is at hand, whatever the strategy
+			if int64(len(head)) > config.maxFileSize {
+				head = cutAtLine(head[:config.maxFileSize])
+			}
+			continue
+		}
+		transformed, keep, err := t.apply(src, head)
+		if err != nil {
+			return nil, false, &skipError{fmt.Errorf("%s transform failed: %w", t.name, err)}
+		}
+		if !keep {
+			return nil, false, nil
+		}
+		head = transformed
+	}
+	return bytes.NewReader(append(head, []byte(truncationMarker(int(size)-len(head)))...)), true, nil
+}
+
+// hasSourceMarkers reports whether a file may hold contextify: markers,
+// reading it in chunks rather than whole. A file that cannot be read is
+// assumed to.
+func hasSourceMarkers(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	marker := []byte("contextify:")
+	buf := make([]byte, streamChunkSize+len(marker))
+	kept := 0
+	for {
+		n, err := f.Read(buf[kept:])
+		if bytes.Contains(buf[:kept+n], marker) {
+			return true
+		}
+		if err != nil {
+			return err != io.EOF
+		}
+		// Keep the tail a marker split across reads starts in
+		kept = copy(buf, buf[max(kept+n-len(marker)+1, 0):kept+n])
+	}
+}
+
+// chunkStream reads a file in line-aligned chunks and runs the line-safe
+// transforms on each, so memory stays bounded by the chunk size.
+type chunkStream struct {
+	src        sourceFile
+	r          *bufio.Reader
+	size       int64
+	config     *Config
+	transforms []contentTransform
+	limit      int64 // stop after this many output bytes, for -truncate head
+	written    int64
+	carry      []byte // partial character held back from the last chunk
+	pending    []byte
+	done       bool
+}
+
+func (c *chunkStream) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		chunk, err := c.nextChunk()
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		c.done = err == io.EOF
+		// A chunk dropped mid-file, e.g. one -undecodable skip rejects,
+		// is left out rather than cutting the whole file; a failed
+		// transform fails the run, as part of the file is already written
+		if c.pending, _, err = c.apply(chunk); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// nextChunk reads about streamChunkSize bytes, ending at a line break. A
+// line longer than that is split at a character boundary.
+func (c *chunkStream) nextChunk() ([]byte, error) {
+	chunk := c.carry
+	c.carry = nil
+	for len(chunk) < streamChunkSize {
+		line, err := c.r.ReadSlice('\n')
+		chunk = append(chunk, line...)
+		if err == bufio.ErrBufferFull {
+			cut := len(chunk)
+			for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(chunk[i]) {
+					if !utf8.FullRune(chunk[i:]) {
+						cut = i
+					}
+					break
+				}
+			}
+			c.carry = append([]byte(nil), chunk[cut:]...)
+			return chunk[:cut], nil
+		}
+		if err != nil {
+			return chunk, err
+		}
+	}
+	return chunk, nil
+}
+
+// apply runs the transforms on a chunk and enforces the head truncation
+// limit.
+func (c *chunkStream) apply(chunk []byte) ([]byte, bool, error) {
+	if c.limit > 0 && c.written >= c.limit {
+		return nil, true, nil
+	}
+	for _, t := range c.transforms {
+		transformed, keep, err := t.apply(c.src, chunk)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s transform failed: %w", t.name, err)
+		}
+		if !keep {
+			return nil, false, nil
+		}
+		chunk = transformed
+	}
+	if c.limit > 0 && c.written+int64(len(chunk)) > c.limit {
+		// Later chunks are still read, and dropped, so that -manifest and
+		// -todos see the whole file
+		chunk = cutAtLine(chunk[:c.limit-c.written])
+		omitted := c.size - c.written - int64(len(chunk))
+		c.written = c.limit
+		return append(chunk, []byte(truncationMarker(int(omitted)))...), true, nil
+	}
+	c.written += int64(len(chunk))
+	return chunk, true, nil
+}
+
+// fileSize returns the size of path, or 0 when it cannot be determined.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
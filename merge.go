@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const generatedFromPrefix = "# Generated from: "
+
+// mergeInput is a context to merge, by the name it is reported under.
+type mergeInput struct {
+	name string
+	data []byte
+}
+
+// mergeResult counts what merging dropped.
+type mergeResult struct {
+	files      int
+	duplicates int      // sections identical to one already kept
+	replaced   []string // paths whose later section replaced an earlier one
+}
+
+func setupMerge(fs *flag.FlagSet) func(args []string) int {
+	var output string
+	fs.StringVar(&output, "output", "-", "Write the merged context to this file (- for stdout)")
+	fs.StringVar(&output, "o", "-", "Shorthand for -output")
+	prefix := fs.Bool("prefix", false, "Put the files of each context under a directory named after its file, for contexts of different repositories whose paths would collide")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		// Flags may follow the contexts, as in "merge a.txt b.txt -o c.txt"
+		var paths []string
+		for len(args) > 0 {
+			if strings.HasPrefix(args[0], "-") && args[0] != "-" {
+				if err := fs.Parse(args); err != nil {
+					return exitFailure
+				}
+				args = fs.Args()
+				continue
+			}
+			paths, args = append(paths, args[0]), args[1:]
+		}
+		args = paths
+
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		if len(args) < 2 {
+			logger.Error("Expected at least two contexts to merge", "args", args)
+			return exitFailure
+		}
+
+		inputs := make([]mergeInput, len(args))
+		for i, arg := range args {
+			data, err := os.ReadFile(arg)
+			if err != nil {
+				logger.Error("Failed to read context", "path", arg, "error", err)
+				return exitFailure
+			}
+			inputs[i] = mergeInput{name: arg, data: data}
+		}
+
+		var merged bytes.Buffer
+		result, err := mergeContexts(&merged, inputs, *prefix)
+		if err != nil {
+			logger.Error("Failed to merge contexts", "error", err)
+			return exitFailure
+		}
+		for _, path := range result.replaced {
+			logger.Warn("File appears in several contexts with different content, keeping the last", "path", path)
+		}
+
+		if output == "-" {
+			_, err = os.Stdout.Write(merged.Bytes())
+		} else {
+			err = os.WriteFile(output, merged.Bytes(), 0o644)
+		}
+		if err != nil {
+			logger.Error("Failed to write merged context", "error", err)
+			return exitFailure
+		}
+
+		logger.Info("Merged contexts",
+			"contexts", len(inputs),
+			"files", result.files,
+			"duplicates", result.duplicates,
+			"replaced", len(result.replaced),
+		)
+		return exitSuccess
+	}
+}
+
+// mergeContexts writes the file sections of the inputs as one context with
+// a fresh header listing them. Each path is kept once: identical sections are
+// dropped and a later section with other content replaces the earlier one
+// where it stood, as a newer run of the same files would. The trailing
+// sections of the inputs, such as the TODO list, are carried across, each
+// once; the manifests are merged into one over the files kept, and a fresh
+// metadata section closes the context.
+func mergeContexts(w io.Writer, inputs []mergeInput, prefix bool) (mergeResult, error) {
+	var result mergeResult
+	var files []packedFile
+	var sources []string
+	var sections []trailingSection
+	var settings []string
+	entries := make(map[string]manifestEntry)
+	index := make(map[string]int)
+	for _, input := range inputs {
+		parsed, start, end, err := parseContextBlocks(input.data)
+		if err != nil {
+			return result, fmt.Errorf("failed to parse %s: %w", input.name, err)
+		}
+		for _, line := range strings.Split(string(input.data[:start]), "\n") {
+			if strings.HasPrefix(line, generatedFromPrefix) && !slices.Contains(sources, line) {
+				sources = append(sources, line)
+			}
+		}
+		dir := ""
+		if prefix {
+			dir = strings.TrimSuffix(filepath.Base(input.name), filepath.Ext(input.name)) + "/"
+		}
+		for _, section := range parseTrailingSections(input.data[end:]) {
+			switch section.name {
+			case metadataMarker:
+				// Written afresh for the merged files
+			case manifestMarker:
+				for _, entry := range section.manifestEntries(&settings) {
+					entry.Path = dir + entry.Path
+					entries[entry.Path] = entry
+				}
+			default:
+				if !slices.ContainsFunc(sections, section.same) {
+					sections = append(sections, section)
+				}
+			}
+		}
+		for _, file := range parsed {
+			file.path = dir + file.path
+			i, seen := index[file.path]
+			switch {
+			case !seen:
+				index[file.path] = len(files)
+				files = append(files, file)
+			case bytes.Equal(files[i].content, file.content):
+				result.duplicates++
+			default:
+				files[i] = file
+				result.replaced = append(result.replaced, file.path)
+			}
+		}
+	}
+	result.files = len(files)
+
+	var buf bytes.Buffer
+	buf.WriteString("# Contextify Output\n")
+	buf.WriteString(formatLine())
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		names[i] = input.name
+	}
+	fmt.Fprintf(&buf, "# Merged from: %s\n", strings.Join(names, ", "))
+	for _, source := range sources {
+		buf.WriteString(source + "\n")
+	}
+	fmt.Fprintf(&buf, "# Files: %d (%d duplicate sections dropped, %d replaced by a later context)\n", len(files), result.duplicates, len(result.replaced))
+	for _, file := range files {
+		fmt.Fprintf(&buf, "#   %s\n", file.path)
+	}
+	buf.WriteString("\n")
+	for _, file := range files {
+		buf.WriteString(fileMarker + file.path + "\n")
+		buf.WriteString(file.metadata)
+		buf.WriteString(blockFence)
+		buf.Write(file.content)
+		buf.WriteString(blockEnd)
+	}
+
+	// Sections of one kind stay together, in the order they first appear
+	first := make(map[string]int)
+	for i, section := range sections {
+		if _, ok := first[section.name]; !ok {
+			first[section.name] = i
+		}
+	}
+	slices.SortStableFunc(sections, func(a, b trailingSection) int {
+		return first[a.name] - first[b.name]
+	})
+	for _, section := range sections {
+		buf.WriteString(section.heading + "\n" + section.body)
+	}
+	writer := bufio.NewWriter(&buf)
+	if len(entries) > 0 {
+		m := &manifest{SettingsDigest: strings.Join(settings, ","), Files: []manifestEntry{}}
+		for _, file := range files {
+			if entry, ok := entries[file.path]; ok {
+				m.Files = append(m.Files, entry)
+			}
+		}
+		m.finish()
+		if err := writeManifestSection(writer, m); err != nil {
+			return result, err
+		}
+	}
+	metadata := &contextMetadata{FormatVersion: formatVersion, Tool: "contextify", ToolVersion: version, Format: "text", Files: len(files)}
+	if err := writeMetadataSection(writer, metadata); err != nil {
+		return result, err
+	}
+	if err := writer.Flush(); err != nil {
+		return result, err
+	}
+	_, err := w.Write(buf.Bytes())
+	return result, err
+}
+
+// trailingSection is one of the sections after the file blocks of a
+// context, such as the TODO list or the manifest.
+type trailingSection struct {
+	heading string // its first line
+	name    string // the heading without its counts
+	body    string // the lines after the heading, fences included
+}
+
+// parseTrailingSections splits what follows the file blocks of a context
+// into its sections. Lines before the first heading, such as a
+// cancellation note, are left out.
+func parseTrailingSections(data []byte) []trailingSection {
+	var sections []trailingSection
+	fenced := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if !fenced && strings.HasPrefix(line, "## ") {
+			heading := strings.TrimSuffix(line, "\n")
+			name, _, _ := strings.Cut(heading, " (")
+			sections = append(sections, trailingSection{heading: heading, name: name})
+			continue
+		}
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+		}
+		if n := len(sections); n > 0 {
+			sections[n-1].body += line
+		}
+	}
+	return sections
+}
+
+func (s trailingSection) same(other trailingSection) bool {
+	return s.heading == other.heading && s.body == other.body
+}
+
+// manifestEntries reads the entries of a manifest section, adding its
+// settings digest to settings unless already there.
+func (s trailingSection) manifestEntries(settings *[]string) []manifestEntry {
+	var entries []manifestEntry
+	for _, line := range strings.Split(s.body, "\n") {
+		if digest, ok := strings.CutPrefix(line, "settings "); ok {
+			if !slices.Contains(*settings, digest) {
+				*settings = append(*settings, digest)
+			}
+			continue
+		}
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		size, sizeErr := strconv.ParseInt(fields[1], 10, 64)
+		tokens, tokensErr := strconv.Atoi(fields[2])
+		if sizeErr != nil || tokensErr != nil {
+			continue
+		}
+		entries = append(entries, manifestEntry{Path: fields[3], SHA256: fields[0], Size: size, Tokens: tokens})
+	}
+	return entries
+}
+
+// appender collects the output of a pack run with -append, to merge it
+// into what the output file held before the run.
+type appender struct {
+	bytes.Buffer
+	name     string
+	previous []byte
+	out      io.Writer
+	logger   *slog.Logger
+}
+
+// newAppender reads the existing output at path. A missing file starts
+// empty.
+func newAppender(path string, logger *slog.Logger) (*appender, error) {
+	previous, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read output to append to: %w", err)
+	}
+	return &appender{name: path, previous: previous, logger: logger}, nil
+}
+
+// merge writes the earlier output and this run as one context to out.
+func (a *appender) merge() error {
+	if a.previous == nil {
+		_, err := a.out.Write(a.Bytes())
+		return err
+	}
+	inputs := []mergeInput{{name: a.name, data: a.previous}, {name: "this run", data: a.Bytes()}}
+	result, err := mergeContexts(a.out, inputs, false)
+	if err != nil {
+		return fmt.Errorf("failed to append to output: %w", err)
+	}
+	a.logger.Info("Appended to output", "path", a.name, "files", result.files, "replaced", len(result.replaced))
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testContext builds a context of the given files, each path followed by
+// its content, and trailing sections.
+func testContext(source string, files []string, trailer string) []byte {
+	var b strings.Builder
+	b.WriteString("# Contextify Output\n" + formatLine() + generatedFromPrefix + source + "\n\n")
+	for i := 0; i+1 < len(files); i += 2 {
+		b.WriteString(fileMarker + files[i] + "\n" + blockFence + files[i+1] + blockEnd)
+	}
+	b.WriteString(trailer)
+	return []byte(b.String())
+}
+
+const testMetadata = metadataMarker + "\n```json\n{\"formatVersion\":1,\"files\":1}\n```\n"
+
+func TestMergeContexts(t *testing.T) {
+	tests := []struct {
+		name           string
+		inputs         []mergeInput
+		prefix         bool
+		wantFiles      []string
+		wantDuplicates int
+		wantReplaced   []string
+		wantSections   []string // headings of the trailing sections, in order
+	}{
+		{
+			name: "distinct files",
+			inputs: []mergeInput{
+				{"a.txt", testContext("/a", []string{"a.go", "package a\n"}, testMetadata)},
+				{"b.txt", testContext("/b", []string{"b.go", "package b\n"}, testMetadata)},
+			},
+			wantFiles:    []string{"a.go", "b.go"},
+			wantSections: []string{metadataMarker},
+		},
+		{
+			name: "duplicate and replaced sections",
+			inputs: []mergeInput{
+				{"a.txt", testContext("/a", []string{"x.go", "package x\n", "y.go", "package y\n"}, "")},
+				{"b.txt", testContext("/a", []string{"x.go", "package x\n", "y.go", "package y // changed\n"}, "")},
+			},
+			wantFiles:      []string{"x.go", "y.go"},
+			wantDuplicates: 1,
+			wantReplaced:   []string{"y.go"},
+			wantSections:   []string{metadataMarker},
+		},
+		{
+			name: "prefixed",
+			inputs: []mergeInput{
+				{"repo1.txt", testContext("/r1", []string{"main.go", "package main\n"}, "")},
+				{"repo2.txt", testContext("/r2", []string{"main.go", "package main // 2\n"}, "")},
+			},
+			prefix:       true,
+			wantFiles:    []string{"repo1/main.go", "repo2/main.go"},
+			wantSections: []string{metadataMarker},
+		},
+		{
+			name: "trailing sections carried and grouped",
+			inputs: []mergeInput{
+				{"a.txt", testContext("/a", []string{"a.go", "package a\n"},
+					"## TODO/FIXME Comments (1)\n```\na.go:1: TODO a\n```\n## Symbol Index (1)\n```\nA func a.go:1\n```\n"+testMetadata)},
+				{"b.txt", testContext("/b", []string{"b.go", "package b\n"},
+					"## TODO/FIXME Comments (1)\n```\nb.go:1: TODO b\n```\n## Symbol Index (1)\n```\nA func a.go:1\n```\n"+testMetadata)},
+			},
+			wantFiles:    []string{"a.go", "b.go"},
+			wantSections: []string{"## TODO/FIXME Comments (1)", "## TODO/FIXME Comments (1)", "## Symbol Index (1)", metadataMarker},
+		},
+		{
+			name: "manifests merged",
+			inputs: []mergeInput{
+				{"a.txt", testContext("/a", []string{"a.go", "package a\n"},
+					"## Manifest (1 files)\n```\ndigest d1\nsettings s1\n"+strings.Repeat("1", 64)+" 10 3 a.go\n```\n")},
+				{"b.txt", testContext("/b", []string{"b.go", "package b\n"},
+					"## Manifest (1 files)\n```\ndigest d2\nsettings s1\n"+strings.Repeat("2", 64)+" 10 3 b.go\n```\n")},
+			},
+			wantFiles:    []string{"a.go", "b.go"},
+			wantSections: []string{"## Manifest (2 files)", metadataMarker},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			result, err := mergeContexts(&out, tt.inputs, tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, _, end, err := parseContextBlocks(out.Bytes())
+			if err != nil {
+				t.Fatalf("merged context does not parse: %v\n%s", err, out.Bytes())
+			}
+			var paths []string
+			for _, f := range files {
+				paths = append(paths, f.path)
+			}
+			if !slices.Equal(paths, tt.wantFiles) || result.files != len(tt.wantFiles) {
+				t.Errorf("files %q (%d), want %q", paths, result.files, tt.wantFiles)
+			}
+			if result.duplicates != tt.wantDuplicates || !slices.Equal(result.replaced, tt.wantReplaced) {
+				t.Errorf("duplicates %d, replaced %q, want %d, %q", result.duplicates, result.replaced, tt.wantDuplicates, tt.wantReplaced)
+			}
+			var headings []string
+			for _, s := range parseTrailingSections(out.Bytes()[end:]) {
+				headings = append(headings, s.heading)
+			}
+			if !slices.Equal(headings, tt.wantSections) {
+				t.Errorf("trailing sections %q, want %q", headings, tt.wantSections)
+			}
+			if !bytes.Contains(out.Bytes(), []byte(fmt.Sprintf(`"files":%d}`, len(tt.wantFiles)))) {
+				t.Errorf("metadata does not count %d files:\n%s", len(tt.wantFiles), out.Bytes()[end:])
+			}
+		})
+	}
+}
+
+func TestMergeContextsManifest(t *testing.T) {
+	a := testContext("/a", []string{"a.go", "package a\n", "c.go", "package c\n"},
+		"## Manifest (2 files)\n```\ndigest d1\nsettings s1\n"+strings.Repeat("1", 64)+" 10 3 a.go\n"+strings.Repeat("3", 64)+" 10 3 c.go\n```\n")
+	b := testContext("/b", []string{"a.go", "package a // 2\n"},
+		"## Manifest (1 files)\n```\ndigest d2\nsettings s2\n"+strings.Repeat("2", 64)+" 15 5 a.go\n```\n")
+	var out bytes.Buffer
+	if _, err := mergeContexts(&out, []mergeInput{{"a.txt", a}, {"b.txt", b}}, false); err != nil {
+		t.Fatal(err)
+	}
+	var settings []string
+	var manifest *trailingSection
+	_, _, end, _ := parseContextBlocks(out.Bytes())
+	for _, s := range parseTrailingSections(out.Bytes()[end:]) {
+		if s.name == manifestMarker {
+			manifest = &s
+		}
+	}
+	if manifest == nil {
+		t.Fatalf("no manifest in\n%s", out.Bytes())
+	}
+	entries := manifest.manifestEntries(&settings)
+	want := []manifestEntry{
+		{Path: "a.go", SHA256: strings.Repeat("2", 64), Size: 15, Tokens: 5},
+		{Path: "c.go", SHA256: strings.Repeat("3", 64), Size: 10, Tokens: 3},
+	}
+	if !slices.EqualFunc(entries, want, func(a, b manifestEntry) bool {
+		return a.Path == b.Path && a.SHA256 == b.SHA256 && a.Size == b.Size && a.Tokens == b.Tokens
+	}) {
+		t.Errorf("manifest entries %+v, want %+v", entries, want)
+	}
+	if !slices.Equal(settings, []string{"s1,s2"}) {
+		t.Errorf("manifest settings %q, want both inputs' digests", settings)
+	}
+}
+
+func TestParseTrailingSections(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []trailingSection
+	}{
+		{"none", "", nil},
+		{
+			name: "two sections",
+			data: "## TODO/FIXME Comments (2)\n```\na.go:1: TODO x\n```\n## Metadata\n```json\n{}\n```\n",
+			want: []trailingSection{
+				{heading: "## TODO/FIXME Comments (2)", name: "## TODO/FIXME Comments", body: "```\na.go:1: TODO x\n```\n"},
+				{heading: "## Metadata", name: "## Metadata", body: "```json\n{}\n```\n"},
+			},
+		},
+		{
+			name: "heading-like line inside a fence",
+			data: "## SQL Schema: db (1 migrations)\n```sql\n## not a heading\n```\n",
+			want: []trailingSection{
+				{heading: "## SQL Schema: db (1 migrations)", name: "## SQL Schema: db", body: "```sql\n## not a heading\n```\n"},
+			},
+		},
+		{
+			name: "text before the first heading left out",
+			data: "# Output incomplete\n## Symbol Index (0)\n```\n```\n",
+			want: []trailingSection{
+				{heading: "## Symbol Index (0)", name: "## Symbol Index", body: "```\n```\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseTrailingSections([]byte(tt.data)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseTrailingSections = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var metadataFields = []string{"size", "mtime", "mode", "hash"}
+
+// metadataPrefix starts the optional line between a file header and its
+// opening fence.
+const metadataPrefix = "Metadata: "
+
+func parseMetadataFields(spec string) ([]string, error) {
+	fields := parseCommaSeparated(spec)
+	for _, field := range fields {
+		if !slices.Contains(metadataFields, field) {
+			return nil, fmt.Errorf("unknown metadata field %q (valid: %s)", field, strings.Join(metadataFields, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// metadataLine renders the selected fields of a file, in the order given,
+// e.g. "Metadata: size=1234 mtime=2024-05-01T12:00:00Z mode=-rw-r--r--".
+// The hash is the SHA-256 of the bytes on disk, before any transform.
+// extra fields, such as coverage, follow the selected ones.
+func metadataLine(path string, info fs.FileInfo, fields, extra []string) (string, error) {
+	parts := make([]string, 0, len(fields)+len(extra))
+	for _, field := range fields {
+		switch field {
+		case "size":
+			parts = append(parts, "size="+strconv.FormatInt(info.Size(), 10))
+		case "mtime":
+			parts = append(parts, "mtime="+info.ModTime().UTC().Format(time.RFC3339))
+		case "mode":
+			parts = append(parts, "mode="+info.Mode().String())
+		case "hash":
+			sum, err := hashFile(path)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "sha256="+sum)
+		}
+	}
+	parts = append(parts, extra...)
+	return metadataPrefix + strings.Join(parts, " ") + "\n", nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
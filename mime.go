@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// sniffMIME detects a file's media type from its first 512 bytes, without
+// parameters such as the charset. Extensionless text like Dockerfiles and
+// scripts comes out as text/plain.
+func sniffMIME(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	// SVG with an XML prolog sniffs as plain XML
+	if mediaType == "text/xml" && bytes.Contains(head, []byte("<svg")) {
+		mediaType = "image/svg+xml"
+	}
+	return mediaType, nil
+}
+
+// parseMIMEPatterns validates patterns such as "text/*" or "application/pdf".
+func parseMIMEPatterns(spec string) ([]string, error) {
+	patterns := parseCommaSeparated(spec)
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("invalid MIME pattern %q (expected type/subtype, e.g., text/*)", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid MIME pattern %q: %w", pattern, err)
+		}
+	}
+	return patterns, nil
+}
+
+func matchesMIME(mediaType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), mediaType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeFiltered reports whether the MIME filters leave a file out, and why.
+func mimeFiltered(filePath string, config *Config) (string, bool) {
+	if len(config.includeMIME) == 0 && len(config.excludeMIME) == 0 {
+		return "", false
+	}
+	mediaType, err := sniffMIME(filePath)
+	if err != nil {
+		// Left for processFile to report as unreadable
+		return "", false
+	}
+	if len(config.includeMIME) > 0 && !matchesMIME(mediaType, config.includeMIME) {
+		return mediaType + " not included", true
+	}
+	if matchesMIME(mediaType, config.excludeMIME) {
+		return mediaType + " excluded", true
+	}
+	return "", false
+}
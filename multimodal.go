@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Layout of the directory -format multimodal writes: the text context, the
+// images it references and an index of them.
+const (
+	multimodalContext = "context.txt"
+	multimodalImages  = "images"
+	multimodalIndex   = "images.json"
+)
+
+// attachment is an image copied next to the context for -format
+// multimodal, under an ID derived from its content so the same image keeps
+// its ID from run to run.
+type attachment struct {
+	ID        string `json:"id"`
+	File      string `json:"file"`
+	Source    string `json:"source"`
+	MediaType string `json:"media_type"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Bytes     int    `json:"bytes"`
+	path      string
+}
+
+// imageReference replaces an image with a line naming the copy the
+// multimodal output holds of it, e.g.
+// [image img-3f2a9c01d4: images/img-3f2a9c01d4.png, png, 640x480 pixels, 12.1 KB],
+// and records the image for the formatter to copy.
+func imageReference(src sourceFile, data []byte, config *Config) []byte {
+	sum := sha256.Sum256(data)
+	id := "img-" + hex.EncodeToString(sum[:5])
+	format, width, height := imageInfo(src.path, data)
+	file := path.Join(multimodalImages, id+strings.ToLower(filepath.Ext(src.path)))
+	dimensions := "unknown dimensions"
+	if width > 0 && height > 0 {
+		dimensions = fmt.Sprintf("%dx%d pixels", width, height)
+	}
+	config.attachments = append(config.attachments, attachment{
+		ID:        id,
+		File:      file,
+		Source:    src.relPath,
+		MediaType: imageMediaType(src.path, format),
+		Width:     max(width, 0),
+		Height:    max(height, 0),
+		Bytes:     len(data),
+		path:      src.path,
+	})
+	return []byte(fmt.Sprintf("[image %s: %s, %s, %s, %s]\n", id, file, format, dimensions, formatBytes(int64(len(data)))))
+}
+
+// multimodalFormatter writes the context as text; on close it copies the
+// images the context references into the output directory and indexes
+// them, so a client can send each one next to the text that names it.
+type multimodalFormatter struct {
+	textFormatter
+	config *Config
+}
+
+func (m *multimodalFormatter) close() error {
+	dir := filepath.Join(m.config.outputPath, multimodalImages)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	index := make([]attachment, 0, len(m.config.attachments))
+	copied := make(map[string]bool)
+	for _, a := range m.config.attachments {
+		index = append(index, a)
+		if copied[a.File] {
+			continue
+		}
+		copied[a.File] = true
+		if err := copyFile(a.path, filepath.Join(m.config.outputPath, filepath.FromSlash(a.File))); err != nil {
+			return fmt.Errorf("failed to copy image %s: %w", a.Source, err)
+		}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.config.outputPath, multimodalIndex), append(data, '\n'), 0o644)
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// normalizeOptions selects the whitespace normalizations applied to emitted
+// content.
+type normalizeOptions struct {
+	eol           bool
+	trailingSpace bool
+	tabWidth      int
+}
+
+func (n normalizeOptions) enabled() bool {
+	return n.eol || n.trailingSpace || n.tabWidth > 0
+}
+
+// String renders the options as a spec in a fixed order, for the manifest
+// settings.
+func (n normalizeOptions) String() string {
+	var items []string
+	if n.eol {
+		items = append(items, "eol")
+	}
+	if n.trailingSpace {
+		items = append(items, "trailing-ws")
+	}
+	if n.tabWidth > 0 {
+		items = append(items, "tabs="+strconv.Itoa(n.tabWidth))
+	}
+	return strings.Join(items, ",")
+}
+
+// parseNormalize parses a spec such as "eol,trailing-ws,tabs=4".
+func parseNormalize(spec string) (normalizeOptions, error) {
+	var opts normalizeOptions
+	for _, item := range parseCommaSeparated(spec) {
+		name, value, hasValue := strings.Cut(item, "=")
+		switch name {
+		case "eol":
+			opts.eol = true
+		case "trailing-ws":
+			opts.trailingSpace = true
+		case "tabs":
+			opts.tabWidth = 4
+			if hasValue {
+				width, err := strconv.Atoi(value)
+				if err != nil || width < 1 {
+					return opts, fmt.Errorf("invalid tab width %q", value)
+				}
+				opts.tabWidth = width
+			}
+		default:
+			return opts, fmt.Errorf("unknown normalization %q (valid: eol, trailing-ws, tabs=N)", item)
+		}
+	}
+	return opts, nil
+}
+
+// normalizeWhitespace converts CRLF and lone CR line endings to LF, trims
+// trailing whitespace and expands tabs to the next tab stop, as selected.
+func normalizeWhitespace(data []byte, opts normalizeOptions) []byte {
+	if opts.eol {
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	}
+	if !opts.trailingSpace && opts.tabWidth == 0 {
+		return data
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if opts.trailingSpace {
+			line = bytes.TrimRight(line, " \t\r")
+		}
+		if opts.tabWidth > 0 && bytes.IndexByte(line, '\t') >= 0 {
+			line = expandTabs(line, opts.tabWidth)
+		}
+		lines[i] = line
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func expandTabs(line []byte, width int) []byte {
+	var out bytes.Buffer
+	column := 0
+	for _, r := range string(line) {
+		if r == '\t' {
+			spaces := width - column%width
+			out.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		out.WriteRune(r)
+		column++
+	}
+	return out.Bytes()
+}
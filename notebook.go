@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type notebook struct {
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType string           `json:"cell_type"`
+	Source   notebookText     `json:"source"`
+	Outputs  []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	Ename      string                  `json:"ename"`
+	Evalue     string                  `json:"evalue"`
+}
+
+// notebookText accepts both of the nbformat encodings for multi-line text: a
+// single string or a list of lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = notebookText(s)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		// Non-text payloads such as JSON widget data are not rendered
+		return nil
+	}
+	*t = notebookText(strings.Join(lines, ""))
+	return nil
+}
+
+// convertNotebook renders a Jupyter notebook in the "percent" script format:
+// code cells as-is, markdown cells as comments, and optionally the text
+// outputs of each code cell.
+func convertNotebook(data []byte, includeOutputs bool) ([]byte, error) {
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("failed to parse notebook: %w", err)
+	}
+
+	language := nb.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = nb.Metadata.Kernelspec.Language
+	}
+	comment := "#"
+	switch strings.ToLower(language) {
+	case "javascript", "typescript", "java", "scala", "kotlin", "c++", "c#", "csharp", "go", "rust", "swift":
+		comment = "//"
+	}
+
+	var out bytes.Buffer
+	if language != "" {
+		fmt.Fprintf(&out, "%s Notebook language: %s\n\n", comment, language)
+	}
+	for _, cell := range nb.Cells {
+		source := strings.TrimRight(string(cell.Source), "\n")
+		switch cell.CellType {
+		case "code":
+			fmt.Fprintf(&out, "%s %%%%\n%s\n", comment, source)
+			if includeOutputs {
+				writeNotebookOutputs(&out, comment, cell.Outputs)
+			}
+		case "markdown":
+			fmt.Fprintf(&out, "%s %%%% [markdown]\n%s\n", comment, commentLines(source, comment))
+		default:
+			fmt.Fprintf(&out, "%s %%%% [%s]\n%s\n", comment, cell.CellType, commentLines(source, comment))
+		}
+		out.WriteString("\n")
+	}
+	return bytes.TrimRight(out.Bytes(), "\n"), nil
+}
+
+func writeNotebookOutputs(out *bytes.Buffer, comment string, outputs []notebookOutput) {
+	for _, output := range outputs {
+		var text string
+		switch output.OutputType {
+		case "stream":
+			text = string(output.Text)
+		case "execute_result", "display_data":
+			if plain, ok := output.Data["text/plain"]; ok {
+				text = string(plain)
+			} else {
+				mimeTypes := make([]string, 0, len(output.Data))
+				for mimeType := range output.Data {
+					mimeTypes = append(mimeTypes, mimeType)
+				}
+				sort.Strings(mimeTypes)
+				text = fmt.Sprintf("[%s output omitted]", strings.Join(mimeTypes, ", "))
+			}
+		case "error":
+			text = fmt.Sprintf("%s: %s", output.Ename, output.Evalue)
+		}
+		text = strings.TrimRight(text, "\n")
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(out, "%s Output:\n%s\n", comment, commentLines(text, comment))
+	}
+}
+
+func commentLines(text, comment string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = comment
+		} else {
+			lines[i] = comment + " " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// notify POSTs the run summary to a webhook. Slack incoming webhooks only
+// accept a message, so they get a one-line summary instead of the JSON.
+func notify(ctx context.Context, webhook string, result *runResult) error {
+	var payload any = result
+	if u, err := url.Parse(webhook); err == nil && u.Host == "hooks.slack.com" {
+		payload = map[string]string{"text": notifyText(result)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// A cancelled run is still reported
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func notifyText(result *runResult) string {
+	text := fmt.Sprintf("contextify %s: %s -> %s, %d of %d files, %s, ~%d tokens",
+		result.Status, result.Input, result.Output, result.FilesIncluded, result.FilesMatched,
+		formatBytes(result.BytesWritten), result.Tokens)
+	if result.Error != "" {
+		text += "\nError: " + result.Error
+	}
+	return text
+}
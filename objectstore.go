@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// isObjectStoreURL reports whether an output path names an S3 or GCS object.
+func isObjectStoreURL(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// uploadCommand returns the command that copies a local file to an object
+// store. The provider CLIs resolve credentials through their standard
+// environment variables, profiles and instance metadata.
+func uploadCommand(dest, local string) (*exec.Cmd, error) {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		if _, err := exec.LookPath("aws"); err != nil {
+			return nil, fmt.Errorf("writing to s3:// requires the aws CLI: %w", err)
+		}
+		return exec.Command("aws", "s3", "cp", "--only-show-errors", local, dest), nil
+	case strings.HasPrefix(dest, "gs://"):
+		if _, err := exec.LookPath("gcloud"); err == nil {
+			return exec.Command("gcloud", "storage", "cp", "--quiet", local, dest), nil
+		}
+		if _, err := exec.LookPath("gsutil"); err != nil {
+			return nil, fmt.Errorf("writing to gs:// requires the gcloud or gsutil CLI: %w", err)
+		}
+		return exec.Command("gsutil", "-q", "cp", local, dest), nil
+	default:
+		return nil, fmt.Errorf("unsupported object store URL %q", dest)
+	}
+}
+
+// upload copies a local file to dest.
+func upload(dest, local string) error {
+	cmd, err := uploadCommand(dest, local)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to upload to %s: %w: %s", dest, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// openCommands are the commands that open a file with its default
+// application, per platform.
+var openCommands = map[string][]string{
+	"darwin":  {"open"},
+	"windows": {"cmd", "/C", "start", ""},
+	"linux":   {"xdg-open"},
+}
+
+// openOutput shows the output of a pack for -open: text and message
+// formats in $VISUAL or $EDITOR when one is set, waiting for the editor to
+// exit, and HTML pages, archives and anything without an editor with the
+// default application of the platform.
+func openOutput(config *Config) error {
+	path := config.outputPath
+	if config.format == "multimodal" {
+		path = filepath.Join(path, multimodalContext)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	var cmd *exec.Cmd
+	if fields := strings.Fields(editor); len(fields) > 0 && config.format != "html" && config.format != "archive" {
+		cmd = exec.Command(fields[0], append(fields[1:], path)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+	} else {
+		opener, ok := openCommands[runtime.GOOS]
+		if !ok {
+			opener = openCommands["linux"]
+		}
+		cmd = exec.Command(opener[0], append(opener[1:], path)...)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to open %s with %s: %w", path, cmd.Args[0], err)
+	}
+	return nil
+}
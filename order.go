@@ -0,0 +1,168 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goPackage groups the collected Go files of one directory.
+type goPackage struct {
+	dir     string
+	isMain  bool
+	imports map[string]bool
+	files   []sourceFile
+}
+
+// orderByDependencies emits Go packages in topological import order so that
+// dependencies come before their users and main packages come last. Non-Go
+// files keep their walk order and are placed before the Go files.
+//
+// The graph is built from the import lines of the collected files with
+// go/parser rather than loaded with golang.org/x/tools/go/packages, which
+// runs the go command: it needs no Go toolchain and works on partial trees
+// and file lists. Build tags and GOOS/GOARCH file suffixes are not
+// evaluated, so imports of every variant count, and only packages among
+// the collected files are ordered.
+func orderByDependencies(absPath string, files []sourceFile, logger *slog.Logger) []sourceFile {
+	var others []sourceFile
+	packages := make(map[string]*goPackage)
+	fset := token.NewFileSet()
+
+	for _, file := range files {
+		if filepath.Ext(file.path) != ".go" {
+			others = append(others, file)
+			continue
+		}
+
+		dir := filepath.Dir(file.path)
+		pkg := packages[dir]
+		if pkg == nil {
+			pkg = &goPackage{dir: dir, imports: make(map[string]bool)}
+			packages[dir] = pkg
+		}
+		pkg.files = append(pkg.files, file)
+
+		parsed, err := parser.ParseFile(fset, file.path, nil, parser.ImportsOnly)
+		if err != nil {
+			logger.Warn("Could not parse Go imports", "path", file.relPath, "error", err)
+			continue
+		}
+		if parsed.Name.Name == "main" {
+			pkg.isMain = true
+		}
+		for _, imp := range parsed.Imports {
+			if importPath, err := strconv.Unquote(imp.Path.Value); err == nil {
+				pkg.imports[importPath] = true
+			}
+		}
+	}
+
+	// Map import paths to collected package directories
+	modules := newModuleResolver(absPath)
+	byImportPath := make(map[string]*goPackage)
+	for dir, pkg := range packages {
+		if importPath, ok := modules.importPath(dir); ok {
+			byImportPath[importPath] = pkg
+		}
+	}
+
+	dirs := make([]string, 0, len(packages))
+	for dir := range packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		a, b := packages[dirs[i]], packages[dirs[j]]
+		if a.isMain != b.isMain {
+			return !a.isMain
+		}
+		return a.dir < b.dir
+	})
+
+	ordered := append([]sourceFile(nil), others...)
+	visited := make(map[*goPackage]bool)
+	var visit func(pkg *goPackage)
+	visit = func(pkg *goPackage) {
+		if visited[pkg] {
+			return
+		}
+		visited[pkg] = true
+
+		imports := make([]string, 0, len(pkg.imports))
+		for importPath := range pkg.imports {
+			imports = append(imports, importPath)
+		}
+		sort.Strings(imports)
+		for _, importPath := range imports {
+			if dep, ok := byImportPath[importPath]; ok {
+				visit(dep)
+			}
+		}
+
+		// Tests read best after the code they exercise
+		sort.SliceStable(pkg.files, func(i, j int) bool {
+			return !strings.HasSuffix(pkg.files[i].path, "_test.go") && strings.HasSuffix(pkg.files[j].path, "_test.go")
+		})
+		ordered = append(ordered, pkg.files...)
+	}
+	for _, dir := range dirs {
+		visit(packages[dir])
+	}
+
+	logger.Debug("Ordered Go packages by dependencies", "packages", len(packages))
+	return ordered
+}
+
+// moduleResolver maps directories to Go import paths using the nearest
+// go.mod file at or below the input root.
+type moduleResolver struct {
+	root  string
+	cache map[string]moduleInfo
+}
+
+type moduleInfo struct {
+	dir  string
+	path string
+}
+
+func newModuleResolver(root string) *moduleResolver {
+	return &moduleResolver{root: root, cache: make(map[string]moduleInfo)}
+}
+
+func (r *moduleResolver) importPath(dir string) (string, bool) {
+	mod, ok := r.module(dir)
+	if !ok {
+		return "", false
+	}
+	rel, err := filepath.Rel(mod.dir, dir)
+	if err != nil {
+		return "", false
+	}
+	if rel == "." {
+		return mod.path, true
+	}
+	return mod.path + "/" + filepath.ToSlash(rel), true
+}
+
+func (r *moduleResolver) module(dir string) (moduleInfo, bool) {
+	if mod, ok := r.cache[dir]; ok {
+		return mod, mod.path != ""
+	}
+
+	var mod moduleInfo
+	if modPath, _, err := parseGoMod(filepath.Join(dir, "go.mod")); err == nil {
+		mod = moduleInfo{dir: dir, path: modPath}
+	} else if _, statErr := os.Stat(filepath.Join(dir, "go.mod")); os.IsNotExist(statErr) {
+		parent := filepath.Dir(dir)
+		if dir != r.root && parent != dir && strings.HasPrefix(parent, r.root) {
+			mod, _ = r.module(parent)
+		}
+	}
+	r.cache[dir] = mod
+	return mod, mod.path != ""
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// braceLanguages are the languages whose bodies outlineSource finds by
+// their braces, by extension.
+var braceLanguages = map[string]string{
+	".js": "js", ".jsx": "js", ".mjs": "js", ".cjs": "js",
+	".ts": "js", ".tsx": "js", ".mts": "js", ".cts": "js",
+	".java": "java",
+	".rs":   "rust",
+}
+
+// outlineSource elides the function bodies of a source file for the smart
+// truncation strategy, keeping imports, exports, type and class
+// declarations and signatures. Go files are parsed; Python and the brace
+// languages are lexed, so braces and colons in strings, comments, template
+// literals and regular expressions do not count. Languages whose strings
+// nest code, such as Kotlin, Scala and C# interpolation, are left to the
+// indentation fallback. It returns nil for other files or Go that does not
+// parse.
+func outlineSource(relPath string, src []byte) []byte {
+	ext := strings.ToLower(filepath.Ext(relPath))
+	switch {
+	case ext == ".go":
+		return elideGoBodies(src)
+	case ext == ".py" || ext == ".pyi":
+		return elidePythonBodies(src)
+	case braceLanguages[ext] != "":
+		return elideBraceBodies(src, braceLanguages[ext])
+	}
+	return nil
+}
+
+// codeMask returns a copy of src with the contents of strings, character
+// literals, comments and regular expression literals blanked out, newlines
+// kept, so offsets match and only code is left to scan.
+func codeMask(src []byte, lang string) []byte {
+	code := bytes.Clone(src)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(code); i++ {
+			if code[i] != '\n' {
+				code[i] = ' '
+			}
+		}
+	}
+	// skipQuoted returns the offset after a string closed by quote, with
+	// backslash escapes unless raw.
+	skipQuoted := func(i int, quote string, raw bool) int {
+		for i < len(src) {
+			if !raw && src[i] == '\\' {
+				i += 2
+				continue
+			}
+			if strings.HasPrefix(string(src[i:min(i+len(quote), len(src))]), quote) {
+				return i + len(quote)
+			}
+			i++
+		}
+		return len(src)
+	}
+
+	lastCode := byte(0) // the last code character, for telling regexes from division
+	for i := 0; i < len(src); {
+		c := src[i]
+		next := byte(0)
+		if i+1 < len(src) {
+			next = src[i+1]
+		}
+		start := i
+		switch {
+		case c == '/' && next == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && next == '*':
+			// Rust block comments nest
+			depth := 0
+			for i < len(src) {
+				if src[i] == '/' && i+1 < len(src) && src[i+1] == '*' {
+					depth++
+					i += 2
+					if lang != "rust" {
+						depth = 1
+					}
+					continue
+				}
+				if src[i] == '*' && i+1 < len(src) && src[i+1] == '/' {
+					i += 2
+					if depth--; depth == 0 {
+						break
+					}
+					continue
+				}
+				i++
+			}
+		case lang == "js" && c == '/' && strings.IndexByte("(,=:[!&|?{};+-*%<>~^", lastCode) >= 0:
+			// A regular expression literal
+			inClass := false
+			for i++; i < len(src) && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+					continue
+				}
+				if src[i] == '[' {
+					inClass = true
+				} else if src[i] == ']' {
+					inClass = false
+				} else if src[i] == '/' && !inClass {
+					i++
+					break
+				}
+			}
+		case lang == "js" && c == '`':
+			i = skipTemplate(src, i+1)
+		case lang == "java" && bytes.HasPrefix(src[i:], []byte(`"""`)):
+			i = skipQuoted(i+3, `"""`, true)
+		case lang == "rust" && c == 'r' && (next == '"' || next == '#') && !isIdentByte(lastByte(src, i)):
+			hashes := 0
+			j := i + 1
+			for j < len(src) && src[j] == '#' {
+				hashes++
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				i++
+				lastCode = c
+				continue
+			}
+			i = skipQuoted(j+1, `"`+strings.Repeat("#", hashes), true)
+		case lang == "rust" && c == '\'':
+			// A character literal, not a lifetime like 'a
+			if m := rustChar.Find(src[i:]); m != nil {
+				i += len(m)
+			} else {
+				i++
+				lastCode = c
+				continue
+			}
+		case c == '"' || c == '\'':
+			i = skipQuoted(i+1, string(c), false)
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				lastCode = c
+			}
+			i++
+			continue
+		}
+		blank(start, i)
+		lastCode = 'x'
+	}
+	return code
+}
+
+var rustChar = regexp.MustCompile(`^'(?:\\(?:u\{[0-9a-fA-F]+\}|x[0-9a-fA-F]{2}|.)|[^\\'\n])'`)
+
+// skipTemplate returns the offset after a JavaScript template literal
+// starting at i, past any ${...} substitutions and the strings in them.
+func skipTemplate(src []byte, i int) int {
+	for i < len(src) {
+		switch {
+		case src[i] == '\\':
+			i += 2
+		case src[i] == '`':
+			return i + 1
+		case src[i] == '$' && i+1 < len(src) && src[i+1] == '{':
+			depth := 0
+			for i++; i < len(src); i++ {
+				if src[i] == '{' {
+					depth++
+				} else if src[i] == '}' {
+					if depth--; depth == 0 {
+						break
+					}
+				} else if src[i] == '`' {
+					i = skipTemplate(src, i+1) - 1
+				} else if src[i] == '"' || src[i] == '\'' {
+					// A string inside the substitution
+					for quote := src[i]; i+1 < len(src) && src[i+1] != quote && src[i+1] != '\n'; i++ {
+						if src[i+1] == '\\' {
+							i++
+						}
+					}
+					i++
+				}
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return len(src)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func lastByte(src []byte, i int) byte {
+	if i == 0 {
+		return 0
+	}
+	return src[i-1]
+}
+
+var containerKeyword = regexp.MustCompile(`\b(?:class|interface|struct|enum|trait|impl|namespace|module|record|object|union|mod|extern)\b`)
+
+// elideBraceBodies replaces the bodies of functions, methods and lambdas
+// with "{ ... }" in a language with C-like braces. A block whose
+// declaration names a class, interface, struct, enum, trait, impl or
+// namespace is kept and its members outlined; other blocks are bodies when
+// a parameter list or an arrow leads to them. Object literals, initializers
+// and property accessors are kept.
+func elideBraceBodies(src []byte, lang string) []byte {
+	code := codeMask(src, lang)
+
+	type frame struct {
+		open   int
+		header int // where the statement leading to the brace starts
+		elide  bool
+	}
+	type span struct{ start, end int }
+	var stack []frame
+	var bodies []span
+	eliding := 0 // open frames being elided
+	stmtStart := 0
+	for i, c := range code {
+		switch c {
+		case '{':
+			elide := false
+			if eliding == 0 {
+				elide = isBodyHeader(string(code[stmtStart:i]))
+			}
+			if elide {
+				eliding++
+			}
+			stack = append(stack, frame{i, stmtStart, elide})
+			stmtStart = i + 1
+		case '}':
+			if len(stack) == 0 {
+				// Unbalanced; leave the file as it is
+				return nil
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if f.elide {
+				if eliding--; eliding == 0 {
+					bodies = append(bodies, span{f.open, i + 1})
+				}
+			}
+			stmtStart = i + 1
+			if header := string(code[f.header:f.open]); !f.elide && (openParens(header) > 0 || strings.HasSuffix(strings.TrimSpace(header), ":")) {
+				// A destructured parameter or a type literal, as in
+				// function f({ a }): { b: number } {; the statement goes on
+				stmtStart = f.header
+			}
+		case ';':
+			stmtStart = i + 1
+		}
+	}
+	if len(stack) > 0 {
+		return nil
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, body := range bodies {
+		out.Write(src[last:body.start])
+		out.WriteString("{ ... }")
+		last = body.end
+	}
+	out.Write(src[last:])
+	return out.Bytes()
+}
+
+// isBodyHeader reports whether the code before an opening brace introduces
+// a function body. Inside an open argument list only the last argument
+// counts, as in describe("x", () => {.
+func isBodyHeader(header string) bool {
+	depth := 0
+	cut := -1
+	for i := len(header) - 1; i >= 0; i-- {
+		switch header[i] {
+		case ')':
+			depth++
+		case '(':
+			if depth == 0 {
+				cut = i
+				i = -1 // the innermost open parenthesis
+				continue
+			}
+			depth--
+		}
+	}
+	if cut >= 0 {
+		header = header[cut+1:]
+		depth = 0
+		for i := len(header) - 1; i >= 0; i-- {
+			switch header[i] {
+			case ')':
+				depth++
+			case '(':
+				depth--
+			case ',':
+				if depth == 0 {
+					header = header[i+1:]
+					i = -1
+				}
+			}
+		}
+	}
+	if containerKeyword.MatchString(header) || strings.HasSuffix(strings.TrimSpace(header), ":") {
+		// A type literal, as in f(): { a: number }, is not a body
+		return false
+	}
+	return strings.Contains(header, "(") || strings.Contains(header, "=>") || strings.Contains(header, "->") || strings.Contains(header, "function")
+}
+
+// openParens returns how many parentheses s leaves open.
+func openParens(s string) int {
+	return strings.Count(s, "(") - strings.Count(s, ")")
+}
+
+// elidePythonBodies replaces the bodies of functions with "..." at their
+// indentation, keeping decorators, signatures and docstrings. Classes are
+// kept with their methods outlined.
+func elidePythonBodies(src []byte) []byte {
+	lines := strings.SplitAfter(string(src), "\n")
+	logical := pythonLogicalLines(lines)
+
+	var out strings.Builder
+	next := 0 // the next physical line to write
+	for k := 0; k < len(logical); k++ {
+		l := logical[k]
+		if l.first < next {
+			continue
+		}
+		if !pythonDef.MatchString(l.code) || !strings.HasSuffix(strings.TrimSpace(l.code), ":") {
+			continue
+		}
+		// The body is every following logical line indented deeper
+		end := k + 1
+		for end < len(logical) && logical[end].indent > l.indent {
+			end++
+		}
+		if end == k+1 {
+			continue
+		}
+		body := logical[k+1 : end]
+
+		for _, line := range lines[next : l.last+1] {
+			out.WriteString(line)
+		}
+		next = l.last + 1
+		if strings.TrimSpace(body[0].code) == "" && body[0].stringOnly {
+			// Keep the docstring
+			for _, line := range lines[next : body[0].last+1] {
+				out.WriteString(line)
+			}
+			next = body[0].last + 1
+		}
+		indent := lines[body[0].first][:len(lines[body[0].first])-len(strings.TrimLeft(lines[body[0].first], " \t"))]
+		out.WriteString(indent + "...\n")
+		next = body[len(body)-1].last + 1
+	}
+	for _, line := range lines[min(next, len(lines)):] {
+		out.WriteString(line)
+	}
+	return []byte(out.String())
+}
+
+var pythonDef = regexp.MustCompile(`^\s*(?:async\s+)?def\b`)
+
+// pythonLine is a logical line of Python: physical lines first to last,
+// joined by open brackets, backslashes or strings, with the code outside
+// strings and comments.
+type pythonLine struct {
+	first, last int
+	indent      int
+	code        string
+	stringOnly  bool // a bare string, such as a docstring
+}
+
+// pythonLogicalLines groups physical lines into logical lines. Blank and
+// comment-only lines belong to no logical line.
+func pythonLogicalLines(lines []string) []pythonLine {
+	var result []pythonLine
+	var current *pythonLine
+	var code strings.Builder
+	depth := 0
+	quote := "" // the open string's quote, when a string spans lines
+	sawString := false
+	for n, line := range lines {
+		if current == nil {
+			if quote == "" && (strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#")) {
+				continue
+			}
+			trimmed := strings.TrimLeft(line, " \t")
+			current = &pythonLine{first: n, indent: len(line) - len(trimmed)}
+			code.Reset()
+			sawString = false
+		}
+		continued := false
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if quote != "" {
+				if c == '\\' {
+					i++
+					continue
+				}
+				if strings.HasPrefix(line[i:], quote) {
+					i += len(quote) - 1
+					quote = ""
+				}
+				continue
+			}
+			switch {
+			case c == '#':
+				i = len(line)
+			case c == '"' || c == '\'':
+				quote = string(c)
+				if strings.HasPrefix(line[i:], strings.Repeat(string(c), 3)) {
+					quote = strings.Repeat(string(c), 3)
+					i += 2
+				}
+				sawString = true
+				// A string prefix such as f, r or b is part of the string
+				s := code.String()
+				code.Reset()
+				code.WriteString(strings.TrimRight(s, "rRbBfFuU"))
+			case c == '\\' && strings.TrimSpace(line[i+1:]) == "":
+				continued = true
+				i = len(line)
+			default:
+				if c == '(' || c == '[' || c == '{' {
+					depth++
+				} else if (c == ')' || c == ']' || c == '}') && depth > 0 {
+					depth--
+				}
+				code.WriteByte(c)
+			}
+		}
+		// Single-quoted strings end at the line
+		if quote == `"` || quote == "'" {
+			quote = ""
+		}
+		if depth > 0 || quote != "" || continued {
+			continue
+		}
+		current.last = n
+		current.code = code.String()
+		current.stringOnly = sawString && strings.TrimSpace(current.code) == ""
+		result = append(result, *current)
+		current = nil
+	}
+	if current != nil {
+		current.last = len(lines) - 1
+		current.code = code.String()
+		result = append(result, *current)
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestOutlineSource(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		src  string
+		want string // "" when the file is left to the fallback
+	}{
+		{
+			name: "go",
+			path: "a.go",
+			src:  "package a\n\nimport \"fmt\"\n\ntype T struct{ n int }\n\nfunc (t T) String() string {\n\treturn fmt.Sprint(t.n)\n}\n",
+			want: "package a\n\nimport \"fmt\"\n\ntype T struct{ n int }\n\nfunc (t T) String() string { ... }\n",
+		},
+		{"go that does not parse", "a.go", "package a\nfunc {\n", ""},
+		{
+			name: "python",
+			path: "a.py",
+			src:  "import os\n\n@cache\ndef f(a,\n      b):\n    \"\"\"Doc.\"\"\"\n    return a + b\n\nclass C:\n    x = \"def g():\"\n\n    async def m(self):\n        s = '''\n  text\n'''\n        return s\n",
+			want: "import os\n\n@cache\ndef f(a,\n      b):\n    \"\"\"Doc.\"\"\"\n    ...\n\nclass C:\n    x = \"def g():\"\n\n    async def m(self):\n        ...\n",
+		},
+		{
+			name: "javascript functions, arrows and methods",
+			path: "a.js",
+			src:  "import x from 'x';\nexport function f(a) {\n  return a;\n}\nconst g = async (b) => {\n  await b;\n};\nclass C extends D {\n  m() {\n    return 1;\n  }\n}\nconst o = { k: 1, n() { return 2; } };\ndescribe(\"x\", () => {\n  it(\"y\", () => {});\n});\n",
+			want: "import x from 'x';\nexport function f(a) { ... }\nconst g = async (b) => { ... };\nclass C extends D {\n  m() { ... }\n}\nconst o = { k: 1, n() { ... } };\ndescribe(\"x\", () => { ... });\n",
+		},
+		{
+			name: "braces in strings, templates, regexes and comments",
+			path: "a.js",
+			src:  "function f() {\n  const s = \"}\" + `${a ? `}` : '{'}` + /[}]/.source; // }\n  /* { */\n}\nconst n = 1;\n",
+			want: "function f() { ... }\nconst n = 1;\n",
+		},
+		{
+			name: "jsx with destructured parameters",
+			path: "a.jsx",
+			src:  "export function App({ a, b }) {\n  return <div>{a}</div>;\n}\n",
+			want: "export function App({ a, b }) { ... }\n",
+		},
+		{
+			name: "typescript type literals",
+			path: "a.ts",
+			src:  "interface I {\n  f(): void;\n}\nfunction f(): { a: number } {\n  return { a: 1 };\n}\nconst g = (x: { y: string }): void => {\n  console.log(x);\n};\nconst c: { a: number } = { a: 1 };\n",
+			want: "interface I {\n  f(): void;\n}\nfunction f(): { a: number } { ... }\nconst g = (x: { y: string }): void => { ... };\nconst c: { a: number } = { a: 1 };\n",
+		},
+		{
+			name: "typescript class",
+			path: "a.ts",
+			src:  "export class A extends B {\n  constructor(private x: number) {\n    super();\n  }\n  get y(): number {\n    return 1;\n  }\n}\n",
+			want: "export class A extends B {\n  constructor(private x: number) { ... }\n  get y(): number { ... }\n}\n",
+		},
+		{
+			name: "java",
+			path: "A.java",
+			src:  "@Ann(\"x\")\npublic class A {\n  static { init(); }\n  void f(Map<String, List<Integer>> m) {\n    char c = '}';\n    String t = \"\"\"\n      }\n      \"\"\";\n  }\n  Runnable r = () -> { run(); };\n}\n",
+			want: "@Ann(\"x\")\npublic class A {\n  static { init(); }\n  void f(Map<String, List<Integer>> m) { ... }\n  Runnable r = () -> { ... };\n}\n",
+		},
+		{
+			name: "rust",
+			path: "a.rs",
+			src:  "impl<T> X<T> where T: Fn() -> u8 {\n    fn f(&self) -> &'static str {\n        r#\"}\"#\n    }\n}\nfn g<'a>(x: &'a str) -> Option<char> { Some('{') }\n/* /* } */ */\n",
+			want: "impl<T> X<T> where T: Fn() -> u8 {\n    fn f(&self) -> &'static str { ... }\n}\nfn g<'a>(x: &'a str) -> Option<char> { ... }\n/* /* } */ */\n",
+		},
+		{"unbalanced braces", "a.js", "function f() {\n", ""},
+		{"kotlin left to the fallback", "A.kt", "class A {\n  fun f() {\n  }\n}\n", ""},
+		{"c# left to the fallback", "A.cs", "class A {\n  int F() { return 1; }\n}\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(outlineSource(tt.path, []byte(tt.src))); got != tt.want {
+				t.Errorf("outlineSource =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// outputFile is the destination of a run. In atomic mode content goes to a
+// temporary file next to the destination that is renamed into place on
+// commit, so readers never observe a partially written output. Object store
+// destinations are written to a local temporary file uploaded on commit.
+type outputFile struct {
+	*os.File
+	path   string
+	atomic bool
+	remote bool
+}
+
+func createOutput(path string, atomic bool) (*outputFile, error) {
+	if isObjectStoreURL(path) {
+		f, err := os.CreateTemp("", "contextify-*")
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{File: f, path: path, remote: true}, nil
+	}
+	if !atomic {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{File: f, path: path}, nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{File: f, path: path, atomic: true}, nil
+}
+
+// commit closes the file and, in atomic mode, moves it to its destination.
+func (o *outputFile) commit() error {
+	if err := o.Close(); err != nil {
+		if o.atomic || o.remote {
+			_ = os.Remove(o.Name())
+		}
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+	if o.remote {
+		defer os.Remove(o.Name())
+		return upload(o.path, o.Name())
+	}
+	if !o.atomic {
+		return nil
+	}
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(o.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(o.Name(), mode); err != nil {
+		_ = os.Remove(o.Name())
+		return fmt.Errorf("failed to set output file mode: %w", err)
+	}
+	if err := os.Rename(o.Name(), o.path); err != nil {
+		_ = os.Remove(o.Name())
+		return fmt.Errorf("failed to move output file into place: %w", err)
+	}
+	return nil
+}
+
+// discard closes and deletes whatever was written.
+func (o *outputFile) discard() error {
+	_ = o.Close()
+	if err := os.Remove(o.Name()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove partial output: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ownOutputs reports whether an absolute path is one a run with config
+// writes: the output, or the directory of a multimodal one, its temporary
+// file, its split parts and resume state, and side files such as the
+// findings report, profile, progress file, manifest and run summary.
+func ownOutputs(config *Config) func(path string) bool {
+	written := make(map[string]bool)
+	add := func(path string) {
+		if path != "" && !isObjectStoreURL(path) {
+			if abs, err := filepath.Abs(path); err == nil {
+				written[abs] = true
+			}
+		}
+	}
+
+	var absOutput string
+	if config.outputPath != "" && config.pipe == "" && !isObjectStoreURL(config.outputPath) {
+		absOutput, _ = filepath.Abs(config.outputPath)
+		add(absOutput)
+		add(resumePath(absOutput))
+	}
+	add(config.findingsReport)
+	add(config.progressFile)
+	add(config.manifestFile)
+	add(config.resultFile)
+	if config.profile != "" {
+		path := config.profileOut
+		if path == "" {
+			path = defaultProfilePath(config.profile)
+		}
+		add(path)
+	}
+
+	ext := filepath.Ext(absOutput)
+	tempPrefix := "." + filepath.Base(absOutput) + ".tmp-"
+	partPrefix := strings.TrimSuffix(filepath.Base(absOutput), ext) + ".part"
+	return func(path string) bool {
+		if written[path] {
+			return true
+		}
+		if absOutput == "" || filepath.Dir(path) != filepath.Dir(absOutput) {
+			return false
+		}
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, tempPrefix) {
+			return true
+		}
+		// context.part1.txt, as splitOutput names the parts
+		part, ok := strings.CutPrefix(name, partPrefix)
+		if !ok {
+			return false
+		}
+		part, ok = strings.CutSuffix(part, ext)
+		return ok && part != "" && strings.Trim(part, "0123456789") == ""
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var jsExtensions = map[string]bool{".js": true, ".jsx": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true, ".mts": true, ".cts": true}
+
+// pairTests places each file's test right after it, and a test's source
+// right before it, for -pair-tests. Partners missing from the list are
+// pulled in from the input directory whatever the filters say. Tests are
+// matched by the naming conventions of Go (x_test.go), JavaScript and
+// TypeScript (x.test.ts, x.spec.ts, __tests__/x.ts), Python (test_x.py,
+// x_test.py, tests/test_x.py), the JVM and .NET (XTest.java,
+// src/test/.../XTest.java, XTests.cs) and Ruby (spec/.../x_spec.rb).
+func pairTests(absPath string, files []sourceFile, config *Config) []sourceFile {
+	byRelPath := make(map[string]sourceFile, len(files))
+	for _, file := range files {
+		byRelPath[filepath.ToSlash(file.relPath)] = file
+	}
+	// lookup finds a partner among the files or on disk
+	lookup := func(candidates []string) (sourceFile, bool) {
+		for _, c := range candidates {
+			if file, ok := byRelPath[c]; ok {
+				return file, true
+			}
+		}
+		for _, c := range candidates {
+			full := filepath.Join(absPath, filepath.FromSlash(c))
+			if info, err := os.Stat(full); err == nil && info.Mode().IsRegular() {
+				config.logger.Debug("Pulling in test partner", "path", c)
+				file := sourceFile{path: full, relPath: filepath.FromSlash(c)}
+				byRelPath[c] = file
+				return file, true
+			}
+		}
+		return sourceFile{}, false
+	}
+
+	paired := make([]sourceFile, 0, len(files))
+	emitted := make(map[string]bool, len(files))
+	emit := func(file sourceFile) {
+		if p := filepath.ToSlash(file.relPath); !emitted[p] {
+			emitted[p] = true
+			paired = append(paired, file)
+		}
+	}
+	for _, file := range files {
+		p := filepath.ToSlash(file.relPath)
+		if emitted[p] || !filepath.IsLocal(file.relPath) {
+			emit(file)
+			continue
+		}
+		if sources := sourceCandidates(p); sources != nil {
+			if source, ok := lookup(sources); ok {
+				emit(source)
+			}
+			emit(file)
+			continue
+		}
+		emit(file)
+		if test, ok := lookup(testCandidates(p)); ok {
+			emit(test)
+		}
+	}
+	return paired
+}
+
+// testCandidates returns where the tests of a source file may be, most
+// likely first.
+func testCandidates(p string) []string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	switch {
+	case ext == ".go":
+		return []string{dir + stem + "_test.go"}
+	case jsExtensions[ext]:
+		return []string{dir + stem + ".test" + ext, dir + stem + ".spec" + ext, dir + "__tests__/" + stem + ".test" + ext, dir + "__tests__/" + base}
+	case ext == ".py":
+		return []string{dir + "test_" + base, dir + stem + "_test.py", dir + "tests/test_" + base, "tests/test_" + base}
+	case ext == ".java" || ext == ".kt" || ext == ".scala" || ext == ".cs":
+		candidates := []string{dir + stem + "Test" + ext, dir + stem + "Tests" + ext}
+		if strings.Contains(dir, "/main/") || strings.HasPrefix(dir, "main/") {
+			testDir := strings.Replace("/"+dir, "/main/", "/test/", 1)[1:]
+			candidates = append(candidates, testDir+stem+"Test"+ext, testDir+stem+"Tests"+ext)
+		}
+		return candidates
+	case ext == ".rb":
+		if rest, ok := cutFirstDir(dir, "lib", "app"); ok {
+			return []string{"spec/" + rest + stem + "_spec.rb"}
+		}
+		return []string{"spec/" + dir + stem + "_spec.rb"}
+	}
+	return nil
+}
+
+// sourceCandidates returns the source files a test may cover, or nil when
+// p is not a test.
+func sourceCandidates(p string) []string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	parent := path.Dir(strings.TrimSuffix(dir, "/"))
+	if parent == "." {
+		parent = ""
+	} else {
+		parent += "/"
+	}
+	switch {
+	case ext == ".go" && strings.HasSuffix(stem, "_test"):
+		return []string{dir + strings.TrimSuffix(stem, "_test") + ext}
+	case jsExtensions[ext]:
+		for _, suffix := range []string{".test", ".spec"} {
+			if name, ok := strings.CutSuffix(stem, suffix); ok {
+				if path.Base(dir) == "__tests__" {
+					return []string{parent + name + ext}
+				}
+				return []string{dir + name + ext}
+			}
+		}
+		if path.Base(dir) == "__tests__" {
+			return []string{parent + base}
+		}
+	case ext == ".py":
+		name, ok := strings.CutPrefix(stem, "test_")
+		if !ok {
+			name, ok = strings.CutSuffix(stem, "_test")
+		}
+		if ok {
+			if path.Base(dir) == "tests" {
+				return []string{parent + name + ext, dir + name + ext}
+			}
+			return []string{dir + name + ext}
+		}
+	case ext == ".java" || ext == ".kt" || ext == ".scala" || ext == ".cs":
+		for _, suffix := range []string{"Tests", "Test"} {
+			if name, ok := strings.CutSuffix(stem, suffix); ok && name != "" {
+				candidates := []string{dir + name + ext}
+				if strings.Contains("/"+dir, "/test/") {
+					mainDir := strings.Replace("/"+dir, "/test/", "/main/", 1)[1:]
+					candidates = append(candidates, mainDir+name+ext)
+				}
+				return candidates
+			}
+		}
+	case ext == ".rb" && strings.HasSuffix(stem, "_spec"):
+		name := strings.TrimSuffix(stem, "_spec")
+		if rest, ok := cutFirstDir(dir, "spec"); ok {
+			return []string{"lib/" + rest + name + ext, "app/" + rest + name + ext}
+		}
+		return []string{dir + name + ext}
+	}
+	return nil
+}
+
+// cutFirstDir cuts one of the named directories off the front of dir.
+func cutFirstDir(dir string, names ...string) (string, bool) {
+	for _, name := range names {
+		if rest, ok := strings.CutPrefix(dir, name+"/"); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
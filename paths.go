@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// windowsReservedNames are device names Windows reserves in every
+// directory, with or without an extension: "nul.txt" opens the NUL device.
+var windowsReservedNames = toSet(strings.Fields(`
+	con prn aux nul
+	com1 com2 com3 com4 com5 com6 com7 com8 com9 com¹ com² com³
+	lpt1 lpt2 lpt3 lpt4 lpt5 lpt6 lpt7 lpt8 lpt9 lpt¹ lpt² lpt³`))
+
+// hasReservedName reports whether any element of a slash-separated path is
+// a reserved Windows device name.
+func hasReservedName(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		stem, _, _ := strings.Cut(part, ".")
+		stem = strings.TrimRight(stem, " ")
+		if windowsReservedNames[strings.ToLower(stem)] {
+			return true
+		}
+	}
+	return false
+}
+
+// stripLongPathPrefix turns a Windows extended-length path back into its
+// usual form for display: \\?\C:\src becomes C:\src and \\?\UNC\host\share
+// becomes \\host\share. The os package adds the prefix itself where a path
+// needs it.
+func stripLongPathPrefix(p string) string {
+	if rest, ok := strings.CutPrefix(p, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(p, `\\?\`)
+}
+
+// containsPathName looks a slash-separated path up in set, comparing the
+// way the platform compares file names.
+func containsPathName(set map[string]bool, name string) bool {
+	if set[name] {
+		return true
+	}
+	if windowsPaths {
+		for entry := range set {
+			if strings.EqualFold(filepath.ToSlash(entry), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPathSuffix is strings.HasSuffix, ignoring case where the platform does.
+func hasPathSuffix(name, suffix string) bool {
+	if windowsPaths {
+		return len(name) >= len(suffix) && strings.EqualFold(name[len(name)-len(suffix):], suffix)
+	}
+	return strings.HasSuffix(name, suffix)
+}
+
+// nfc returns the NFC form of a path or pattern. macOS stores file names
+// decomposed (NFD) while Linux keeps them as created, usually composed, so
+// names are normalized before they are matched or written out.
+func nfc(s string) string {
+	return norm.NFC.String(s)
+}
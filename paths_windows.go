@@ -0,0 +1,7 @@
+//go:build windows
+
+package main
+
+// windowsPaths turns on the Windows file name rules: exclude rules match
+// regardless of case, and reserved device names are never read or written.
+const windowsPaths = true
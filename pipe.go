@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// outputPipe feeds the output to the -pipe command, whose output and errors
+// go to ours. With hold set the output is kept until the run succeeds, so
+// a run -strict fails sends the command nothing.
+type outputPipe struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	held  *bytes.Buffer
+}
+
+func startPipe(ctx context.Context, line string, hold bool) (*outputPipe, error) {
+	cmd := shellCommand(ctx, line)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start -pipe command: %w", err)
+	}
+	p := &outputPipe{cmd: cmd, stdin: stdin}
+	if hold {
+		p.held = &bytes.Buffer{}
+	}
+	return p, nil
+}
+
+func (p *outputPipe) Write(b []byte) (int, error) {
+	if p.held != nil {
+		return p.held.Write(b)
+	}
+	return p.stdin.Write(b)
+}
+
+// finish ends the command's input and waits for it. When the run failed
+// the command is killed instead, so it does not act on a partial context.
+// A command that stopped reading is reported by how it exited.
+func (p *outputPipe) finish(runErr error) error {
+	if errors.Is(runErr, syscall.EPIPE) {
+		if err := p.cmd.Wait(); err != nil {
+			return fmt.Errorf("-pipe command failed: %w", err)
+		}
+		return fmt.Errorf("-pipe command stopped reading the output: %w", runErr)
+	}
+	if runErr != nil {
+		_ = p.cmd.Process.Kill()
+		_ = p.cmd.Wait()
+		return runErr
+	}
+	var writeErr error
+	if p.held != nil {
+		_, writeErr = p.stdin.Write(p.held.Bytes())
+	}
+	closeErr := p.stdin.Close()
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("-pipe command failed: %w", err)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write to -pipe command: %w", writeErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to write to -pipe command: %w", closeErr)
+	}
+	return nil
+}
+
+// processPiped runs processDirectory with the output streamed into the
+// -pipe command instead of a file.
+func processPiped(ctx context.Context, config *Config) error {
+	pipe, err := startPipe(ctx, config.pipe, config.strict != nil)
+	if err != nil {
+		return err
+	}
+	config.outputWriter = pipe
+	return pipe.finish(processDirectory(ctx, config))
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var githubPRPattern = regexp.MustCompile(`^https?://([^/]+)/([^/]+)/([^/]+)/pull/(\d+)`)
+
+// pullRequest is what the pr command packs: the description, discussion,
+// diff and current content of the changed files.
+type pullRequest struct {
+	URL      string
+	Title    string
+	Author   string
+	Base     string
+	Head     string
+	Body     string
+	Files    []prFile
+	Comments []prComment
+}
+
+type prFile struct {
+	Path    string
+	Status  string // added, modified, removed, renamed
+	Patch   string
+	Content []byte // current content; nil for removed or binary files
+}
+
+type prComment struct {
+	Author string
+	Path   string // set for review comments on a line
+	Line   int
+	Body   string
+}
+
+func setupPR(fs *flag.FlagSet) func(args []string) int {
+	output := fs.String("output", "context.txt", "Output file path (- for stdout)")
+	tokenEnv := fs.String("token-env", "", "Environment variable holding the API token (default GITHUB_TOKEN for github.com, or the variable CONTEXTIFY_GIT_HOST_TOKENS names for a GitHub Enterprise host)")
+	apiURL := fs.String("api", "", "API base URL (default https://api.github.com, or https://<host>/api/v3 for GitHub Enterprise)")
+	noContent := fs.Bool("no-content", false, "Leave out the full content of changed files; pack only the diff and discussion")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		if len(args) != 1 {
+			logger.Error("Expected one pull request URL", "args", args)
+			return exitFailure
+		}
+		m := githubPRPattern.FindStringSubmatch(args[0])
+		if m == nil {
+			logger.Error("Not a pull request URL", "url", args[0])
+			return exitFailure
+		}
+		host, owner, repo, number := m[1], m[2], m[3], m[4]
+
+		api := *apiURL
+		if api == "" {
+			api = "https://api.github.com"
+			if host != "github.com" {
+				api = "https://" + host + "/api/v3"
+			}
+		}
+		// A github.com token is never sent to another host
+		keyEnv := *tokenEnv
+		if keyEnv == "" {
+			keyEnv = hostTokenEnv(host)
+			if keyEnv == "" && publicForge("github", host) {
+				keyEnv = "GITHUB_TOKEN"
+			}
+		}
+		client := &githubClient{base: strings.TrimRight(api, "/")}
+		if keyEnv != "" {
+			client.token = os.Getenv(keyEnv)
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		pr, err := client.pullRequest(ctx, owner, repo, number, !*noContent)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				logger.Warn("Cancelled")
+				return exitCancelled
+			}
+			logger.Error("Failed to fetch pull request", "error", err)
+			return exitFailure
+		}
+
+		var w io.Writer = os.Stdout
+		var outputFile *outputFile
+		if *output != "-" {
+			outputFile, err = createOutput(*output, true)
+			if err != nil {
+				logger.Error("Failed to create output file", "error", err)
+				return exitFailure
+			}
+			w = outputFile
+		}
+		writer := bufio.NewWriter(w)
+		err = writePullRequest(writer, pr)
+		if err == nil {
+			err = writer.Flush()
+		}
+		if outputFile != nil {
+			if err != nil {
+				_ = outputFile.discard()
+			} else {
+				err = outputFile.commit()
+			}
+		}
+		if err != nil {
+			logger.Error("Failed to write output", "error", err)
+			return exitFailure
+		}
+
+		logger.Info("Successfully created pull request context", "output", *output, "files", len(pr.Files), "comments", len(pr.Comments))
+		return exitSuccess
+	}
+}
+
+type githubClient struct {
+	base  string
+	token string
+}
+
+// get fetches an API path into v, or returns the raw body when v is nil.
+func (c *githubClient) get(ctx context.Context, path, accept string, v any) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if v != nil {
+		return nil, json.Unmarshal(data, v)
+	}
+	return data, nil
+}
+
+// getPages fetches every page of a list endpoint.
+func getPages[T any](ctx context.Context, c *githubClient, path string) ([]T, error) {
+	var all []T
+	for page := 1; ; page++ {
+		var items []T
+		if _, err := c.get(ctx, fmt.Sprintf("%s?per_page=100&page=%d", path, page), "application/vnd.github+json", &items); err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if len(items) < 100 {
+			return all, nil
+		}
+	}
+}
+
+func (c *githubClient) pullRequest(ctx context.Context, owner, repo, number string, withContent bool) (*pullRequest, error) {
+	prefix := "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+
+	var meta struct {
+		HTMLURL string `json:"html_url"`
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		User    struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+	}
+	if _, err := c.get(ctx, prefix+"/pulls/"+number, "application/vnd.github+json", &meta); err != nil {
+		return nil, err
+	}
+	pr := &pullRequest{
+		URL:    meta.HTMLURL,
+		Title:  meta.Title,
+		Author: meta.User.Login,
+		Base:   meta.Base.Ref,
+		Head:   meta.Head.Ref,
+		Body:   meta.Body,
+	}
+
+	type fileItem struct {
+		Filename string `json:"filename"`
+		Status   string `json:"status"`
+		Patch    string `json:"patch"`
+	}
+	files, err := getPages[fileItem](ctx, c, prefix+"/pulls/"+number+"/files")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		file := prFile{Path: f.Filename, Status: f.Status, Patch: f.Patch}
+		if withContent && f.Status != "removed" {
+			path := prefix + "/contents/" + escapePath(f.Filename) + "?ref=" + url.QueryEscape(meta.Head.SHA)
+			data, err := c.get(ctx, path, "application/vnd.github.raw+json", nil)
+			if err != nil {
+				return nil, err
+			}
+			if !looksBinary(data) {
+				file.Content = data
+			}
+		}
+		pr.Files = append(pr.Files, file)
+	}
+
+	type commentItem struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Body string `json:"body"`
+		Path string `json:"path"`
+		Line int    `json:"line"`
+	}
+	comments, err := getPages[commentItem](ctx, c, prefix+"/issues/"+number+"/comments")
+	if err != nil {
+		return nil, err
+	}
+	reviewComments, err := getPages[commentItem](ctx, c, prefix+"/pulls/"+number+"/comments")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range append(comments, reviewComments...) {
+		pr.Comments = append(pr.Comments, prComment{Author: item.User.Login, Path: item.Path, Line: item.Line, Body: item.Body})
+	}
+	return pr, nil
+}
+
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// writePullRequest renders the pull request as a context document. The file
+// blocks come last and use the pack format, so unpack and diff read them.
+func writePullRequest(writer *bufio.Writer, pr *pullRequest) error {
+	fmt.Fprintf(writer, "# Contextify Output\n%s# Pull request: %s\n# Title: %s\n# Author: %s\n# Branches: %s <- %s\n# Changed files: %d\n\n",
+		formatLine(), pr.URL, pr.Title, pr.Author, pr.Base, pr.Head, len(pr.Files))
+
+	fmt.Fprintf(writer, "## Description\n```\n%s\n```\n\n", strings.TrimSpace(pr.Body))
+
+	if len(pr.Comments) > 0 {
+		fmt.Fprintf(writer, "## Comments (%d)\n```\n", len(pr.Comments))
+		for _, comment := range pr.Comments {
+			location := ""
+			if comment.Path != "" {
+				location = " on " + comment.Path
+				if comment.Line > 0 {
+					location += ":" + strconv.Itoa(comment.Line)
+				}
+			}
+			fmt.Fprintf(writer, "@%s%s:\n%s\n\n", comment.Author, location, strings.TrimSpace(comment.Body))
+		}
+		fmt.Fprint(writer, "```\n\n")
+	}
+
+	fmt.Fprint(writer, "## Diff\n```diff\n")
+	for _, file := range pr.Files {
+		fmt.Fprintf(writer, "diff --git a/%s b/%s (%s)\n", file.Path, file.Path, file.Status)
+		if file.Patch != "" {
+			fmt.Fprintf(writer, "%s\n", file.Patch)
+		}
+	}
+	fmt.Fprint(writer, "```\n\n")
+
+	packed := 0
+	for _, file := range pr.Files {
+		if file.Content == nil {
+			continue
+		}
+		packed++
+		if _, err := fmt.Fprintf(writer, "%s%s\n%s%s%s", fileMarker, file.Path, blockFence, file.Content, blockEnd); err != nil {
+			return err
+		}
+	}
+	return writeMetadataSection(writer, &contextMetadata{
+		FormatVersion: formatVersion,
+		Tool:          "contextify",
+		ToolVersion:   version,
+		Format:        "text",
+		Files:         packed,
+	})
+}
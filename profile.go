@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"text/tabwriter"
+	"time"
+)
+
+var profileKinds = []string{"cpu", "mem", "trace"}
+
+// defaultProfilePath names the profile of a kind when -profile-out is not
+// set.
+func defaultProfilePath(kind string) string {
+	if kind == "trace" {
+		return "contextify.trace"
+	}
+	return "contextify." + kind + ".pprof"
+}
+
+// startProfile starts a CPU profile or execution trace, or prepares a heap
+// profile, and returns the function that stops it and writes it to path.
+// The files are those of runtime/pprof and runtime/trace, for go tool pprof
+// and go tool trace.
+func startProfile(kind, path string) (func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile: %w", err)
+	}
+	switch kind {
+	case "cpu":
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+		return func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		}, nil
+	case "trace":
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start trace: %w", err)
+		}
+		return func() error {
+			trace.Stop()
+			return f.Close()
+		}, nil
+	default:
+		return func() error {
+			// Up-to-date statistics need a collection first
+			runtime.GC()
+			if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to write memory profile: %w", err)
+			}
+			return f.Close()
+		}, nil
+	}
+}
+
+// runTimings breaks the wall time of a run down by phase for -timing.
+// Transform is what the other phases leave: transforms, formatting and
+// bookkeeping.
+type runTimings struct {
+	WalkMs      float64 `json:"walkMs"`
+	BudgetMs    float64 `json:"budgetMs"`
+	ReadMs      float64 `json:"readMs"`
+	TransformMs float64 `json:"transformMs"`
+	TokenizeMs  float64 `json:"tokenizeMs"`
+	WriteMs     float64 `json:"writeMs"`
+	TotalMs     float64 `json:"totalMs"`
+
+	walk, budget, read, tokenize, write time.Duration
+}
+
+// finish derives the millisecond figures from the phase durations.
+func (t *runTimings) finish(total time.Duration) {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	transform := max(total-t.walk-t.budget-t.read-t.tokenize-t.write, 0)
+	t.WalkMs, t.BudgetMs, t.ReadMs = ms(t.walk), ms(t.budget), ms(t.read)
+	t.TransformMs, t.TokenizeMs, t.WriteMs = ms(transform), ms(t.tokenize), ms(t.write)
+	t.TotalMs = ms(total)
+}
+
+func writeTimings(w io.Writer, t *runTimings) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "PHASE\tMS\tSHARE\t")
+	for _, phase := range []struct {
+		name string
+		ms   float64
+	}{
+		{"walk", t.WalkMs},
+		{"budget", t.BudgetMs},
+		{"read", t.ReadMs},
+		{"transform", t.TransformMs},
+		{"tokenize", t.TokenizeMs},
+		{"write", t.WriteMs},
+		{"total", t.TotalMs},
+	} {
+		share := 0.0
+		if t.TotalMs > 0 {
+			share = 100 * phase.ms / t.TotalMs
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%.1f%%\t\n", phase.name, phase.ms, share)
+	}
+	tw.Flush()
+}
+
+// timedWriter adds the time spent writing to w to spent.
+type timedWriter struct {
+	w     io.Writer
+	spent *time.Duration
+}
+
+func (t timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	*t.spent += time.Since(start)
+	return n, err
+}
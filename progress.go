@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var progressModes = []string{"auto", "none", "plain", "bar", "json"}
+
+// progressReporter renders run counters to stderr while the walk and the
+// file processing are under way. In json mode it instead writes an event
+// per step as it happens, one JSON object per line, for tools wrapping
+// contextify.
+type progressReporter struct {
+	mode     string
+	out      io.Writer
+	events   *json.Encoder
+	mu       sync.Mutex // guards events
+	scanned  atomic.Int64
+	total    atomic.Int64
+	done     atomic.Int64
+	included atomic.Int64
+	bytes    atomic.Int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// progressEvent is a line of -progress json.
+type progressEvent struct {
+	Event  string       `json:"event"` // walk_started, file_included, file_skipped, budget_exceeded or done
+	Time   time.Time    `json:"time"`
+	Input  string       `json:"input,omitempty"`
+	Path   string       `json:"path,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+	Budget *budgetUsage `json:"budget,omitempty"`
+	Stats  *runResult   `json:"stats,omitempty"`
+}
+
+// newProgressReporter returns nil when progress output is disabled. auto
+// selects the bar on terminals and nothing otherwise. Progress goes to out,
+// which is stderr unless -progress-file says otherwise.
+func newProgressReporter(mode string, out io.Writer) *progressReporter {
+	if mode == "auto" {
+		mode = "none"
+		if isTerminal(os.Stderr) {
+			mode = "bar"
+		}
+	}
+	if mode == "none" {
+		return nil
+	}
+
+	p := &progressReporter{mode: mode, out: out, stop: make(chan struct{})}
+	if mode == "json" {
+		p.events = json.NewEncoder(out)
+		return p
+	}
+	interval := 200 * time.Millisecond
+	if mode == "plain" {
+		interval = 2 * time.Second
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render(false)
+			case <-p.stop:
+				p.render(true)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progressReporter) fileScanned() {
+	if p != nil {
+		p.scanned.Add(1)
+	}
+}
+
+func (p *progressReporter) setTotal(n int) {
+	if p != nil {
+		p.total.Store(int64(n))
+	}
+}
+
+func (p *progressReporter) fileDone(relPath string, included bool) {
+	if p == nil {
+		return
+	}
+	p.done.Add(1)
+	if included {
+		p.included.Add(1)
+		p.emit(progressEvent{Event: "file_included", Path: relPath})
+	}
+}
+
+// walkStarted, fileSkipped, budgetExceeded and finished only matter to
+// json mode, which the counters cannot serve.
+func (p *progressReporter) walkStarted(input string) {
+	p.emit(progressEvent{Event: "walk_started", Input: input})
+}
+
+func (p *progressReporter) fileSkipped(relPath, reason string) {
+	p.emit(progressEvent{Event: "file_skipped", Path: relPath, Reason: reason})
+}
+
+func (p *progressReporter) budgetExceeded(usage *budgetUsage) {
+	p.emit(progressEvent{Event: "budget_exceeded", Budget: usage})
+}
+
+func (p *progressReporter) finished(result *runResult) {
+	p.emit(progressEvent{Event: "done", Stats: result})
+}
+
+func (p *progressReporter) emit(event progressEvent) {
+	if p == nil || p.events == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.events.Encode(event)
+}
+
+// writer wraps w so that written bytes are counted.
+func (p *progressReporter) writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &countingWriter{w: w, n: &p.bytes}
+}
+
+func (p *progressReporter) finish() {
+	if p == nil || p.events != nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+}
+
+func (p *progressReporter) render(final bool) {
+	scanned, total, done := p.scanned.Load(), p.total.Load(), p.done.Load()
+	status := fmt.Sprintf("%d scanned, %d included, %s written", scanned, p.included.Load(), formatBytes(p.bytes.Load()))
+
+	if p.mode == "plain" {
+		fmt.Fprintf(p.out, "progress: %s\n", status)
+		return
+	}
+
+	bar := strings.Repeat(" ", 30)
+	if total > 0 {
+		filled := int(30 * done / total)
+		bar = strings.Repeat("#", filled) + strings.Repeat(".", 30-filled)
+	}
+	fmt.Fprintf(p.out, "\r[%s] %d/%d files, %s\033[K", bar, done, total, status)
+	if final {
+		fmt.Fprintln(p.out)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
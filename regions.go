@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// lineRange is an inclusive range of 1-based line numbers.
+type lineRange struct {
+	from, to int
+}
+
+// keepLines keeps the given line ranges of data, each widened by context
+// lines on both sides, and replaces every run of lines between them with a
+// marker naming the lines left out.
+func keepLines(data []byte, ranges []lineRange, context int) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	widened := make([]lineRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.from > len(lines) {
+			// Past the end of the file, as a listed range may be
+			continue
+		}
+		widened = append(widened, lineRange{max(r.from-context, 1), min(r.to+context, len(lines))})
+	}
+	sort.Slice(widened, func(i, j int) bool { return widened[i].from < widened[j].from })
+
+	var out bytes.Buffer
+	next := 1 // first line not yet written or omitted
+	for _, r := range widened {
+		if r.to < next {
+			continue
+		}
+		if r.from > next {
+			out.WriteString(omittedLines(next, r.from-1))
+		}
+		for i := max(r.from, next); i <= r.to; i++ {
+			out.Write(lines[i-1])
+		}
+		if r.to >= 1 && !bytes.HasSuffix(lines[r.to-1], []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		next = r.to + 1
+	}
+	if next <= len(lines) {
+		out.WriteString(omittedLines(next, len(lines)))
+	}
+	return out.Bytes()
+}
+
+func omittedLines(from, to int) string {
+	if from == to {
+		return fmt.Sprintf("... [line %d omitted] ...\n", from)
+	}
+	return fmt.Sprintf("... [lines %d-%d omitted] ...\n", from, to)
+}
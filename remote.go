@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// remoteFetch describes how to stream a remote input: cmd writes it as a tar
+// stream to stdout, prefix is the directory inside the stream to pack and
+// cleanup, if set, releases what was created to produce the stream.
+type remoteFetch struct {
+	cmd     *exec.Cmd
+	prefix  string
+	cleanup func()
+}
+
+var remoteFetchers = map[string]func(ctx context.Context, u *url.URL, config *Config) (*remoteFetch, error){
+	"sftp":   sftpFetch,
+	"docker": dockerFetch,
+}
+
+// isRemoteInput reports whether an input path is a URL of a supported
+// remote source.
+func isRemoteInput(input string) bool {
+	scheme, _, ok := strings.Cut(input, "://")
+	return ok && remoteFetchers[scheme] != nil || isGitInput(input)
+}
+
+// inputLabel names the input in the output header: the URL for remote
+// inputs, without any password, and absPath otherwise.
+func inputLabel(input, absPath string) string {
+	if !isRemoteInput(input) {
+		return absPath
+	}
+	if src, ok := parseGitInput(input); ok {
+		return gitInputLabel(src)
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return input
+	}
+	return u.Redacted()
+}
+
+// fetchRemoteInput unpacks a remote input into a temporary directory, which
+// the returned function removes. Nothing is installed on the remote side;
+// the tar stream is produced by tools already there.
+func fetchRemoteInput(ctx context.Context, input string, config *Config) (string, func(), error) {
+	var fetch *remoteFetch
+	var err error
+	if src, ok := parseGitInput(input); ok {
+		if fetch, err = gitFetch(ctx, src, config); err != nil {
+			return "", nil, err
+		}
+	} else {
+		u, err := url.Parse(input)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid input URL: %w", err)
+		}
+		if fetch, err = remoteFetchers[u.Scheme](ctx, u, config); err != nil {
+			return "", nil, err
+		}
+	}
+	if fetch.cleanup != nil {
+		defer fetch.cleanup()
+	}
+
+	dir, err := os.MkdirTemp("", "contextify-input-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			config.logger.Warn("Failed to remove temporary input", "dir", dir, "error", err)
+		}
+	}
+
+	config.logger.Info("Fetching remote input", "input", inputLabel(input, ""), "command", fetch.cmd.Args[0])
+	if err := runTarCommand(ctx, fetch.cmd, dir, fetch.prefix); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// runTarCommand runs cmd and extracts the files below prefix from its
+// output into dir.
+func runTarCommand(ctx context.Context, cmd *exec.Cmd, dir, prefix string) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", cmd.Args[0], err)
+	}
+
+	extractErr := extractTar(ctx, stdout, dir, prefix)
+	if extractErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	if extractErr != nil {
+		return extractErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("%s failed: %w: %s", cmd.Args[0], waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// extractTar writes the regular files of a tar stream below prefix to dir.
+// Links, devices and entries that would escape dir are skipped.
+func extractTar(ctx context.Context, r io.Reader, dir, prefix string) error {
+	prefix = strings.Trim(path.Clean("/"+prefix), "/")
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar stream: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if prefix != "" {
+			rest, ok := strings.CutPrefix(name, prefix+"/")
+			if !ok {
+				continue
+			}
+			name = rest
+		}
+		rel := filepath.FromSlash(name)
+		if !filepath.IsLocal(rel) {
+			continue
+		}
+
+		target := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+	}
+}
+
+// sftpFetch packs a directory on an SSH host with the remote tar, leaving
+// excluded directories out of the transfer.
+func sftpFetch(ctx context.Context, u *url.URL, config *Config) (*remoteFetch, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("sftp input needs a host: sftp://[user@]host[:port]/path")
+	}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return nil, fmt.Errorf("sftp input requires ssh: %w", err)
+	}
+
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	// ssh would take a host or user starting with "-" for an option
+	if strings.HasPrefix(target, "-") {
+		return nil, fmt.Errorf("sftp host %q starts with \"-\"", target)
+	}
+	args := []string{"-o", "BatchMode=yes"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+
+	// sftp://host/~/src is relative to the remote home directory
+	remoteDir := shellQuote(u.Path)
+	if rest, ok := strings.CutPrefix(u.Path, "/~"); ok {
+		remoteDir = "~" + shellQuote(rest)
+		if rest == "" {
+			remoteDir = "~"
+		}
+	} else if u.Path == "" {
+		remoteDir = "."
+	}
+
+	remote := "tar -C " + remoteDir + " -cf -"
+	for _, exclude := range config.excludeDirs {
+		remote += " --exclude=" + shellQuote(exclude)
+	}
+	remote += " ."
+	return &remoteFetch{cmd: exec.CommandContext(ctx, "ssh", append(args, "--", target, remote)...)}, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
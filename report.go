@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// reportEntry is a file or directory with what it contributes to the output.
+type reportEntry struct {
+	Path   string  `json:"path"`
+	Files  int     `json:"files"`
+	Tokens int     `json:"tokens"`
+	Bytes  int64   `json:"bytes"`
+	Share  float64 `json:"share"` // percent of all file tokens
+}
+
+// sizeReport is the output of the report command.
+type sizeReport struct {
+	Files       int           `json:"files"`
+	Tokens      int           `json:"tokens"`
+	Bytes       int64         `json:"bytes"`
+	Largest     []reportEntry `json:"largestFiles"`
+	Directories []reportEntry `json:"largestDirectories"`
+	Suggestions []string      `json:"suggestions"`
+}
+
+// Entries above this share of the tokens are worth a suggestion.
+const reportSuggestShare = 10.0
+
+func setupReport(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+	top := fs.Int("top", 20, "Number of files and directories to list")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	return func(args []string) int {
+		if !noArgs("report", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		config, err := pf.config(logger)
+		if err != nil {
+			logger.Error("Invalid flags", "error", err)
+			return exitFailure
+		}
+
+		// The manifest holds the tokens each file contributes
+		config.outputWriter = io.Discard
+		config.outputPath = ""
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		code, err := pack(ctx, config, *pf.progress, *pf.resultJSON)
+		if code == exitFailure || code == exitCancelled {
+			logOutcome(logger, config, code, err)
+			return code
+		}
+
+		report := buildSizeReport(config.manifest.Files, *top)
+		if *asJSON {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				logger.Error("Failed to encode report", "error", err)
+				return exitFailure
+			}
+			fmt.Println(string(data))
+		} else {
+			writeSizeReport(os.Stdout, report)
+		}
+		return code
+	}
+}
+
+// buildSizeReport ranks the files and every directory containing them by
+// tokens, keeping the top n of each.
+func buildSizeReport(files []manifestEntry, n int) sizeReport {
+	report := sizeReport{Files: len(files), Largest: []reportEntry{}, Directories: []reportEntry{}, Suggestions: []string{}}
+	dirs := make(map[string]*reportEntry)
+	var fileEntries []reportEntry
+	for _, file := range files {
+		report.Tokens += file.Tokens
+		report.Bytes += file.Size
+		filePath := filepath.ToSlash(file.Path)
+		fileEntries = append(fileEntries, reportEntry{Path: filePath, Files: 1, Tokens: file.Tokens, Bytes: file.Size})
+
+		for dir := path.Dir(filePath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			entry := dirs[dir]
+			if entry == nil {
+				entry = &reportEntry{Path: dir}
+				dirs[dir] = entry
+			}
+			entry.Files++
+			entry.Tokens += file.Tokens
+			entry.Bytes += file.Size
+		}
+	}
+	var dirEntries []reportEntry
+	for _, entry := range dirs {
+		dirEntries = append(dirEntries, *entry)
+	}
+
+	rank := func(entries []reportEntry) []reportEntry {
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Tokens != entries[j].Tokens {
+				return entries[i].Tokens > entries[j].Tokens
+			}
+			return entries[i].Path < entries[j].Path
+		})
+		for i := range entries {
+			if report.Tokens > 0 {
+				entries[i].Share = 100 * float64(entries[i].Tokens) / float64(report.Tokens)
+			}
+		}
+		if n >= 0 && len(entries) > n {
+			entries = entries[:n]
+		}
+		return entries
+	}
+	report.Largest = append(report.Largest, rank(fileEntries)...)
+	report.Directories = append(report.Directories, rank(dirEntries)...)
+	report.Suggestions = suggestExcludes(report)
+	return report
+}
+
+// suggestExcludes proposes flags for the directories and files that take a
+// large share of the output. A directory is only suggested when none of
+// its parents is, so the suggestions do not overlap.
+func suggestExcludes(report sizeReport) []string {
+	suggestions := []string{}
+	var excluded []string
+	for _, dir := range report.Directories {
+		if dir.Share < reportSuggestShare || withinDirs(dir.Path, excluded, false) {
+			continue
+		}
+		excluded = append(excluded, dir.Path)
+		suggestions = append(suggestions, fmt.Sprintf("-exclude %s (%d files, ~%d tokens, %.0f%%)", dir.Path, dir.Files, dir.Tokens, dir.Share))
+	}
+	for _, file := range report.Largest {
+		if file.Share >= reportSuggestShare && !withinDirs(file.Path, excluded, false) {
+			suggestions = append(suggestions, fmt.Sprintf("-max-file-size with -truncate smart to shorten %s (~%d tokens, %.0f%%)", file.Path, file.Tokens, file.Share))
+		}
+	}
+	return suggestions
+}
+
+func writeSizeReport(w io.Writer, report sizeReport) {
+	fmt.Fprintf(w, "%d files, ~%d tokens, %s\n", report.Files, report.Tokens, formatBytes(report.Bytes))
+
+	writeEntries := func(title, suffix string, entries []reportEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "TOKENS\tSHARE\tSIZE\tFILES\t  PATH")
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "%d\t%.1f%%\t%s\t%d\t  %s\n", entry.Tokens, entry.Share, formatBytes(entry.Bytes), entry.Files, entry.Path+suffix)
+		}
+		tw.Flush()
+	}
+	writeEntries("Largest files", "", report.Largest)
+	writeEntries("Largest directories", "/", report.Directories)
+
+	if len(report.Suggestions) > 0 {
+		fmt.Fprintln(w, "\nSuggestions:")
+		for _, suggestion := range report.Suggestions {
+			fmt.Fprintf(w, "  %s\n", suggestion)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// reproducibleLabel names a local path in the header or the settings of a
+// -reproducible output. An absolute path is cut to its base name, so that
+// where the input is checked out does not change the output.
+func reproducibleLabel(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Base(path)
+	}
+	return path
+}
+
+// reproducibleTime is the timestamp -reproducible gives files and archive
+// entries: SOURCE_DATE_EPOCH when set, as reproducible-builds.org has it,
+// and otherwise 1980-01-01, the earliest time a zip entry can hold.
+func reproducibleTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// fixedModTime reports a file with the modification time of -reproducible.
+type fixedModTime struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (f fixedModTime) ModTime() time.Time { return f.modTime }
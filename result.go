@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Exit codes returned by a pack run.
+const (
+	exitSuccess        = 0
+	exitFailure        = 1
+	exitPartial        = 2 // output written, but some files could not be read
+	exitNothingMatched = 3
+	exitBudgetExceeded = 4 // output written, but files were left out to stay within a budget
+	exitCancelled      = 130
+)
+
+// runResult summarises a run for wrapping scripts.
+type runResult struct {
+	Status         string                    `json:"status"`
+	ExitCode       int                       `json:"exitCode"`
+	Input          string                    `json:"input"`
+	Output         string                    `json:"output"`
+	FormatVersion  int                       `json:"formatVersion"`
+	FilesScanned   int                       `json:"filesScanned"`
+	FilesMatched   int                       `json:"filesMatched"`
+	FilesIncluded  int                       `json:"filesIncluded"`
+	FilesSkipped   []skippedFile             `json:"filesSkipped"`
+	BytesWritten   int64                     `json:"bytesWritten"`
+	Tokens         int                       `json:"estimatedTokens"`
+	Characters     int                       `json:"characters"`
+	Lines          int                       `json:"lines"`
+	Budget         *budgetUsage              `json:"budget,omitempty"`
+	Windows        *windowFit                `json:"windows,omitempty"`
+	Parts          []string                  `json:"parts,omitempty"`
+	OversizedParts []oversizedPart           `json:"oversizedParts,omitempty"`
+	StrictIssues   []strictIssue             `json:"strictIssues,omitempty"`
+	Duplicates     []duplicateFile           `json:"duplicates,omitempty"`
+	Submodules     []submoduleRef            `json:"submodules,omitempty"`
+	Timing         *runTimings               `json:"timing,omitempty"`
+	Redactions     int                       `json:"redactions,omitempty"`
+	RedactedFiles  map[string]map[string]int `json:"redactedFiles,omitempty"`
+	Error          string                    `json:"error,omitempty"`
+	StartedAt      time.Time                 `json:"startedAt"`
+	DurationMs     int64                     `json:"durationMs"`
+
+	budgetExceeded bool
+	bytes          atomic.Int64
+	tokens         tokenCounter
+}
+
+type skippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// skipError marks a per-file failure that leaves the file out of the output
+// without failing the run.
+type skipError struct {
+	err error
+}
+
+func (e *skipError) Error() string { return e.err.Error() }
+func (e *skipError) Unwrap() error { return e.err }
+
+func newRunResult(config *Config) *runResult {
+	return &runResult{
+		Input:         config.inputPath,
+		Output:        config.outputPath,
+		FormatVersion: formatVersion,
+		FilesSkipped:  []skippedFile{},
+		StartedAt:     time.Now(),
+		tokens:        tokenCounter{bpe: config.tokenizer},
+	}
+}
+
+func (r *runResult) skip(path string, err error) {
+	r.FilesSkipped = append(r.FilesSkipped, skippedFile{Path: path, Reason: err.Error()})
+}
+
+// finish derives the status and exit code from the run error and counters.
+func (r *runResult) finish(err error) int {
+	r.DurationMs = time.Since(r.StartedAt).Milliseconds()
+	r.BytesWritten = r.bytes.Load()
+	r.Tokens = r.tokens.tokens()
+	r.Characters = r.tokens.runes
+	r.Lines = r.tokens.lines()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.Status, r.ExitCode = "cancelled", exitCancelled
+	case err != nil:
+		r.Status, r.ExitCode = "failed", exitFailure
+	case len(r.FilesSkipped) > 0:
+		r.Status, r.ExitCode = "partial", exitPartial
+	case r.budgetExceeded:
+		r.Status, r.ExitCode = "budget_exceeded", exitBudgetExceeded
+	case r.FilesIncluded == 0:
+		r.Status, r.ExitCode = "nothing_matched", exitNothingMatched
+	default:
+		r.Status, r.ExitCode = "success", exitSuccess
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r.ExitCode
+}
+
+func (r *runResult) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write result file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// checkpoint records progress of a -resume run, one JSON line per step.
+// The first line covers the header and carries the settings digest; each
+// further line covers one source file. End is the output offset after the
+// step and SHA256 the hash of the output bytes the step wrote, so a resumed
+// run can verify the partial output before trusting it.
+type checkpoint struct {
+	Settings string `json:"settings,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	ModTime  int64  `json:"mtime,omitempty"` // Unix nanoseconds
+	Included bool   `json:"included,omitempty"`
+	End      int64  `json:"end"`
+	SHA256   string `json:"sha256"`
+}
+
+// resumer keeps the checkpoint file of a run written with -resume. It is
+// also an io.Writer that hashes the output as it is written.
+type resumer struct {
+	path     string
+	file     *os.File
+	settings string
+	hash     hash.Hash
+	offset   int64 // output offset of the last checkpoint
+	written  int64 // output bytes since then
+
+	// Steps of an earlier run found intact in the output
+	header   bool
+	skip     int // files
+	included int // of those, files in the output
+}
+
+func resumePath(outputPath string) string {
+	return outputPath + ".resume"
+}
+
+// openResume prepares a -resume run. When the checkpoint of an earlier run
+// matches the current settings, it verifies the output it describes and
+// keeps the longest prefix whose bytes are intact and whose source files
+// have not changed since; the run then continues after that prefix.
+func openResume(config *Config, files []sourceFile) (*resumer, error) {
+	r := &resumer{
+		path:     resumePath(config.outputPath),
+		settings: newManifest(config).SettingsDigest,
+		hash:     sha256.New(),
+	}
+
+	valid, err := r.verify(config, files)
+	if err != nil {
+		return nil, err
+	}
+	if len(valid) > 0 {
+		r.header = true
+		r.skip = len(valid) - 1
+		r.offset = valid[len(valid)-1].End
+		for _, step := range valid {
+			if step.Included {
+				r.included++
+			}
+		}
+	}
+
+	// Start the checkpoint file over with what is still valid
+	r.file, err = os.Create(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resume checkpoint: %w", err)
+	}
+	for _, step := range valid {
+		if err := r.writeStep(step); err != nil {
+			r.file.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// verify returns the checkpoint steps of an earlier run that still hold.
+func (r *resumer) verify(config *Config, files []sourceFile) ([]checkpoint, error) {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume checkpoint: %w", err)
+	}
+	output, err := os.Open(config.outputPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		config.logger.Info("Output of the interrupted run is gone, starting over")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer output.Close()
+	reader := bufio.NewReader(output)
+
+	var valid []checkpoint
+	offset := int64(0)
+	for i, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var step checkpoint
+		if err := json.Unmarshal(line, &step); err != nil {
+			break
+		}
+		if i == 0 && step.Settings != r.settings {
+			config.logger.Info("Settings changed since the interrupted run, starting over")
+			return nil, nil
+		}
+		if i > 0 {
+			if i > len(files) || files[i-1].relPath != step.Path || !unchanged(files[i-1].path, step) {
+				config.logger.Info("Input changed since the interrupted run, resuming before it", "path", step.Path)
+				break
+			}
+		}
+
+		h := sha256.New()
+		if n, err := io.CopyN(h, reader, step.End-offset); err != nil || n != step.End-offset {
+			break
+		}
+		if hex.EncodeToString(h.Sum(nil)) != step.SHA256 {
+			config.logger.Warn("Output does not match the resume checkpoint, resuming before the mismatch", "offset", offset)
+			break
+		}
+		valid = append(valid, step)
+		offset = step.End
+	}
+	return valid, nil
+}
+
+func unchanged(path string, step checkpoint) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Size() == step.Size && info.ModTime().UnixNano() == step.ModTime
+}
+
+// openOutput opens the output for writing after the resumed prefix.
+func (r *resumer) openOutput(outputPath string) (*outputFile, error) {
+	if r.offset == 0 {
+		return createOutput(outputPath, false)
+	}
+	f, err := os.OpenFile(outputPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(r.offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &outputFile{File: f, path: outputPath}, nil
+}
+
+func (r *resumer) Write(p []byte) (int, error) {
+	r.written += int64(len(p))
+	return r.hash.Write(p)
+}
+
+// record checkpoints the output written since the last step. The caller
+// flushes first so that every byte of the step has reached the output.
+func (r *resumer) record(src *sourceFile, included bool) error {
+	step := checkpoint{End: r.offset + r.written, SHA256: hex.EncodeToString(r.hash.Sum(nil))}
+	if src == nil {
+		step.Settings = r.settings
+	} else {
+		step.Path, step.Included = src.relPath, included
+		if info, err := os.Stat(src.path); err == nil {
+			step.Size, step.ModTime = info.Size(), info.ModTime().UnixNano()
+		}
+	}
+	r.offset, r.written = step.End, 0
+	r.hash.Reset()
+	return r.writeStep(step)
+}
+
+func (r *resumer) writeStep(step checkpoint) error {
+	data, err := json.Marshal(step)
+	if err != nil {
+		return err
+	}
+	if _, err := r.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write resume checkpoint: %w", err)
+	}
+	return nil
+}
+
+// finish closes the checkpoint file, removing it once the run completed.
+func (r *resumer) finish(completed bool) error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if completed {
+		return os.Remove(r.path)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const apiSurfaceMarker = "## API Surface"
+
+// route is an HTTP route registration found in a file.
+type route struct {
+	method  string
+	path    string
+	handler string
+	file    string
+	line    int
+}
+
+var (
+	// net/http: mux.HandleFunc("GET /items/{id}", getItem)
+	netHTTPRoute = regexp.MustCompile(`\b(?:HandleFunc|Handle)\(\s*"([^"]*)"\s*,\s*(.*)$`)
+	// gin and echo: r.GET("/items", list), e.POST("/items", create, auth)
+	ginRoute = regexp.MustCompile(`\b(\w+)\.(GET|POST|PUT|DELETE|PATCH|HEAD|OPTIONS|Any|Match)\(\s*"([^"]*)"\s*,\s*(.*)$`)
+	// gin and echo groups: v1 := r.Group("/v1")
+	goGroup = regexp.MustCompile(`\b(\w+)\s*:?=\s*(\w+)\.Group\(\s*"([^"]*)"`)
+	// Express: app.get('/items', list), router.post("/items", auth, create)
+	expressRoute = regexp.MustCompile("\\b(\\w+)\\.(get|post|put|delete|patch|head|options|all)\\(\\s*['\"`]([^'\"`]*)['\"`]\\s*,\\s*(.*)$")
+	// FastAPI and Flask: @app.get("/items"), @router.post("/items"),
+	// @app.route("/items", methods=["POST"])
+	pythonRoute   = regexp.MustCompile(`^\s*@(\w+)\.(get|post|put|delete|patch|head|options|api_route|route)\(\s*['"]([^'"]*)['"](.*)$`)
+	pythonMethods = regexp.MustCompile(`methods\s*=\s*\[([^\]]*)\]`)
+	pythonDefName = regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)
+	// FastAPI routers with a prefix: router = APIRouter(prefix="/items")
+	pythonPrefix = regexp.MustCompile(`^\s*(\w+)\s*=\s*(?:APIRouter|Blueprint)\(.*\b(?:prefix|url_prefix)\s*=\s*['"]([^'"]*)['"]`)
+)
+
+// routeScanner finds the route registrations of one file as it streams
+// through, for net/http, gin and echo in Go, Express in JavaScript and
+// TypeScript, and FastAPI and Flask in Python. Go group and Python router
+// prefixes declared in the same file are applied; routers mounted from
+// another file keep their own paths.
+type routeScanner struct {
+	lineFeed
+	path     string
+	lang     string
+	line     int
+	prefixes map[string]string // by router variable
+	pending  []route           // Python decorators waiting for their function
+	routes   []route
+}
+
+func newRouteScanner(relPath string) *routeScanner {
+	s := &routeScanner{path: relPath, prefixes: make(map[string]string)}
+	switch strings.ToLower(filepath.Ext(relPath)) {
+	case ".go":
+		s.lang = "go"
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts":
+		s.lang = "js"
+	case ".py":
+		s.lang = "python"
+	}
+	s.onLine = s.scanLine
+	return s
+}
+
+func (s *routeScanner) scanLine(line []byte) {
+	s.line++
+	if s.lang == "" {
+		return
+	}
+	text := string(line)
+	add := func(method, path, handler string) {
+		s.routes = append(s.routes, route{method: method, path: path, handler: handler, file: s.path, line: s.line})
+	}
+
+	switch s.lang {
+	case "go":
+		if m := goGroup.FindStringSubmatch(text); m != nil {
+			s.prefixes[m[1]] = s.prefixes[m[2]] + m[3]
+			return
+		}
+		if m := ginRoute.FindStringSubmatch(text); m != nil {
+			method := strings.ToUpper(m[2])
+			if method == "MATCH" {
+				method = "ANY"
+			}
+			add(method, s.prefixes[m[1]]+m[3], lastArgument(m[4]))
+			return
+		}
+		if m := netHTTPRoute.FindStringSubmatch(text); m != nil {
+			method, path := "ANY", m[1]
+			// Go 1.22 patterns carry the method: "GET /items/{id}"
+			if verb, rest, ok := strings.Cut(path, " "); ok {
+				method, path = verb, strings.TrimSpace(rest)
+			}
+			add(method, path, lastArgument(m[2]))
+		}
+	case "js":
+		if m := expressRoute.FindStringSubmatch(text); m != nil && strings.HasPrefix(m[3], "/") {
+			add(strings.ToUpper(m[2]), m[3], lastArgument(m[4]))
+		}
+	case "python":
+		if m := pythonPrefix.FindStringSubmatch(text); m != nil {
+			s.prefixes[m[1]] = m[2]
+			return
+		}
+		if m := pythonRoute.FindStringSubmatch(text); m != nil {
+			methods := []string{strings.ToUpper(m[2])}
+			if m[2] == "route" || m[2] == "api_route" {
+				methods = []string{"GET"}
+				if mm := pythonMethods.FindStringSubmatch(m[4]); mm != nil {
+					methods = nil
+					for _, method := range strings.Split(mm[1], ",") {
+						if method = strings.Trim(strings.TrimSpace(method), `'"`); method != "" {
+							methods = append(methods, strings.ToUpper(method))
+						}
+					}
+				}
+			}
+			for _, method := range methods {
+				s.pending = append(s.pending, route{method: method, path: s.prefixes[m[1]] + m[3], file: s.path, line: s.line})
+			}
+			return
+		}
+		if m := pythonDefName.FindStringSubmatch(text); m != nil && len(s.pending) > 0 {
+			for _, r := range s.pending {
+				r.handler = m[1]
+				s.routes = append(s.routes, r)
+			}
+			s.pending = nil
+		}
+	}
+}
+
+// lastArgument returns the handler of a registration: its last argument,
+// after any middleware, or "inline" for a function written in place.
+func lastArgument(args string) string {
+	args = strings.TrimSpace(args)
+	if strings.Contains(args, "=>") || strings.Contains(args, "func(") || strings.Contains(args, "function") {
+		return "inline"
+	}
+	args = strings.TrimRight(args, ");{ \t")
+	if i := strings.LastIndex(args, ","); i >= 0 {
+		args = args[i+1:]
+	}
+	return strings.TrimSpace(args)
+}
+
+// routeCollector gathers the routes of the included files for
+// -api-surface.
+type routeCollector struct {
+	routes []route
+}
+
+// commit records the routes of a finished file if it made it into the
+// output.
+func (c *routeCollector) commit(s *routeScanner, keep bool) {
+	s.flush()
+	if keep {
+		c.routes = append(c.routes, s.routes...)
+	}
+}
+
+// writeAPISurfaceSection lists the routes by path and method, with where
+// each is handled.
+func writeAPISurfaceSection(writer *bufio.Writer, routes []route, config *Config) error {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].path != routes[j].path {
+			return routes[i].path < routes[j].path
+		}
+		return routes[i].method < routes[j].method
+	})
+	if _, err := fmt.Fprintf(writer, "%s (%d routes)\n```\n", apiSurfaceMarker, len(routes)); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	for _, r := range routes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s:%d\n", r.method, r.path, r.handler, config.displayPath(r.file), r.line)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
+
+// lineFeed is an io.Writer that hands a scanner the written bytes line by
+// line, holding at most maxTodoLine bytes of a line.
+type lineFeed struct {
+	partial []byte
+	onLine  func(line []byte)
+}
+
+func (f *lineFeed) Write(p []byte) (int, error) {
+	data := p
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			f.keep(data)
+			return len(p), nil
+		}
+		f.keep(data[:idx])
+		f.onLine(f.partial)
+		f.partial = f.partial[:0]
+		data = data[idx+1:]
+	}
+}
+
+func (f *lineFeed) keep(data []byte) {
+	if room := maxTodoLine - len(f.partial); room > 0 {
+		f.partial = append(f.partial, data[:min(room, len(data))]...)
+	}
+}
+
+// flush scans a last line without a line break.
+func (f *lineFeed) flush() {
+	if len(f.partial) > 0 {
+		f.onLine(f.partial)
+		f.partial = f.partial[:0]
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sampleData keeps the header row plus the first and last n rows of a
+// line-oriented data file. Only n rows at each end are held in memory, so
+// arbitrarily large files stream through.
+func sampleData(r io.Reader, n int, hasHeader bool) ([]byte, error) {
+	reader := bufio.NewReader(r)
+	var header []byte
+	var head [][]byte
+	tail := make([][]byte, 0, n)
+	tailStart := 0
+	rows := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+			switch {
+			case hasHeader && header == nil:
+				header = line
+			case len(head) < n:
+				head = append(head, line)
+				rows++
+			case n > 0:
+				// Ring buffer of the last n rows
+				if len(tail) < n {
+					tail = append(tail, line)
+				} else {
+					tail[tailStart] = line
+					tailStart = (tailStart + 1) % n
+				}
+				rows++
+			default:
+				rows++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data file: %w", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if header != nil {
+		out.Write(header)
+		out.WriteByte('\n')
+	}
+	for _, line := range head {
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if omitted := rows - len(head) - len(tail); omitted > 0 {
+		fmt.Fprintf(&out, "... %s rows omitted ...\n", humanCount(omitted))
+	}
+	for i := range tail {
+		out.Write(tail[(tailStart+i)%len(tail)])
+		out.WriteByte('\n')
+	}
+	return bytes.TrimRight(out.Bytes(), "\n"), nil
+}
+
+// humanCount formats large counts compactly, e.g. 1234567 as "1.2M".
+func humanCount(n int) string {
+	switch {
+	case n >= 1_000_000_000:
+		return trimZeroDecimal(fmt.Sprintf("%.1f", float64(n)/1e9)) + "B"
+	case n >= 1_000_000:
+		return trimZeroDecimal(fmt.Sprintf("%.1f", float64(n)/1e6)) + "M"
+	case n >= 10_000:
+		return trimZeroDecimal(fmt.Sprintf("%.1f", float64(n)/1e3)) + "K"
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+func trimZeroDecimal(s string) string {
+	return strings.TrimSuffix(s, ".0")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// version is the contextify release, set at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// formatVersion is the version of the context file layout: the header, the
+// file blocks and the sections after them. It goes up whenever an older
+// contextify would misread a newer context. Readers refuse versions newer
+// than their own and read contexts without one as version 0, the layout
+// from before versioning.
+const formatVersion = 1
+
+const (
+	// formatLinePrefix starts the header line naming the format version,
+	// e.g. "# Format: contextify/1 (contextify v1.4.0)".
+	formatLinePrefix = "# Format: contextify/"
+	metadataMarker   = "## Metadata"
+)
+
+// contextMetadata is the closing section of a context: what produced it
+// and from what. inputDigest is the manifest digest over the settings and
+// every included file; a resumed run leaves it out, as it did not read
+// the files of the interrupted one. Outputs other than packs, such as pull
+// request contexts, have no settings.
+type contextMetadata struct {
+	FormatVersion  int               `json:"formatVersion"`
+	Tool           string            `json:"tool"`
+	ToolVersion    string            `json:"toolVersion"`
+	Format         string            `json:"format"`
+	Settings       *manifestSettings `json:"settings,omitempty"`
+	SettingsDigest string            `json:"settingsDigest,omitempty"`
+	InputDigest    string            `json:"inputDigest,omitempty"`
+	Files          int               `json:"files"`
+}
+
+func newContextMetadata(config *Config, complete bool) *contextMetadata {
+	m := config.manifest
+	metadata := &contextMetadata{
+		FormatVersion:  formatVersion,
+		Tool:           "contextify",
+		ToolVersion:    version,
+		Format:         config.format,
+		Settings:       &m.settings,
+		SettingsDigest: m.SettingsDigest,
+		Files:          len(m.Files),
+	}
+	if complete {
+		metadata.InputDigest = m.Digest
+	}
+	return metadata
+}
+
+func formatLine() string {
+	return fmt.Sprintf("%s%d (contextify %s)\n", formatLinePrefix, formatVersion, version)
+}
+
+func writeMetadataSection(writer *bufio.Writer, metadata *contextMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "%s\n```json\n%s\n```\n", metadataMarker, data)
+	return err
+}
+
+// contextFormatVersion reads the format version from the header of a
+// context, the part before the first file block.
+func contextFormatVersion(data []byte) (int, error) {
+	header := data
+	if idx := bytes.Index(data, []byte("\n"+fileMarker)); idx >= 0 {
+		header = data[:idx]
+	}
+	for _, line := range bytes.Split(header, []byte("\n")) {
+		rest, ok := bytes.CutPrefix(line, []byte(formatLinePrefix))
+		if !ok {
+			continue
+		}
+		if sp := bytes.IndexByte(rest, ' '); sp >= 0 {
+			rest = rest[:sp]
+		}
+		v, err := strconv.Atoi(string(rest))
+		if err != nil || v < 1 {
+			return 0, fmt.Errorf("invalid format line %q", line)
+		}
+		if v > formatVersion {
+			return 0, fmt.Errorf("context uses format version %d, but this contextify (%s) reads up to version %d; upgrade contextify", v, version, formatVersion)
+		}
+		return v, nil
+	}
+	return 0, nil
+}
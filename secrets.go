@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var redactKinds = []string{"secrets", "pii"}
+
+// secretRule detects one kind of secret. Rules follow the gitleaks model:
+// the secret is capture group secretGroup of the match, or the first
+// non-empty group, or the whole match; keywords pre-filter content cheaply
+// and allowlisted secrets are left alone. valid, if set, rejects matches
+// that only look like a secret.
+type secretRule struct {
+	id       string
+	regex    *regexp.Regexp
+	group    int
+	keywords []string
+	allow    []*regexp.Regexp
+	valid    func(secret []byte) bool
+}
+
+// builtinSecretRules cover widely used credential formats.
+var builtinSecretRules = []secretRule{
+	{id: "private-key", regex: regexp.MustCompile(`(?s)-----BEGIN[ A-Z0-9_-]{0,100}PRIVATE KEY( BLOCK)?-----.*?-----END[ A-Z0-9_-]{0,100}PRIVATE KEY( BLOCK)?-----`), keywords: []string{"private key"}},
+	{id: "aws-access-key-id", regex: regexp.MustCompile(`\b((?:A3T[A-Z0-9]|AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16})\b`), keywords: []string{"akia", "asia", "abia", "acca", "a3t"}},
+	{id: "aws-secret-access-key", regex: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), keywords: []string{"secret"}},
+	{id: "github-token", regex: regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`), keywords: []string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_"}},
+	{id: "gitlab-token", regex: regexp.MustCompile(`\b(glpat-[A-Za-z0-9_-]{20})\b`), keywords: []string{"glpat-"}},
+	{id: "slack-token", regex: regexp.MustCompile(`\b(xox[baprs]-[A-Za-z0-9-]{10,})`), keywords: []string{"xox"}},
+	{id: "slack-webhook", regex: regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9+/]{40,}`), keywords: []string{"hooks.slack.com"}},
+	{id: "google-api-key", regex: regexp.MustCompile(`\b(AIza[0-9A-Za-z_-]{35})\b`), keywords: []string{"aiza"}},
+	{id: "stripe-key", regex: regexp.MustCompile(`\b((?:sk|rk)_(?:live|test)_[0-9A-Za-z]{16,})\b`), keywords: []string{"sk_live", "sk_test", "rk_live", "rk_test"}},
+	{id: "openai-api-key", regex: regexp.MustCompile(`\b(sk-(?:proj-)?[A-Za-z0-9_-]{20,}T3BlbkFJ[A-Za-z0-9_-]{20,})\b`), keywords: []string{"t3blbkfj"}},
+	{id: "anthropic-api-key", regex: regexp.MustCompile(`\b(sk-ant-[A-Za-z0-9_-]{20,})`), keywords: []string{"sk-ant-"}},
+	{id: "jwt", regex: regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`), keywords: []string{"eyj"}},
+	{id: "url-credentials", regex: regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@"']+:([^/\s@"']+)@`), keywords: []string{"://"}},
+	{id: "generic-secret", regex: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api_?key|access_?token|auth_?token|client_?secret)\b["']?\s*[:=]\s*["']([^"'\s]{8,})["']`), keywords: []string{"pass", "pwd", "secret", "key", "token"}},
+}
+
+// redaction records one redacted match.
+type redaction struct {
+	Rule string `json:"rule"`
+	Line int    `json:"line"`
+}
+
+// redactor replaces detected secrets and personal data with
+// "<redacted:rule-id>". Findings
+// are kept per file, so measuring and writing a file records it once.
+type redactor struct {
+	rules    []secretRule
+	allow    []*regexp.Regexp
+	findings map[string][]redaction
+}
+
+func newRedactor(kinds []string, rulesFile string) (*redactor, error) {
+	for _, kind := range kinds {
+		if !slices.Contains(redactKinds, kind) {
+			return nil, fmt.Errorf("unknown redact kind %q (valid: %s)", kind, strings.Join(redactKinds, ", "))
+		}
+	}
+
+	r := &redactor{findings: make(map[string][]redaction)}
+	if slices.Contains(kinds, "secrets") || rulesFile != "" {
+		r.rules = append(r.rules, builtinSecretRules...)
+	}
+	if slices.Contains(kinds, "pii") {
+		r.rules = append(r.rules, piiRules...)
+	}
+	if rulesFile != "" {
+		rules, allow, err := loadSecretRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rules...)
+		r.allow = allow
+	}
+	return r, nil
+}
+
+// redact returns data with every detected secret replaced.
+func (r *redactor) redact(relPath string, data []byte) []byte {
+	type span struct {
+		start, end int
+		rule       string
+	}
+	var spans []span
+	lower := bytes.ToLower(data)
+	for _, rule := range r.rules {
+		if len(rule.keywords) > 0 && !containsAny(lower, rule.keywords) {
+			continue
+		}
+		for _, m := range rule.regex.FindAllSubmatchIndex(data, -1) {
+			start, end := secretSpan(m, rule.group)
+			if start < 0 || r.allowed(rule, data[start:end]) || (rule.valid != nil && !rule.valid(data[start:end])) {
+				continue
+			}
+			spans = append(spans, span{start, end, rule.id})
+		}
+	}
+	if len(spans) == 0 {
+		delete(r.findings, relPath)
+		return data
+	}
+
+	// Stable, so that of two matches at the same offset the earlier rule wins
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var out bytes.Buffer
+	var findings []redaction
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			// Overlaps a secret already redacted
+			continue
+		}
+		out.Write(data[last:s.start])
+		out.WriteString("<redacted:" + s.rule + ">")
+		findings = append(findings, redaction{Rule: s.rule, Line: bytes.Count(data[:s.start], []byte("\n")) + 1})
+		last = s.end
+	}
+	out.Write(data[last:])
+	r.findings[relPath] = findings
+	return out.Bytes()
+}
+
+// count returns the number of matches redacted across all files.
+func (r *redactor) count() int {
+	n := 0
+	for _, findings := range r.findings {
+		n += len(findings)
+	}
+	return n
+}
+
+// summary returns the redaction counts per file and rule.
+func (r *redactor) summary() map[string]map[string]int {
+	summary := make(map[string]map[string]int, len(r.findings))
+	for path, findings := range r.findings {
+		counts := make(map[string]int)
+		for _, finding := range findings {
+			counts[finding.Rule]++
+		}
+		summary[path] = counts
+	}
+	return summary
+}
+
+// ruleIDs lists the active rules, for the manifest settings digest.
+func (r *redactor) ruleIDs() []string {
+	if r == nil {
+		return nil
+	}
+	ids := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		ids[i] = rule.id
+	}
+	return ids
+}
+
+func (r *redactor) allowed(rule secretRule, secret []byte) bool {
+	for _, allow := range rule.allow {
+		if allow.Match(secret) {
+			return true
+		}
+	}
+	for _, allow := range r.allow {
+		if allow.Match(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretSpan picks the secret out of a submatch index slice.
+func secretSpan(m []int, group int) (int, int) {
+	if group > 0 {
+		if 2*group+1 < len(m) {
+			return m[2*group], m[2*group+1]
+		}
+		return -1, -1
+	}
+	for g := 1; 2*g+1 < len(m); g++ {
+		if m[2*g] >= 0 && m[2*g+1] > m[2*g] {
+			return m[2*g], m[2*g+1]
+		}
+	}
+	return m[0], m[1]
+}
+
+func containsAny(data []byte, keywords []string) bool {
+	for _, keyword := range keywords {
+		if bytes.Contains(data, []byte(strings.ToLower(keyword))) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretRulesFile is a gitleaks configuration, or the same rules in YAML.
+type secretRulesFile struct {
+	Rules []struct {
+		ID          string            `toml:"id" yaml:"id"`
+		Regex       string            `toml:"regex" yaml:"regex"`
+		SecretGroup int               `toml:"secretGroup" yaml:"secretGroup"`
+		Keywords    []string          `toml:"keywords" yaml:"keywords"`
+		Allowlist   secretAllowlist   `toml:"allowlist" yaml:"allowlist"`
+		Allowlists  []secretAllowlist `toml:"allowlists" yaml:"allowlists"`
+	} `toml:"rules" yaml:"rules"`
+	Allowlist  secretAllowlist   `toml:"allowlist" yaml:"allowlist"`
+	Allowlists []secretAllowlist `toml:"allowlists" yaml:"allowlists"`
+}
+
+type secretAllowlist struct {
+	Regexes []string `toml:"regexes" yaml:"regexes"`
+}
+
+// loadSecretRules reads rules from a gitleaks-compatible TOML file or a
+// YAML file of the same shape. Rules whose regex Go cannot compile, such as
+// those using lookaround, are reported as errors.
+func loadSecretRules(path string) ([]secretRule, []*regexp.Regexp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read secret rules: %w", err)
+	}
+
+	var file secretRulesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = toml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse secret rules: %w", err)
+	}
+
+	compileAll := func(lists ...secretAllowlist) ([]*regexp.Regexp, error) {
+		var compiled []*regexp.Regexp
+		for _, list := range lists {
+			for _, expr := range list.Regexes {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid allowlist regex %q: %w", expr, err)
+				}
+				compiled = append(compiled, re)
+			}
+		}
+		return compiled, nil
+	}
+
+	var rules []secretRule
+	for i, rule := range file.Rules {
+		if rule.Regex == "" {
+			// Path-only gitleaks rules do not apply to content
+			continue
+		}
+		id := rule.ID
+		if id == "" {
+			id = fmt.Sprintf("rule-%d", i+1)
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %s: invalid regex: %w", id, err)
+		}
+		allow, err := compileAll(append(rule.Allowlists, rule.Allowlist)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %s: %w", id, err)
+		}
+		rules = append(rules, secretRule{id: id, regex: re, group: rule.SecretGroup, keywords: rule.Keywords, allow: allow})
+	}
+
+	allow, err := compileAll(append(file.Allowlists, file.Allowlist)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rules, allow, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// seedFile is a collected Go file as -seed expansion sees it.
+type seedFile struct {
+	index   int // position in the collected files
+	dir     string
+	test    bool
+	parsed  *ast.File
+	imports map[string]string // local name to import path
+	dotted  []string          // import paths of dot and blank imports
+}
+
+// seedGraph indexes the top-level declarations and methods of the
+// collected Go files by package directory.
+type seedGraph struct {
+	files   map[string]*seedFile // by relPath
+	dirs    map[string]string    // import path to package directory
+	decls   map[string]map[string][]*seedFile
+	methods map[string]map[string][]*seedFile
+	pkgs    map[string][]*seedFile
+}
+
+// expandSeeds keeps the -seed files and the files they reach within
+// -expand-depth steps. For Go files a step follows references through the
+// AST: a name of another file in the same package, or pkg.Name of an
+// imported package in the input, leads to the files declaring it, and a
+// method call x.Name() leads to the files declaring methods of that name in
+// the same or an imported package, since the type of x is not resolved.
+// Dot and blank imports lead to the whole package. This is a heuristic
+// over names rather than a call graph: it may reach more files than are
+// called, and misses calls through interfaces and function values. Files
+// keep their walk order.
+func expandSeeds(absPath string, files []sourceFile, config *Config) ([]sourceFile, error) {
+	byRelPath := make(map[string]int, len(files))
+	for i, file := range files {
+		byRelPath[file.relPath] = i
+	}
+	var frontier []int
+	depth := make(map[int]int)
+	for _, seed := range config.seeds {
+		relPath := nfc(path.Clean(filepath.ToSlash(seed)))
+		i, ok := byRelPath[relPath]
+		if !ok {
+			return nil, fmt.Errorf("seed %s is not among the files to pack", seed)
+		}
+		if _, seen := depth[i]; !seen {
+			depth[i] = 0
+			frontier = append(frontier, i)
+		}
+	}
+
+	graph := newSeedGraph(absPath, files, config)
+	for level := 1; level <= config.expandDepth && len(frontier) > 0; level++ {
+		var next []int
+		for _, i := range frontier {
+			f := graph.files[files[i].relPath]
+			if f == nil {
+				continue
+			}
+			for _, dep := range graph.references(f) {
+				if _, seen := depth[dep.index]; !seen {
+					depth[dep.index] = level
+					next = append(next, dep.index)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	kept := make([]sourceFile, 0, len(depth))
+	for i, file := range files {
+		if _, ok := depth[i]; ok {
+			kept = append(kept, file)
+		}
+	}
+	config.logger.Debug("Expanded seed files", "seeds", len(config.seeds), "depth", config.expandDepth, "files", len(kept))
+	return kept, nil
+}
+
+func newSeedGraph(absPath string, files []sourceFile, config *Config) *seedGraph {
+	g := &seedGraph{
+		files:   make(map[string]*seedFile),
+		dirs:    make(map[string]string),
+		decls:   make(map[string]map[string][]*seedFile),
+		methods: make(map[string]map[string][]*seedFile),
+		pkgs:    make(map[string][]*seedFile),
+	}
+	modules := newModuleResolver(absPath)
+	fset := token.NewFileSet()
+	for i, file := range files {
+		if filepath.Ext(file.path) != ".go" {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, file.path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			config.logger.Warn("Could not parse Go file", "path", file.relPath, "error", err)
+			continue
+		}
+		dir := filepath.Dir(file.path)
+		f := &seedFile{
+			index:   i,
+			dir:     dir,
+			test:    strings.HasSuffix(file.path, "_test.go"),
+			parsed:  parsed,
+			imports: make(map[string]string),
+		}
+		g.files[file.relPath] = f
+		if importPath, ok := modules.importPath(dir); ok {
+			g.dirs[importPath] = dir
+		}
+		if !f.test {
+			g.pkgs[dir] = append(g.pkgs[dir], f)
+		}
+
+		for _, imp := range parsed.Imports {
+			importPath, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			switch {
+			case imp.Name == nil:
+				f.imports[path.Base(importPath)] = importPath
+			case imp.Name.Name == "." || imp.Name.Name == "_":
+				f.dotted = append(f.dotted, importPath)
+			default:
+				f.imports[imp.Name.Name] = importPath
+			}
+		}
+		for _, decl := range parsed.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv != nil {
+					g.add(g.methods, dir, decl.Name.Name, f)
+				} else {
+					g.add(g.decls, dir, decl.Name.Name, f)
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						g.add(g.decls, dir, spec.Name.Name, f)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							g.add(g.decls, dir, name.Name, f)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Packages whose name is not the last element of their import path
+	for _, f := range g.files {
+		for name, importPath := range f.imports {
+			if dir, ok := g.dirs[importPath]; ok && len(g.pkgs[dir]) > 0 {
+				if pkgName := g.pkgs[dir][0].parsed.Name.Name; pkgName != name && name == path.Base(importPath) {
+					delete(f.imports, name)
+					f.imports[pkgName] = importPath
+				}
+			}
+		}
+	}
+	return g
+}
+
+func (g *seedGraph) add(index map[string]map[string][]*seedFile, dir, name string, f *seedFile) {
+	if index[dir] == nil {
+		index[dir] = make(map[string][]*seedFile)
+	}
+	index[dir][name] = append(index[dir][name], f)
+}
+
+// references returns the files f refers to, in the order it does. Test
+// files are only reached from test files.
+func (g *seedGraph) references(f *seedFile) []*seedFile {
+	var refs []*seedFile
+	seen := map[*seedFile]bool{f: true}
+	add := func(candidates []*seedFile) {
+		for _, c := range candidates {
+			if !seen[c] && (!c.test || f.test) {
+				seen[c] = true
+				refs = append(refs, c)
+			}
+		}
+	}
+
+	for _, importPath := range f.dotted {
+		if dir, ok := g.dirs[importPath]; ok {
+			add(g.pkgs[dir])
+		}
+	}
+	importedDirs := []string{f.dir}
+	for _, importPath := range f.imports {
+		if dir, ok := g.dirs[importPath]; ok {
+			importedDirs = append(importedDirs, dir)
+		}
+	}
+
+	called := make(map[*ast.SelectorExpr]bool)
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok {
+				called[sel] = true
+			}
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok {
+				if importPath, ok := f.imports[x.Name]; ok {
+					if dir, ok := g.dirs[importPath]; ok {
+						add(g.decls[dir][n.Sel.Name])
+					}
+					return false
+				}
+			}
+			if called[n] {
+				for _, dir := range importedDirs {
+					add(g.methods[dir][n.Sel.Name])
+				}
+			}
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.Ident:
+			add(g.decls[f.dir][n.Name])
+		}
+		return true
+	}
+	for _, decl := range f.parsed.Decls {
+		ast.Inspect(decl, visit)
+	}
+	return refs
+}
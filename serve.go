@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// requestFlags are the pack flags requests may set. The others read or
+// write files on the server, run commands, reach other hosts, spend the
+// server's credentials or control the run itself, and are left to the
+// server. Flags are refused until they are added here.
+var requestFlags = map[string]bool{
+	"input":                 true,
+	"exclude":               true,
+	"extensions":            true,
+	"exclude-extensions":    true,
+	"include-mime":          true,
+	"exclude-mime":          true,
+	"include-names":         true,
+	"workspace":             true,
+	"order":                 true,
+	"symbols":               true,
+	"todos":                 true,
+	"notebook-outputs":      true,
+	"extract-docs":          true,
+	"sample-data":           true,
+	"max-file-size":         true,
+	"truncate":              true,
+	"anonymize":             true,
+	"anonymize-domains":     true,
+	"undecodable":           true,
+	"normalize":             true,
+	"hidden":                true,
+	"max-depth":             true,
+	"max-tokens":            true,
+	"budget":                true,
+	"format":                true,
+	"model":                 true,
+	"max-response-tokens":   true,
+	"manifest":              true,
+	"redact":                true,
+	"always-include":        true,
+	"mode":                  true,
+	"include-generated":     true,
+	"metadata":              true,
+	"max-memory":            true,
+	"over-memory":           true,
+	"error-context":         true,
+	"seed":                  true,
+	"expand-depth":          true,
+	"condense-schemas":      true,
+	"sql-schema":            true,
+	"strip-config-values":   true,
+	"images":                true,
+	"max-chars":             true,
+	"max-lines":             true,
+	"tokenizer":             true,
+	"map":                   true,
+	"file-header-format":    true,
+	"file-separator":        true,
+	"strict":                true,
+	"strict-file-size":      true,
+	"strict-tokens":         true,
+	"regions-only":          true,
+	"reproducible":          true,
+	"max-output-size":       true,
+	"submodules":            true,
+	"symbol-index":          true,
+	"api-surface":           true,
+	"detect-dupes":          true,
+	"collapse-dupes":        true,
+	"pair-tests":            true,
+	"codeowners":            true,
+	"owner":                 true,
+	"condense-locales":      true,
+	"locales":               true,
+	"trim-fixtures":         true,
+	"strip-license-headers": true,
+}
+
+// packServer answers pack and stats requests. Query parameters are pack
+// flags, e.g. /pack?input=src&extensions=.go,.mod&max-tokens=50000, and
+// inputs are resolved against root.
+type packServer struct {
+	root    string
+	limits  serveLimits
+	tenants []*tenant // nil when requests need no token
+	logger  *slog.Logger
+}
+
+func setupServe(fs *flag.FlagSet) func(args []string) int {
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	root := fs.String("root", ".", "Directory that requested inputs are resolved against; requests cannot leave it")
+	grpcAddr := fs.String("grpc-addr", "", "Also serve the gRPC API of proto/contextify.proto on this address")
+	allow := fs.String("allow", "", "Comma-separated directories, relative to -root, that requests may pack (default: all of -root)")
+	maxFiles := fs.Int("max-files", 10000, "Most files a request may match; 0 for no limit")
+	maxBytes := fs.String("max-bytes", "50MB", "Largest output a request may produce; empty for no limit")
+	maxTime := fs.Duration("max-time", 2*time.Minute, "Longest a request may run; 0 for no limit")
+	maxConcurrent := fs.Int("max-concurrent", 4, "Most requests packed at once; further requests are turned away; 0 for no limit")
+	tenantsPath := fs.String("tenants", "", "YAML or TOML file of bearer tokens and their allowed roots, defaults and budget caps; requests then need a token")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		if !noArgs("serve", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		absRoot, err := filepath.Abs(*root)
+		if err == nil {
+			// Inputs are checked with symlinks resolved, so the root is too
+			absRoot, err = filepath.EvalSymlinks(absRoot)
+		}
+		if err != nil {
+			logger.Error("Failed to resolve root", "error", err)
+			return exitFailure
+		}
+		limits := serveLimits{maxFiles: *maxFiles, maxTime: *maxTime}
+		if limits.maxBytes, err = parseSize(*maxBytes); err != nil {
+			logger.Error("Invalid -max-bytes", "error", err)
+			return exitFailure
+		}
+		if *maxConcurrent > 0 {
+			limits.slots = make(chan struct{}, *maxConcurrent)
+		}
+		for _, dir := range parseCommaSeparated(*allow) {
+			limits.allowed = append(limits.allowed, filepath.Join(absRoot, filepath.FromSlash(dir)))
+		}
+		s := &packServer{root: absRoot, limits: limits, logger: logger}
+		if *tenantsPath != "" {
+			if s.tenants, err = loadTenants(*tenantsPath, absRoot); err != nil {
+				logger.Error("Invalid tenants", "error", err)
+				return exitFailure
+			}
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "ok")
+		})
+		mux.HandleFunc("GET /pack", s.handlePack)
+		mux.HandleFunc("GET /stats", s.handleStats)
+		server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		ctx, stop := signalContext()
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+
+		if *grpcAddr != "" {
+			listener, err := net.Listen("tcp", *grpcAddr)
+			if err != nil {
+				logger.Error("Failed to listen for gRPC", "error", err)
+				return exitFailure
+			}
+			grpcServer := newGRPCServer(s)
+			go func() {
+				<-ctx.Done()
+				grpcServer.GracefulStop()
+			}()
+			go func() {
+				if err := grpcServer.Serve(listener); err != nil {
+					logger.Error("Failed to serve gRPC", "error", err)
+					stop()
+				}
+			}()
+			logger.Info("Serving contextify over gRPC", "addr", *grpcAddr)
+		}
+
+		logger.Info("Serving contextify", "addr", *addr, "root", absRoot, "tenants", len(s.tenants))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Failed to serve", "error", err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+}
+
+// paramsConfig builds the run configuration from request parameters: the
+// query of an HTTP request or the flags of a gRPC one. A tenant's defaults
+// and caps apply on top.
+func (s *packServer) paramsConfig(params url.Values, t *tenant) (*Config, error) {
+	// The last value of a flag wins, so a repeated parameter could slip
+	// past the checks of the first
+	for name, values := range params {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("parameter %q is given more than once", name)
+		}
+	}
+	if err := t.apply(params); err != nil {
+		return nil, err
+	}
+	fs := flag.NewFlagSet("request", flag.ContinueOnError)
+	pf := registerPackFlags(fs)
+	for name, values := range params {
+		f := fs.Lookup(name)
+		if f == nil || !requestFlags[name] {
+			return nil, fmt.Errorf("unsupported parameter %q", name)
+		}
+		for _, value := range values {
+			// A bare boolean parameter such as ?todos switches it on
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && value == "" {
+				value = "true"
+			}
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("invalid parameter %q: %w", name, err)
+			}
+		}
+	}
+
+	input := filepath.FromSlash(*pf.inputPath)
+	if !filepath.IsLocal(input) && input != "." {
+		return nil, fmt.Errorf("input must be a relative path inside the served root")
+	}
+	*pf.inputPath = filepath.Join(s.root, input)
+	// A symlink along the way may lead elsewhere; its target is checked too
+	real, err := filepath.EvalSymlinks(*pf.inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("input %q not found", filepath.ToSlash(input))
+	}
+	for _, path := range []string{*pf.inputPath, real} {
+		if !(&serveLimits{allowed: []string{s.root}}).allowedInput(path) || !s.limits.allowedInput(path) || !t.allowedInput(path) {
+			return nil, fmt.Errorf("input %q is not in a directory this server allows", filepath.ToSlash(input))
+		}
+	}
+	*pf.progress = "none"
+
+	config, err := pf.config(s.logger)
+	if err != nil {
+		return nil, err
+	}
+	config.confineTo = real
+	return config, nil
+}
+
+func (s *packServer) handlePack(w http.ResponseWriter, r *http.Request) {
+	t, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	config, err := s.paramsConfig(r.URL.Query(), t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Buffer the output so that failures can still be reported as errors
+	var buf bytes.Buffer
+	config.outputWriter = &buf
+	code, err := s.run(r.Context(), config, true)
+	if code == exitFailure || code == exitCancelled {
+		s.httpError(w, "pack", config, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Contextify-Status", config.result.Status)
+	w.Header().Set("X-Contextify-Files", strconv.Itoa(config.result.FilesIncluded))
+	if _, err := buf.WriteTo(w); err != nil {
+		s.logger.Debug("Failed to write response", "error", err)
+	}
+}
+
+func (s *packServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	t, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	config, err := s.paramsConfig(r.URL.Query(), t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counter := &tokenCounter{bpe: config.tokenizer}
+	config.outputWriter = counter
+	config.outputPath = ""
+	code, err := s.run(r.Context(), config, false)
+	if code == exitFailure || code == exitCancelled {
+		s.httpError(w, "collect stats", config, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statsReport{runResult: config.result, EstimatedTokens: counter.tokens()}); err != nil {
+		s.logger.Debug("Failed to write response", "error", err)
+	}
+}
+
+// httpError reports a failed request, with a status that tells a client
+// hitting a limit apart from a server failure.
+func (s *packServer) httpError(w http.ResponseWriter, action string, config *Config, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBusy):
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", "1")
+	case errors.Is(err, errLimitExceeded):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	if status == http.StatusInternalServerError {
+		s.logger.Error("Failed to "+action, "input", config.inputPath, "error", err)
+	} else {
+		s.logger.Warn("Request over limits", "input", config.inputPath, "error", err)
+	}
+	http.Error(w, "failed to "+action+": "+err.Error(), status)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Groups of -order smart, in output order.
+const (
+	smartReadme = iota
+	smartConfig
+	smartEntry
+	smartCode
+	smartTest
+	smartFixture
+)
+
+// projectManifests are the top-level files that say what a project is and
+// how it builds.
+var projectManifests = map[string]bool{
+	"go.mod": true, "go.work": true, "package.json": true, "tsconfig.json": true, "deno.json": true,
+	"cargo.toml": true, "pyproject.toml": true, "setup.py": true, "setup.cfg": true, "requirements.txt": true,
+	"pom.xml": true, "build.gradle": true, "build.gradle.kts": true, "settings.gradle": true, "settings.gradle.kts": true,
+	"gemfile": true, "composer.json": true, "mix.exs": true, "cmakelists.txt": true, "makefile": true,
+	"dockerfile": true, "docker-compose.yml": true, "docker-compose.yaml": true, "compose.yml": true, "compose.yaml": true,
+}
+
+// entryPoints are the names programs conventionally start in.
+var entryPoints = map[string]bool{
+	"main.go": true, "main.py": true, "__main__.py": true, "app.py": true, "manage.py": true, "wsgi.py": true,
+	"main.rs": true, "lib.rs": true, "index.js": true, "index.ts": true, "main.js": true, "main.ts": true,
+	"server.js": true, "server.ts": true, "app.js": true, "app.ts": true, "program.cs": true, "main.c": true,
+	"main.cpp": true, "main.java": true, "application.java": true, "main.kt": true, "main.swift": true,
+}
+
+var fixtureDirs = map[string]bool{"testdata": true, "fixtures": true, "fixture": true, "__fixtures__": true, "__snapshots__": true, "golden": true}
+
+var testDirs = map[string]bool{"test": true, "tests": true, "__tests__": true, "spec": true, "specs": true, "e2e": true}
+
+// orderSmart puts READMEs first, then the top-level project manifests and
+// the entry points, then the code by directory, tests and last fixtures.
+// Files of a group keep their walk order; READMEs go outermost first.
+func orderSmart(files []sourceFile) []sourceFile {
+	ordered := append([]sourceFile(nil), files...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		gi, gj := smartGroup(ordered[i].relPath), smartGroup(ordered[j].relPath)
+		if gi != gj {
+			return gi < gj
+		}
+		if gi == smartReadme {
+			return strings.Count(filepath.ToSlash(ordered[i].relPath), "/") < strings.Count(filepath.ToSlash(ordered[j].relPath), "/")
+		}
+		return false
+	})
+	return ordered
+}
+
+func smartGroup(relPath string) int {
+	p := filepath.ToSlash(relPath)
+	base := strings.ToLower(path.Base(p))
+	dirs := strings.Split(strings.ToLower(path.Dir(p)), "/")
+	for _, dir := range dirs {
+		if fixtureDirs[dir] {
+			return smartFixture
+		}
+	}
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	name := strings.TrimSuffix(path.Base(p), path.Ext(p)) // JUnit and xUnit names are CamelCase
+	switch {
+	case ext == ".snap" || ext == ".golden":
+		return smartFixture
+	case strings.HasPrefix(base, "readme"):
+		return smartReadme
+	case !strings.Contains(p, "/") && projectManifests[base]:
+		return smartConfig
+	case strings.HasSuffix(stem, "_test") || strings.HasPrefix(stem, "test_") || strings.HasSuffix(stem, ".test") ||
+		strings.HasSuffix(stem, ".spec") || strings.HasSuffix(name, "Test") && ext == ".java" || strings.HasSuffix(name, "Tests") && ext == ".cs":
+		return smartTest
+	}
+	for _, dir := range dirs {
+		if testDirs[dir] {
+			return smartTest
+		}
+	}
+	if entryPoints[base] {
+		return smartEntry
+	}
+	return smartCode
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var oversizePolicies = []string{"fail", "split"}
+
+// splitPeek is how far the scan of an output looks ahead, past a closing
+// fence, to tell the end of a file block from a fence in its content.
+const splitPeek = 64 << 10
+
+// outputUnit is a byte range of an output that goes into one part whole: a
+// file block, or the sections after the files.
+type outputUnit struct {
+	from, to int64
+	path     string // empty for the trailing sections
+}
+
+// oversizedPart is a part over the limit because what it holds does not
+// fit a part of its own.
+type oversizedPart struct {
+	Part  string `json:"part"`
+	Holds string `json:"holds"`
+	Size  int64  `json:"size"`
+}
+
+// splitOutput replaces an output larger than limit with parts of at most
+// limit bytes, cut between file blocks: context.txt becomes
+// context.part1.txt, context.part2.txt and so on. Each part repeats the
+// header with a line saying which part it is; the sections after the
+// files, metadata included, go into the last part. Both count against the
+// limit. The output is streamed from disk, never held whole. A file block,
+// or trailing sections, too large for any part still get a part of their
+// own, which is returned in oversized. It returns the part names, or nil
+// when the output is within the limit.
+func splitOutput(path string, limit int64) (names []string, oversized []oversizedPart, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() <= limit {
+		return nil, nil, nil
+	}
+	headerEnd, units, err := scanOutputUnits(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read output to split: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	// The header is repeated without the blank line that ends it, which
+	// follows the part line instead
+	headerLen := headerEnd
+	if last := make([]byte, 1); headerLen > 0 {
+		if _, err := f.ReadAt(last, headerLen-1); err == nil && last[0] == '\n' {
+			headerLen--
+		}
+	}
+	digits := strings.Repeat("9", len(strconv.Itoa(max(len(units), 1))))
+	overhead := headerLen + int64(len(partLine(digits, digits)))
+	if overhead >= limit {
+		return nil, nil, fmt.Errorf("the header alone (%s) leaves no room for files under -max-output-size %s", formatBytes(overhead), formatBytes(limit))
+	}
+
+	// Units go into a part while it stays within the limit
+	type part struct {
+		from, to int64
+		holds    string
+	}
+	var parts []part
+	for _, u := range units {
+		if n := len(parts); n > 0 && overhead+u.to-parts[n-1].from <= limit {
+			parts[n-1].to = u.to
+			continue
+		}
+		holds := u.path
+		if holds == "" {
+			holds = "the sections after the files"
+		}
+		parts = append(parts, part{from: u.from, to: u.to, holds: holds})
+	}
+	if len(parts) == 0 {
+		parts = append(parts, part{from: headerEnd, to: headerEnd})
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	names = make([]string, len(parts))
+	for i, p := range parts {
+		names[i] = fmt.Sprintf("%s.part%d%s", base, i+1, ext)
+		size, err := writePart(names[i], f, headerLen, partLine(strconv.Itoa(i+1), strconv.Itoa(len(parts))), p.from, p.to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to write output part: %w", err)
+		}
+		if size > limit {
+			oversized = append(oversized, oversizedPart{Part: names[i], Holds: p.holds, Size: size})
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, nil, fmt.Errorf("failed to remove split output: %w", err)
+	}
+	return names, oversized, nil
+}
+
+func partLine(n, of string) string {
+	return "# Part " + n + " of " + of + "\n\n"
+}
+
+// writePart writes the header, the part line and the bytes from to to of
+// the output to name, returning the size written.
+func writePart(name string, f *os.File, headerLen int64, line string, from, to int64) (int64, error) {
+	out, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(out)
+	var size int64
+	n, err := io.Copy(w, io.NewSectionReader(f, 0, headerLen))
+	size += n
+	if err == nil {
+		var m int
+		m, err = w.WriteString(line)
+		size += int64(m)
+	}
+	if err == nil {
+		n, err = io.Copy(w, io.NewSectionReader(f, from, to-from))
+		size += n
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return size, err
+}
+
+// scanOutputUnits finds the file blocks of an output and the sections
+// after them, the way parseContextBlocks does, but reading the output as a
+// stream. headerEnd is where the first block starts.
+func scanOutputUnits(r io.Reader) (headerEnd int64, units []outputUnit, err error) {
+	br := bufio.NewReaderSize(r, splitPeek)
+	var pos int64
+	version := 0
+
+	// The header runs to the first line starting a file block
+	for lineStart := true; ; {
+		if lineStart {
+			if next, _ := br.Peek(len(fileMarker)); string(next) == fileMarker {
+				break
+			}
+		}
+		line, err := br.ReadSlice('\n')
+		if lineStart && bytes.HasPrefix(line, []byte(formatLinePrefix)) {
+			v, versionErr := contextFormatVersion(line)
+			if versionErr != nil {
+				return 0, nil, versionErr
+			}
+			version = v
+		}
+		pos += int64(len(line))
+		lineStart = err == nil
+		if errors.Is(err, io.EOF) {
+			return pos, nil, nil
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return 0, nil, err
+		}
+	}
+	headerEnd = pos
+
+	for {
+		peek, err := br.Peek(splitPeek)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, nil, err
+		}
+		path, contentStart, ok := blockStart(peek)
+		if !ok {
+			return 0, nil, fmt.Errorf("malformed file block at byte %d", pos)
+		}
+		from := pos
+		if _, err := br.Discard(contentStart); err != nil {
+			return 0, nil, err
+		}
+		pos += int64(contentStart)
+
+		// Find the closing fence followed by what may follow a block
+		for {
+			peek, err := br.Peek(splitPeek)
+			eof := errors.Is(err, io.EOF)
+			if err != nil && !eof {
+				return 0, nil, err
+			}
+			i := bytes.Index(peek, []byte(blockEnd))
+			if i < 0 {
+				if eof {
+					return 0, nil, fmt.Errorf("unterminated block for %s", path)
+				}
+				skip := len(peek) - len(blockEnd) + 1
+				br.Discard(skip)
+				pos += int64(skip)
+				continue
+			}
+			if i > 0 && !eof {
+				// Look from the fence, so the whole window is past it
+				br.Discard(i)
+				pos += int64(i)
+				continue
+			}
+			if !isBlockBoundary(peek[i+len(blockEnd):], version) {
+				br.Discard(i + 1)
+				pos += int64(i + 1)
+				continue
+			}
+			br.Discard(i + len(blockEnd))
+			pos += int64(i + len(blockEnd))
+			break
+		}
+		units = append(units, outputUnit{from: from, to: pos, path: path})
+
+		if next, _ := br.Peek(len(fileMarker)); string(next) != fileMarker {
+			break
+		}
+	}
+
+	// What follows the blocks stays together
+	rest, err := io.Copy(io.Discard, br)
+	if err != nil {
+		return 0, nil, err
+	}
+	if rest > 0 {
+		units = append(units, outputUnit{from: pos, to: pos + rest})
+	}
+	return headerEnd, units, nil
+}
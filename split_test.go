@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScanOutputUnits(t *testing.T) {
+	header := "# Contextify Output\n" + formatLine() + "# Generated from: x\n\n"
+	fence := "```"
+	tests := []struct {
+		name      string
+		output    string
+		wantPaths []string // "" for the trailing sections
+		wantErr   bool
+	}{
+		{"header only", header, nil, false},
+		{"files", header + fileMarker + "a.go\n" + blockFence + "a\n" + blockEnd + fileMarker + "b.go\n" + blockFence + "b\n" + blockEnd, []string{"a.go", "b.go"}, false},
+		{"trailing sections", header + fileMarker + "a.go\n" + blockFence + "a\n" + blockEnd + testMetadata, []string{"a.go", ""}, false},
+		{"fence inside content", header + fileMarker + "README.md\n" + blockFence + fence + "\ncode\n" + fence + "\n\ntext\n" + blockEnd, []string{"README.md"}, false},
+		{"metadata line", header + fileMarker + "a.go\nMetadata: lines=1-2\n" + blockFence + "a\n" + blockEnd, []string{"a.go"}, false},
+		{"content past the read-ahead", header + fileMarker + "big.txt\n" + blockFence + strings.Repeat("x\n", splitPeek) + blockEnd + testMetadata, []string{"big.txt", ""}, false},
+		{"unterminated", header + fileMarker + "a.go\n" + blockFence + "a\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headerEnd, units, err := scanOutputUnits(strings.NewReader(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scanOutputUnits error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if headerEnd != int64(len(header)) {
+				t.Errorf("header ends at %d, want %d", headerEnd, len(header))
+			}
+			var paths []string
+			next := headerEnd
+			for _, u := range units {
+				paths = append(paths, u.path)
+				if u.from != next {
+					t.Errorf("unit %q starts at %d, want %d", u.path, u.from, next)
+				}
+				next = u.to
+			}
+			if !slices.Equal(paths, tt.wantPaths) {
+				t.Errorf("units %q, want %q", paths, tt.wantPaths)
+			}
+			if len(units) > 0 && next != int64(len(tt.output)) {
+				t.Errorf("units end at %d, want %d", next, len(tt.output))
+			}
+		})
+	}
+}
+
+func TestSplitOutput(t *testing.T) {
+	header := "# Contextify Output\n" + formatLine() + "# Generated from: x\n\n"
+	block := func(path string, size int) string {
+		return fileMarker + path + "\n" + blockFence + strings.Repeat("x", size-1) + "\n" + blockEnd
+	}
+	tests := []struct {
+		name          string
+		output        string
+		limit         int64
+		wantParts     int
+		wantOversized []string // what the oversized parts hold
+		wantErr       bool
+	}{
+		{"within the limit", header + block("a", 10), 1 << 20, 0, nil, false},
+		{"two parts", header + block("a", 100) + block("b", 100) + testMetadata, 300, 2, nil, false},
+		{"one block a part", header + block("a", 100) + block("b", 100) + block("c", 100), 250, 3, nil, false},
+		{"oversized block", header + block("a", 100) + block("big", 1000) + block("c", 100), 300, 3, []string{"big"}, false},
+		{"header over the limit", header + block("a", 100), int64(len(header)), 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "context.txt")
+			if err := os.WriteFile(path, []byte(tt.output), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			names, oversized, err := splitOutput(path, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitOutput error = %v, want error %t", err, tt.wantErr)
+			}
+			if len(names) != tt.wantParts {
+				t.Fatalf("%d parts, want %d", len(names), tt.wantParts)
+			}
+			var holds []string
+			for _, o := range oversized {
+				holds = append(holds, o.Holds)
+			}
+			if !slices.Equal(holds, tt.wantOversized) {
+				t.Errorf("oversized parts hold %q, want %q", holds, tt.wantOversized)
+			}
+			if len(names) == 0 {
+				return
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("split output still there: %v", err)
+			}
+
+			// Parts rejoined without their headers give back the files and
+			// trailing sections
+			var rejoined bytes.Buffer
+			rejoined.WriteString(header)
+			for i, name := range names {
+				if want := filepath.Join(filepath.Dir(path), "context.part"+strconv.Itoa(i+1)+".txt"); name != want {
+					t.Errorf("part %d is %s, want %s", i+1, name, want)
+				}
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(data)) > tt.limit && !slices.ContainsFunc(oversized, func(o oversizedPart) bool { return o.Part == name }) {
+					t.Errorf("part %s is %d bytes, over the limit of %d", name, len(data), tt.limit)
+				}
+				_, body, ok := strings.Cut(string(data), "# Part ")
+				if !ok {
+					t.Fatalf("part %s has no part line", name)
+				}
+				_, body, _ = strings.Cut(body, "\n\n")
+				rejoined.WriteString(body)
+			}
+			if rejoined.String() != tt.output {
+				t.Errorf("parts rejoined =\n%s\nwant\n%s", rejoined.String(), tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sqlSchemaMarker = "## SQL Schema"
+
+// migrationDirNames name the directories whose .sql files -sql-schema
+// replaces with the schema they build up.
+var migrationDirNames = map[string]bool{"migrations": true, "migration": true, "migrate": true}
+
+// migrationSet is the .sql files of one migrations directory.
+type migrationSet struct {
+	dir   string
+	files []sourceFile
+}
+
+// splitMigrations takes the .sql files below migrations directories out
+// of files, grouped by the nearest such directory and in version order.
+func splitMigrations(files []sourceFile) ([]sourceFile, []migrationSet) {
+	var kept []sourceFile
+	byDir := make(map[string]*migrationSet)
+	var dirs []string
+	for _, file := range files {
+		dir := migrationDir(file.relPath)
+		if dir == "" || strings.ToLower(path.Ext(file.relPath)) != ".sql" {
+			kept = append(kept, file)
+			continue
+		}
+		set := byDir[dir]
+		if set == nil {
+			set = &migrationSet{dir: dir}
+			byDir[dir] = set
+			dirs = append(dirs, dir)
+		}
+		set.files = append(set.files, file)
+	}
+	sets := make([]migrationSet, 0, len(dirs))
+	for _, dir := range dirs {
+		set := byDir[dir]
+		sort.SliceStable(set.files, func(i, j int) bool {
+			return naturalLess(set.files[i].relPath, set.files[j].relPath)
+		})
+		sets = append(sets, *set)
+	}
+	return kept, sets
+}
+
+func migrationDir(relPath string) string {
+	dir := path.Dir(relPath)
+	for d := dir; d != "." && d != "/"; d = path.Dir(d) {
+		if migrationDirNames[strings.ToLower(path.Base(d))] {
+			return d
+		}
+	}
+	return ""
+}
+
+// naturalLess orders strings with their digit runs compared as numbers, so
+// V2__x.sql comes before V10__x.sql.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.ParseUint(strings.TrimLeft(da, "0")+"0", 10, 64)
+			nb, _ := strconv.ParseUint(strings.TrimLeft(db, "0")+"0", 10, 64)
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// writeSQLSchemas writes the schema each migrations directory builds up.
+func writeSQLSchemas(writer *bufio.Writer, sets []migrationSet, config *Config) error {
+	for _, set := range sets {
+		schema := newSQLSchema()
+		applied := 0
+		for _, file := range set.files {
+			if isDownMigration(file.relPath) {
+				continue
+			}
+			data, err := os.ReadFile(file.path)
+			if err != nil {
+				config.logger.Warn("Skipping unreadable migration", "path", file.relPath, "error", err)
+				config.skipFile(file.relPath, err)
+				continue
+			}
+			schema.apply(string(data))
+			applied++
+		}
+		if _, err := fmt.Fprintf(writer, "%s: %s (%d migrations)\n```sql\n%s```\n\n", sqlSchemaMarker, set.dir, applied, schema.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isDownMigration reports rollback files of golang-migrate (*.down.sql),
+// Flyway (U1__x.sql) and similar tools.
+func isDownMigration(relPath string) bool {
+	base := strings.ToLower(path.Base(relPath))
+	return strings.HasSuffix(base, ".down.sql") || base == "down.sql" || base == "rollback.sql" ||
+		len(base) > 1 && base[0] == 'u' && base[1] >= '0' && base[1] <= '9' && strings.Contains(base, "__")
+}
+
+// sqlTable is a table as the statements so far leave it.
+type sqlTable struct {
+	name        string
+	columns     []sqlColumn
+	constraints []string
+	indexes     []string // index names
+}
+
+type sqlColumn struct {
+	name string
+	def  string
+}
+
+// sqlSchema is the result of running DDL statements: tables with their
+// columns, constraints and indexes, and other objects like types and views.
+// It understands the common forms of PostgreSQL, MySQL and SQLite DDL; other
+// statements, including data changes, are ignored.
+type sqlSchema struct {
+	tables  []*sqlTable
+	indexes map[string]string // name to CREATE INDEX statement
+	objects []sqlObject
+}
+
+type sqlObject struct {
+	kind, name, statement string
+}
+
+func newSQLSchema() *sqlSchema {
+	return &sqlSchema{indexes: make(map[string]string)}
+}
+
+var (
+	sqlCreateTable = regexp.MustCompile(`(?is)^create\s+(?:(?:global\s+|local\s+)?(?:temporary|temp)\s+|unlogged\s+)?table\s+(?:if\s+not\s+exists\s+)?([^\s(]+)\s*\(`)
+	sqlAlterTable  = regexp.MustCompile(`(?is)^alter\s+table\s+(?:if\s+exists\s+)?(?:only\s+)?(\S+)\s+(.*)$`)
+	sqlDropTable   = regexp.MustCompile(`(?is)^drop\s+table\s+(?:if\s+exists\s+)?(.+?)(?:\s+(?:cascade|restrict))?$`)
+	sqlRenameTable = regexp.MustCompile(`(?is)^rename\s+table\s+(\S+)\s+to\s+(\S+)$`)
+	sqlCreateIndex = regexp.MustCompile(`(?is)^create\s+(?:unique\s+)?index\s+(?:concurrently\s+)?(?:if\s+not\s+exists\s+)?(?:(\S+)\s+)?on\s+(?:only\s+)?([^\s(]+)`)
+	sqlDropIndex   = regexp.MustCompile(`(?is)^drop\s+index\s+(?:concurrently\s+)?(?:if\s+exists\s+)?(.+?)(?:\s+on\s+\S+)?(?:\s+(?:cascade|restrict))?$`)
+	sqlCreateOther = regexp.MustCompile(`(?is)^create\s+(?:or\s+replace\s+)?(?:materialized\s+)?(view|type|sequence|extension|schema|function|procedure|trigger|domain)\s+(?:if\s+not\s+exists\s+)?([^\s(]+)`)
+	sqlDropOther   = regexp.MustCompile(`(?is)^drop\s+(?:materialized\s+)?(view|type|sequence|extension|schema|function|procedure|trigger|domain)\s+(?:if\s+exists\s+)?([^\s(,]+)`)
+	sqlBodyStart   = regexp.MustCompile(`(?is)\s(?:as|begin|return)\s`)
+
+	sqlRenameTo      = regexp.MustCompile(`(?is)^rename\s+to\s+(\S+)$`)
+	sqlRenameColumn  = regexp.MustCompile(`(?is)^rename\s+(?:column\s+)?(\S+)\s+to\s+(\S+)$`)
+	sqlAddConstraint = regexp.MustCompile(`(?is)^add\s+((?:constraint|primary\s+key|unique|foreign\s+key|check|exclude)\b.*)$`)
+	sqlAddIndex      = regexp.MustCompile(`(?is)^add\s+((?:unique\s+)?(?:key|index)\b.*)$`)
+	sqlAddColumn     = regexp.MustCompile(`(?is)^add\s+(?:column\s+)?(?:if\s+not\s+exists\s+)?(\S+)\s+(.*)$`)
+	sqlDropConstr    = regexp.MustCompile(`(?is)^drop\s+constraint\s+(?:if\s+exists\s+)?(\S+)`)
+	sqlDropColumn    = regexp.MustCompile(`(?is)^drop\s+(?:column\s+)?(?:if\s+exists\s+)?(\S+)(?:\s+(?:cascade|restrict))?$`)
+	sqlAlterType     = regexp.MustCompile(`(?is)^alter\s+(?:column\s+)?(\S+)\s+(?:set\s+data\s+)?type\s+(.+?)(?:\s+using\s+.*)?$`)
+	sqlSetNotNull    = regexp.MustCompile(`(?is)^alter\s+(?:column\s+)?(\S+)\s+(set|drop)\s+not\s+null$`)
+	sqlSetDefault    = regexp.MustCompile(`(?is)^alter\s+(?:column\s+)?(\S+)\s+(?:set\s+default\s+(.+)|drop\s+default)$`)
+	sqlModifyColumn  = regexp.MustCompile(`(?is)^modify\s+(?:column\s+)?(\S+)\s+(.*)$`)
+	sqlChangeColumn  = regexp.MustCompile(`(?is)^change\s+(?:column\s+)?(\S+)\s+(\S+)\s+(.*)$`)
+	sqlDefault       = regexp.MustCompile(`(?i)\s*\bdefault\s+(?:'[^']*'|\([^)]*\)|\S+)`)
+	sqlNotNull       = regexp.MustCompile(`(?i)\s*\bnot\s+null\b`)
+	sqlColumnAttr    = regexp.MustCompile(`(?i)\s(?:not\s+null|null|default|primary|references|unique|check|generated|collate|constraint|auto_increment|identity)\b`)
+)
+
+// apply runs the DDL of a migration. Files with goose or sql-migrate
+// annotations contribute only their Up section.
+func (s *sqlSchema) apply(sql string) {
+	for _, stmt := range splitSQL(upSection(sql)) {
+		s.statement(stmt)
+	}
+}
+
+func (s *sqlSchema) statement(stmt string) {
+	if m := sqlCreateTable.FindStringSubmatchIndex(stmt); m != nil {
+		name := stmt[m[2]:m[3]]
+		body, _ := parenthesized(stmt[m[1]-1:])
+		s.dropTable(name)
+		t := &sqlTable{name: name}
+		for _, item := range splitTopLevel(body, ',') {
+			if isTableConstraint(item) {
+				t.constraints = append(t.constraints, item)
+			} else if colName, def, ok := strings.Cut(item, " "); ok {
+				t.columns = append(t.columns, sqlColumn{colName, strings.TrimSpace(def)})
+			} else {
+				t.columns = append(t.columns, sqlColumn{item, ""})
+			}
+		}
+		s.tables = append(s.tables, t)
+		return
+	}
+	if m := sqlAlterTable.FindStringSubmatch(stmt); m != nil {
+		if t := s.table(m[1]); t != nil {
+			for _, action := range splitTopLevel(m[2], ',') {
+				s.alter(t, action)
+			}
+		}
+		return
+	}
+	if m := sqlDropTable.FindStringSubmatch(stmt); m != nil {
+		for _, name := range splitTopLevel(m[1], ',') {
+			s.dropTable(name)
+		}
+		return
+	}
+	if m := sqlRenameTable.FindStringSubmatch(stmt); m != nil {
+		if t := s.table(m[1]); t != nil {
+			t.name = m[2]
+		}
+		return
+	}
+	if m := sqlCreateIndex.FindStringSubmatch(stmt); m != nil {
+		name := m[1]
+		if name == "" {
+			name = stmt
+		}
+		if t := s.table(m[2]); t != nil {
+			key := sqlKey(name)
+			if _, exists := s.indexes[key]; !exists {
+				t.indexes = append(t.indexes, key)
+			}
+			s.indexes[key] = stmt
+		}
+		return
+	}
+	if m := sqlDropIndex.FindStringSubmatch(stmt); m != nil {
+		for _, name := range splitTopLevel(m[1], ',') {
+			delete(s.indexes, sqlKey(name))
+		}
+		return
+	}
+	if m := sqlCreateOther.FindStringSubmatch(stmt); m != nil {
+		kind := strings.ToLower(m[1])
+		if kind == "function" || kind == "procedure" || kind == "trigger" {
+			// Signatures only
+			if loc := sqlBodyStart.FindStringIndex(stmt); loc != nil {
+				stmt = strings.TrimSpace(stmt[:loc[0]])
+			}
+		}
+		s.dropObject(kind, m[2])
+		s.objects = append(s.objects, sqlObject{kind, m[2], stmt})
+		return
+	}
+	if m := sqlDropOther.FindStringSubmatch(stmt); m != nil {
+		s.dropObject(strings.ToLower(m[1]), m[2])
+	}
+}
+
+func (s *sqlSchema) alter(t *sqlTable, action string) {
+	col := func(name string) *sqlColumn {
+		for i := range t.columns {
+			if sqlKey(t.columns[i].name) == sqlKey(name) {
+				return &t.columns[i]
+			}
+		}
+		return nil
+	}
+	if m := sqlRenameTo.FindStringSubmatch(action); m != nil {
+		t.name = m[1]
+	} else if m := sqlRenameColumn.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c != nil {
+			c.name = m[2]
+		}
+	} else if m := sqlAddConstraint.FindStringSubmatch(action); m != nil {
+		t.constraints = append(t.constraints, m[1])
+	} else if m := sqlAddIndex.FindStringSubmatch(action); m != nil {
+		t.constraints = append(t.constraints, m[1])
+	} else if m := sqlAddColumn.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c == nil {
+			t.columns = append(t.columns, sqlColumn{m[1], m[2]})
+		}
+	} else if m := sqlDropConstr.FindStringSubmatch(action); m != nil {
+		t.constraints = slices.DeleteFunc(t.constraints, func(c string) bool {
+			fields := strings.Fields(c)
+			return len(fields) > 1 && strings.EqualFold(fields[0], "constraint") && sqlKey(fields[1]) == sqlKey(m[1])
+		})
+	} else if m := sqlAlterType.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c != nil {
+			attrs := ""
+			if loc := sqlColumnAttr.FindStringIndex(" " + c.def); loc != nil {
+				attrs = (" " + c.def)[loc[0]:]
+			}
+			c.def = m[2] + attrs
+		}
+	} else if m := sqlSetNotNull.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c != nil {
+			c.def = sqlNotNull.ReplaceAllString(c.def, "")
+			if strings.EqualFold(m[2], "set") {
+				c.def += " NOT NULL"
+			}
+		}
+	} else if m := sqlSetDefault.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c != nil {
+			c.def = sqlDefault.ReplaceAllString(c.def, "")
+			if m[2] != "" {
+				c.def += " DEFAULT " + m[2]
+			}
+		}
+	} else if m := sqlModifyColumn.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c != nil {
+			c.def = m[2]
+		}
+	} else if m := sqlChangeColumn.FindStringSubmatch(action); m != nil {
+		if c := col(m[1]); c != nil {
+			c.name, c.def = m[2], m[3]
+		}
+	} else if m := sqlDropColumn.FindStringSubmatch(action); m != nil {
+		t.columns = slices.DeleteFunc(t.columns, func(c sqlColumn) bool { return sqlKey(c.name) == sqlKey(m[1]) })
+	}
+}
+
+func (s *sqlSchema) table(name string) *sqlTable {
+	for _, t := range s.tables {
+		if sqlKey(t.name) == sqlKey(name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *sqlSchema) dropTable(name string) {
+	s.tables = slices.DeleteFunc(s.tables, func(t *sqlTable) bool {
+		if sqlKey(t.name) != sqlKey(name) {
+			return false
+		}
+		for _, index := range t.indexes {
+			delete(s.indexes, index)
+		}
+		return true
+	})
+}
+
+func (s *sqlSchema) dropObject(kind, name string) {
+	s.objects = slices.DeleteFunc(s.objects, func(o sqlObject) bool {
+		return o.kind == kind && sqlKey(o.name) == sqlKey(name)
+	})
+}
+
+// empty reports whether no statement defined anything.
+func (s *sqlSchema) empty() bool {
+	return len(s.tables) == 0 && len(s.indexes) == 0 && len(s.objects) == 0
+}
+
+// String renders the schema as DDL: extensions, schemas, types and
+// sequences, then each table followed by its indexes, then views,
+// functions and triggers.
+func (s *sqlSchema) String() string {
+	var b strings.Builder
+	late := map[string]bool{"view": true, "function": true, "procedure": true, "trigger": true}
+	for _, o := range s.objects {
+		if !late[o.kind] {
+			b.WriteString(o.statement + ";\n")
+		}
+	}
+	for _, t := range s.tables {
+		fmt.Fprintf(&b, "CREATE TABLE %s (\n", t.name)
+		lines := make([]string, 0, len(t.columns)+len(t.constraints))
+		for _, c := range t.columns {
+			lines = append(lines, strings.TrimSpace(c.name+" "+c.def))
+		}
+		lines = append(lines, t.constraints...)
+		for i, line := range lines {
+			sep := ","
+			if i == len(lines)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, "  %s%s\n", line, sep)
+		}
+		b.WriteString(");\n")
+		for _, index := range t.indexes {
+			if stmt, ok := s.indexes[index]; ok {
+				b.WriteString(stmt + ";\n")
+			}
+		}
+	}
+	for _, o := range s.objects {
+		if late[o.kind] {
+			b.WriteString(o.statement + ";\n")
+		}
+	}
+	return b.String()
+}
+
+// sqlKey folds an identifier for comparison: quotes are removed and case
+// is ignored, as it is for unquoted identifiers.
+func sqlKey(name string) string {
+	return strings.ToLower(strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "").Replace(strings.TrimSpace(name)))
+}
+
+func isTableConstraint(item string) bool {
+	first, _, _ := strings.Cut(strings.ToLower(item), " ")
+	switch first {
+	case "constraint", "primary", "unique", "foreign", "check", "key", "index", "exclude", "fulltext", "spatial":
+		return true
+	}
+	return false
+}
+
+// upSection returns the Up part of a goose or sql-migrate migration, or
+// the whole file without such annotations.
+func upSection(sql string) string {
+	lower := strings.ToLower(sql)
+	for _, tool := range []string{"-- +goose ", "-- +migrate "} {
+		up := strings.Index(lower, tool+"up")
+		if up < 0 {
+			continue
+		}
+		rest := sql[up:]
+		if down := strings.Index(strings.ToLower(rest), tool+"down"); down >= 0 {
+			rest = rest[:down]
+		}
+		return rest
+	}
+	return sql
+}
+
+// splitSQL splits a script into statements with comments removed and
+// whitespace collapsed. Quoted strings, quoted identifiers and
+// PostgreSQL dollar-quoted bodies are kept intact.
+func splitSQL(sql string) []string {
+	var stmts []string
+	var b strings.Builder
+	flush := func() {
+		if stmt := strings.Join(strings.Fields(b.String()), " "); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case strings.HasPrefix(sql[i:], "--") || c == '#' && (i == 0 || sql[i-1] == '\n'):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+				continue
+			}
+			i += end + 4
+			b.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(sql) {
+				if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			j = min(j+1, len(sql))
+			b.WriteString(sql[i:j])
+			i = j
+		case c == '$':
+			tag := sql[i : i+1+strings.IndexByte(sql[i+1:], '$')+1]
+			if !isDollarTag(tag) {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				b.WriteString(sql[i:])
+				i = len(sql)
+				continue
+			}
+			j := i + len(tag) + end + len(tag)
+			b.WriteString(sql[i:j])
+			i = j
+		case c == ';':
+			flush()
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	return stmts
+}
+
+// isDollarTag reports whether tag is a PostgreSQL dollar quote like $$ or
+// $body$.
+func isDollarTag(tag string) bool {
+	if len(tag) < 2 || tag[len(tag)-1] != '$' {
+		return false
+	}
+	for _, r := range tag[1 : len(tag)-1] {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// parenthesized returns what is inside the parentheses s starts with.
+func parenthesized(s string) (string, bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[1:i], true
+			}
+		}
+	}
+	return strings.TrimPrefix(s, "("), false
+}
+
+// splitTopLevel splits s on sep outside parentheses and quotes.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			if part := strings.TrimSpace(s[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// sqlSchemaView reduces a standalone .sql file to the schema its DDL
+// defines. Files without DDL, like query files, are kept as they are.
+func sqlSchemaView(src sourceFile, data []byte) ([]byte, bool, error) {
+	schema := newSQLSchema()
+	schema.apply(string(data))
+	if schema.empty() {
+		return data, true, nil
+	}
+	return []byte(schema.String()), true, nil
+}
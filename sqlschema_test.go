@@ -0,0 +1,149 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSQLSchema(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []string
+		want       string
+	}{
+		{
+			name:       "create table",
+			migrations: []string{"CREATE TABLE users (\n  id serial PRIMARY KEY,\n  email text NOT NULL -- login\n);"},
+			want:       "CREATE TABLE users (\n  id serial PRIMARY KEY,\n  email text NOT NULL\n);\n",
+		},
+		{
+			name: "columns added, renamed and dropped",
+			migrations: []string{
+				"CREATE TABLE users (id int, name text, age int);",
+				"ALTER TABLE users ADD COLUMN email text NOT NULL;\nALTER TABLE users RENAME COLUMN name TO full_name;",
+				"ALTER TABLE users DROP COLUMN age;",
+			},
+			want: "CREATE TABLE users (\n  id int,\n  full_name text,\n  email text NOT NULL\n);\n",
+		},
+		{
+			name: "column type, default and not null changed",
+			migrations: []string{
+				"CREATE TABLE t (n int);",
+				"ALTER TABLE t ALTER COLUMN n TYPE bigint;\nALTER TABLE t ALTER COLUMN n SET NOT NULL;\nALTER TABLE t ALTER COLUMN n SET DEFAULT 0;",
+			},
+			want: "CREATE TABLE t (\n  n bigint NOT NULL DEFAULT 0\n);\n",
+		},
+		{
+			name: "dropped table",
+			migrations: []string{
+				"CREATE TABLE a (id int);\nCREATE TABLE b (id int);",
+				"DROP TABLE IF EXISTS a CASCADE;",
+			},
+			want: "CREATE TABLE b (\n  id int\n);\n",
+		},
+		{
+			name: "renamed table",
+			migrations: []string{
+				"CREATE TABLE a (id int);",
+				"ALTER TABLE a RENAME TO b;",
+			},
+			want: "CREATE TABLE b (\n  id int\n);\n",
+		},
+		{
+			name: "dropped index",
+			migrations: []string{
+				"CREATE TABLE a (id int);\nCREATE UNIQUE INDEX a_id ON a (id);",
+				"DROP INDEX a_id;",
+			},
+			want: "CREATE TABLE a (\n  id int\n);\n",
+		},
+		{
+			name:       "objects before and after tables",
+			migrations: []string{"CREATE VIEW v AS SELECT 1;\nCREATE TABLE a (id int);\nCREATE TYPE mood AS ENUM ('ok');"},
+			want:       "CREATE TYPE mood AS ENUM ('ok');\nCREATE TABLE a (\n  id int\n);\nCREATE VIEW v AS SELECT 1;\n",
+		},
+		{
+			name:       "goose down section ignored",
+			migrations: []string{"-- +goose Up\nCREATE TABLE a (id int);\n-- +goose Down\nDROP TABLE a;"},
+			want:       "CREATE TABLE a (\n  id int\n);\n",
+		},
+		{
+			name:       "data changes ignored",
+			migrations: []string{"CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\nUPDATE a SET id = 2;"},
+			want:       "CREATE TABLE a (\n  id int\n);\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := newSQLSchema()
+			for _, m := range tt.migrations {
+				schema.apply(m)
+			}
+			if got := schema.String(); got != tt.want {
+				t.Errorf("schema =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"SELECT ';' -- a; comment\n; /* b; */ SELECT\n  2", []string{"SELECT ';'", "SELECT 2"}},
+		{`CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END $$ LANGUAGE plpgsql;`, []string{`CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END $$ LANGUAGE plpgsql`}},
+		{`SELECT "a;b" FROM t`, []string{`SELECT "a;b" FROM t`}},
+		{"  \n-- only a comment\n", nil},
+	}
+	for _, tt := range tests {
+		if got := splitSQL(tt.sql); !slices.Equal(got, tt.want) {
+			t.Errorf("splitSQL(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestIsDownMigration(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"db/migrations/0001_init.up.sql", false},
+		{"db/migrations/0001_init.down.sql", true},
+		{"db/migrations/V1__init.sql", false},
+		{"db/migrations/U1__init.sql", true},
+		{"db/migrations/2/down.sql", true},
+		{"db/migrations/users.sql", false},
+	}
+	for _, tt := range tests {
+		if got := isDownMigration(tt.path); got != tt.want {
+			t.Errorf("isDownMigration(%q) = %t, want %t", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSplitMigrations(t *testing.T) {
+	var files []sourceFile
+	for _, p := range []string{"main.go", "db/migrations/10_c.sql", "db/migrations/2_b.sql", "queries/q.sql", "db/migrations/README.md", "db/migrations/1_a.sql"} {
+		files = append(files, sourceFile{relPath: p})
+	}
+	kept, sets := splitMigrations(files)
+	var keptPaths []string
+	for _, f := range kept {
+		keptPaths = append(keptPaths, f.relPath)
+	}
+	if want := []string{"main.go", "queries/q.sql", "db/migrations/README.md"}; !slices.Equal(keptPaths, want) {
+		t.Errorf("kept %q, want %q", keptPaths, want)
+	}
+	if len(sets) != 1 || sets[0].dir != "db/migrations" {
+		t.Fatalf("sets = %+v, want one for db/migrations", sets)
+	}
+	var order []string
+	for _, f := range sets[0].files {
+		order = append(order, f.relPath)
+	}
+	if want := []string{"db/migrations/1_a.sql", "db/migrations/2_b.sql", "db/migrations/10_c.sql"}; !slices.Equal(order, want) {
+		t.Errorf("migration order %q, want %q", order, want)
+	}
+}
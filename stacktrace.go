@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const stackTraceMarker = "## Stack Trace"
+
+// traceFrame is one frame of a -from-trace stack trace.
+type traceFrame struct {
+	function string
+	path     string // as the trace names it
+	relPath  string // empty when the file is not in the input
+	line     int
+}
+
+var (
+	// Go: the function line, then "\t/src/app/main.go:12 +0x1d"
+	goFrameLocation = regexp.MustCompile(`^\t(.+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	// Rust: "  12: app::main", then "             at ./src/main.rs:20:9"
+	rustFrameFunction = regexp.MustCompile(`^\s*\d+:\s+(\S+)`)
+	// Python: `  File "app/views.py", line 12, in handle`
+	pythonFrame = regexp.MustCompile(`^\s*File "(.+?)", line (\d+)(?:, in (.+))?$`)
+	// Java, Kotlin and Scala: "\tat com.acme.Billing.charge(Billing.java:12)"
+	javaFrame = regexp.MustCompile(`^\s*at (?:[\w.$@]+/)*([\w.$<>]+)\.([\w$<>]+)\(([\w$]+\.\w+):(\d+)\)$`)
+	// Node: "    at charge (/app/src/billing.js:12:5)", or without a function,
+	// which is also how Rust prints locations
+	nodeFrame = regexp.MustCompile(`^\s*at (?:(.+?) \()?(?:file://)?([^()\s]+?):(\d+)(?::\d+)?\)?$`)
+)
+
+// parseStackTrace returns the frames of Go, Python, Java, Node and Rust
+// stack traces, innermost first. Python prints its innermost frame last, so
+// each of its tracebacks is reversed.
+func parseStackTrace(data []byte) []traceFrame {
+	var frames []traceFrame
+	pending := ""     // function named on the line before a location line
+	pythonStart := -1 // index of the current Python traceback's first frame
+	reversePython := func() {
+		if pythonStart >= 0 {
+			tb := frames[pythonStart:]
+			for i, j := 0, len(tb)-1; i < j; i, j = i+1, j-1 {
+				tb[i], tb[j] = tb[j], tb[i]
+			}
+			pythonStart = -1
+		}
+	}
+
+	for _, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(raw, "\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "Traceback (most recent call last)") {
+			reversePython()
+			pythonStart = len(frames)
+			continue
+		}
+		// A traceback ends with its unindented exception line
+		if pythonStart >= 0 && line != "" && line[0] != ' ' && line[0] != '\t' {
+			reversePython()
+		}
+		if m := goFrameLocation.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			frames = append(frames, traceFrame{function: pending, path: m[1], line: n})
+			pending = ""
+			continue
+		}
+		if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			frames = append(frames, traceFrame{function: m[3], path: m[1], line: n})
+			continue
+		}
+		if m := javaFrame.FindStringSubmatch(line); m != nil {
+			class := m[1]
+			if i := strings.IndexByte(class, '$'); i >= 0 {
+				class = class[:i]
+			}
+			path := m[3]
+			if i := strings.LastIndexByte(class, '.'); i >= 0 {
+				path = strings.ReplaceAll(class[:i], ".", "/") + "/" + m[3]
+			}
+			n, _ := strconv.Atoi(m[4])
+			frames = append(frames, traceFrame{function: m[1] + "." + m[2], path: path, line: n})
+			continue
+		}
+		if m := nodeFrame.FindStringSubmatch(line); m != nil {
+			function := m[1]
+			if function == "" {
+				function = pending
+			}
+			n, _ := strconv.Atoi(m[3])
+			frames = append(frames, traceFrame{function: function, path: m[2], line: n})
+			pending = ""
+			continue
+		}
+		if m := rustFrameFunction.FindStringSubmatch(line); m != nil {
+			pending = m[1]
+			continue
+		}
+		pending = goFrameFunction(line)
+	}
+	reversePython()
+	return frames
+}
+
+// goFrameFunction returns the function of a Go frame's first line, e.g.
+// "main.(*Server).handle(0xc000010000, ...)" or "created by main.main in
+// goroutine 1".
+func goFrameFunction(line string) string {
+	line = strings.TrimPrefix(line, "created by ")
+	if i := strings.Index(line, " in goroutine "); i >= 0 {
+		line = line[:i]
+	}
+	if strings.HasSuffix(line, ")") {
+		if i := strings.LastIndexByte(line, '('); i > 0 {
+			line = line[:i]
+		}
+	}
+	if line == "" || strings.ContainsAny(line, " \t") {
+		return ""
+	}
+	return line
+}
+
+// stackTraceFiles returns the input files the frames of the -from-trace
+// trace fall in, innermost frame first, and records the frame lines of each
+// for -error-context. A frame path that does not resolve as is, such as one
+// from the machine the trace was taken on or a Java package path, matches
+// the input file it shares its trailing path elements with.
+func stackTraceFiles(ctx context.Context, absPath string, config *Config) ([]sourceFile, error) {
+	data, err := readPastedLog(config.fromTrace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stack trace: %w", err)
+	}
+	config.traceLog = string(bytes.TrimRight(data, "\n"))
+	config.errorLines = make(map[string][]int)
+
+	frames := parseStackTrace(data)
+	var index map[string][]string
+	var files []sourceFile
+	for i := range frames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		frame := &frames[i]
+		path, relPath, ok := resolveErrorPath(absPath, frame.path)
+		if !ok {
+			if index == nil {
+				if index, err = indexFileNames(ctx, absPath, config); err != nil {
+					return nil, err
+				}
+			}
+			relPath, ok = matchFrameSuffix(index, frame.path)
+			path = filepath.Join(absPath, filepath.FromSlash(relPath))
+		}
+		if !ok {
+			config.logger.Debug("Skipping stack frame outside the input", "path", frame.path, "function", frame.function)
+			continue
+		}
+		frame.relPath = relPath
+		if _, seen := config.errorLines[relPath]; !seen {
+			config.result.FilesScanned++
+			files = append(files, sourceFile{path: path, relPath: relPath})
+		}
+		config.errorLines[relPath] = append(config.errorLines[relPath], frame.line)
+	}
+	config.traceFrames = frames
+	return files, nil
+}
+
+// indexFileNames lists the files of the input by base name, outside the
+// excluded directories.
+func indexFileNames(ctx context.Context, absPath string, config *Config) (map[string][]string, error) {
+	index := make(map[string][]string)
+	err := filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(absPath, path)
+		if d.IsDir() {
+			if d.Name() == ".git" || (relPath != "." && shouldExcludeDir(relPath, config.excludeMap)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath = nfc(filepath.ToSlash(relPath))
+		index[d.Name()] = append(index[d.Name()], relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index input files: %w", err)
+	}
+	return index, nil
+}
+
+// matchFrameSuffix finds the input file whose path ends with the frame's,
+// or whose path the frame's ends with; the shortest wins a tie.
+func matchFrameSuffix(index map[string][]string, framePath string) (string, bool) {
+	framePath = path.Clean("/" + filepath.ToSlash(framePath))
+	candidates := index[nfc(filepath.Base(framePath))]
+	var matches []string
+	for _, relPath := range candidates {
+		if strings.HasSuffix("/"+relPath, framePath) || strings.HasSuffix(framePath, "/"+relPath) {
+			matches = append(matches, relPath)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if len(matches[i]) != len(matches[j]) {
+			return len(matches[i]) < len(matches[j])
+		}
+		return matches[i] < matches[j]
+	})
+	return matches[0], true
+}
+
+// writeStackTrace writes the trace as given, then its frames innermost
+// first with the input files they resolved to.
+func writeStackTrace(w io.Writer, trace string, frames []traceFrame) error {
+	if _, err := fmt.Fprintf(w, "%s\n```\n%s\n```\n\n## Stack Frames (innermost first)\n```\n", stackTraceMarker, trace); err != nil {
+		return err
+	}
+	for i, frame := range frames {
+		function := frame.function
+		if function == "" {
+			function = "?"
+		}
+		location := fmt.Sprintf("%s:%d", frame.relPath, frame.line)
+		if frame.relPath == "" {
+			location = fmt.Sprintf("%s:%d (not in the input)", frame.path, frame.line)
+		}
+		if _, err := fmt.Fprintf(w, "#%d %s %s\n", i, function, location); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "```\n\n")
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// statsReport is the -json output of the stats command.
+type statsReport struct {
+	*runResult
+	EstimatedTokens int             `json:"estimatedTokens"`
+	Languages       []languageStats `json:"languages"`
+}
+
+func setupStats(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	return func(args []string) int {
+		if !noArgs("stats", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		config, err := pf.config(logger)
+		if err != nil {
+			logger.Error("Invalid flags", "error", err)
+			return exitFailure
+		}
+
+		// Render everything as pack would, but only count what comes out
+		counter := &tokenCounter{bpe: config.tokenizer}
+		config.outputWriter = counter
+		config.outputPath = ""
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		code, err := pack(ctx, config, *pf.progress, *pf.resultJSON)
+		if code == exitFailure || code == exitCancelled {
+			logOutcome(logger, config, code, err)
+			return code
+		}
+
+		report := statsReport{
+			runResult:       config.result,
+			EstimatedTokens: counter.tokens(),
+			Languages:       languageBreakdown(config.manifest.Files),
+		}
+		if *asJSON {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				logger.Error("Failed to encode report", "error", err)
+				return exitFailure
+			}
+			fmt.Println(string(data))
+		} else {
+			writeStats(os.Stdout, report)
+		}
+		return code
+	}
+}
+
+func writeStats(w io.Writer, report statsReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Input:\t%s\n", report.Input)
+	fmt.Fprintf(tw, "Files scanned:\t%d\n", report.FilesScanned)
+	fmt.Fprintf(tw, "Files matched:\t%d\n", report.FilesMatched)
+	fmt.Fprintf(tw, "Files included:\t%d\n", report.FilesIncluded)
+	fmt.Fprintf(tw, "Files skipped:\t%d\n", len(report.FilesSkipped))
+	fmt.Fprintf(tw, "Output size:\t%s\n", formatBytes(report.BytesWritten))
+	fmt.Fprintf(tw, "Estimated tokens:\t%d\n", report.EstimatedTokens)
+	fmt.Fprintf(tw, "Characters:\t%d\n", report.Characters)
+	fmt.Fprintf(tw, "Lines:\t%d\n", report.Lines)
+	fmt.Fprintf(tw, "Format version:\t%d\n", report.FormatVersion)
+	if b := report.Budget; b != nil {
+		for _, budget := range []struct {
+			name      string
+			used, max int
+		}{{"Token", b.UsedTokens, b.MaxTokens}, {"Character", b.UsedChars, b.MaxChars}, {"Line", b.UsedLines, b.MaxLines}} {
+			if budget.max > 0 {
+				fmt.Fprintf(tw, "%s budget:\t%d of %d used, %d files left out\n", budget.name, budget.used, budget.max, len(b.FilesDropped))
+			}
+		}
+	}
+	tw.Flush()
+
+	if len(report.Languages) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "FILES\tLINES\tTOKENS\tSHARE\t  LANGUAGE")
+		for _, language := range report.Languages {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%.1f%%\t  %s\n", language.Files, language.Lines, language.Tokens, language.Share, language.Language)
+		}
+		tw.Flush()
+	}
+
+	for _, skipped := range report.FilesSkipped {
+		fmt.Fprintf(w, "skipped %s: %s\n", skipped.Path, skipped.Reason)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// strictIssue is something -strict refuses to ship.
+type strictIssue struct {
+	Path   string `json:"path,omitempty"`
+	Kind   string `json:"kind"` // secret, size, binary or tokens
+	Rule   string `json:"rule,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// strictChecker inspects every file as it will be written, after all other
+// transforms, for -strict. Issues are kept per file, so measuring and
+// writing a file records it once.
+type strictChecker struct {
+	maxFileSize int64
+	maxTokens   int
+	secrets     *redactor
+	issues      map[string][]strictIssue
+}
+
+func newStrictChecker(maxFileSize int64, maxTokens int) *strictChecker {
+	secrets, _ := newRedactor([]string{"secrets"}, "")
+	return &strictChecker{maxFileSize: maxFileSize, maxTokens: maxTokens, secrets: secrets, issues: make(map[string][]strictIssue)}
+}
+
+func (s *strictChecker) check(src sourceFile, data []byte) ([]byte, bool, error) {
+	var issues []strictIssue
+	s.secrets.redact(src.relPath, data)
+	for _, finding := range s.secrets.findings[src.relPath] {
+		issues = append(issues, strictIssue{Path: src.relPath, Kind: "secret", Rule: finding.Rule, Line: finding.Line, Detail: fmt.Sprintf("likely %s on line %d", finding.Rule, finding.Line)})
+	}
+	if s.maxFileSize > 0 && int64(len(data)) > s.maxFileSize {
+		issues = append(issues, strictIssue{Path: src.relPath, Kind: "size", Detail: fmt.Sprintf("%s, over the %s limit", formatBytes(int64(len(data))), formatBytes(s.maxFileSize))})
+	}
+	if detail := binaryGarbage(data); detail != "" {
+		issues = append(issues, strictIssue{Path: src.relPath, Kind: "binary", Detail: detail})
+	}
+	if len(issues) == 0 {
+		delete(s.issues, src.relPath)
+	} else {
+		s.issues[src.relPath] = issues
+	}
+	return data, true, nil
+}
+
+// binaryGarbage describes content that is not text: NUL bytes, or more
+// than 1% replacement characters and control characters other than
+// whitespace.
+func binaryGarbage(data []byte) string {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "contains NUL bytes"
+	}
+	bad, total := 0, 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		total++
+		if r == utf8.RuneError || r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != '\v' && r != 0x1b {
+			bad++
+		}
+	}
+	if total > 0 && bad*100 > total {
+		return fmt.Sprintf("%d of %d characters are undecodable or control characters", bad, total)
+	}
+	return ""
+}
+
+// verdict returns the issues of the run, files in path order and the token
+// total last, and an error when there are any.
+func (s *strictChecker) verdict(tokens int) ([]strictIssue, error) {
+	paths := make([]string, 0, len(s.issues))
+	for path := range s.issues {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var issues []strictIssue
+	for _, path := range paths {
+		issues = append(issues, s.issues[path]...)
+	}
+	if s.maxTokens > 0 && tokens > s.maxTokens {
+		issues = append(issues, strictIssue{Kind: "tokens", Detail: fmt.Sprintf("~%d tokens, over the %d limit", tokens, s.maxTokens)})
+	}
+	if len(issues) == 0 {
+		return nil, nil
+	}
+	return issues, fmt.Errorf("-strict found %d problems in the output, which was not written", len(issues))
+}
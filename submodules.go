@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var submoduleModes = []string{"include", "skip", "include-with-ref"}
+
+type submoduleRef struct {
+	Path     string `json:"path"`
+	Commit   string `json:"commit,omitempty"` // empty when not checked out
+	Included bool   `json:"included"`
+}
+
+// gitModulePaths returns the submodule paths .gitmodules declares in root,
+// so submodules that are not checked out, and have no .git of their own,
+// are still recognized.
+func gitModulePaths(root string) map[string]bool {
+	paths := make(map[string]bool)
+	f, err := os.Open(filepath.Join(root, ".gitmodules"))
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok && strings.TrimSpace(key) == "path" {
+			paths[filepath.FromSlash(strings.TrimSpace(value))] = true
+		}
+	}
+	return paths
+}
+
+// isNestedRepo reports whether dir is a submodule or another repository
+// nested in the input: it has a .git directory, or the .git file a
+// submodule checkout has, or .gitmodules declares it.
+func isNestedRepo(dir, relPath string, modules map[string]bool) bool {
+	if modules[relPath] {
+		return true
+	}
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// gitHead returns the commit checked out in the repository at dir, read
+// from its git directory without running git, or "" if it cannot be
+// found. A submodule's .git is a file pointing at its git directory in the
+// parent repository.
+func gitHead(dir string) string {
+	gitDir := filepath.Join(dir, ".git")
+	if data, err := os.ReadFile(gitDir); err == nil {
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return ""
+		}
+		gitDir = strings.TrimSpace(target)
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(dir, gitDir)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(data))
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		return head // detached
+	}
+	if data, err := os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	packed, err := os.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		if commit, name, ok := strings.Cut(strings.TrimSpace(line), " "); ok && name == ref {
+			return commit
+		}
+	}
+	return ""
+}
+
+// recordSubmodule notes a nested repository met by the walk for the
+// header.
+func (c *Config) recordSubmodule(dir, relPath string) {
+	c.result.Submodules = append(c.result.Submodules, submoduleRef{
+		Path:     c.displayPath(filepath.ToSlash(relPath)),
+		Commit:   gitHead(dir),
+		Included: c.submodules != "skip",
+	})
+}
+
+// submoduleHeader describes a nested repository for the header.
+func submoduleHeader(ref submoduleRef) string {
+	commit := "not checked out"
+	if ref.Commit != "" {
+		commit = "at " + ref.Commit
+	}
+	if !ref.Included {
+		return fmt.Sprintf("# Submodule: %s %s, skipped\n", ref.Path, commit)
+	}
+	return fmt.Sprintf("# Submodule: %s %s\n", ref.Path, commit)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var summarizeModes = []string{"replace", "alongside"}
+
+const summarizePrompt = "Summarize this file from a software repository for a reader who will not see it. " +
+	"State its purpose, its main types and functions and how they are used, and anything surprising. " +
+	"Answer in at most six sentences of plain text."
+
+// summarizer replaces large files with a summary from an OpenAI-compatible
+// chat API for -summarize. Summaries are cached in the user cache directory
+// by model and content hash, so unchanged files cost nothing the next run.
+type summarizer struct {
+	mode     string // replace or alongside
+	over     int64  // files at least this large are summarized
+	model    string
+	endpoint string
+	apiKey   string
+	cacheDir string
+	logger   *slog.Logger
+}
+
+func newSummarizer(mode string, over int64, model, endpoint, keyEnv string, logger *slog.Logger) (*summarizer, error) {
+	if model == "" {
+		return nil, fmt.Errorf("-summarize requires -summarize-model")
+	}
+	s := &summarizer{mode: mode, over: over, model: model, endpoint: endpoint, apiKey: os.Getenv(keyEnv), logger: logger}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		s.cacheDir = filepath.Join(cacheDir, "contextify", "summaries")
+	}
+	return s, nil
+}
+
+// summarize returns the summary in place of the content, or before it in
+// alongside mode. When the API fails the content is kept as it is.
+func (s *summarizer) summarize(src sourceFile, data []byte) ([]byte, bool, error) {
+	if int64(len(data)) < s.over {
+		return data, true, nil
+	}
+	summary, err := s.summary(data)
+	if err != nil {
+		s.logger.Warn("Failed to summarize file, keeping its content", "path", src.relPath, "error", err)
+		return data, true, nil
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "[summary of %s by %s]\n%s\n", formatBytes(int64(len(data))), s.model, summary)
+	if s.mode == "alongside" {
+		out.WriteString("[full content]\n")
+		out.Write(data)
+	}
+	return out.Bytes(), true, nil
+}
+
+func (s *summarizer) summary(data []byte) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00", s.model, summarizePrompt)
+	hash.Write(data)
+	key := hex.EncodeToString(hash.Sum(nil))
+	cached := ""
+	if s.cacheDir != "" {
+		cached = filepath.Join(s.cacheDir, key+".txt")
+		if summary, err := os.ReadFile(cached); err == nil {
+			return string(summary), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	var answer bytes.Buffer
+	request := chatRequest{Model: s.model, Stream: true, Messages: []chatMessage{
+		{Role: "system", Content: summarizePrompt},
+		{Role: "user", Content: string(data)},
+	}}
+	if err := streamChat(ctx, s.endpoint, s.apiKey, request, &answer); err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(answer.String())
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	if cached != "" {
+		if err := os.MkdirAll(s.cacheDir, 0o755); err == nil {
+			if err := os.WriteFile(cached, []byte(summary), 0o644); err != nil {
+				s.logger.Debug("Failed to cache summary", "error", err)
+			}
+		}
+	}
+	return summary, nil
+}
+
+// summarizeSetting describes -summarize for the manifest settings.
+func summarizeSetting(s *summarizer) string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s over %d bytes by %s", s.mode, s.over, s.model)
+}
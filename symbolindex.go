@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const symbolIndexMarker = "## Symbol Index"
+
+type symbolEntry struct {
+	name string
+	kind string
+	path string
+	line int
+}
+
+type symbolPattern struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+var (
+	goSymbols = []symbolPattern{
+		{"method", regexp.MustCompile(`^func \((?:\w+ )?\*?([A-Z]\w*)(?:\[[^\]]*\])?\) ([A-Z]\w*)`)},
+		{"func", regexp.MustCompile(`^func ([A-Z]\w*)`)},
+		{"type", regexp.MustCompile(`^type ([A-Z]\w*)`)},
+	}
+	jsSymbols = []symbolPattern{
+		{"class", regexp.MustCompile(`^export (?:default )?(?:abstract )?class (\w+)`)},
+		{"func", regexp.MustCompile(`^export (?:default )?(?:async )?function\*? ?(\w+)`)},
+		{"type", regexp.MustCompile(`^export (?:declare )?(?:interface|type|enum) (\w+)`)},
+		{"const", regexp.MustCompile(`^export (?:const|let|var) (\w+)`)},
+	}
+	pythonSymbols = []symbolPattern{
+		{"class", regexp.MustCompile(`^class ([A-Za-z]\w*)`)},
+		{"func", regexp.MustCompile(`^(?:async )?def ([A-Za-z]\w*)`)},
+	}
+	jvmSymbols = []symbolPattern{
+		{"type", regexp.MustCompile(`^\s*public (?:(?:static|final|abstract|sealed|partial|readonly) )*(?:class|interface|enum|record|struct|@interface) (\w+)`)},
+		{"method", regexp.MustCompile(`^\s*public (?:(?:static|final|abstract|override|virtual|async|synchronized) )*[\w<>\[\],.? ]+? (\w+)\s*\(`)},
+	}
+	rustSymbols = []symbolPattern{
+		{"func", regexp.MustCompile(`^\s*pub (?:const )?(?:async )?(?:unsafe )?fn (\w+)`)},
+		{"type", regexp.MustCompile(`^pub (?:struct|enum|trait|type|union) (\w+)`)},
+		{"mod", regexp.MustCompile(`^pub mod (\w+)`)},
+	}
+)
+
+// symbolPatterns returns the declaration patterns for a file's language.
+func symbolPatterns(relPath string) []symbolPattern {
+	switch strings.ToLower(filepath.Ext(relPath)) {
+	case ".go":
+		return goSymbols
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts":
+		return jsSymbols
+	case ".py":
+		return pythonSymbols
+	case ".java", ".cs", ".kt", ".scala":
+		return jvmSymbols
+	case ".rs":
+		return rustSymbols
+	}
+	return nil
+}
+
+// symbolIndex gathers the exported declarations and HTTP endpoints of the
+// included files for -symbol-index, with their lines in the files on disk.
+type symbolIndex struct {
+	entries []symbolEntry
+}
+
+// symbolScanner finds the symbols of one file as it streams through;
+// endpoints come from its route scanner.
+type symbolScanner struct {
+	lineFeed
+	path     string
+	patterns []symbolPattern
+	line     int
+	entries  []symbolEntry
+	routes   *routeScanner
+}
+
+func (x *symbolIndex) scan(relPath string) *symbolScanner {
+	s := &symbolScanner{path: relPath, patterns: symbolPatterns(relPath), routes: newRouteScanner(relPath)}
+	s.onLine = s.scanLine
+	return s
+}
+
+// commit records the symbols of a finished file if it made it into the
+// output.
+func (x *symbolIndex) commit(s *symbolScanner, keep bool) {
+	s.flush()
+	if !keep {
+		return
+	}
+	x.entries = append(x.entries, s.entries...)
+	for _, r := range s.routes.routes {
+		x.entries = append(x.entries, symbolEntry{name: r.method + " " + r.path, kind: "endpoint", path: r.file, line: r.line})
+	}
+}
+
+func (s *symbolScanner) scanLine(line []byte) {
+	s.line++
+	s.routes.scanLine(line)
+	for _, p := range s.patterns {
+		if m := p.pattern.FindSubmatch(line); m != nil {
+			name := string(m[1])
+			if len(m) > 2 {
+				name += "." + string(m[2])
+			}
+			s.entries = append(s.entries, symbolEntry{name: name, kind: p.kind, path: s.path, line: s.line})
+			return
+		}
+	}
+}
+
+// writeSymbolIndexSection lists the symbols by name, so a declaration can
+// be looked up without reading every file.
+func writeSymbolIndexSection(writer *bufio.Writer, entries []symbolEntry, config *Config) error {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := strings.ToLower(entries[i].name), strings.ToLower(entries[j].name)
+		if a != b {
+			return a < b
+		}
+		return entries[i].path < entries[j].path
+	})
+	if _, err := fmt.Fprintf(writer, "%s (%d)\n```\n", symbolIndexMarker, len(entries)); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(writer, "%s %s %s:%d\n", entry.name, entry.kind, config.displayPath(entry.path), entry.line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// symbolSelector picks Go declarations by name. Plain patterns match
+// top-level functions, types, variables and constants; patterns containing a
+// dot match methods as Type.Method. Patterns use path.Match syntax.
+type symbolSelector struct {
+	patterns []string
+	// receivers holds, per package directory, the receiver types of matched
+	// methods so their type declarations are emitted too.
+	receivers map[string]map[string]bool
+}
+
+func newSymbolSelector(patterns []string, files []sourceFile, logger *slog.Logger) *symbolSelector {
+	selector := &symbolSelector{
+		patterns:  patterns,
+		receivers: make(map[string]map[string]bool),
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if filepath.Ext(file.path) != ".go" {
+			continue
+		}
+		src, err := os.ReadFile(file.path)
+		if err != nil {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, file.path, src, parser.SkipObjectResolution)
+		if err != nil {
+			logger.Warn("Could not parse Go file", "path", file.relPath, "error", err)
+			continue
+		}
+
+		dir := filepath.Dir(file.path)
+		for _, decl := range parsed.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil {
+				continue
+			}
+			recv := receiverName(fn)
+			if selector.matches(recv + "." + fn.Name.Name) {
+				if selector.receivers[dir] == nil {
+					selector.receivers[dir] = make(map[string]bool)
+				}
+				selector.receivers[dir][recv] = true
+			}
+		}
+	}
+
+	return selector
+}
+
+func (s *symbolSelector) matches(name string) bool {
+	for _, pattern := range s.patterns {
+		if strings.Contains(pattern, ".") != strings.Contains(name, ".") {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// extract returns the package clause followed by the selected declarations
+// and their doc comments. It reports false when nothing in the file matched.
+func (s *symbolSelector) extract(file sourceFile, src []byte) ([]byte, bool, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file.path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false, err
+	}
+
+	receivers := s.receivers[filepath.Dir(file.path)]
+	var out bytes.Buffer
+	found := false
+	for _, decl := range parsed.Decls {
+		var doc *ast.CommentGroup
+		selected := false
+
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			doc = d.Doc
+			if d.Recv != nil {
+				selected = s.matches(receiverName(d) + "." + d.Name.Name)
+			} else {
+				selected = s.matches(d.Name.Name)
+			}
+		case *ast.GenDecl:
+			doc = d.Doc
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					selected = selected || s.matches(sp.Name.Name) || receivers[sp.Name.Name]
+				case *ast.ValueSpec:
+					for _, name := range sp.Names {
+						selected = selected || s.matches(name.Name)
+					}
+				}
+			}
+		}
+		if !selected {
+			continue
+		}
+
+		if !found {
+			out.WriteString("package " + parsed.Name.Name + "\n")
+			found = true
+		}
+		start := decl.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		out.WriteString("\n")
+		out.Write(src[fset.Position(start).Offset:fset.Position(decl.End()).Offset])
+		out.WriteString("\n")
+	}
+
+	return out.Bytes(), found, nil
+}
+
+// receiverName returns the base type name of a method receiver.
+func receiverName(fn *ast.FuncDecl) string {
+	expr := fn.Recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var errUnauthorized = errors.New("missing or unknown bearer token")
+
+// tenantsFile is the -tenants file of serve: who may call it and with
+// what settings, e.g.
+//
+//	tenants:
+//	  - name: payments
+//	    tokenEnv: PAYMENTS_TOKEN
+//	    roots: [services/payments, libs/shared]
+//	    defaults:
+//	      exclude: node_modules,dist
+//	    maxTokens: 100000
+type tenantsFile struct {
+	Tenants []struct {
+		Name      string            `toml:"name" yaml:"name"`
+		Token     string            `toml:"token" yaml:"token"`
+		TokenEnv  string            `toml:"tokenEnv" yaml:"tokenEnv"`
+		Roots     []string          `toml:"roots" yaml:"roots"`
+		Defaults  map[string]string `toml:"defaults" yaml:"defaults"`
+		MaxTokens int               `toml:"maxTokens" yaml:"maxTokens"`
+	} `toml:"tenants" yaml:"tenants"`
+}
+
+// tenant is a caller of serve identified by its bearer token.
+type tenant struct {
+	name      string
+	tokenHash [sha256.Size]byte
+	roots     []string          // absolute directories it may pack; nil for all the server allows
+	defaults  map[string]string // pack flags applied when a request leaves them out
+	maxTokens int               // cap on -max-tokens, applied when a request sets none
+}
+
+func loadTenants(path, root string) ([]*tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+	var file tenantsFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &file)
+	default:
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tenants: %w", err)
+	}
+	if len(file.Tenants) == 0 {
+		return nil, fmt.Errorf("%s defines no tenants", path)
+	}
+
+	var tenants []*tenant
+	for i, entry := range file.Tenants {
+		t := &tenant{name: entry.Name, defaults: entry.Defaults, maxTokens: entry.MaxTokens}
+		if t.name == "" {
+			t.name = fmt.Sprintf("tenant-%d", i+1)
+		}
+		token := entry.Token
+		if entry.TokenEnv != "" {
+			token = os.Getenv(entry.TokenEnv)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("tenant %s has no token", t.name)
+		}
+		t.tokenHash = sha256.Sum256([]byte(token))
+		for _, dir := range entry.Roots {
+			t.roots = append(t.roots, filepath.Join(root, filepath.FromSlash(dir)))
+		}
+		for name := range t.defaults {
+			if !requestFlags[name] {
+				return nil, fmt.Errorf("tenant %s: %q is not a flag requests may set", t.name, name)
+			}
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
+
+// authenticate finds the tenant of an Authorization header value. Tokens
+// are compared as hashes in constant time.
+func (s *packServer) authenticate(authorization string) (*tenant, error) {
+	if s.tenants == nil {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return nil, errUnauthorized
+	}
+	hash := sha256.Sum256([]byte(token))
+	for _, t := range s.tenants {
+		if subtle.ConstantTimeCompare(hash[:], t.tokenHash[:]) == 1 {
+			return t, nil
+		}
+	}
+	return nil, errUnauthorized
+}
+
+// apply fills in the tenant's defaults and enforces its token cap on the
+// request parameters.
+func (t *tenant) apply(params url.Values) error {
+	if t == nil {
+		return nil
+	}
+	for name, value := range t.defaults {
+		if !params.Has(name) {
+			params.Set(name, value)
+		}
+	}
+	if t.maxTokens > 0 {
+		requested, _ := strconv.Atoi(params.Get("max-tokens"))
+		if requested <= 0 {
+			params.Set("max-tokens", strconv.Itoa(t.maxTokens))
+		} else if requested > t.maxTokens {
+			return fmt.Errorf("max-tokens %d is over the cap of %d for this token", requested, t.maxTokens)
+		}
+	}
+	return nil
+}
+
+// allowedInput reports whether the tenant may pack an absolute input path.
+func (t *tenant) allowedInput(input string) bool {
+	return t == nil || (&serveLimits{allowed: t.roots}).allowedInput(input)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTenants(t *testing.T) {
+	t.Setenv("TENANTS_TEST_TOKEN", "from-env")
+	root := t.TempDir()
+	tests := []struct {
+		name      string
+		file      string
+		data      string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "yaml",
+			file:      "tenants.yaml",
+			data:      "tenants:\n  - name: payments\n    token: secret\n    roots: [services/payments]\n    defaults: {exclude: dist}\n    maxTokens: 1000\n  - tokenEnv: TENANTS_TEST_TOKEN\n",
+			wantNames: []string{"payments", "tenant-2"},
+		},
+		{
+			name:      "toml",
+			file:      "tenants.toml",
+			data:      "[[tenants]]\nname = \"web\"\ntoken = \"secret\"\n",
+			wantNames: []string{"web"},
+		},
+		{"no tenants", "tenants.yaml", "tenants: []\n", nil, true},
+		{"no token", "tenants.yaml", "tenants:\n  - name: a\n", nil, true},
+		{"empty token variable", "tenants.yaml", "tenants:\n  - name: a\n    tokenEnv: TENANTS_TEST_UNSET\n", nil, true},
+		{"default a request may not set", "tenants.yaml", "tenants:\n  - token: x\n    defaults: {output: /etc/passwd}\n", nil, true},
+		{"invalid yaml", "tenants.yaml", "tenants: [", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tenants, err := loadTenants(path, root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTenants error = %v, want error %t", err, tt.wantErr)
+			}
+			if len(tenants) != len(tt.wantNames) {
+				t.Fatalf("%d tenants, want %d", len(tenants), len(tt.wantNames))
+			}
+			for i, loaded := range tenants {
+				if loaded.name != tt.wantNames[i] {
+					t.Errorf("tenant %d is %s, want %s", i, loaded.name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(t.TempDir(), "tenants.yaml")
+	if err := os.WriteFile(path, []byte("tenants:\n  - name: a\n    token: alpha\n  - name: b\n    token: beta\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := loadTenants(path, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &packServer{tenants: tenants}
+	tests := []struct {
+		authorization string
+		want          string
+		wantErr       bool
+	}{
+		{"Bearer alpha", "a", false},
+		{"Bearer beta", "b", false},
+		{"Bearer gamma", "", true},
+		{"Bearer ", "", true},
+		{"Basic YTpi", "", true},
+		{"alpha", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := s.authenticate(tt.authorization)
+		if (err != nil) != tt.wantErr || tt.wantErr && !errors.Is(err, errUnauthorized) {
+			t.Errorf("authenticate(%q) error = %v, want error %t", tt.authorization, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.name != tt.want {
+			t.Errorf("authenticate(%q) = %s, want %s", tt.authorization, got.name, tt.want)
+		}
+	}
+
+	if got, err := (&packServer{}).authenticate(""); got != nil || err != nil {
+		t.Errorf("authenticate without tenants = %v, %v, want no tenant and no error", got, err)
+	}
+}
+
+func TestTenantApply(t *testing.T) {
+	capped := &tenant{name: "a", defaults: map[string]string{"exclude": "dist"}, maxTokens: 1000}
+	tests := []struct {
+		name    string
+		tenant  *tenant
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"defaults and cap filled in", capped, "", "exclude=dist&max-tokens=1000", false},
+		{"request values kept", capped, "exclude=build&max-tokens=500", "exclude=build&max-tokens=500", false},
+		{"cap exceeded", capped, "max-tokens=5000", "", true},
+		{"zero asks for the cap", capped, "max-tokens=0", "exclude=dist&max-tokens=1000", false},
+		{"no tenant", nil, "max-tokens=5000", "max-tokens=5000", false},
+		{"no cap", &tenant{name: "b"}, "max-tokens=5000", "max-tokens=5000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.tenant.apply(params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && params.Encode() != tt.want {
+				t.Errorf("params %s, want %s", params.Encode(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantAllowedInput(t *testing.T) {
+	root := t.TempDir()
+	scoped := &tenant{name: "a", roots: []string{filepath.Join(root, "services", "payments")}}
+	tests := []struct {
+		tenant *tenant
+		input  string
+		want   bool
+	}{
+		{scoped, filepath.Join(root, "services", "payments"), true},
+		{scoped, filepath.Join(root, "services", "payments", "api"), true},
+		{scoped, filepath.Join(root, "services", "payments-old"), false},
+		{scoped, filepath.Join(root, "services"), false},
+		{nil, filepath.Join(root, "anything"), true},
+	}
+	for _, tt := range tests {
+		if got := tt.tenant.allowedInput(tt.input); got != tt.want {
+			t.Errorf("allowedInput(%s) = %t, want %t", tt.input, got, tt.want)
+		}
+	}
+}
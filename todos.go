@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// todoPattern matches TODO-style markers that directly follow a comment
+// token, which keeps identifiers and string literals out of the report.
+var todoPattern = regexp.MustCompile(`(?://|/\*|#|--|<!--|;|^\s*\*)\s*(TODO|FIXME|HACK|XXX)\b(.*)`)
+
+type todoEntry struct {
+	path string
+	line int
+	tag  string
+	text string
+}
+
+// todoCollector gathers TODO/FIXME/HACK/XXX comments from file content as it
+// is streamed to the output.
+type todoCollector struct {
+	entries []todoEntry
+}
+
+// maxTodoLine caps how much of a line is scanned, so that a file without
+// line breaks is not held whole.
+const maxTodoLine = 64 << 10
+
+// todoScanner is an io.Writer that scans one file line by line.
+type todoScanner struct {
+	path    string
+	line    int
+	partial []byte
+	entries []todoEntry
+}
+
+func (c *todoCollector) scan(relPath string) *todoScanner {
+	return &todoScanner{path: relPath}
+}
+
+// commit records the entries of a finished file if it made it into the
+// output.
+func (c *todoCollector) commit(s *todoScanner, keep bool) {
+	s.flush()
+	if keep {
+		c.entries = append(c.entries, s.entries...)
+	}
+}
+
+func (s *todoScanner) Write(p []byte) (int, error) {
+	data := p
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			s.keep(data)
+			return len(p), nil
+		}
+		s.keep(data[:idx])
+		s.scanLine()
+		data = data[idx+1:]
+	}
+}
+
+func (s *todoScanner) keep(data []byte) {
+	if room := maxTodoLine - len(s.partial); room > 0 {
+		s.partial = append(s.partial, data[:min(room, len(data))]...)
+	}
+}
+
+func (s *todoScanner) flush() {
+	if len(s.partial) > 0 {
+		s.scanLine()
+	}
+}
+
+func (s *todoScanner) scanLine() {
+	s.line++
+	line := s.partial
+	s.partial = s.partial[:0]
+
+	match := todoPattern.FindSubmatch(line)
+	if match == nil {
+		return
+	}
+	text := strings.TrimSpace(string(match[2]))
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(text, "*/"), "-->"))
+	text = strings.TrimLeft(text, ":- ")
+	s.entries = append(s.entries, todoEntry{path: s.path, line: s.line, tag: string(match[1]), text: text})
+}
+
+func writeTodoSection(writer *bufio.Writer, entries []todoEntry) error {
+	if _, err := fmt.Fprintf(writer, "## TODO/FIXME Comments (%d)\n```\n", len(entries)); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(writer, "%s:%d: %s %s\n", entry.path, entry.line, entry.tag, entry.text); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(writer, "```\n")
+	return err
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var tokenizers = []string{"approx", "cl100k", "o200k", "llama3"}
+
+// Pre-tokenization patterns of the BPE tokenizers. The originals end in
+// \s+(?!\S)|\s+, which RE2 cannot express; bpeEncoding.pieces gives a
+// whitespace run's last character back to the word after it instead.
+var tokenizerPatterns = map[string]*regexp.Regexp{
+	"cl100k": regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`),
+	"o200k": regexp.MustCompile(`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`),
+	"llama3": regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`),
+}
+
+// tokenizerVocabs are the published vocabularies, downloaded when
+// -tokenizer-vocab is not given, with the SHA-256 they are checked against
+// when downloaded and when loaded. Llama 3's comes with the model weights
+// and has to be given.
+var tokenizerVocabs = map[string]struct{ url, sha256 string }{
+	"cl100k": {"https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken", "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7"},
+	"o200k":  {"https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken", "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d"},
+}
+
+// bpeEncoding counts tokens with byte-pair encoding over a vocabulary of
+// merge ranks. Counts of pieces already seen are cached, so one encoding is
+// shared by every counter of a run and by concurrent server requests.
+type bpeEncoding struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+// loadedEncodings keeps vocabularies loaded once per process, by name and
+// vocabulary file.
+var loadedEncodings sync.Map
+
+// loadTokenizer returns the encoding for -tokenizer, or nil for approx,
+// which estimates four characters per token. vocab is a tiktoken-format
+// file of base64 tokens and their ranks, such as Llama 3's tokenizer.model.
+func loadTokenizer(name, vocab string, logger *slog.Logger) (*bpeEncoding, error) {
+	if name == "approx" {
+		if vocab != "" {
+			return nil, fmt.Errorf("-tokenizer-vocab requires -tokenizer cl100k, o200k or llama3")
+		}
+		return nil, nil
+	}
+	published, pinned := tokenizerVocabs[name]
+	if vocab == "" {
+		if !pinned {
+			return nil, fmt.Errorf("-tokenizer %s requires -tokenizer-vocab, the tokenizer.model that comes with the model", name)
+		}
+		var err error
+		if vocab, err = cachedVocab(published.url, published.sha256, logger); err != nil {
+			return nil, err
+		}
+	}
+	key := name + "\x00" + vocab
+	if e, ok := loadedEncodings.Load(key); ok {
+		return e.(*bpeEncoding), nil
+	}
+	data, err := os.ReadFile(vocab)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokenizer vocabulary: %w", err)
+	}
+	if pinned {
+		if err := checkVocabDigest(data, published.sha256); err != nil {
+			return nil, fmt.Errorf("tokenizer vocabulary %s is not the published %s one: %w", vocab, name, err)
+		}
+	}
+	ranks, err := parseRanks(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer vocabulary %s: %w", vocab, err)
+	}
+	e := &bpeEncoding{name: name, ranks: ranks, pattern: tokenizerPatterns[name], cache: make(map[string]int)}
+	actual, _ := loadedEncodings.LoadOrStore(key, e)
+	return actual.(*bpeEncoding), nil
+}
+
+// parseRanks reads "<base64 token> <rank>" lines.
+func parseRanks(r io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a token and its rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rank: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("no tokens")
+	}
+	return ranks, nil
+}
+
+// checkVocabDigest reports whether data has the SHA-256 want.
+func checkVocabDigest(data []byte, want string) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("SHA-256 %s, want %s", got, want)
+	}
+	return nil
+}
+
+// cachedVocab returns the path of a downloaded vocabulary in the user cache
+// directory, downloading it the first time. A download without the SHA-256
+// want is discarded.
+func cachedVocab(url, want string, logger *slog.Logger) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find a cache directory for the tokenizer vocabulary: %w", err)
+	}
+	dir := filepath.Join(cacheDir, "contextify", "tokenizers")
+	file := filepath.Join(dir, path.Base(url))
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create tokenizer cache: %w", err)
+	}
+
+	logger.Info("Downloading tokenizer vocabulary", "url", url)
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download tokenizer vocabulary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download tokenizer vocabulary: %s", resp.Status)
+	}
+	tmp, err := os.CreateTemp(dir, ".vocab-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download tokenizer vocabulary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return "", fmt.Errorf("downloaded tokenizer vocabulary %s has SHA-256 %s, want %s", url, got, want)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// count returns the number of tokens text encodes to.
+func (e *bpeEncoding) count(text []byte) int {
+	n := 0
+	for _, piece := range e.pieces(text) {
+		n += e.pieceTokens(piece)
+	}
+	return n
+}
+
+// pieces splits text as the tokenizer's pattern does.
+func (e *bpeEncoding) pieces(text []byte) [][]byte {
+	var pieces [][]byte
+	for pos := 0; pos < len(text); {
+		loc := e.pattern.FindIndex(text[pos:])
+		if loc == nil || loc[1] == 0 {
+			// Invalid UTF-8 matches nothing; it becomes a piece of its own
+			pieces = append(pieces, text[pos:pos+1])
+			pos++
+			continue
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if start > pos {
+			pieces = append(pieces, text[pos:start])
+		}
+		// \s+(?!\S): leave the last space of a run for the word after it
+		if end < len(text) && end-start > 1 && isSpaceRun(text[start:end]) && !isSpaceByte(text[end]) && text[end-1] != '\n' && text[end-1] != '\r' {
+			end--
+		}
+		pieces = append(pieces, text[start:end])
+		pos = end
+	}
+	return pieces
+}
+
+func isSpaceRun(b []byte) bool {
+	for _, c := range b {
+		if !isSpaceByte(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func (e *bpeEncoding) pieceTokens(piece []byte) int {
+	if _, ok := e.ranks[string(piece)]; ok {
+		return 1
+	}
+	e.mu.Lock()
+	n, ok := e.cache[string(piece)]
+	e.mu.Unlock()
+	if ok {
+		return n
+	}
+	n = bytePairMerge(piece, e.ranks)
+	e.mu.Lock()
+	if len(e.cache) < 1<<20 {
+		e.cache[string(piece)] = n
+	}
+	e.mu.Unlock()
+	return n
+}
+
+// bytePairMerge starts from single bytes and merges the adjacent pair of
+// lowest rank, the leftmost of equals, until no pair is in the vocabulary,
+// returning the number of parts left. The pairs wait in a heap, so a piece
+// of n bytes takes O(n log n) rather than a scan of every pair per merge.
+func bytePairMerge(piece []byte, ranks map[string]int) int {
+	n := len(piece)
+	// next[i] is where the part starting at i ends, or -1 once merged into
+	// the part before it; prev[i] is where the part before it starts
+	next := make([]int, n)
+	prev := make([]int, n)
+	for i := range n {
+		next[i], prev[i] = i+1, i-1
+	}
+	pairs := &mergeHeap{}
+	push := func(start int) {
+		if start < 0 || next[start] >= n {
+			return
+		}
+		end := next[next[start]]
+		if rank, ok := ranks[string(piece[start:end])]; ok {
+			heap.Push(pairs, mergePair{rank: rank, start: start, end: end})
+		}
+	}
+	for i := range n {
+		push(i)
+	}
+	parts := n
+	for pairs.Len() > 0 {
+		p := heap.Pop(pairs).(mergePair)
+		mid := next[p.start]
+		if mid < 0 || mid >= n || next[mid] != p.end {
+			// A merge since it was pushed changed the pair
+			continue
+		}
+		next[p.start], next[mid] = p.end, -1
+		if p.end < n {
+			prev[p.end] = p.start
+		}
+		parts--
+		push(prev[p.start])
+		push(p.start)
+	}
+	return parts
+}
+
+// mergePair is two adjacent parts, from start to end, that merge into a
+// token of rank.
+type mergePair struct {
+	rank, start, end int
+}
+
+type mergeHeap []mergePair
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].start < h[j].start
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergePair)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
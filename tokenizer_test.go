@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBytePairMerge(t *testing.T) {
+	ranks := map[string]int{
+		"ab": 0, "cd": 1, "abcd": 2, "aa": 3, "aaa": 4, "bc": 5, "abc": 6,
+	}
+	tests := []struct {
+		piece string
+		want  int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"ab", 1},
+		{"abcd", 1},
+		{"abcdx", 2},
+		// ab (0) goes before bc (5), then abc (6) is there to merge with
+		{"abc", 1},
+		// The leftmost of equal pairs merges first: aa|a, then aaa
+		{"aaa", 1},
+		{"aaaa", 2},
+		{"xyz", 3},
+		{"abxab", 3},
+	}
+	for _, tt := range tests {
+		if got := bytePairMerge([]byte(tt.piece), ranks); got != tt.want {
+			t.Errorf("bytePairMerge(%q) = %d, want %d", tt.piece, got, tt.want)
+		}
+	}
+}
+
+func TestBytePairMergeLongPiece(t *testing.T) {
+	// A merge per pass over every pair took minutes on a piece this long
+	ranks := map[string]int{"ab": 0, "abab": 1}
+	piece := []byte(strings.Repeat("ab", 1<<17) + "c")
+	if got, want := bytePairMerge(piece, ranks), 1<<16+1; got != want {
+		t.Errorf("bytePairMerge = %d, want %d", got, want)
+	}
+}
+
+func TestCheckVocabDigest(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", false},
+		{"YQ== 0\n", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", true},
+		{"", tokenizerVocabs["cl100k"].sha256, true},
+	}
+	for _, tt := range tests {
+		if err := checkVocabDigest([]byte(tt.data), tt.want); (err != nil) != tt.wantErr {
+			t.Errorf("checkVocabDigest(%q) error = %v, want error %t", tt.data, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadTokenizerRejectsUnpublishedVocab(t *testing.T) {
+	vocab := filepath.Join(t.TempDir(), "cl100k_base.tiktoken")
+	if err := os.WriteFile(vocab, []byte("YQ== 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTokenizer("cl100k", vocab, slog.Default()); err == nil {
+		t.Error("loadTokenizer accepted a vocabulary that is not the published one")
+	}
+}
+
+// TestTokenCountsMatchTiktoken compares counts with those tiktoken gives for
+// the same text. It needs the published vocabularies in the cache, where a
+// run with -tokenizer cl100k or o200k downloads them.
+func TestTokenCountsMatchTiktoken(t *testing.T) {
+	tests := []struct {
+		tokenizer string
+		text      string
+		want      int
+	}{
+		{"cl100k", "", 0},
+		{"cl100k", "hello world", 2},
+		{"cl100k", "package main\n\nfunc main() {\n\tfmt.Println(\"Hello, 世界\")\n}\n", 18},
+		{"cl100k", "    indented   text\n\n\n  with\ttabs and trailing spaces   \n", 14},
+		{"cl100k", "I'm sure they'll say it's 12345678 or 3.14159, won't they?", 23},
+		{"cl100k", "Ünïcödé naïve café — “quotes” 🙂🙃 日本語のテキスト", 26},
+		{"cl100k", "def f(x):\n    return {'a': [1, 2, 3], \"b\": x ** 2}  # comment\n", 30},
+		{"cl100k", "SELECT id, name FROM users WHERE created_at > '2024-01-01';", 18},
+		{"cl100k", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", 9},
+		{"cl100k", "<|endoftext|> is plain text here", 11},
+		{"o200k", "", 0},
+		{"o200k", "hello world", 2},
+		{"o200k", "package main\n\nfunc main() {\n\tfmt.Println(\"Hello, 世界\")\n}\n", 15},
+		{"o200k", "    indented   text\n\n\n  with\ttabs and trailing spaces   \n", 14},
+		{"o200k", "I'm sure they'll say it's 12345678 or 3.14159, won't they?", 19},
+		{"o200k", "Ünïcödé naïve café — “quotes” 🙂🙃 日本語のテキスト", 21},
+		{"o200k", "def f(x):\n    return {'a': [1, 2, 3], \"b\": x ** 2}  # comment\n", 30},
+		{"o200k", "SELECT id, name FROM users WHERE created_at > '2024-01-01';", 18},
+		{"o200k", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", 9},
+		{"o200k", "<|endoftext|> is plain text here", 11},
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tt := range tests {
+		url := tokenizerVocabs[tt.tokenizer].url
+		vocab := filepath.Join(cacheDir, "contextify", "tokenizers", filepath.Base(url))
+		if _, err := os.Stat(vocab); err != nil {
+			t.Skipf("no cached %s vocabulary: %v", tt.tokenizer, err)
+		}
+		e, err := loadTokenizer(tt.tokenizer, vocab, slog.Default())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.count([]byte(tt.text)); got != tt.want {
+			t.Errorf("%s count(%q) = %d, want %d", tt.tokenizer, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+// tokenCounter is an io.Writer that counts the tokens written: with a BPE
+// encoding for -tokenizer, or else estimated with the common approximation
+// of four characters per token. It also counts characters and lines.
+type tokenCounter struct {
+	runes    int
+	newlines int
+	last     byte
+
+	bpe     *bpeEncoding
+	pending []byte // text not yet encoded
+	encoded int    // tokens of the text before pending
+}
+
+func (t *tokenCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		// Count rune starts so multi-byte characters split across writes
+		// are counted once
+		if b&0xC0 != 0x80 {
+			t.runes++
+		}
+		if b == '\n' {
+			t.newlines++
+		}
+	}
+	if len(p) > 0 {
+		t.last = p[len(p)-1]
+	}
+	if t.bpe != nil {
+		t.pending = append(t.pending, p...)
+		// No piece spans a newline followed by something other than
+		// whitespace, so the text up to there encodes the same on its own
+		for i := len(t.pending) - 1; i > 0; i-- {
+			if t.pending[i-1] == '\n' && !isSpaceByte(t.pending[i]) {
+				t.encoded += t.bpe.count(t.pending[:i])
+				t.pending = append(t.pending[:0], t.pending[i:]...)
+				break
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tokenCounter) tokens() int {
+	if t.bpe != nil {
+		return t.encoded + t.bpe.count(t.pending)
+	}
+	return (t.runes + 3) / 4
+}
+
+// lines counts a final line without a newline too.
+func (t *tokenCounter) lines() int {
+	if t.runes > 0 && t.last != '\n' {
+		return t.newlines + 1
+	}
+	return t.newlines
+}
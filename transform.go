@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// contentTransform rewrites the content of matching files before it is
+// written. apply reports false to leave the file out of the output. A
+// transform may instead set stream to consume the raw file without it being
+// buffered first; streaming transforms run before all others. lineSafe
+// marks transforms that work line by line, so they can run on line-aligned
+// chunks of a file too large to buffer.
+type contentTransform struct {
+	name     string
+	applies  func(src sourceFile) bool
+	apply    func(src sourceFile, data []byte) ([]byte, bool, error)
+	stream   func(src sourceFile, r io.Reader) ([]byte, error)
+	lineSafe bool
+}
+
+// buildTransforms returns the content transforms enabled in config, in the
+// order they run.
+func buildTransforms(config *Config) []contentTransform {
+	var transforms []contentTransform
+
+	if config.sampleData > 0 {
+		transforms = append(transforms, contentTransform{
+			name:    "sample-data",
+			applies: hasExtension(".csv", ".tsv", ".jsonl", ".ndjson"),
+			stream: func(src sourceFile, r io.Reader) ([]byte, error) {
+				hasHeader := hasExtension(".csv", ".tsv")(src)
+				return sampleData(r, config.sampleData, hasHeader)
+			},
+		})
+	}
+
+	// Images are described, like binary documents are converted, before
+	// text decoding
+	if config.images != "" {
+		transforms = append(transforms, contentTransform{
+			name:    "images",
+			applies: hasExtension(imageExtensions...),
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				if config.format == "multimodal" {
+					return imageReference(src, data, config), true, nil
+				}
+				return imagePlaceholder(src, data, config.images), true, nil
+			},
+		})
+	}
+
+	// Binary document formats are converted before text decoding
+	if config.extractDocs {
+		transforms = append(transforms, contentTransform{
+			name:    "docx",
+			applies: hasExtension(".docx"),
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				text, err := extractDocx(data)
+				return text, true, err
+			},
+		}, contentTransform{
+			name:    "pdf",
+			applies: hasExtension(".pdf"),
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				text, err := extractPDF(data)
+				return text, true, err
+			},
+		})
+	}
+
+	transforms = append(transforms, contentTransform{
+		name:     "encoding",
+		applies:  func(sourceFile) bool { return true },
+		lineSafe: true,
+		apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+			decoded, name := decodeText(data)
+			if name != "" {
+				if name != "utf-8" {
+					config.logger.Debug("Converted file to UTF-8", "path", src.relPath, "encoding", name)
+				}
+				return decoded, true, nil
+			}
+
+			switch config.undecodable {
+			case "skip":
+				config.logger.Debug("Skipping undecodable file", "path", src.relPath)
+				return nil, false, nil
+			case "replace":
+				return bytes.ToValidUTF8(data, []byte("\uFFFD")), true, nil
+			default:
+				return data, true, nil
+			}
+		},
+	})
+
+	if config.normalize.enabled() {
+		transforms = append(transforms, contentTransform{
+			name:     "normalize",
+			applies:  func(sourceFile) bool { return true },
+			lineSafe: true,
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return normalizeWhitespace(data, config.normalize), true, nil
+			},
+		})
+	}
+
+	// Duplicate blocks refer to the file as written too; files cut to error
+	// regions or line ranges keep them
+	if config.collapseDupes && len(config.duplicateBlocks) > 0 {
+		byPath := make(map[string][]duplicateBlock)
+		for _, b := range config.duplicateBlocks {
+			byPath[b.path] = append(byPath[b.path], b)
+		}
+		transforms = append(transforms, contentTransform{
+			name: "collapse-dupes",
+			applies: func(src sourceFile) bool {
+				return len(byPath[src.relPath]) > 0 && len(config.errorLines[src.relPath]) == 0 && len(config.lineRanges[src.relPath]) == 0
+			},
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return collapseDuplicates(data, byPath[src.relPath]), true, nil
+			},
+		})
+	}
+
+	// Error lines refer to the file as written, so the regions are cut
+	// before anything else changes its lines
+	if config.errorContext > 0 {
+		transforms = append(transforms, contentTransform{
+			name:    "error-regions",
+			applies: func(src sourceFile) bool { return len(config.errorLines[src.relPath]) > 0 },
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return errorRegions(data, config.errorLines[src.relPath], config.errorContext), true, nil
+			},
+		})
+	}
+
+	// Listed line ranges too refer to the file as written
+	if len(config.lineRanges) > 0 {
+		transforms = append(transforms, contentTransform{
+			name:    "line-ranges",
+			applies: func(src sourceFile) bool { return len(config.lineRanges[src.relPath]) > 0 },
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return keepLines(data, config.lineRanges[src.relPath], 0), true, nil
+			},
+		})
+	}
+
+	transforms = append(transforms, contentTransform{
+		name:    "source-markers",
+		applies: func(sourceFile) bool { return true },
+		apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+			data, keep := applySourceMarkers(data, config.regionsOnly)
+			if !keep {
+				config.logger.Debug("Skipping file marked contextify:ignore-file", "path", src.relPath)
+			}
+			return data, keep, nil
+		},
+	})
+
+	transforms = append(transforms, contentTransform{
+		name:    "notebook",
+		applies: hasExtension(".ipynb"),
+		apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+			converted, err := convertNotebook(data, config.notebookOutputs)
+			return converted, true, err
+		},
+	})
+
+	if config.stripLicenseHeaders {
+		transforms = append(transforms, contentTransform{
+			name:    "strip-license",
+			applies: func(sourceFile) bool { return true },
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return stripLicenseHeader(data), true, nil
+			},
+		})
+	}
+
+	if config.symbolSelector != nil {
+		transforms = append(transforms, contentTransform{
+			name:    "symbols",
+			applies: hasExtension(".go"),
+			apply:   config.symbolSelector.extract,
+		})
+	}
+
+	if config.condenseLocales {
+		transforms = append(transforms, contentTransform{
+			name:    "condense-locales",
+			applies: func(src sourceFile) bool { return condensesLocale(src, config.locales) },
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return condenseLocale(src, data, config.locales)
+			},
+		})
+	}
+
+	if config.condenseSchemas {
+		transforms = append(transforms, contentTransform{
+			name:    "condense-schema",
+			applies: hasExtension(".proto", ".yaml", ".yml", ".json"),
+			apply:   condenseSchema,
+		})
+	}
+
+	if config.sqlSchema {
+		transforms = append(transforms, contentTransform{
+			name:    "sql-schema",
+			applies: hasExtension(".sql"),
+			apply:   sqlSchemaView,
+		})
+	}
+
+	if config.mode == "docs" {
+		transforms = append(transforms, contentTransform{
+			name:    "docs",
+			applies: func(sourceFile) bool { return true },
+			apply:   docView,
+		})
+	}
+
+	if config.stripConfigValues {
+		transforms = append(transforms, contentTransform{
+			name:    "strip-config-values",
+			applies: func(src sourceFile) bool { return infraConfigKind(src.relPath) != "" },
+			apply:   stripConfigValues,
+		})
+	}
+
+	// Custom transforms see the content the built-in views produce and are
+	// still subject to redaction, truncation and anonymization
+	if config.transform != "" {
+		transforms = append(transforms, commandTransform(config.transform))
+	}
+
+	// Redact before truncating so that no secret is cut into an
+	// unrecognisable fragment
+	if config.redactor != nil {
+		transforms = append(transforms, contentTransform{
+			name:    "redact",
+			applies: func(sourceFile) bool { return true },
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return config.redactor.redact(src.relPath, data), true, nil
+			},
+		})
+	}
+
+	// Summaries are asked for with secrets already redacted, and make
+	// truncation unnecessary
+	if config.summarizer != nil {
+		transforms = append(transforms, contentTransform{
+			name:    "summarize",
+			applies: func(sourceFile) bool { return true },
+			apply:   config.summarizer.summarize,
+		})
+	}
+
+	if config.maxFileSize > 0 {
+		transforms = append(transforms, contentTransform{
+			name:    "truncate",
+			applies: func(sourceFile) bool { return true },
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				if int64(len(data)) > config.maxFileSize {
+					config.logger.Debug("Truncating file", "path", src.relPath, "size", len(data), "strategy", config.truncate)
+				}
+				return truncateContent(src.relPath, data, int(config.maxFileSize), config.truncate), true, nil
+			},
+		})
+	}
+
+	if config.anonymizer != nil {
+		transforms = append(transforms, contentTransform{
+			name:     "anonymize",
+			applies:  func(sourceFile) bool { return true },
+			lineSafe: true,
+			apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+				return []byte(config.anonymizer.apply(string(data))), true, nil
+			},
+		})
+	}
+
+	// Strict checks see exactly what will be written
+	if config.strict != nil {
+		transforms = append(transforms, contentTransform{
+			name:    "strict",
+			applies: func(sourceFile) bool { return true },
+			apply:   config.strict.check,
+		})
+	}
+
+	return transforms
+}
+
+func hasExtension(exts ...string) func(src sourceFile) bool {
+	return func(src sourceFile) bool {
+		ext := strings.ToLower(filepath.Ext(src.path))
+		for _, e := range exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// transformContent applies the content transforms enabled in config. Files
+// that need no transform are streamed unchanged, and files larger than
+// -max-memory are never held whole. It reports false when the
+// file should be left out of the output. A failing transform leaves the
+// file out too, with a skipError: passing on the content it did not
+// transform could leak what a redaction hook removes.
+func transformContent(src sourceFile, r io.Reader, config *Config) (io.Reader, bool, error) {
+	var active []contentTransform
+	for _, t := range config.transforms {
+		if t.applies(src) {
+			active = append(active, t)
+		}
+	}
+	if len(active) == 0 {
+		return r, true, nil
+	}
+
+	var data []byte
+	var err error
+	if first := active[0]; first.stream != nil {
+		data, err = first.stream(src, r)
+		active = active[1:]
+	} else if size := fileSize(src.path); config.maxMemory > 0 && size > config.maxMemory {
+		return boundedContent(src, r, size, active, config)
+	} else {
+		data, err = io.ReadAll(r)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	for _, t := range active {
+		transformed, keep, err := t.apply(src, data)
+		if err != nil {
+			return nil, false, &skipError{fmt.Errorf("%s transform failed: %w", t.name, err)}
+		}
+		if !keep {
+			return nil, false, nil
+		}
+		data = transformed
+	}
+	return bytes.NewReader(data), true, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// transformDropStatus is the exit status with which a -transform-cmd
+// leaves the file out of the output.
+const transformDropStatus = 3
+
+// commandTransform runs a user command on each file's content: the content
+// arrives on stdin and stdout replaces it. CONTEXTIFY_PATH holds the
+// relative path and CONTEXTIFY_FILE the path on disk, so the command can
+// decide per file. Exiting with transformDropStatus leaves the file out;
+// any other failure leaves it out too and marks the run partial, since the
+// content the command did not see through must not be packed.
+func commandTransform(line string) contentTransform {
+	return contentTransform{
+		name:    "transform-cmd",
+		applies: func(sourceFile) bool { return true },
+		apply: func(src sourceFile, data []byte) ([]byte, bool, error) {
+			cmd := shellCommand(context.Background(), line)
+			cmd.Env = append(os.Environ(), "CONTEXTIFY_PATH="+src.relPath, "CONTEXTIFY_FILE="+src.path)
+			cmd.Stdin = bytes.NewReader(data)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			if err := cmd.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) && exitErr.ExitCode() == transformDropStatus {
+					return nil, false, nil
+				}
+				return nil, true, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			return stdout.Bytes(), true, nil
+		},
+	}
+}
+
+// shellCommand runs a command line through the platform shell.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
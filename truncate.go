@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var truncateStrategies = []string{"head", "tail", "middle", "smart"}
+
+// truncateContent shortens data to at most limit bytes, cutting on line
+// boundaries. head keeps the beginning, tail keeps the end, middle keeps both
+// ends and smart keeps imports, signatures and top-level comments while
+// eliding function bodies.
+func truncateContent(relPath string, data []byte, limit int, strategy string) []byte {
+	if len(data) <= limit {
+		return data
+	}
+
+	switch strategy {
+	case "tail":
+		keep := data[len(data)-limit:]
+		if idx := bytes.IndexByte(keep, '\n'); idx >= 0 {
+			keep = keep[idx+1:]
+		}
+		return append([]byte(truncationMarker(len(data)-len(keep))+"\n"), keep...)
+	case "middle":
+		head := cutAtLine(data[:limit/2])
+		tail := data[len(data)-limit/2:]
+		if idx := bytes.IndexByte(tail, '\n'); idx >= 0 {
+			tail = tail[idx+1:]
+		}
+		var out bytes.Buffer
+		out.Write(head)
+		out.WriteString(truncationMarker(len(data)-len(head)-len(tail)) + "\n")
+		out.Write(tail)
+		return out.Bytes()
+	case "smart":
+		outlined := outlineSource(relPath, data)
+		if outlined == nil {
+			outlined = elideIndentedBlocks(data)
+		}
+		if len(outlined) <= limit {
+			return outlined
+		}
+		return truncateContent(relPath, outlined, limit, "head")
+	default:
+		head := cutAtLine(data[:limit])
+		return append(head, []byte(truncationMarker(len(data)-len(head)))...)
+	}
+}
+
+func truncationMarker(omitted int) string {
+	return fmt.Sprintf("... [truncated: %d bytes omitted] ...", omitted)
+}
+
+// cutAtLine drops the trailing partial line of data.
+func cutAtLine(data []byte) []byte {
+	if idx := bytes.LastIndexByte(data, '\n'); idx >= 0 {
+		return data[:idx+1]
+	}
+	return data
+}
+
+// elideGoBodies replaces every function body with "{ ... }". It returns nil
+// when the source does not parse.
+func elideGoBodies(src []byte) []byte {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	type span struct{ start, end int }
+	var bodies []span
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			if fn.Body != nil {
+				bodies = append(bodies, span{fset.Position(fn.Body.Lbrace).Offset, fset.Position(fn.Body.Rbrace).Offset + 1})
+			}
+			return false
+		case *ast.FuncLit:
+			bodies = append(bodies, span{fset.Position(fn.Body.Lbrace).Offset, fset.Position(fn.Body.Rbrace).Offset + 1})
+			return false
+		}
+		return true
+	})
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].start < bodies[j].start })
+
+	var out bytes.Buffer
+	last := 0
+	for _, body := range bodies {
+		out.Write(src[last:body.start])
+		out.WriteString("{ ... }")
+		last = body.end
+	}
+	out.Write(src[last:])
+	return out.Bytes()
+}
+
+var signaturePattern = regexp.MustCompile(`^\s*(?:(?:export|public|private|protected|internal|static|async|abstract|override|pub(?:\([a-z]+\))?|default)\s+)*(?:def|class|func|function|fn|interface|struct|enum|trait|impl|type|module|namespace)\b`)
+
+// elideIndentedBlocks is the language-agnostic fallback of the smart
+// strategy: top-level lines and declaration signatures are kept, and runs of
+// other indented lines collapse to a single "..." line.
+func elideIndentedBlocks(src []byte) []byte {
+	var out bytes.Buffer
+	elided := false
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if len(trimmed) == len(line) || strings.TrimSpace(line) == "" || signaturePattern.MatchString(line) {
+			out.WriteString(line)
+			elided = false
+			continue
+		}
+		if !elided {
+			out.WriteString(line[:len(line)-len(trimmed)] + "...\n")
+			elided = true
+		}
+	}
+	return out.Bytes()
+}
+
+// parseSize parses a byte size such as "512", "100KB" or "1.5MB". Units are
+// powers of 1024.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		value  int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s = strings.TrimSpace(number)
+			multiplier = unit.value
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
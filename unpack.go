@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	fileMarker  = "## File: "
+	blockFence  = "```\n"
+	blockEnd    = "\n```\n\n"
+	todoMarker  = "## TODO/FIXME Comments"
+	cancelNoted = "\n# Output incomplete"
+)
+
+// trailingMarkers start the sections that may follow the file blocks.
+var trailingMarkers = []string{todoMarker, manifestMarker, sqlSchemaMarker, cancelNoted, symbolIndexMarker, dupesMarker, apiSurfaceMarker, issueRefsMarker, fixturesMarker}
+
+// packedFile is a file block read back from a context file.
+type packedFile struct {
+	path     string
+	metadata string // the metadata line, if any, with its newline
+	content  []byte
+}
+
+func setupUnpack(fs *flag.FlagSet) func(args []string) int {
+	dir := fs.String("dir", ".", "Directory to recreate the files in")
+	force := fs.Bool("force", false, "Overwrite files that already exist")
+	dryRun := fs.Bool("dry-run", false, "List the files without writing them")
+	lf := registerLogFlags(fs)
+
+	return func(args []string) int {
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		input := "context.txt"
+		switch len(args) {
+		case 0:
+		case 1:
+			input = args[0]
+		default:
+			logger.Error("Expected at most one context file", "args", args)
+			return exitFailure
+		}
+
+		var data []byte
+		if input == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(input)
+		}
+		if err != nil {
+			logger.Error("Failed to read context file", "error", err)
+			return exitFailure
+		}
+
+		files, err := parseContext(data)
+		if err != nil {
+			logger.Error("Failed to parse context file", "error", err)
+			return exitFailure
+		}
+		if len(files) == 0 {
+			logger.Warn("No file blocks found", "input", input)
+			return exitNothingMatched
+		}
+
+		for _, file := range files {
+			if *dryRun {
+				fmt.Printf("%s (%d bytes)\n", file.path, len(file.content))
+				continue
+			}
+			if err := writeUnpacked(*dir, file, *force); err != nil {
+				logger.Error("Failed to unpack file", "path", file.path, "error", err)
+				return exitFailure
+			}
+			logger.Debug("File unpacked", "path", file.path, "bytes", len(file.content))
+		}
+		if !*dryRun {
+			logger.Info("Successfully unpacked context file", "files", len(files), "dir", *dir)
+		}
+		return exitSuccess
+	}
+}
+
+// parseContext splits a context file into its file blocks. File content is
+// not escaped, so a block ends at the first closing fence that is followed
+// by another block, the TODO section, a cancellation note or the end of the
+// file.
+func parseContext(data []byte) ([]packedFile, error) {
+	files, _, _, err := parseContextBlocks(data)
+	return files, err
+}
+
+// parseContextBlocks is parseContext that also returns where the file
+// blocks start and end, so that the header and trailing sections can be
+// told apart. Contexts of a newer format version are refused.
+func parseContextBlocks(data []byte) (files []packedFile, start, end int, err error) {
+	version, err := contextFormatVersion(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	pos := 0
+	if !bytes.HasPrefix(data, []byte(fileMarker)) {
+		idx := bytes.Index(data, []byte("\n"+fileMarker))
+		if idx < 0 {
+			return nil, len(data), len(data), nil
+		}
+		pos = idx + 1
+	}
+	start = pos
+
+	for pos < len(data) {
+		path, contentStart, ok := blockStart(data[pos:])
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("malformed file block at byte %d", pos)
+		}
+		contentStart += pos
+
+		contentEnd := -1
+		for search := contentStart; ; {
+			idx := bytes.Index(data[search:], []byte(blockEnd))
+			if idx < 0 {
+				break
+			}
+			idx += search
+			if rest := data[idx+len(blockEnd):]; isBlockBoundary(rest, version) {
+				contentEnd = idx
+				break
+			}
+			search = idx + 1
+		}
+		if contentEnd < 0 {
+			return nil, 0, 0, fmt.Errorf("unterminated block for %s", path)
+		}
+
+		nl := pos + bytes.IndexByte(data[pos:], '\n') + 1
+		files = append(files, packedFile{path: path, metadata: string(data[nl : contentStart-len(blockFence)]), content: data[contentStart:contentEnd]})
+
+		pos = contentEnd + len(blockEnd)
+		if !bytes.HasPrefix(data[pos:], []byte(fileMarker)) {
+			break
+		}
+	}
+	return files, start, pos, nil
+}
+
+// blockStart parses a "## File:" line, an optional metadata line and the
+// opening fence, returning the path and the offset of the content.
+func blockStart(data []byte) (string, int, bool) {
+	if !bytes.HasPrefix(data, []byte(fileMarker)) {
+		return "", 0, false
+	}
+	nl := bytes.IndexByte(data, '\n')
+	if nl < 0 {
+		return "", 0, false
+	}
+	fence := nl + 1
+	if bytes.HasPrefix(data[fence:], []byte(metadataPrefix)) {
+		end := bytes.IndexByte(data[fence:], '\n')
+		if end < 0 {
+			return "", 0, false
+		}
+		fence += end + 1
+	}
+	if !bytes.HasPrefix(data[fence:], []byte(blockFence)) {
+		return "", 0, false
+	}
+	return string(data[len(fileMarker):nl]), fence + len(blockFence), true
+}
+
+// isBlockBoundary reports whether rest starts what may follow a file
+// block. The metadata section only ends blocks from format version 1 on.
+func isBlockBoundary(rest []byte, version int) bool {
+	if len(rest) == 0 {
+		return true
+	}
+	for _, marker := range trailingMarkers {
+		if bytes.HasPrefix(rest, []byte(marker)) {
+			return true
+		}
+	}
+	if version >= 1 && bytes.HasPrefix(rest, []byte(metadataMarker)) {
+		return true
+	}
+	_, _, ok := blockStart(rest)
+	return ok
+}
+
+// writeUnpacked writes file below dir. Paths that would escape dir are
+// rejected.
+func writeUnpacked(dir string, file packedFile, force bool) error {
+	if windowsPaths && hasReservedName(file.path) {
+		return fmt.Errorf("refusing to write a reserved Windows device name: %s", file.path)
+	}
+	rel := filepath.FromSlash(file.path)
+	if !filepath.IsLocal(rel) {
+		return fmt.Errorf("refusing to write outside the target directory: %s", file.path)
+	}
+	target := filepath.Join(dir, rel)
+
+	if !force {
+		if _, err := os.Lstat(target); err == nil {
+			return fmt.Errorf("%s already exists (use -force to overwrite)", target)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return os.WriteFile(target, file.content, 0o644)
+}
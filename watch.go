@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func setupWatch(fs *flag.FlagSet) func(args []string) int {
+	pf := registerPackFlags(fs)
+	lf := registerLogFlags(fs)
+	interval := fs.Duration("interval", time.Second, "How often to check the input directory for changes")
+
+	return func(args []string) int {
+		if !noArgs("watch", args) {
+			return exitFailure
+		}
+		logger, closeLog, err := lf.logger()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contextify:", err)
+			return exitFailure
+		}
+		defer closeLog()
+
+		// Validate once up front; every pack builds a fresh config so that
+		// per-run state does not carry over
+		validated, err := pf.config(logger)
+		if err != nil {
+			logger.Error("Invalid flags", "error", err)
+			return exitFailure
+		}
+		if isRemoteInput(*pf.inputPath) {
+			logger.Error("watch needs a local input directory", "input", *pf.inputPath)
+			return exitFailure
+		}
+		if *pf.filesFrom == "-" || *pf.fromErrors == "-" || *pf.fromTrace == "-" {
+			logger.Error("stdin cannot be read more than once; pass -files-from, -from-errors or -from-trace a file to watch")
+			return exitFailure
+		}
+		// What a pack writes must not trigger the next one
+		ignore := ownOutputs(validated)
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		logger.Info("Watching for changes", "input", *pf.inputPath, "interval", *interval)
+		var last uint64
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for first := true; ; first = false {
+			if !first {
+				select {
+				case <-ctx.Done():
+					logger.Info("Stopped watching")
+					return exitSuccess
+				case <-ticker.C:
+				}
+			}
+
+			sum, err := snapshotTree(ctx, *pf.inputPath, ignore)
+			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				logger.Error("Failed to scan input directory", "error", err)
+				return exitFailure
+			}
+			if !first && sum == last {
+				continue
+			}
+			last = sum
+
+			config, err := pf.config(logger)
+			if err != nil {
+				logger.Error("Invalid flags", "error", err)
+				return exitFailure
+			}
+			code, err := pack(ctx, config, "none", *pf.resultJSON)
+			if code == exitCancelled {
+				continue
+			}
+			logOutcome(logger, config, code, err)
+		}
+	}
+}
+
+// snapshotTree hashes the names, sizes and modification times of the files
+// below root, so that any change to the tree changes the sum.
+func snapshotTree(ctx context.Context, root string, ignored func(string) bool) (uint64, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	err = filepath.WalkDir(absRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ignored(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Deleted while walking; the next scan sees the result
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64(), err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// wellKnownNames are files identified by name rather than extension. They
+// are kept when -extensions is set, since no extension list would match
+// them.
+var wellKnownNames = []string{
+	"Dockerfile", "Containerfile", "Makefile", "GNUmakefile", "Jenkinsfile", "Rakefile", "Gemfile",
+	"Procfile", "Vagrantfile", "Brewfile", "Justfile", "Taskfile", "BUILD", "WORKSPACE",
+	"LICENSE", "LICENCE", "COPYING", "NOTICE", "README", "CHANGELOG", "CONTRIBUTING", "CODEOWNERS",
+	"go.mod", "go.work", ".gitignore", ".gitattributes", ".dockerignore", ".editorconfig",
+	".npmrc", ".nvmrc", ".python-version", ".tool-versions", ".env.example", ".contextifyignore",
+}
+
+// includeNames resolves -include-names: the well-known names plus any
+// listed, or only those listed after "none".
+func includeNames(spec string) []string {
+	listed := parseCommaSeparated(spec)
+	if slices.Contains(listed, "none") {
+		return slices.DeleteFunc(listed, func(name string) bool { return name == "none" })
+	}
+	return append(slices.Clone(wellKnownNames), listed...)
+}
+
+// matchesName reports whether a file's base name is one of names, ignoring
+// case. Names without an extension also match variants such as
+// Dockerfile.dev or LICENSE.md; those compare case-sensitively, so that
+// LICENSE does not match license.go.
+func matchesName(relPath string, names []string) bool {
+	base := filepath.Base(relPath)
+	for _, name := range names {
+		if strings.EqualFold(base, name) {
+			return true
+		}
+		if filepath.Ext(name) == "" && !strings.HasPrefix(name, ".") && strings.HasPrefix(base, name+".") {
+			return true
+		}
+	}
+	return false
+}
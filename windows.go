@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// contextWindow is a context size common to a family of models.
+type contextWindow struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+	Models string `json:"models"`
+}
+
+var contextWindows = []contextWindow{
+	{"8k", 8_192, "GPT-4, Llama 3"},
+	{"32k", 32_768, "GPT-4-32k, Mistral 7B"},
+	{"128k", 128_000, "GPT-4o, Llama 3.1"},
+	{"200k", 200_000, "Claude, o3"},
+	{"1M", 1_000_000, "Gemini 1.5 Pro, GPT-4.1"},
+}
+
+// windowFit is the -windows report: the windows the output fits, and for
+// the largest window it does not, the directories whose exclusion would
+// bring it under.
+type windowFit struct {
+	Tokens   int             `json:"tokens"`
+	Fits     []contextWindow `json:"fits"`
+	Next     *contextWindow  `json:"next,omitempty"`
+	Over     int             `json:"over,omitempty"`
+	Excludes []dirTokens     `json:"excludes,omitempty"`
+}
+
+type dirTokens struct {
+	Dir    string `json:"dir"`
+	Tokens int    `json:"tokens"`
+}
+
+// fitWindows compares the output's tokens with the common windows. The
+// suggested exclusions are the smallest directory that would be enough on
+// its own or, when none is, the largest directories in turn.
+func fitWindows(tokens int, files []manifestEntry) *windowFit {
+	fit := &windowFit{Tokens: tokens, Fits: []contextWindow{}}
+	for i, w := range contextWindows {
+		if tokens <= w.Tokens {
+			fit.Fits = append(fit.Fits, w)
+		} else {
+			fit.Next = &contextWindows[i]
+		}
+	}
+	if fit.Next == nil {
+		return fit
+	}
+	fit.Over = tokens - fit.Next.Tokens
+
+	byDir := make(map[string]int)
+	for _, file := range files {
+		for dir := path.Dir(file.Path); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			byDir[dir] += file.Tokens
+		}
+	}
+	dirs := make([]dirTokens, 0, len(byDir))
+	for dir, n := range byDir {
+		dirs = append(dirs, dirTokens{dir, n})
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].Tokens != dirs[j].Tokens {
+			return dirs[i].Tokens > dirs[j].Tokens
+		}
+		return dirs[i].Dir < dirs[j].Dir
+	})
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if dirs[i].Tokens >= fit.Over {
+			fit.Excludes = []dirTokens{dirs[i]}
+			return fit
+		}
+	}
+	freed := 0
+	for _, d := range dirs {
+		if freed >= fit.Over {
+			break
+		}
+		if insideAny(fit.Excludes, d.Dir) {
+			continue
+		}
+		fit.Excludes = append(fit.Excludes, d)
+		freed += d.Tokens
+	}
+	if freed < fit.Over {
+		// Files outside any directory make up the rest
+		fit.Excludes = nil
+	}
+	return fit
+}
+
+// insideAny reports whether dir is inside a directory of dirs.
+func insideAny(dirs []dirTokens, dir string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(dir, d.Dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeWindowFit(w io.Writer, fit *windowFit) {
+	if len(fit.Fits) == 0 {
+		fmt.Fprintf(w, "~%d tokens: too large for every common context window\n", fit.Tokens)
+	} else {
+		names := make([]string, len(fit.Fits))
+		for i, window := range fit.Fits {
+			names[i] = fmt.Sprintf("%s (%s)", window.Name, window.Models)
+		}
+		fmt.Fprintf(w, "~%d tokens: fits %s\n", fit.Tokens, strings.Join(names, ", "))
+	}
+	if fit.Next == nil {
+		return
+	}
+	fmt.Fprintf(w, "%d tokens over %s (%s)", fit.Over, fit.Next.Name, fit.Next.Models)
+	if len(fit.Excludes) == 0 {
+		fmt.Fprintln(w)
+		return
+	}
+	parts := make([]string, len(fit.Excludes))
+	for i, d := range fit.Excludes {
+		parts[i] = fmt.Sprintf("%s (~%d tokens)", d.Dir, d.Tokens)
+	}
+	fmt.Fprintf(w, "; to fit, exclude %s\n", strings.Join(parts, ", "))
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// workspaceMember is a single package/module/crate of a monorepo workspace.
+type workspaceMember struct {
+	name string
+	dir  string   // slash-separated, relative to the workspace root
+	deps []string // names of other members this one depends on
+}
+
+type workspace struct {
+	kind     string // go, pnpm, npm, cargo
+	manifest string // manifest path relative to the workspace root
+	members  []workspaceMember
+}
+
+// detectWorkspace looks for a supported workspace manifest in root. It
+// returns nil without error when the directory is not a workspace.
+func detectWorkspace(root string) (*workspace, error) {
+	detectors := []func(string) (*workspace, error){
+		detectGoWorkspace,
+		detectPnpmWorkspace,
+		detectNpmWorkspace,
+		detectCargoWorkspace,
+	}
+	for _, detect := range detectors {
+		ws, err := detect(root)
+		if err != nil {
+			return nil, err
+		}
+		if ws != nil {
+			return ws, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolve returns the directories of the named member and of every member it
+// transitively depends on.
+func (ws *workspace) resolve(name string) ([]string, error) {
+	byName := make(map[string]*workspaceMember)
+	for i := range ws.members {
+		byName[ws.members[i].name] = &ws.members[i]
+	}
+
+	start := ws.find(name)
+	if start == nil {
+		names := make([]string, 0, len(ws.members))
+		for _, m := range ws.members {
+			names = append(names, m.name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown %s workspace member %q (available: %s)", ws.kind, name, strings.Join(names, ", "))
+	}
+
+	seen := map[string]bool{start.name: true}
+	queue := []*workspaceMember{start}
+	var dirs []string
+	for len(queue) > 0 {
+		member := queue[0]
+		queue = queue[1:]
+		dirs = append(dirs, member.dir)
+		for _, dep := range member.deps {
+			if next, ok := byName[dep]; ok && !seen[dep] {
+				seen[dep] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// find matches a member by its full name, the last element of its name or
+// its directory.
+func (ws *workspace) find(name string) *workspaceMember {
+	for i, m := range ws.members {
+		if m.name == name || m.dir == strings.TrimSuffix(filepath.ToSlash(name), "/") {
+			return &ws.members[i]
+		}
+	}
+	for i, m := range ws.members {
+		if path.Base(m.name) == name {
+			return &ws.members[i]
+		}
+	}
+	return nil
+}
+
+func detectGoWorkspace(root string) (*workspace, error) {
+	dirs, err := parseGoWork(filepath.Join(root, "go.work"))
+	if err != nil || dirs == nil {
+		return nil, err
+	}
+
+	ws := &workspace{kind: "go", manifest: "go.work"}
+	modules := make(map[string]bool)
+	for _, dir := range dirs {
+		modPath, requires, err := parseGoMod(filepath.Join(root, filepath.FromSlash(dir), "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		modules[modPath] = true
+		ws.members = append(ws.members, workspaceMember{name: modPath, dir: dir, deps: requires})
+	}
+	for i := range ws.members {
+		ws.members[i].deps = filterDeps(ws.members[i].deps, modules)
+	}
+	return ws, nil
+}
+
+// parseGoWork returns the directories listed in use directives, or nil if the
+// file does not exist.
+func parseGoWork(file string) ([]string, error) {
+	lines, err := readLines(file)
+	if err != nil || lines == nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	inBlock := false
+	for _, line := range lines {
+		line = stripLineComment(line)
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock && line != "":
+			dirs = append(dirs, cleanMemberDir(unquote(line)))
+		case line == "use (":
+			inBlock = true
+		case strings.HasPrefix(line, "use "):
+			dirs = append(dirs, cleanMemberDir(unquote(strings.TrimSpace(strings.TrimPrefix(line, "use ")))))
+		}
+	}
+	return dirs, nil
+}
+
+// parseGoMod returns the module path and the required module paths of a
+// go.mod file.
+func parseGoMod(file string) (string, []string, error) {
+	lines, err := readLines(file)
+	if err != nil {
+		return "", nil, err
+	}
+	if lines == nil {
+		return "", nil, fmt.Errorf("missing %s", file)
+	}
+
+	var modPath string
+	var requires []string
+	inBlock := false
+	for _, line := range lines {
+		line = stripLineComment(line)
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock && line != "":
+			requires = append(requires, unquote(strings.Fields(line)[0]))
+		case strings.HasPrefix(line, "module "):
+			modPath = unquote(strings.TrimSpace(strings.TrimPrefix(line, "module ")))
+		case line == "require (":
+			inBlock = true
+		case strings.HasPrefix(line, "require "):
+			requires = append(requires, unquote(strings.Fields(line)[1]))
+		}
+	}
+	if modPath == "" {
+		return "", nil, fmt.Errorf("no module directive in %s", file)
+	}
+	return modPath, requires, nil
+}
+
+func detectPnpmWorkspace(root string) (*workspace, error) {
+	data, err := os.ReadFile(filepath.Join(root, "pnpm-workspace.yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pnpm-workspace.yaml: %w", err)
+	}
+
+	var manifest struct {
+		Packages []string `yaml:"packages"`
+	}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse pnpm-workspace.yaml: %w", err)
+	}
+	return nodeWorkspace(root, "pnpm", "pnpm-workspace.yaml", manifest.Packages)
+}
+
+func detectNpmWorkspace(root string) (*workspace, error) {
+	data, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+
+	var manifest struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json: %w", err)
+	}
+	if len(manifest.Workspaces) == 0 {
+		return nil, nil
+	}
+
+	// npm uses a plain array, yarn also accepts {"packages": [...]}
+	var patterns []string
+	if err := json.Unmarshal(manifest.Workspaces, &patterns); err != nil {
+		var yarn struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(manifest.Workspaces, &yarn); err != nil {
+			return nil, fmt.Errorf("failed to parse workspaces in package.json: %w", err)
+		}
+		patterns = yarn.Packages
+	}
+	return nodeWorkspace(root, "npm", "package.json", patterns)
+}
+
+func nodeWorkspace(root, kind, manifest string, patterns []string) (*workspace, error) {
+	dirs, err := expandMemberPatterns(root, patterns, "package.json")
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &workspace{kind: kind, manifest: manifest}
+	names := make(map[string]bool)
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(dir), "package.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read package.json in %s: %w", dir, err)
+		}
+		var pkg struct {
+			Name                 string            `json:"name"`
+			Dependencies         map[string]string `json:"dependencies"`
+			DevDependencies      map[string]string `json:"devDependencies"`
+			PeerDependencies     map[string]string `json:"peerDependencies"`
+			OptionalDependencies map[string]string `json:"optionalDependencies"`
+		}
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			return nil, fmt.Errorf("failed to parse package.json in %s: %w", dir, err)
+		}
+		if pkg.Name == "" {
+			pkg.Name = path.Base(dir)
+		}
+
+		var deps []string
+		for _, group := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies, pkg.OptionalDependencies} {
+			for dep := range group {
+				deps = append(deps, dep)
+			}
+		}
+		names[pkg.Name] = true
+		ws.members = append(ws.members, workspaceMember{name: pkg.Name, dir: dir, deps: deps})
+	}
+	for i := range ws.members {
+		ws.members[i].deps = filterDeps(ws.members[i].deps, names)
+	}
+	return ws, nil
+}
+
+type cargoManifest struct {
+	Workspace *struct {
+		Members []string `toml:"members"`
+		Exclude []string `toml:"exclude"`
+	} `toml:"workspace"`
+	Package struct {
+		Name string `toml:"name"`
+	} `toml:"package"`
+	Dependencies      map[string]any `toml:"dependencies"`
+	DevDependencies   map[string]any `toml:"dev-dependencies"`
+	BuildDependencies map[string]any `toml:"build-dependencies"`
+}
+
+func detectCargoWorkspace(root string) (*workspace, error) {
+	var manifest cargoManifest
+	if _, err := toml.DecodeFile(filepath.Join(root, "Cargo.toml"), &manifest); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse Cargo.toml: %w", err)
+	}
+	if manifest.Workspace == nil {
+		return nil, nil
+	}
+
+	dirs, err := expandMemberPatterns(root, manifest.Workspace.Members, "Cargo.toml")
+	if err != nil {
+		return nil, err
+	}
+	excluded := createLookupMap(manifest.Workspace.Exclude)
+
+	ws := &workspace{kind: "cargo", manifest: "Cargo.toml"}
+	names := make(map[string]bool)
+	for _, dir := range dirs {
+		if excluded[dir] {
+			continue
+		}
+		var crate cargoManifest
+		if _, err := toml.DecodeFile(filepath.Join(root, filepath.FromSlash(dir), "Cargo.toml"), &crate); err != nil {
+			return nil, fmt.Errorf("failed to parse Cargo.toml in %s: %w", dir, err)
+		}
+		name := crate.Package.Name
+		if name == "" {
+			name = path.Base(dir)
+		}
+
+		var deps []string
+		for _, group := range []map[string]any{crate.Dependencies, crate.DevDependencies, crate.BuildDependencies} {
+			for dep := range group {
+				deps = append(deps, dep)
+			}
+		}
+		names[name] = true
+		ws.members = append(ws.members, workspaceMember{name: name, dir: dir, deps: deps})
+	}
+	for i := range ws.members {
+		ws.members[i].deps = filterDeps(ws.members[i].deps, names)
+	}
+	return ws, nil
+}
+
+// expandMemberPatterns resolves workspace member globs to directories that
+// contain the given manifest file. A trailing "/**" matches at any depth.
+func expandMemberPatterns(root string, patterns []string, manifest string) ([]string, error) {
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		dir = cleanMemberDir(dir)
+		if seen[dir] {
+			return
+		}
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir), manifest)); err == nil {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+
+		if base, ok := strings.CutSuffix(pattern, "/**"); ok {
+			start := filepath.Join(root, filepath.FromSlash(base))
+			err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() && d.Name() == "node_modules" {
+					return filepath.SkipDir
+				}
+				if d.IsDir() {
+					rel, _ := filepath.Rel(root, p)
+					add(filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand workspace pattern %q: %w", pattern, err)
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			rel, _ := filepath.Rel(root, match)
+			add(filepath.ToSlash(rel))
+		}
+	}
+
+	// Negated patterns remove members matched above
+	for _, pattern := range patterns {
+		negated, ok := strings.CutPrefix(pattern, "!")
+		if !ok {
+			continue
+		}
+		kept := dirs[:0]
+		for _, dir := range dirs {
+			if matched, _ := path.Match(cleanMemberDir(negated), dir); !matched {
+				kept = append(kept, dir)
+			}
+		}
+		dirs = kept
+	}
+
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+func filterDeps(deps []string, members map[string]bool) []string {
+	var result []string
+	for _, dep := range deps {
+		if members[dep] {
+			result = append(result, dep)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func cleanMemberDir(dir string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(dir)), "./")
+}
+
+// readLines returns the trimmed lines of a file, or nil if it does not exist.
+func readLines(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return lines, nil
+}
+
+func stripLineComment(line string) string {
+	if idx := strings.Index(line, "//"); idx >= 0 {
+		line = line[:idx]
+	}
+	return strings.TrimSpace(line)
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, "\"`")
+}
+
+// withinDirs reports whether relPath is inside one of dirs. Ancestors of a
+// dir also match when forWalk is set so the walk can descend into it.
+func withinDirs(relPath string, dirs []string, forWalk bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, dir := range dirs {
+		if dir == "." || relPath == dir || strings.HasPrefix(relPath, dir+"/") {
+			return true
+		}
+		if forWalk && (relPath == "." || strings.HasPrefix(dir, relPath+"/")) {
+			return true
+		}
+	}
+	return false
+}